@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"net"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/blake2b"
+)
+
+// AnonymizeHashes are the algorithms of AnonymizeHash.
+var AnonymizeHashes = []string{"sha256", "sha1", "blake2b", "siphash"}
+
+// AddressHasher returns the hex hash of ip with salt.
+type AddressHasher func(salt []byte, ip net.IP) string
+
+// NewAddressHasher returns the AddressHasher of algorithm.
+// sha256, sha1 and blake2b (256 bits) hash the salt and the address,
+// siphash (SipHash-2-4) hashes the address keyed by the first 16 bytes of the salt, zero padded.
+func NewAddressHasher(algorithm string) (AddressHasher, error) {
+	switch algorithm {
+	case "", "sha256":
+		return func(salt []byte, ip net.IP) string {
+			return fmt.Sprintf("%x", sha256.Sum256(saltedAddress(salt, ip)))
+		}, nil
+	case "sha1":
+		return func(salt []byte, ip net.IP) string {
+			return fmt.Sprintf("%x", sha1.Sum(saltedAddress(salt, ip)))
+		}, nil
+	case "blake2b":
+		return func(salt []byte, ip net.IP) string {
+			return fmt.Sprintf("%x", blake2b.Sum256(saltedAddress(salt, ip)))
+		}, nil
+	case "siphash":
+		return func(salt []byte, ip net.IP) string {
+			var key [16]byte
+			copy(key[:], salt)
+			k0, k1 := binary.LittleEndian.Uint64(key[:8]), binary.LittleEndian.Uint64(key[8:])
+			return fmt.Sprintf("%016x", sipHash24(k0, k1, ip.To16()))
+		}, nil
+	}
+	return nil, errors.Errorf("unknown hash algorithm %s", algorithm)
+}
+
+// saltedAddress returns the hashed data of ip.
+// It is zero filled before the salt as ever, so hashes of sha256 are the same as older versions.
+func saltedAddress(salt []byte, ip net.IP) []byte {
+	bs := make([]byte, len(salt)+16)
+	bs = append(bs, salt...)
+	return append(bs, ip.To16()...)
+}
+
+// sipHash24 returns SipHash-2-4 of p with the key k0 and k1.
+func sipHash24(k0, k1 uint64, p []byte) uint64 {
+	v0 := k0 ^ 0x736f6d6570736575
+	v1 := k1 ^ 0x646f72616e646f6d
+	v2 := k0 ^ 0x6c7967656e657261
+	v3 := k1 ^ 0x7465646279746573
+	round := func() {
+		v0 += v1
+		v1 = bits.RotateLeft64(v1, 13)
+		v1 ^= v0
+		v0 = bits.RotateLeft64(v0, 32)
+		v2 += v3
+		v3 = bits.RotateLeft64(v3, 16)
+		v3 ^= v2
+		v0 += v3
+		v3 = bits.RotateLeft64(v3, 21)
+		v3 ^= v0
+		v2 += v1
+		v1 = bits.RotateLeft64(v1, 17)
+		v1 ^= v2
+		v2 = bits.RotateLeft64(v2, 32)
+	}
+	last := uint64(len(p)) << 56
+	for ; len(p) >= 8; p = p[8:] {
+		m := binary.LittleEndian.Uint64(p)
+		v3 ^= m
+		round()
+		round()
+		v0 ^= m
+	}
+	for i := len(p) - 1; i >= 0; i-- {
+		last |= uint64(p[i]) << (8 * uint(i))
+	}
+	v3 ^= last
+	round()
+	round()
+	v0 ^= last
+	v2 ^= 0xff
+	round()
+	round()
+	round()
+	round()
+	return v0 ^ v1 ^ v2 ^ v3
+}
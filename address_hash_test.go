@@ -0,0 +1,76 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+func testHashSalt() []byte {
+	salt := make([]byte, 16)
+	for i := range salt {
+		salt[i] = byte(i)
+	}
+	return salt
+}
+
+func TestAddressHasher(t *testing.T) {
+	salt := testHashSalt()
+	// the address is 00..0f as the salt, siphash is the SipHash-2-4 reference vector.
+	ip := net.IP(testHashSalt())
+	legacy := append(make([]byte, len(salt)+16), salt...)
+	legacy = append(legacy, ip...)
+	testcases := map[string]string{
+		"sha256":  fmt.Sprintf("%x", sha256.Sum256(legacy)),
+		"sha1":    "85cc412cc7ca6736ca6030d2bcb7506967224c74",
+		"blake2b": "d731af712bacbd61d99745e88ffb98c279ffff7c591f315a86007e99ff1e6645",
+		"siphash": "3f2acc7f57c29bdb",
+	}
+	for algorithm, expected := range testcases {
+		h, err := dtap.NewAddressHasher(algorithm)
+		if assert.NoError(t, err, algorithm) {
+			assert.Equal(t, expected, h(salt, ip), algorithm)
+		}
+	}
+	_, err := dtap.NewAddressHasher("md5")
+	assert.Error(t, err)
+}
+
+func TestFlatConfigAnonymizeHash(t *testing.T) {
+	assert.Nil(t, (&dtap.FlatConfig{AnonymizeHash: "siphash"}).Validate())
+	assert.NotNil(t, (&dtap.FlatConfig{AnonymizeHash: "md5"}).Validate())
+}
+
+func BenchmarkAddressHasher(b *testing.B) {
+	salt := make([]byte, 32)
+	ip := net.ParseIP("2001:db8::1")
+	for _, algorithm := range dtap.AnonymizeHashes {
+		h, _ := dtap.NewAddressHasher(algorithm)
+		b.Run(algorithm, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				h(salt, ip)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"io/ioutil"
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// AnonymizerKeySize is the key size of IPAnonymizer.
+const AnonymizerKeySize = 32
+
+// IPAnonymizer pseudonymizes addresses with Crypto-PAn.
+// Addresses sharing a n bit prefix are mapped to addresses sharing a n bit prefix,
+// and the mapping is the same as long as the key is the same.
+type IPAnonymizer struct {
+	block cipher.Block
+	pad   [aes.BlockSize]byte
+}
+
+// NewIPAnonymizer returns IPAnonymizer of 32 bytes key,
+// the first half is the AES key and the second half makes the pad.
+func NewIPAnonymizer(key []byte) (*IPAnonymizer, error) {
+	if len(key) != AnonymizerKeySize {
+		return nil, errors.Errorf("anonymization key must be %d bytes", AnonymizerKeySize)
+	}
+	block, err := aes.NewCipher(key[:16])
+	if err != nil {
+		return nil, err
+	}
+	a := &IPAnonymizer{block: block}
+	block.Encrypt(a.pad[:], key[16:])
+	return a, nil
+}
+
+// LoadIPAnonymizer reads the key from filename, as 32 raw bytes or 64 hex digits.
+func LoadIPAnonymizer(filename string) (*IPAnonymizer, error) {
+	bs, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't read anonymization key %s", filename)
+	}
+	if len(bs) != AnonymizerKeySize {
+		if bs, err = hex.DecodeString(string(bytes.TrimSpace(bs))); err != nil {
+			return nil, errors.Errorf("anonymization key %s must be %d bytes or %d hex digits", filename, AnonymizerKeySize, AnonymizerKeySize*2)
+		}
+	}
+	return NewIPAnonymizer(bs)
+}
+
+// failedIPAnonymizer is used when the key can't be loaded, it anonymizes every address to nil
+// so that addresses are never emitted less masked than configured.
+var failedIPAnonymizer = &IPAnonymizer{}
+
+// Anonymize returns the pseudonymized address, IPv4 addresses in 4 bytes form.
+func (a *IPAnonymizer) Anonymize(ip net.IP) net.IP {
+	if a.block == nil {
+		return nil
+	}
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	} else if ip = ip.To16(); ip == nil {
+		return nil
+	}
+	// the i-th bit is flipped by the first bit of the cipher of
+	// the first i bits of the address followed by the pad.
+	var in, out [aes.BlockSize]byte
+	res := make(net.IP, len(ip))
+	for i := 0; i < len(ip)*8; i++ {
+		n, bit := i/8, byte(0x80>>uint(i%8))
+		low := bit<<1 - 1
+		copy(in[:n], ip[:n])
+		in[n] = ip[n]&^low | a.pad[n]&low
+		copy(in[n+1:], a.pad[n+1:])
+		a.block.Encrypt(out[:], in[:])
+		res[n] |= (ip[n] ^ out[0]>>uint(i%8)) & bit
+	}
+	return res
+}
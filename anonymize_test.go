@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+// testAnonymizerKey is the key of the Crypto-PAn reference test vectors.
+var testAnonymizerKey = []byte{21, 34, 23, 141, 51, 164, 207, 128, 19, 10, 91, 22, 73, 144, 125, 16,
+	216, 152, 143, 131, 121, 121, 101, 39, 98, 87, 76, 45, 42, 132, 34, 2}
+
+func TestIPAnonymizer(t *testing.T) {
+	a, err := dtap.NewIPAnonymizer(testAnonymizerKey)
+	assert.NoError(t, err)
+	testcases := []struct {
+		ip       string
+		expected string
+	}{
+		{"128.11.68.132", "135.242.180.132"},
+		{"129.118.74.4", "134.136.186.123"},
+		{"192.0.2.1", ""},
+		{"2001:db8::1", ""},
+	}
+	for _, tc := range testcases {
+		ip := net.ParseIP(tc.ip)
+		res := a.Anonymize(ip)
+		if tc.expected != "" {
+			assert.Equal(t, tc.expected, res.String())
+		}
+		assert.Equal(t, res, a.Anonymize(ip))
+		assert.NotEqual(t, ip.String(), res.String())
+	}
+	// prefix preserving
+	x := a.Anonymize(net.ParseIP("192.0.2.1"))
+	y := a.Anonymize(net.ParseIP("192.0.2.200"))
+	z := a.Anonymize(net.ParseIP("192.0.3.1"))
+	assert.Equal(t, x[:3], y[:3])
+	assert.Equal(t, x[:2], z[:2])
+	assert.Equal(t, x[2]&0xfe, z[2]&0xfe)
+	assert.NotEqual(t, x[2], z[2])
+	x = a.Anonymize(net.ParseIP("2001:db8:1::1"))
+	y = a.Anonymize(net.ParseIP("2001:db8:1::2"))
+	assert.Len(t, x, 16)
+	assert.Equal(t, x[:15], y[:15])
+
+	_, err = dtap.NewIPAnonymizer([]byte("short"))
+	assert.Error(t, err)
+}
+
+func TestFlatDnstapPrefixPreservingAnonymization(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dtap")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	keyPath := filepath.Join(dir, "key")
+	assert.NoError(t, ioutil.WriteFile(keyPath, []byte(hex.EncodeToString(testAnonymizerKey)+"\n"), 0600))
+
+	opt := &dtap.FlatConfig{PrefixPreservingAnonymization: true, AnonymizationKeyPath: keyPath}
+	assert.Nil(t, opt.Validate())
+	a, _ := dtap.NewIPAnonymizer(testAnonymizerKey)
+	data, err := dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("www.example.com.", dns.TypeA)), opt)
+	assert.NoError(t, err)
+	assert.Equal(t, a.Anonymize(net.ParseIP("192.0.2.1")).String(), data.QueryAddress.String())
+
+	opt = &dtap.FlatConfig{PrefixPreservingAnonymization: true, AnonymizationKeyPath: filepath.Join(dir, "none")}
+	assert.NotNil(t, opt.Validate())
+
+	// addresses are dropped instead of masked when the key can't be loaded.
+	for _, opt := range []*dtap.FlatConfig{
+		opt,
+		{PrefixPreservingAnonymization: true, AnonymizationKeyPath: filepath.Join(dir, "none")},
+	} {
+		data, err = dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("www.example.com.", dns.TypeA)), opt)
+		assert.NoError(t, err)
+		assert.Nil(t, data.QueryAddress)
+		assert.Same(t, opt.GetAnonymizer(), opt.GetAnonymizer())
+	}
+}
@@ -0,0 +1,173 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/linkedin/goavro"
+	_ "github.com/mimuret/dtap/statik"
+	"github.com/pkg/errors"
+	"github.com/rakyll/statik/fs"
+)
+
+// schemaStr is the Avro schema of flat records, assets/flat.avsc.
+var schemaStr string
+
+func init() {
+	statikFS, _ := fs.New()
+	f, _ := statikFS.Open("/flat.avsc")
+	b, _ := ioutil.ReadAll(f)
+	schemaStr = string(b)
+}
+
+// FlatAvroSchema returns the Avro schema of flat records.
+func FlatAvroSchema() string {
+	return schemaStr
+}
+
+type avroField struct {
+	name string
+	typ  string
+}
+
+// AvroSerializer encodes flat record maps as Avro binary of the flat schema.
+// Keys not in the schema are dropped and values are converted to the field types.
+type AvroSerializer struct {
+	codec  *goavro.Codec
+	fields []avroField
+	// schemaID is the Confluent Schema Registry id of the schema, nil is plain Avro binary.
+	schemaID []byte
+}
+
+// NewAvroSerializer returns a serializer of the flat Avro schema.
+func NewAvroSerializer() (*AvroSerializer, error) {
+	codec, err := goavro.NewCodec(schemaStr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't parse avro schema")
+	}
+	schema := struct {
+		Fields []struct {
+			Name string      `json:"name"`
+			Type interface{} `json:"type"`
+		} `json:"fields"`
+	}{}
+	if err := json.Unmarshal([]byte(schemaStr), &schema); err != nil {
+		return nil, errors.Wrapf(err, "can't parse avro schema")
+	}
+	s := &AvroSerializer{codec: codec}
+	for _, f := range schema.Fields {
+		typ, _ := f.Type.(string)
+		s.fields = append(s.fields, avroField{name: f.Name, typ: typ})
+	}
+	return s, nil
+}
+
+// Codec returns the codec of the flat schema.
+func (s *AvroSerializer) Codec() *goavro.Codec {
+	return s.codec
+}
+
+// SetSchemaID frames records in the Confluent wire format,
+// magic byte 0 and the 4 byte schema id before the Avro binary.
+func (s *AvroSerializer) SetSchemaID(id uint32) {
+	s.schemaID = make([]byte, 4)
+	binary.BigEndian.PutUint32(s.schemaID, id)
+}
+
+func (s *AvroSerializer) Serialize(m map[string]interface{}) ([]byte, error) {
+	native := make(map[string]interface{}, len(s.fields))
+	for _, f := range s.fields {
+		value, ok := m[f.name]
+		if !ok {
+			// records of KeyCase camel.
+			value = m[camelCase(f.name)]
+		}
+		v, err := avroValue(f.typ, value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "avro: field %s", f.name)
+		}
+		native[f.name] = v
+	}
+	var buf []byte
+	if s.schemaID != nil {
+		buf = append([]byte{0}, s.schemaID...)
+	}
+	return s.codec.BinaryFromNative(buf, native)
+}
+
+func (s *AvroSerializer) ContentType() string {
+	return "application/avro"
+}
+
+// avroValue converts v to the Avro primitive type typ, nil is the zero value.
+// Numbers made strings by NumbersAsStrings are parsed back.
+func avroValue(typ string, v interface{}) (interface{}, error) {
+	switch typ {
+	case "string":
+		switch v := v.(type) {
+		case nil:
+			return "", nil
+		case string:
+			return v, nil
+		}
+		return fmt.Sprint(v), nil
+	case "int", "long":
+		var n int64
+		switch v := v.(type) {
+		case nil:
+		case int:
+			n = int64(v)
+		case int32:
+			n = int64(v)
+		case int64:
+			n = v
+		case uint16:
+			n = int64(v)
+		case uint32:
+			n = int64(v)
+		case float64:
+			n = int64(v)
+		case string:
+			var err error
+			if n, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, errors.Errorf("unsupported type %T", v)
+		}
+		if typ == "int" {
+			return int32(n), nil
+		}
+		return n, nil
+	case "boolean":
+		switch v := v.(type) {
+		case nil:
+			return false, nil
+		case bool:
+			return v, nil
+		case string:
+			return strconv.ParseBool(v)
+		}
+		return nil, errors.Errorf("unsupported type %T", v)
+	}
+	return v, nil
+}
@@ -0,0 +1,164 @@
+/*
+ * Copyright (c) 2019 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Batcher collects records and sends them by count or interval.
+type Batcher struct {
+	mux      sync.Mutex
+	records  []interface{}
+	size     int
+	interval time.Duration
+	send     func([]interface{}) error
+	cancel   context.CancelFunc
+	done     chan struct{}
+	logger   log.FieldLogger
+}
+
+func NewBatcher(size int, interval time.Duration, send func([]interface{}) error) *Batcher {
+	return &Batcher{
+		size:     size,
+		interval: interval,
+		send:     send,
+		logger:   log.StandardLogger(),
+	}
+}
+
+// SetLogger replaces the logger of send errors of the interval flusher.
+func (b *Batcher) SetLogger(logger log.FieldLogger) {
+	b.logger = logger
+}
+
+// Start runs interval flusher until Stop.
+func (b *Batcher) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	b.cancel = cancel
+	b.done = make(chan struct{})
+	go func() {
+		defer close(b.done)
+		ticker := time.NewTicker(b.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := b.Flush(); err != nil {
+					b.logger.Warnf("batch send error: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Add appends record, and sends batch when it reaches size.
+func (b *Batcher) Add(v interface{}) error {
+	b.mux.Lock()
+	b.records = append(b.records, v)
+	if len(b.records) < b.size {
+		b.mux.Unlock()
+		return nil
+	}
+	records := b.records
+	b.records = nil
+	b.mux.Unlock()
+	return b.send(records)
+}
+
+func (b *Batcher) Flush() error {
+	b.mux.Lock()
+	records := b.records
+	b.records = nil
+	b.mux.Unlock()
+	if len(records) == 0 {
+		return nil
+	}
+	return b.send(records)
+}
+
+// Stop stops interval flusher and sends remaining records.
+func (b *Batcher) Stop() error {
+	if b.cancel != nil {
+		b.cancel()
+		<-b.done
+		b.cancel = nil
+	}
+	return b.Flush()
+}
+
+// KeyedBatcher batches records per key, the batch of each key is sent by its own count and interval.
+type KeyedBatcher struct {
+	mux      sync.Mutex
+	batchers map[string]*Batcher
+	size     int
+	interval time.Duration
+	send     func([]interface{}) error
+	logger   log.FieldLogger
+}
+
+func NewKeyedBatcher(size int, interval time.Duration, send func([]interface{}) error) *KeyedBatcher {
+	return &KeyedBatcher{
+		batchers: map[string]*Batcher{},
+		size:     size,
+		interval: interval,
+		send:     send,
+		logger:   log.StandardLogger(),
+	}
+}
+
+// SetLogger replaces the logger of send errors of the interval flushers.
+func (k *KeyedBatcher) SetLogger(logger log.FieldLogger) {
+	k.logger = logger
+}
+
+// Add appends record to the batch of key, and sends the batch when it reaches size.
+// The batch and its interval flusher are started by the first record of key.
+func (k *KeyedBatcher) Add(key string, v interface{}) error {
+	k.mux.Lock()
+	b, ok := k.batchers[key]
+	if !ok {
+		b = NewBatcher(k.size, k.interval, k.send)
+		b.SetLogger(k.logger)
+		b.Start()
+		k.batchers[key] = b
+	}
+	k.mux.Unlock()
+	return b.Add(v)
+}
+
+// Stop stops interval flushers and sends remaining records of all keys.
+// It returns the first send error.
+func (k *KeyedBatcher) Stop() error {
+	k.mux.Lock()
+	batchers := k.batchers
+	k.batchers = map[string]*Batcher{}
+	k.mux.Unlock()
+	var err error
+	for _, b := range batchers {
+		if serr := b.Stop(); serr != nil && err == nil {
+			err = serr
+		}
+	}
+	return err
+}
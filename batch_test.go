@@ -0,0 +1,51 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+func TestKeyedBatcher(t *testing.T) {
+	var mux sync.Mutex
+	var batches [][]interface{}
+	b := dtap.NewKeyedBatcher(2, time.Hour, func(records []interface{}) error {
+		mux.Lock()
+		batches = append(batches, records)
+		mux.Unlock()
+		return nil
+	})
+	assert.NoError(t, b.Add("dnstap.a", "a1"))
+	assert.NoError(t, b.Add("dnstap.aaaa", "aaaa1"))
+	// the batch of dnstap.a is full, dnstap.aaaa is not mixed into it.
+	assert.NoError(t, b.Add("dnstap.a", "a2"))
+	mux.Lock()
+	assert.Equal(t, [][]interface{}{{"a1", "a2"}}, batches)
+	mux.Unlock()
+
+	assert.NoError(t, b.Add("dnstap.mx", "mx1"))
+	assert.NoError(t, b.Stop())
+	sort.Slice(batches, func(i, j int) bool { return batches[i][0].(string) < batches[j][0].(string) })
+	assert.Equal(t, [][]interface{}{{"a1", "a2"}, {"aaaa1"}, {"mx1"}}, batches)
+}
@@ -0,0 +1,167 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "github.com/sirupsen/logrus"
+)
+
+var blocklistMatched = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "dtap_flat_blocklist_matched_total",
+	Help: "Total number of flat records with qnames matching BlocklistFile.",
+})
+
+// blocklistSet is the parsed entries of a blocklist file.
+type blocklistSet struct {
+	// domains are names without the trailing dot, they match the name and its subdomains.
+	domains map[string]struct{}
+	// re is the alternation of all patterns, the match of patterns[i] is the group groups[i].
+	re       *regexp.Regexp
+	patterns []string
+	groups   []int
+}
+
+// Blocklist matches qnames against domains and regular expressions of a file.
+// Lines are a domain, or a regular expression enclosed in slashes like /^[a-z0-9]{32}\./,
+// blank lines and lines starting with # are ignored.
+// Domains are looked up by each suffix of the qname, and patterns are matched at once as an alternation.
+type Blocklist struct {
+	filename string
+	mux      sync.RWMutex
+	set      *blocklistSet
+}
+
+var (
+	blocklistsMux sync.Mutex
+	blocklists    = map[string]*Blocklist{}
+)
+
+// LoadBlocklist returns the Blocklist of filename, shared by outputs and reloaded by ReloadBlocklists.
+func LoadBlocklist(filename string) (*Blocklist, error) {
+	blocklistsMux.Lock()
+	defer blocklistsMux.Unlock()
+	if b, ok := blocklists[filename]; ok {
+		return b, nil
+	}
+	b := &Blocklist{filename: filename}
+	if err := b.Reload(); err != nil {
+		return nil, err
+	}
+	blocklists[filename] = b
+	return b, nil
+}
+
+// ReloadBlocklists reloads all loaded blocklists, e.g. on SIGHUP.
+// Blocklists failed to reload keep the old entries.
+func ReloadBlocklists() {
+	blocklistsMux.Lock()
+	defer blocklistsMux.Unlock()
+	for filename, b := range blocklists {
+		if err := b.Reload(); err != nil {
+			log.Errorf("can't reload blocklist %s: %s", filename, err)
+			continue
+		}
+		log.Infof("blocklist %s reloaded", filename)
+	}
+}
+
+// Reload reads the file, the entries are replaced only when it succeeds.
+func (b *Blocklist) Reload() error {
+	f, err := os.Open(b.filename)
+	if err != nil {
+		return errors.Wrapf(err, "can't open blocklist %s", b.filename)
+	}
+	defer f.Close()
+	set := &blocklistSet{domains: map[string]struct{}{}}
+	var alternation []string
+	group := 1
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if len(line) > 2 && strings.HasPrefix(line, "/") && strings.HasSuffix(line, "/") {
+			pattern := line[1 : len(line)-1]
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return errors.Wrapf(err, "invalid pattern in blocklist %s line %d", b.filename, n)
+			}
+			set.patterns = append(set.patterns, line)
+			set.groups = append(set.groups, group)
+			alternation = append(alternation, "("+pattern+")")
+			group += re.NumSubexp() + 1
+			continue
+		}
+		set.domains[blocklistName(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrapf(err, "can't read blocklist %s", b.filename)
+	}
+	if len(alternation) > 0 {
+		set.re = regexp.MustCompile(strings.Join(alternation, "|"))
+	}
+	b.mux.Lock()
+	b.set = set
+	b.mux.Unlock()
+	return nil
+}
+
+func blocklistName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+// Match returns the entry matching qname, domains first, and false when nothing matches.
+// Patterns are matched against the lower-cased qname without the trailing dot.
+func (b *Blocklist) Match(qname string) (string, bool) {
+	b.mux.RLock()
+	set := b.set
+	b.mux.RUnlock()
+	name := blocklistName(qname)
+	for suffix := name; suffix != ""; {
+		if _, ok := set.domains[suffix]; ok {
+			return suffix, true
+		}
+		i := strings.IndexByte(suffix, '.')
+		if i < 0 {
+			break
+		}
+		suffix = suffix[i+1:]
+	}
+	if set.re == nil {
+		return "", false
+	}
+	m := set.re.FindStringSubmatchIndex(name)
+	if m == nil {
+		return "", false
+	}
+	for i, group := range set.groups {
+		if m[2*group] >= 0 {
+			return set.patterns[i], true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+func TestBlocklist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dtap")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "blocklist")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("# malicious\nzip\nBad.Example.\n\n/^[a-z0-9]{20,}\\./\n/(c2|beacon)-[0-9]+\\.net$/\n"), 0600))
+
+	b, err := dtap.LoadBlocklist(path)
+	assert.NoError(t, err)
+	for qname, match := range map[string]string{
+		"www.example.zip.":          "zip",
+		"WWW.BAD.example.com.":      "",
+		"bad.example.":              "bad.example",
+		"x.bad.example.":            "bad.example",
+		"notbad.example.":           "",
+		"abcdefghij0123456789.com.": "/^[a-z0-9]{20,}\\./",
+		"www.beacon-12.net.":        "/(c2|beacon)-[0-9]+\\.net$/",
+		"www.example.com.":          "",
+	} {
+		m, ok := b.Match(qname)
+		assert.Equal(t, match != "", ok, qname)
+		assert.Equal(t, match, m, qname)
+	}
+
+	same, err := dtap.LoadBlocklist(path)
+	assert.NoError(t, err)
+	assert.True(t, b == same)
+
+	// invalid files keep the old entries.
+	assert.NoError(t, ioutil.WriteFile(path, []byte("/[/\n"), 0600))
+	assert.Error(t, b.Reload())
+	_, ok := b.Match("www.example.zip.")
+	assert.True(t, ok)
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("example.com\n"), 0600))
+	dtap.ReloadBlocklists()
+	_, ok = b.Match("www.example.zip.")
+	assert.False(t, ok)
+
+	opt := &dtap.FlatConfig{BlocklistFile: path}
+	assert.Nil(t, opt.Validate())
+	data, err := dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("www.example.com.", dns.TypeA)), opt)
+	assert.NoError(t, err)
+	m := data.ToMapString()
+	assert.Equal(t, true, m["blocklisted"])
+	assert.Equal(t, "example.com", m["blocklist_match"])
+
+	opt = &dtap.FlatConfig{BlocklistFile: filepath.Join(dir, "none")}
+	assert.NotNil(t, opt.Validate())
+}
@@ -0,0 +1,166 @@
+/*
+ * Copyright (c) 2019 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var DefaultCacheSize = 100000
+
+var (
+	cacheEvictions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dtap_cache_evictions_total",
+		Help: "The total number of evicted cache entries.",
+	}, []string{"cache"})
+	cacheEntries = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "dtap_cache_entries",
+		Help: "The current number of cache entries.",
+	}, []string{"cache"})
+)
+
+type cacheEntry struct {
+	key    string
+	value  interface{}
+	expire time.Time
+}
+
+// Cache is LRU cache bounded by size, entries also expire by ttl.
+// Zero ttl means no expiry.
+type Cache struct {
+	mux       sync.Mutex
+	size      int
+	ttl       time.Duration
+	ll        *list.List
+	items     map[string]*list.Element
+	evictions prometheus.Counter
+	entries   prometheus.Gauge
+	// OnEvict is called with removed entry by size or ttl, under cache lock.
+	OnEvict func(key string, value interface{})
+	now     func() time.Time
+}
+
+func NewCache(name string, size int, ttl time.Duration) *Cache {
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+	return &Cache{
+		size:      size,
+		ttl:       ttl,
+		ll:        list.New(),
+		items:     map[string]*list.Element{},
+		evictions: cacheEvictions.WithLabelValues(name),
+		entries:   cacheEntries.WithLabelValues(name),
+		now:       time.Now,
+	}
+}
+
+// SetNow replaces the clock for TTL, for tests.
+func (c *Cache) SetNow(now func() time.Time) {
+	c.mux.Lock()
+	c.now = now
+	c.mux.Unlock()
+}
+
+func (c *Cache) Get(key string) (interface{}, bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := e.Value.(*cacheEntry)
+	if c.expired(entry) {
+		c.evict(e)
+		return nil, false
+	}
+	c.ll.MoveToFront(e)
+	return entry.value, true
+}
+
+func (c *Cache) Set(key string, value interface{}) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	var expire time.Time
+	if c.ttl > 0 {
+		expire = c.now().Add(c.ttl)
+	}
+	if e, ok := c.items[key]; ok {
+		entry := e.Value.(*cacheEntry)
+		entry.value = value
+		entry.expire = expire
+		c.ll.MoveToFront(e)
+		return
+	}
+	c.items[key] = c.ll.PushFront(&cacheEntry{key: key, value: value, expire: expire})
+	for c.ll.Len() > c.size {
+		c.evict(c.ll.Back())
+	}
+	c.entries.Set(float64(c.ll.Len()))
+}
+
+func (c *Cache) Delete(key string) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.ll.Remove(e)
+		delete(c.items, key)
+		c.entries.Set(float64(c.ll.Len()))
+	}
+}
+
+func (c *Cache) Len() int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.ll.Len()
+}
+
+// Expire removes all expired entries.
+func (c *Cache) Expire() {
+	if c.ttl <= 0 {
+		return
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	for e := c.ll.Back(); e != nil; {
+		prev := e.Prev()
+		if c.expired(e.Value.(*cacheEntry)) {
+			c.evict(e)
+		}
+		e = prev
+	}
+}
+
+func (c *Cache) expired(entry *cacheEntry) bool {
+	return c.ttl > 0 && c.now().After(entry.expire)
+}
+
+func (c *Cache) evict(e *list.Element) {
+	entry := e.Value.(*cacheEntry)
+	c.ll.Remove(e)
+	delete(c.items, entry.key)
+	c.evictions.Inc()
+	c.entries.Set(float64(c.ll.Len()))
+	if c.OnEvict != nil {
+		c.OnEvict(entry.key, entry.value)
+	}
+}
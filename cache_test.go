@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) 2019 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+func TestCacheBounded(t *testing.T) {
+	c := dtap.NewCache("test_bounded", 1000, 0)
+	evicted := 0
+	c.OnEvict = func(string, interface{}) { evicted++ }
+	for i := 0; i < 100000; i++ {
+		c.Set(strconv.Itoa(i)+".example.", i)
+		assert.True(t, c.Len() <= 1000)
+	}
+	assert.Equal(t, 1000, c.Len())
+	assert.Equal(t, 99000, evicted)
+
+	// least recently used keys are evicted
+	_, ok := c.Get("0.example.")
+	assert.False(t, ok)
+	v, ok := c.Get("99999.example.")
+	assert.True(t, ok)
+	assert.Equal(t, 99999, v)
+}
+
+func TestCacheTTL(t *testing.T) {
+	now := time.Unix(1546300800, 0)
+	c := dtap.NewCache("test_ttl", 10, 10*time.Second)
+	c.SetNow(func() time.Time { return now })
+	c.Set("a", 1)
+	now = now.Add(9 * time.Second)
+	_, ok := c.Get("a")
+	assert.True(t, ok)
+	now = now.Add(2 * time.Second)
+	_, ok = c.Get("a")
+	assert.False(t, ok)
+
+	c.Set("b", 1)
+	c.Set("c", 1)
+	now = now.Add(11 * time.Second)
+	c.Expire()
+	assert.Equal(t, 0, c.Len())
+}
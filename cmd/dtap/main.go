@@ -18,6 +18,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
@@ -25,6 +26,7 @@ import (
 	"runtime"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/mimuret/dtap"
 	log "github.com/sirupsen/logrus"
@@ -36,9 +38,10 @@ func init() {
 }
 
 var (
-	flagConfigFile     = flag.String("c", "dtap.toml", "config file path")
+	flagConfigFile     = flag.String("c", "dtap.toml", "config file path, or directory of *.toml files")
 	flagLogLevel       = flag.String("d", "info", "log level(debug,info,warn,error,fatal)")
 	flagExporterListen = flag.String("e", ":9520", "prometheus exporter listen address")
+	flagDryRun         = flag.Bool("n", false, "dry run, validate config and probe outputs then exit")
 )
 
 func usage() {
@@ -46,16 +49,60 @@ func usage() {
 	flag.PrintDefaults()
 }
 
-func outputLoop(output []dtap.Output, irbuf *dtap.RBuf) {
+func outputLoop(output *dtap.OutputMux, irbuf *dtap.RBuf) {
 	log.Info("start outputLoop")
-	for frame := range irbuf.Read() {
-		for _, o := range output {
-			o.SetMessage(frame)
-		}
+	for m := range irbuf.Read() {
+		output.SetMessage(m)
 	}
 	log.Info("finish outputLoop")
 }
 
+// newOutputParams returns params of the output name with its buffer config.
+func newOutputParams(name string, buffer *dtap.OutputBufferConfig, config *dtap.Config) *dtap.DnstapOutputParams {
+	params := &dtap.DnstapOutputParams{
+		Name:              name,
+		BufferSize:        buffer.GetBufferSize(),
+		InCounter:         TotalRecvOutputFrame,
+		LostCounter:       TotalLostInputFrame,
+		DiskBufferDir:     buffer.DiskBufferDir,
+		DiskBufferMaxSize: buffer.GetDiskBufferMaxSize(),
+		ShutdownTimeout:   config.GetShutdownTimeout(),
+		DedupExactWindow:  buffer.GetDedupExactWindow(),
+		DedupExactSize:    buffer.DedupExactSize,
+		Block:             buffer.Full,
+		ErrorLogLevels:    config.GetErrorLogLevels(),
+	}
+	// dry run doesn't create the disk buffer.
+	if *flagDryRun {
+		params.DiskBufferDir = ""
+	}
+	return params
+}
+
+func dryRun(configErrors []error, output *dtap.OutputMux) int {
+	res := 0
+	if len(configErrors) > 0 {
+		res = 1
+	}
+	for n, o := range output.Outputs() {
+		name := fmt.Sprintf("output[%d]", n)
+		if named, ok := o.(interface{ Name() string }); ok {
+			name = named.Name()
+		}
+		err := o.Probe()
+		switch {
+		case errors.Is(err, dtap.ErrNotProbed):
+			log.Infof("%s not probed", name)
+		case err != nil:
+			log.Errorf("%s probe failed: %s", name, err)
+			res = 1
+		default:
+			log.Infof("%s probe ok", name)
+		}
+	}
+	return res
+}
+
 func fatalCheck(err error) {
 	if err != nil {
 		log.Fatalf("%+v", err)
@@ -86,130 +133,214 @@ func main() {
 		os.Exit(1)
 	}
 	var input []dtap.Input
-	var output []dtap.Output
-	go prometheusExporter(context.Background(), *flagExporterListen)
-	config, err := dtap.NewConfigFromFile(*flagConfigFile)
+	output := dtap.NewOutputMux()
+	config, err := dtap.NewConfigFromPath(*flagConfigFile)
 	fatalCheck(err)
-	for _, ic := range config.InputFile {
-		i, err := dtap.NewDnstapFstrmFileInput(ic)
-		fatalCheck(err)
-		input = append(input, i)
+	configErrors := config.Validate()
+	for _, err := range configErrors {
+		if config.Strict || *flagDryRun {
+			log.Errorf("config error: %s", err)
+		} else {
+			log.Warnf("config error: %s", err)
+		}
 	}
-
-	for _, ic := range config.InputTCP {
-		i, err := dtap.NewDnstapFstrmTCPSocketInput(ic)
-		fatalCheck(err)
-		input = append(input, i)
+	if config.Strict && len(configErrors) > 0 && !*flagDryRun {
+		log.Fatal("invalid config in strict mode")
 	}
-
-	for _, ic := range config.InputUnix {
-		i, err := dtap.NewDnstapFstrmUnixSocketInput(ic)
-		fatalCheck(err)
-		input = append(input, i)
+	for _, line := range config.Summary() {
+		log.Info(line)
 	}
-
-	if len(input) == 0 {
-		log.Fatal("No input settings")
-	}
-
-	for _, oc := range config.OutputFile {
-		params := &dtap.DnstapOutputParams{
-			BufferSize:  oc.Buffer.GetBufferSize(),
-			InCounter:   TotalRecvOutputFrame,
-			LostCounter: TotalLostInputFrame,
-		}
+	for n, oc := range config.OutputFile {
+		params := newOutputParams(fmt.Sprintf("OutputFile[%d]", n), &oc.Buffer, config)
 		o := dtap.NewDnstapFstrmFileOutput(oc, params)
-		output = append(output, o)
+		output.AddStream(o, oc.Buffer.Stream, oc.Buffer.GetSampleRate())
 	}
 
-	for _, oc := range config.OutputTCP {
-		params := &dtap.DnstapOutputParams{
-			BufferSize:  oc.Buffer.GetBufferSize(),
-			InCounter:   TotalRecvOutputFrame,
-			LostCounter: TotalLostInputFrame,
-		}
+	for n, oc := range config.OutputTCP {
+		params := newOutputParams(fmt.Sprintf("OutputTCP[%d]", n), &oc.Buffer, config)
 		o := dtap.NewDnstapFstrmTCPSocketOutput(oc, params)
-		output = append(output, o)
+		output.AddStream(o, oc.Buffer.Stream, oc.Buffer.GetSampleRate())
 	}
 
-	for _, oc := range config.OutputUnix {
-		params := &dtap.DnstapOutputParams{
-			BufferSize:  oc.Buffer.GetBufferSize(),
-			InCounter:   TotalRecvOutputFrame,
-			LostCounter: TotalLostInputFrame,
-		}
+	for n, oc := range config.OutputUnix {
+		params := newOutputParams(fmt.Sprintf("OutputUnix[%d]", n), &oc.Buffer, config)
 		o := dtap.NewDnstapFstrmUnixSockOutput(oc, params)
-		output = append(output, o)
+		output.AddStream(o, oc.Buffer.Stream, oc.Buffer.GetSampleRate())
 	}
 
-	for _, oc := range config.OutputFluent {
-		params := &dtap.DnstapOutputParams{
-			BufferSize:  oc.Buffer.GetBufferSize(),
-			InCounter:   TotalRecvOutputFrame,
-			LostCounter: TotalLostInputFrame,
-		}
+	for n, oc := range config.OutputFluent {
+		params := newOutputParams(fmt.Sprintf("OutputFluent[%d]", n), &oc.Buffer, config)
 		o := dtap.NewDnstapFluentdOutput(oc, params)
-		output = append(output, o)
+		output.AddStream(o, oc.Buffer.Stream, oc.Buffer.GetSampleRate())
 		if oc.Flat.GetIPHashSaltPath() != "" {
 			go oc.Flat.WatchSalt(context.Background())
 		}
 	}
 
-	for _, oc := range config.OutputKafka {
-		params := &dtap.DnstapOutputParams{
-			BufferSize:  oc.Buffer.GetBufferSize(),
-			InCounter:   TotalRecvOutputFrame,
-			LostCounter: TotalLostInputFrame,
-		}
+	for n, oc := range config.OutputKafka {
+		params := newOutputParams(fmt.Sprintf("OutputKafka[%d]", n), &oc.Buffer, config)
 		o, err := dtap.NewDnstapKafkaOutput(oc, params)
 		if err != nil {
 			log.Fatal(err)
 		}
-		output = append(output, o)
+		output.AddStream(o, oc.Buffer.Stream, oc.Buffer.GetSampleRate())
 	}
 
-	for _, oc := range config.OutputNats {
-		params := &dtap.DnstapOutputParams{
-			BufferSize:  oc.Buffer.GetBufferSize(),
-			InCounter:   TotalRecvOutputFrame,
-			LostCounter: TotalLostInputFrame,
-		}
+	for n, oc := range config.OutputNats {
+		params := newOutputParams(fmt.Sprintf("OutputNats[%d]", n), &oc.Buffer, config)
 		o := dtap.NewDnstapNatsOutput(oc, params)
-		output = append(output, o)
+		output.AddStream(o, oc.Buffer.Stream, oc.Buffer.GetSampleRate())
 		if oc.Flat.GetIPHashSaltPath() != "" {
 			go oc.Flat.WatchSalt(context.Background())
 		}
 	}
 
-	for _, oc := range config.OutputPrometheus {
-		params := &dtap.DnstapOutputParams{
-			BufferSize:  oc.Buffer.GetBufferSize(),
-			InCounter:   TotalRecvOutputFrame,
-			LostCounter: TotalLostInputFrame,
-		}
+	for n, oc := range config.OutputPrometheus {
+		params := newOutputParams(fmt.Sprintf("OutputPrometheus[%d]", n), &oc.Buffer, config)
 		o := dtap.NewDnstapPrometheusOutput(oc, params)
-		output = append(output, o)
+		output.AddStream(o, oc.Buffer.Stream, oc.Buffer.GetSampleRate())
 	}
-	for _, oc := range config.OutputStdout {
-		params := &dtap.DnstapOutputParams{
-			BufferSize:  oc.Buffer.GetBufferSize(),
-			InCounter:   TotalRecvOutputFrame,
-			LostCounter: TotalLostInputFrame,
-		}
+	for n, oc := range config.OutputStdout {
+		params := newOutputParams(fmt.Sprintf("OutputStdout[%d]", n), &oc.Buffer, config)
 		o := dtap.NewDnstapStdoutOutput(oc, params)
-		output = append(output, o)
+		output.AddStream(o, oc.Buffer.Stream, oc.Buffer.GetSampleRate())
+	}
+	for n, oc := range config.OutputCSV {
+		params := newOutputParams(fmt.Sprintf("OutputCSV[%d]", n), &oc.Buffer, config)
+		o := dtap.NewDnstapCSVOutput(oc, params)
+		output.AddStream(o, oc.Buffer.Stream, oc.Buffer.GetSampleRate())
+	}
+	for n, oc := range config.OutputTopN {
+		params := newOutputParams(fmt.Sprintf("OutputTopN[%d]", n), &oc.Buffer, config)
+		o := dtap.NewDnstapTopNOutput(oc, params)
+		output.AddStream(o, oc.Buffer.Stream, oc.Buffer.GetSampleRate())
+	}
+	for n, oc := range config.OutputRcodeRatio {
+		params := newOutputParams(fmt.Sprintf("OutputRcodeRatio[%d]", n), &oc.Buffer, config)
+		o := dtap.NewDnstapRcodeRatioOutput(oc, params)
+		output.AddStream(o, oc.Buffer.Stream, oc.Buffer.GetSampleRate())
+	}
+	for n, oc := range config.OutputIdentitySummary {
+		params := newOutputParams(fmt.Sprintf("OutputIdentitySummary[%d]", n), &oc.Buffer, config)
+		o := dtap.NewDnstapIdentitySummaryOutput(oc, params)
+		output.AddStream(o, oc.Buffer.Stream, oc.Buffer.GetSampleRate())
+	}
+	for n, oc := range config.OutputOTLP {
+		params := newOutputParams(fmt.Sprintf("OutputOTLP[%d]", n), &oc.Buffer, config)
+		o := dtap.NewDnstapOTLPOutput(oc, params)
+		output.AddStream(o, oc.Buffer.Stream, oc.Buffer.GetSampleRate())
+	}
+	for n, oc := range config.OutputLoki {
+		params := newOutputParams(fmt.Sprintf("OutputLoki[%d]", n), &oc.Buffer, config)
+		o := dtap.NewDnstapLokiOutput(oc, params)
+		output.AddStream(o, oc.Buffer.Stream, oc.Buffer.GetSampleRate())
+	}
+	for n, oc := range config.OutputPubSub {
+		params := newOutputParams(fmt.Sprintf("OutputPubSub[%d]", n), &oc.Buffer, config)
+		o := dtap.NewDnstapPubSubOutput(oc, params)
+		output.AddStream(o, oc.Buffer.Stream, oc.Buffer.GetSampleRate())
+	}
+	for n, oc := range config.OutputPulsar {
+		params := newOutputParams(fmt.Sprintf("OutputPulsar[%d]", n), &oc.Buffer, config)
+		o := dtap.NewDnstapPulsarOutput(oc, params)
+		output.AddStream(o, oc.Buffer.Stream, oc.Buffer.GetSampleRate())
+	}
+	for n, oc := range config.OutputEventHub {
+		params := newOutputParams(fmt.Sprintf("OutputEventHub[%d]", n), &oc.Buffer, config)
+		o := dtap.NewDnstapEventHubOutput(oc, params)
+		output.AddStream(o, oc.Buffer.Stream, oc.Buffer.GetSampleRate())
+	}
+	for n, oc := range config.OutputJSON {
+		params := newOutputParams(fmt.Sprintf("OutputJSON[%d]", n), &oc.Buffer, config)
+		o := dtap.NewDnstapJSONOutput(oc, params)
+		output.AddStream(o, oc.Buffer.Stream, oc.Buffer.GetSampleRate())
+	}
+	for n, oc := range config.OutputLoopback {
+		params := newOutputParams(fmt.Sprintf("OutputLoopback[%d]", n), &oc.Buffer, config)
+		o := dtap.NewDnstapLoopbackOutput(oc, params)
+		output.AddStream(o, oc.Buffer.Stream, oc.Buffer.GetSampleRate())
+	}
+	for n, oc := range config.OutputQueryAPI {
+		params := newOutputParams(fmt.Sprintf("OutputQueryAPI[%d]", n), &oc.Buffer, config)
+		o := dtap.NewDnstapQueryAPIOutput(oc, params)
+		output.AddStream(o, oc.Buffer.Stream, oc.Buffer.GetSampleRate())
+	}
+	for n, oc := range config.OutputSSE {
+		params := newOutputParams(fmt.Sprintf("OutputSSE[%d]", n), &oc.Buffer, config)
+		o := dtap.NewDnstapSSEOutput(oc, params)
+		output.AddStream(o, oc.Buffer.Stream, oc.Buffer.GetSampleRate())
+	}
+	for n, oc := range config.OutputGRPC {
+		params := newOutputParams(fmt.Sprintf("OutputGRPC[%d]", n), &oc.Buffer, config)
+		o, err := dtap.NewDnstapGRPCOutput(oc, params)
+		if err != nil {
+			log.Fatal(err)
+		}
+		output.AddStream(o, oc.Buffer.Stream, oc.Buffer.GetSampleRate())
+	}
+	for n, oc := range config.OutputS3 {
+		params := newOutputParams(fmt.Sprintf("OutputS3[%d]", n), &oc.Buffer, config)
+		o, err := dtap.NewDnstapS3Output(oc, params)
+		if err != nil {
+			log.Fatal(err)
+		}
+		output.AddStream(o, oc.Buffer.Stream, oc.Buffer.GetSampleRate())
+	}
+	for n, oc := range config.OutputStatsD {
+		params := newOutputParams(fmt.Sprintf("OutputStatsD[%d]", n), &oc.Buffer, config)
+		o := dtap.NewDnstapStatsDOutput(oc, params)
+		output.AddStream(o, oc.Buffer.Stream, oc.Buffer.GetSampleRate())
 	}
 
-	if len(output) == 0 {
+	if len(output.Outputs()) == 0 {
 		log.Fatal("No output settings")
 	}
 
-	iRBuf := dtap.NewRbuf(config.InputMsgBuffer, TotalRecvInputFrame, TotalLostInputFrame)
-	fatalCh := make(chan error)
+	if *flagDryRun {
+		os.Exit(dryRun(configErrors, output))
+	}
+	go prometheusExporter(context.Background(), *flagExporterListen)
+
+	for _, ic := range config.InputFile {
+		i, err := dtap.NewDnstapFstrmFileInput(ic)
+		fatalCheck(err)
+		input = append(input, i)
+	}
+
+	for _, ic := range config.InputTCP {
+		i, err := dtap.NewDnstapFstrmTCPSocketInput(ic)
+		fatalCheck(err)
+		input = append(input, i)
+	}
+
+	for _, ic := range config.InputUnix {
+		i, err := dtap.NewDnstapFstrmUnixSocketInput(ic)
+		fatalCheck(err)
+		input = append(input, i)
+	}
+
+	for _, ic := range config.InputHTTP {
+		i, err := dtap.NewDnstapHTTPInput(ic)
+		fatalCheck(err)
+		input = append(input, i)
+	}
+
+	for _, ic := range config.InputKafka {
+		i, err := dtap.NewDnstapKafkaInput(ic)
+		fatalCheck(err)
+		input = append(input, i)
+	}
+
+	if len(input) == 0 {
+		log.Fatal("No input settings")
+	}
+
+	// buffered for every input, so inputs failing after shutdown don't block.
+	fatalCh := make(chan error, len(input))
 
 	outputCtx, outputCancel := context.WithCancel(context.Background())
 	owg := &sync.WaitGroup{}
-	for _, o := range output {
+	for _, o := range output.Outputs() {
 		child, _ := context.WithCancel(outputCtx)
 		owg.Add(1)
 		go func(o dtap.Output) {
@@ -217,7 +348,18 @@ func main() {
 			owg.Done()
 		}(o)
 	}
-	go outputLoop(output, iRBuf)
+	var iRBuf *dtap.RBuf
+	if direct := output.Direct(); direct != nil {
+		// single output, inputs write to output buffer directly.
+		log.Info("single output, skip outputLoop")
+		iRBuf = dtap.NewRbufTo(direct, TotalRecvInputFrame)
+	} else {
+		iRBuf = dtap.NewRbuf(config.InputMsgBuffer, TotalRecvInputFrame, TotalLostInputFrame)
+		go outputLoop(output, iRBuf)
+	}
+	if config.PerIdentityMaxQPS > 0 {
+		iRBuf.SetIdentityLimiter(dtap.NewIdentityLimiter(config.PerIdentityMaxQPS, config.GetPerIdentityBurst(), time.Now))
+	}
 
 	inputCtx, intputCancel := context.WithCancel(context.Background())
 
@@ -242,6 +384,16 @@ func main() {
 
 	log.Info("finish boot dtap")
 
+	// SIGHUP reloads blocklists of BlocklistFile.
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+	go func() {
+		for range hupCh {
+			log.Info("recieve SIGHUP, reload blocklists")
+			dtap.ReloadBlocklists()
+		}
+	}()
+
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGINT)
 
@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCollapseSize is the default max number of collapse windows.
+var DefaultCollapseSize = 100000
+
+type collapseEntry struct {
+	key   string
+	start time.Time
+	last  *DnstapFlatT
+	count int
+}
+
+// Collapser emits the first record of identical type, qname, qtype and query address
+// in a window, and counts the following ones into a summary record with occurrences
+// when the window closes. Summaries are emitted with the records of a later frame,
+// and by Flush on shutdown. Records beyond size windows are emitted as is.
+type Collapser struct {
+	window  time.Duration
+	size    int
+	now     func() time.Time
+	mux     sync.Mutex
+	entries map[string]*collapseEntry
+	// queue is entries in order of start.
+	queue []*collapseEntry
+}
+
+func NewCollapser(window time.Duration, size int, now func() time.Time) *Collapser {
+	if size <= 0 {
+		size = DefaultCollapseSize
+	}
+	return &Collapser{
+		window:  window,
+		size:    size,
+		now:     now,
+		entries: map[string]*collapseEntry{},
+	}
+}
+
+func collapseKey(data *DnstapFlatT) string {
+	return strings.Join([]string{data.Type, strings.ToLower(data.Qname), data.Qtype, data.QueryAddress.String()}, "\x00")
+}
+
+// Collapse returns summaries of closed windows and records to emit.
+func (c *Collapser) Collapse(records []*DnstapFlatT) []*DnstapFlatT {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	now := c.now()
+	res := c.expire(now)
+	for _, data := range records {
+		key := collapseKey(data)
+		if e, ok := c.entries[key]; ok {
+			e.last = data
+			e.count++
+			continue
+		}
+		if len(c.entries) < c.size {
+			e := &collapseEntry{key: key, start: now}
+			c.entries[key] = e
+			c.queue = append(c.queue, e)
+		}
+		res = append(res, data)
+	}
+	return res
+}
+
+// expire returns summaries of windows closed by now.
+func (c *Collapser) expire(now time.Time) []*DnstapFlatT {
+	var res []*DnstapFlatT
+	for len(c.queue) > 0 && now.Sub(c.queue[0].start) >= c.window {
+		e := c.queue[0]
+		c.queue = c.queue[1:]
+		delete(c.entries, e.key)
+		if e.count > 0 {
+			e.last.Occurrences = e.count
+			res = append(res, e.last)
+		}
+	}
+	return res
+}
+
+// Flush returns summaries of all windows.
+func (c *Collapser) Flush() []*DnstapFlatT {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	var res []*DnstapFlatT
+	for _, e := range c.queue {
+		if e.count > 0 {
+			e.last.Occurrences = e.count
+			res = append(res, e.last)
+		}
+	}
+	c.entries = map[string]*collapseEntry{}
+	c.queue = nil
+	return res
+}
@@ -0,0 +1,54 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"testing"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+func TestFlatFrameCollapse(t *testing.T) {
+	clock := time.Unix(1546300800, 0)
+	flat := &dtap.FlatConfig{CollapseIdenticalWithin: 5}
+	flat.SetNow(func() time.Time { return clock })
+	columns := []string{"qname", "occurrences"}
+	query := func(qname string) *dtap.Message {
+		return newTestMessage(t, newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery(qname, dns.TypeA)))
+	}
+
+	www := query("www.example.com.")
+	rows := flatFrameRows(t, flat, columns, www, www, www, www, query("other.example.com."))
+	clock = clock.Add(10 * time.Second)
+	next := query("next.example.com.")
+	rows = append(rows, flatFrameRows(t, flat, columns, next, next, next)...)
+	// the window of next.example.com. is flushed on shutdown.
+	rows = append(rows, flatFrameRows(t, flat, columns, dtap.NewFlushMessage())...)
+
+	assert.Equal(t, [][]string{
+		{"www.example.com.", ""},
+		{"other.example.com.", ""},
+		{"www.example.com.", "3"},
+		{"next.example.com.", ""},
+		{"next.example.com.", "2"},
+	}, rows)
+}
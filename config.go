@@ -19,37 +19,81 @@ package dtap
 import (
 	"context"
 	"crypto/rand"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"net"
+	"net/url"
 	"os"
+	"path/filepath"
+	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"text/template"
+	"time"
 
+	dnstap "github.com/dnstap/golang-dnstap"
 	"github.com/fsnotify/fsnotify"
+	"github.com/miekg/dns"
+	"github.com/mitchellh/mapstructure"
 	"github.com/pkg/errors"
-	"github.com/prometheus/common/log"
+	log "github.com/sirupsen/logrus"
 
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	InputMsgBuffer   uint
-	InputUnix        []*InputUnixSocketConfig
-	InputFile        []*InputFileConfig
-	InputTail        []*InputTailConfig
-	InputTCP         []*InputTCPSocketConfig
-	OutputUnix       []*OutputUnixSocketConfig
-	OutputFile       []*OutputFileConfig
-	OutputTCP        []*OutputTCPSocketConfig
-	OutputFluent     []*OutputFluentConfig
-	OutputKafka      []*OutputKafkaConfig
-	OutputNats       []*OutputNatsConfig
-	OutputPrometheus []*OutputPrometheus
-	OutputStdout     []*OutputStdoutConfig
+	// Strict rejects unknown keys instead of ignoring them, and config errors are fatal on startup.
+	Strict         bool
+	InputMsgBuffer uint
+	// ShutdownTimeout is seconds to write buffered frames and close outputs on shutdown, default 30.
+	ShutdownTimeout uint
+	// LogLevelParse, LogLevelPost and LogLevelConnect are log levels of output errors decoding frames,
+	// writing to and opening the destination, debug, info, warn, error or none.
+	// Defaults are warn, warn and debug.
+	LogLevelParse   string
+	LogLevelPost    string
+	LogLevelConnect string
+	// CollectorID is collector of flat records of outputs with IncludeCollector, default is the hostname.
+	CollectorID string
+	// PerIdentityMaxQPS limits input frames per second of each dnstap identity, 0 is unlimited.
+	PerIdentityMaxQPS float64
+	// PerIdentityBurst is frames of an identity allowed at once over PerIdentityMaxQPS, default is PerIdentityMaxQPS.
+	PerIdentityBurst      int
+	InputUnix             []*InputUnixSocketConfig
+	InputFile             []*InputFileConfig
+	InputTail             []*InputTailConfig
+	InputTCP              []*InputTCPSocketConfig
+	InputHTTP             []*InputHTTPConfig
+	InputKafka            []*InputKafkaConfig
+	OutputUnix            []*OutputUnixSocketConfig
+	OutputFile            []*OutputFileConfig
+	OutputTCP             []*OutputTCPSocketConfig
+	OutputFluent          []*OutputFluentConfig
+	OutputKafka           []*OutputKafkaConfig
+	OutputNats            []*OutputNatsConfig
+	OutputPrometheus      []*OutputPrometheus
+	OutputStdout          []*OutputStdoutConfig
+	OutputCSV             []*OutputCSVConfig
+	OutputJSON            []*OutputJSONConfig
+	OutputTopN            []*OutputTopNConfig
+	OutputRcodeRatio      []*OutputRcodeRatioConfig
+	OutputIdentitySummary []*OutputIdentitySummaryConfig
+	OutputOTLP            []*OutputOTLPConfig
+	OutputLoki            []*OutputLokiConfig
+	OutputPubSub          []*OutputPubSubConfig
+	OutputPulsar          []*OutputPulsarConfig
+	OutputStatsD          []*OutputStatsDConfig
+	OutputEventHub        []*OutputEventHubConfig
+	OutputLoopback        []*OutputLoopbackConfig
+	OutputQueryAPI        []*OutputQueryAPIConfig
+	OutputSSE             []*OutputSSEConfig
+	OutputGRPC            []*OutputGRPCConfig
+	OutputS3              []*OutputS3Config
 }
 
 var (
@@ -106,6 +150,21 @@ func (c *Config) Validate() []error {
 	if c.InputMsgBuffer < 128 {
 		errs = append(errs, errors.New("InputMsgBuffer must not small 128"))
 	}
+	for name, level := range map[string]string{
+		"LogLevelParse":   c.LogLevelParse,
+		"LogLevelPost":    c.LogLevelPost,
+		"LogLevelConnect": c.LogLevelConnect,
+	} {
+		if level != "" && !ValidErrorLogLevel(level) {
+			errs = append(errs, errors.Errorf("%s must be debug, info, warn, error or none, got %s", name, level))
+		}
+	}
+	if c.PerIdentityMaxQPS < 0 {
+		errs = append(errs, errors.New("PerIdentityMaxQPS must not be negative"))
+	}
+	if c.PerIdentityBurst < 0 {
+		errs = append(errs, errors.New("PerIdentityBurst must not be negative"))
+	}
 	for n, i := range c.InputUnix {
 		if err := i.Validate(); err != nil {
 			err.configType = "InputUnix"
@@ -127,6 +186,20 @@ func (c *Config) Validate() []error {
 			errs = append(errs, err)
 		}
 	}
+	for n, i := range c.InputHTTP {
+		if err := i.Validate(); err != nil {
+			err.configType = "InputHTTP"
+			err.no = n
+			errs = append(errs, err)
+		}
+	}
+	for n, i := range c.InputKafka {
+		if err := i.Validate(); err != nil {
+			err.configType = "InputKafka"
+			err.no = n
+			errs = append(errs, err)
+		}
+	}
 	for n, o := range c.OutputUnix {
 		if err := o.Validate(); err != nil {
 			err.configType = "OutputUnix"
@@ -176,9 +249,248 @@ func (c *Config) Validate() []error {
 			errs = append(errs, err)
 		}
 	}
+	for n, o := range c.OutputStdout {
+		if err := o.Validate(); err != nil {
+			err.configType = "OutputStdout"
+			err.no = n
+			errs = append(errs, err)
+		}
+	}
+	for n, o := range c.OutputCSV {
+		if err := o.Validate(); err != nil {
+			err.configType = "OutputCSV"
+			err.no = n
+			errs = append(errs, err)
+		}
+	}
+	for n, o := range c.OutputTopN {
+		if err := o.Validate(); err != nil {
+			err.configType = "OutputTopN"
+			err.no = n
+			errs = append(errs, err)
+		}
+	}
+	for n, o := range c.OutputIdentitySummary {
+		if err := o.Validate(); err != nil {
+			err.configType = "OutputIdentitySummary"
+			err.no = n
+			errs = append(errs, err)
+		}
+	}
+	for n, o := range c.OutputRcodeRatio {
+		if err := o.Validate(); err != nil {
+			err.configType = "OutputRcodeRatio"
+			err.no = n
+			errs = append(errs, err)
+		}
+	}
+	for n, o := range c.OutputOTLP {
+		if err := o.Validate(); err != nil {
+			err.configType = "OutputOTLP"
+			err.no = n
+			errs = append(errs, err)
+		}
+	}
+	for n, o := range c.OutputPubSub {
+		if err := o.Validate(); err != nil {
+			err.configType = "OutputPubSub"
+			err.no = n
+			errs = append(errs, err)
+		}
+	}
+	for n, o := range c.OutputPulsar {
+		if err := o.Validate(); err != nil {
+			err.configType = "OutputPulsar"
+			err.no = n
+			errs = append(errs, err)
+		}
+	}
+	for n, o := range c.OutputStatsD {
+		if err := o.Validate(); err != nil {
+			err.configType = "OutputStatsD"
+			err.no = n
+			errs = append(errs, err)
+		}
+	}
+	for n, o := range c.OutputEventHub {
+		if err := o.Validate(); err != nil {
+			err.configType = "OutputEventHub"
+			err.no = n
+			errs = append(errs, err)
+		}
+	}
+	for n, o := range c.OutputJSON {
+		if err := o.Validate(); err != nil {
+			err.configType = "OutputJSON"
+			err.no = n
+			errs = append(errs, err)
+		}
+	}
+	for n, o := range c.OutputLoopback {
+		if err := o.Validate(); err != nil {
+			err.configType = "OutputLoopback"
+			err.no = n
+			errs = append(errs, err)
+		}
+	}
+	for n, o := range c.OutputQueryAPI {
+		if err := o.Validate(); err != nil {
+			err.configType = "OutputQueryAPI"
+			err.no = n
+			errs = append(errs, err)
+		}
+	}
+	for n, o := range c.OutputSSE {
+		if err := o.Validate(); err != nil {
+			err.configType = "OutputSSE"
+			err.no = n
+			errs = append(errs, err)
+		}
+	}
+	for n, o := range c.OutputGRPC {
+		if err := o.Validate(); err != nil {
+			err.configType = "OutputGRPC"
+			err.no = n
+			errs = append(errs, err)
+		}
+	}
+	for n, o := range c.OutputS3 {
+		if err := o.Validate(); err != nil {
+			err.configType = "OutputS3"
+			err.no = n
+			errs = append(errs, err)
+		}
+	}
+	for n, o := range c.OutputLoki {
+		if err := o.Validate(); err != nil {
+			err.configType = "OutputLoki"
+			err.no = n
+			errs = append(errs, err)
+		}
+	}
+	return append(errs, c.validateStreams()...)
+}
+
+// validateStreams checks Buffer of outputs, full streams must not be sampled
+// and outputs of the same Stream must have the same Full and SampleRate.
+func (c *Config) validateStreams() []error {
+	var errs []error
+	streams := map[string]*OutputBufferConfig{}
+	cv := reflect.ValueOf(c).Elem()
+	for i := 0; i < cv.NumField(); i++ {
+		name := cv.Type().Field(i).Name
+		f := cv.Field(i)
+		if f.Kind() != reflect.Slice || !strings.HasPrefix(name, "Output") {
+			continue
+		}
+		for n := 0; n < f.Len(); n++ {
+			bv := f.Index(n).Elem().FieldByName("Buffer")
+			if !bv.IsValid() {
+				continue
+			}
+			b := bv.Addr().Interface().(*OutputBufferConfig)
+			if b.Full && b.GetSampleRate() < 1 {
+				errs = append(errs, errors.Errorf("%s[%d] Buffer.SampleRate must not be set for the full stream", name, n))
+			}
+			if b.Stream == "" {
+				continue
+			}
+			if prev, ok := streams[b.Stream]; ok && (prev.Full != b.Full || prev.GetSampleRate() != b.GetSampleRate()) {
+				errs = append(errs, errors.Errorf("%s[%d] Buffer of stream %s must have the same Full and SampleRate as others", name, n, b.Stream))
+			}
+			streams[b.Stream] = b
+		}
+	}
 	return errs
 }
 
+// Summary returns a line per input and output with its effective settings as JSON,
+// and a line of other settings. Getters of the same type override field values,
+// so defaults are shown. Fields tagged with secret:"true" are masked.
+func (c *Config) Summary() []string {
+	var res []string
+	global := map[string]interface{}{}
+	cv := reflect.ValueOf(c).Elem()
+	for i := 0; i < cv.NumField(); i++ {
+		name := cv.Type().Field(i).Name
+		f := cv.Field(i)
+		if f.Kind() != reflect.Slice {
+			global[name] = f.Interface()
+			continue
+		}
+		for n := 0; n < f.Len(); n++ {
+			buf, _ := json.Marshal(summaryValue(f.Index(n)))
+			res = append(res, fmt.Sprintf("%s[%d] %s", name, n, buf))
+		}
+	}
+	buf, _ := json.Marshal(global)
+	return append([]string{fmt.Sprintf("Config %s", buf)}, res...)
+}
+
+func summaryValue(v reflect.Value) interface{} {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Ptr && v.Type().Elem().Kind() != reflect.Struct {
+			return v.Interface()
+		}
+		res := []interface{}{}
+		for n := 0; n < v.Len(); n++ {
+			res = append(res, summaryValue(v.Index(n)))
+		}
+		return res
+	default:
+		return v.Interface()
+	}
+	res := map[string]interface{}{}
+	var ptr reflect.Value
+	if v.CanAddr() {
+		ptr = v.Addr()
+	}
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		fv := v.Field(i)
+		if ptr.IsValid() {
+			if m := ptr.MethodByName("Get" + field.Name); m.IsValid() &&
+				m.Type().NumIn() == 0 && m.Type().NumOut() == 1 && m.Type().Out(0) == field.Type {
+				fv = m.Call(nil)[0]
+			}
+		}
+		if field.Tag.Get("secret") == "true" {
+			res[field.Name] = secretValue(fv)
+			continue
+		}
+		res[field.Name] = summaryValue(fv)
+	}
+	return res
+}
+
+// secretValue masks a string field tagged with secret:"true", or values of a map field like auth headers.
+func secretValue(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.String:
+		if v.Len() > 0 {
+			return "***"
+		}
+	case reflect.Map:
+		res := map[string]string{}
+		for _, k := range v.MapKeys() {
+			res[fmt.Sprint(k.Interface())] = "***"
+		}
+		return res
+	}
+	return v.Interface()
+}
+
 type ValidationError struct {
 	configType string
 	no         int
@@ -219,22 +531,206 @@ func NewConfigFromFile(filename string) (*Config, error) {
 }
 
 func NewConfigFromReader(r io.Reader) (*Config, error) {
-	c := &Config{}
+	v, err := readViper(r)
+	if err != nil {
+		return nil, err
+	}
+	c, err := decodeConfig(v, v.GetBool("Strict"))
+	if err != nil {
+		return nil, err
+	}
+	c.setCollectorID()
+	return c, nil
+}
+
+// NewConfigFromPath loads a config file, or all *.toml files when path is a directory.
+func NewConfigFromPath(path string) (*Config, error) {
+	st, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if st.IsDir() {
+		return NewConfigFromDir(path)
+	}
+	return NewConfigFromFile(path)
+}
+
+// NewConfigFromDir loads and merges all *.toml files in dir in lexical order.
+// Inputs and outputs are appended in file order,
+// other settings must not be set in more than one file.
+// Strict in any file applies to all files.
+func NewConfigFromDir(dir string) (*Config, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.toml"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, errors.Errorf("no *.toml files in %s", dir)
+	}
+	vipers := make([]*viper.Viper, len(files))
+	strict := false
+	for n, filename := range files {
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		vipers[n], err = readViper(f)
+		f.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "file %s", filename)
+		}
+		strict = strict || vipers[n].GetBool("Strict")
+	}
+	var c *Config
+	setBy := map[string]string{}
+	for n, filename := range files {
+		v := vipers[n]
+		fc, err := decodeConfig(v, strict)
+		if err != nil {
+			return nil, errors.Wrapf(err, "file %s", filename)
+		}
+		if c == nil {
+			c = fc
+		} else if err := mergeConfig(c, fc, v, filename, setBy); err != nil {
+			return nil, err
+		}
+		for _, key := range singletonKeys(v) {
+			setBy[key] = filename
+		}
+	}
+	c.setCollectorID()
+	return c, nil
+}
+
+// DefaultShutdownTimeout is the default of ShutdownTimeout.
+var DefaultShutdownTimeout = 30 * time.Second
+
+func (c *Config) GetShutdownTimeout() time.Duration {
+	if c.ShutdownTimeout == 0 {
+		return DefaultShutdownTimeout
+	}
+	return time.Duration(c.ShutdownTimeout) * time.Second
+}
+
+func (c *Config) GetCollectorID() string {
+	if c.CollectorID == "" {
+		return DefaultCollectorID
+	}
+	return c.CollectorID
+}
+
+// setCollectorID sets CollectorID of the config to Flat of outputs without their own.
+func (c *Config) setCollectorID() {
+	if c.CollectorID == "" {
+		return
+	}
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		if f.Kind() != reflect.Slice {
+			continue
+		}
+		for j := 0; j < f.Len(); j++ {
+			o := reflect.Indirect(f.Index(j))
+			if o.Kind() != reflect.Struct || !o.FieldByName("Flat").IsValid() {
+				continue
+			}
+			if flat, ok := o.FieldByName("Flat").Addr().Interface().(*FlatConfig); ok && flat.CollectorID == "" {
+				flat.CollectorID = c.CollectorID
+			}
+		}
+	}
+}
+
+// GetErrorLogLevels returns DefaultErrorLogLevels with the levels set in the config.
+func (c *Config) GetErrorLogLevels() map[ErrorCategory]string {
+	levels := map[ErrorCategory]string{}
+	for category, level := range DefaultErrorLogLevels {
+		levels[category] = level
+	}
+	for category, level := range map[ErrorCategory]string{
+		ErrorCategoryParse:   c.LogLevelParse,
+		ErrorCategoryPost:    c.LogLevelPost,
+		ErrorCategoryConnect: c.LogLevelConnect,
+	} {
+		if level != "" {
+			levels[category] = level
+		}
+	}
+	return levels
+}
+
+func (c *Config) GetPerIdentityBurst() int {
+	if c.PerIdentityBurst == 0 {
+		return int(math.Ceil(c.PerIdentityMaxQPS))
+	}
+	return c.PerIdentityBurst
+}
+
+func readViper(r io.Reader) (*viper.Viper, error) {
 	v := viper.New()
 	v.SetConfigType("toml")
 	v.SetDefault("InputMsgBuffer", 10000)
 	if err := v.ReadConfig(r); err != nil {
 		return nil, errors.Wrap(err, "can't read config")
 	}
-	if err := v.Unmarshal(c); err != nil {
+	return v, nil
+}
+
+// decodeConfig decodes settings of v, unknown keys are errors when strict.
+func decodeConfig(v *viper.Viper, strict bool) (*Config, error) {
+	c := &Config{}
+	if err := v.Unmarshal(c, func(dc *mapstructure.DecoderConfig) {
+		dc.ErrorUnused = strict
+	}); err != nil {
+		if strict {
+			return nil, errors.Wrap(err, "can't parse config in strict mode")
+		}
 		return nil, errors.Wrap(err, "can't parse config")
 	}
 	return c, nil
 }
 
+// singletonKeys returns non list Config fields set in the file of v.
+func singletonKeys(v *viper.Viper) []string {
+	var keys []string
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Type.Kind() != reflect.Slice && v.InConfig(strings.ToLower(f.Name)) {
+			keys = append(keys, f.Name)
+		}
+	}
+	return keys
+}
+
+// mergeConfig appends lists of src into dst and sets singletons set in filename.
+func mergeConfig(dst, src *Config, v *viper.Viper, filename string, setBy map[string]string) error {
+	dv := reflect.ValueOf(dst).Elem()
+	sv := reflect.ValueOf(src).Elem()
+	for i := 0; i < dv.NumField(); i++ {
+		if dv.Field(i).Kind() == reflect.Slice {
+			dv.Field(i).Set(reflect.AppendSlice(dv.Field(i), sv.Field(i)))
+		}
+	}
+	for _, key := range singletonKeys(v) {
+		if prev, ok := setBy[key]; ok {
+			return errors.Errorf("%s is set in both %s and %s", key, prev, filename)
+		}
+		dv.FieldByName(key).Set(sv.FieldByName(key))
+	}
+	return nil
+}
+
 type InputUnixSocketConfig struct {
 	Path string
 	User string
+	// ReadTimeout is seconds to wait for next data before closing connection. 0 is disable.
+	ReadTimeout uint
+	// MaxConnections is max number of concurrent connections, more are refused. 0 is unlimited.
+	MaxConnections int
+	// Source is the label of the input in records, default unix:<Path>.
+	Source string
 }
 
 func (i *InputUnixSocketConfig) Validate() *ValidationError {
@@ -242,18 +738,33 @@ func (i *InputUnixSocketConfig) Validate() *ValidationError {
 	if i.Path == "" {
 		err.Add(errors.New("Path must not be empty"))
 	}
+	if i.MaxConnections < 0 {
+		err.Add(errors.New("MaxConnections must not be negative"))
+	}
 	return err.Err()
 }
 
 func (i *InputUnixSocketConfig) GetPath() string {
 	return i.Path
 }
+func (i *InputUnixSocketConfig) GetSource() string {
+	if i.Source == "" {
+		return "unix:" + i.Path
+	}
+	return i.Source
+}
+
 func (i *InputUnixSocketConfig) GetUser() string {
 	return i.User
 }
+func (i *InputUnixSocketConfig) GetReadTimeout() time.Duration {
+	return time.Duration(i.ReadTimeout) * time.Second
+}
 
 type InputFileConfig struct {
 	Path string
+	// Source is the label of the input in records, default file:<Path>.
+	Source string
 }
 
 func (i *InputFileConfig) Validate() *ValidationError {
@@ -268,8 +779,17 @@ func (i *InputFileConfig) GetPath() string {
 	return i.Path
 }
 
+func (i *InputFileConfig) GetSource() string {
+	if i.Source == "" {
+		return "file:" + i.Path
+	}
+	return i.Source
+}
+
 type InputTailConfig struct {
 	Path string
+	// Source is the label of the input in records, default tail:<Path>.
+	Source string
 }
 
 func (i *InputTailConfig) Validate() *ValidationError {
@@ -284,9 +804,33 @@ func (i *InputTailConfig) GetPath() string {
 	return i.Path
 }
 
+func (i *InputTailConfig) GetSource() string {
+	if i.Source == "" {
+		return "tail:" + i.Path
+	}
+	return i.Source
+}
+
 type InputTCPSocketConfig struct {
 	Address string
 	Port    uint16
+	// ReadTimeout is seconds to wait for next data before closing connection. 0 is disable.
+	ReadTimeout uint
+	// KeepAliveInterval is seconds between TCP keepalive probes. 0 is the OS default.
+	KeepAliveInterval uint
+	// MaxConnections is max number of concurrent connections, more are refused. 0 is unlimited.
+	MaxConnections int
+	// Source is the label of the input in records, default tcp:<Address>:<Port>.
+	Source string
+	// TLSCert and TLSKey enable TLS with the server certificate.
+	TLSCert string
+	TLSKey  string
+	// TLSClientCA requires client certificates verified by the CA file.
+	TLSClientCA string
+	// UseTLSIdentity sets identity of frames to the CN, or the first DNS SAN, of the client certificate.
+	UseTLSIdentity bool
+	// TLSIdentityDefault sets it only to frames without identity.
+	TLSIdentityDefault bool
 }
 
 func (i *InputTCPSocketConfig) Validate() *ValidationError {
@@ -294,6 +838,18 @@ func (i *InputTCPSocketConfig) Validate() *ValidationError {
 	if i.Address == "" {
 		err.Add(errors.New("Host must not be empty"))
 	}
+	if i.MaxConnections < 0 {
+		err.Add(errors.New("MaxConnections must not be negative"))
+	}
+	if (i.TLSCert == "") != (i.TLSKey == "") {
+		err.Add(errors.New("TLSCert and TLSKey must be set together"))
+	}
+	if i.TLSClientCA != "" && i.TLSCert == "" {
+		err.Add(errors.New("TLSClientCA needs TLSCert and TLSKey"))
+	}
+	if i.UseTLSIdentity && i.TLSClientCA == "" {
+		err.Add(errors.New("UseTLSIdentity needs TLSClientCA"))
+	}
 	return err.Err()
 }
 
@@ -311,49 +867,196 @@ func (i *InputTCPSocketConfig) GetNet() string {
 	}
 	return address + ":" + strconv.Itoa(int(port))
 }
-
-type OutputUnixSocketConfig struct {
-	Path   string
-	Buffer OutputBufferConfig
+func (i *InputTCPSocketConfig) GetSource() string {
+	if i.Source == "" {
+		return "tcp:" + i.GetNet()
+	}
+	return i.Source
 }
 
-func (o *OutputUnixSocketConfig) Validate() *ValidationError {
-	err := NewValidationError()
-	if o.Path == "" {
-		err.Add(errors.New("Path must not be empty"))
-	}
-	return err.Err()
+func (i *InputTCPSocketConfig) GetReadTimeout() time.Duration {
+	return time.Duration(i.ReadTimeout) * time.Second
 }
 
-func (o *OutputUnixSocketConfig) GetPath() string {
-	return o.Path
+func (i *InputTCPSocketConfig) GetKeepAliveInterval() time.Duration {
+	return time.Duration(i.KeepAliveInterval) * time.Second
 }
 
-type OutputFileConfig struct {
-	Path   string
-	User   string
-	Buffer OutputBufferConfig
+type InputHTTPConfig struct {
+	Address string
+	Port    uint16
+	Path    string
+	// Token is required as "Authorization: Bearer <Token>" when not empty.
+	Token string `secret:"true"`
+	// Source is the label of the input in records, default http:<Address>:<Port>.
+	Source string
 }
 
-func (o *OutputFileConfig) Validate() *ValidationError {
+func (i *InputHTTPConfig) Validate() *ValidationError {
 	err := NewValidationError()
-	if o.Path == "" {
-		err.Add(errors.New("Path must not be empty"))
+	if !strings.HasPrefix(i.GetPath(), "/") {
+		err.Add(errors.New("Path must start with /"))
 	}
 	return err.Err()
 }
 
-func (o *OutputFileConfig) GetPath() string {
-	return o.Path
-}
-func (o *OutputFileConfig) GetUser() string {
-	return o.User
+func (i *InputHTTPConfig) GetNet() string {
+	address := i.Address
+	port := i.Port
+	if address == "" {
+		address = "0.0.0.0"
+	}
+	if port == 0 {
+		port = 10080
+	}
+	return net.JoinHostPort(address, strconv.Itoa(int(port)))
 }
-
-type OutputTCPSocketConfig struct {
-	Host   string
-	Port   uint16
-	Buffer OutputBufferConfig
+func (i *InputHTTPConfig) GetPath() string {
+	if i.Path == "" {
+		return "/dnstap"
+	}
+	return i.Path
+}
+func (i *InputHTTPConfig) GetSource() string {
+	if i.Source == "" {
+		return "http:" + i.GetNet()
+	}
+	return i.Source
+}
+
+func (i *InputHTTPConfig) GetToken() string {
+	return i.Token
+}
+
+type InputKafkaConfig struct {
+	Hosts []string
+	Topic string
+	// GroupID is the consumer group, default dtap.
+	GroupID string
+	// InitialOffset is oldest or newest (default), where a group without committed offsets starts.
+	InitialOffset string
+	// TLS enables TLS connections to brokers.
+	TLS                   bool
+	TLSCA                 string
+	TLSCert               string
+	TLSKey                string
+	TLSInsecureSkipVerify bool
+	// SASLMechanism is PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512. empty is disable SASL.
+	SASLMechanism string
+	SASLUser      string
+	SASLPassword  string `secret:"true"`
+	// Source is the label of the input in records, default kafka:<Topic>.
+	Source string
+}
+
+func (i *InputKafkaConfig) Validate() *ValidationError {
+	valerr := NewValidationError()
+	if i.Topic == "" {
+		valerr.Add(errors.New("Topic must not be empty"))
+	}
+	if len(i.Hosts) == 0 {
+		valerr.Add(errors.New("Hosts must not be empty"))
+	}
+	switch i.GetInitialOffset() {
+	case "oldest", "newest":
+	default:
+		valerr.Add(errors.New("InitialOffset must be oldest or newest"))
+	}
+	i.SASLMechanism = i.security().validate(valerr)
+	return valerr.Err()
+}
+
+func (i *InputKafkaConfig) security() kafkaSecurity {
+	return kafkaSecurity{
+		TLS:                   i.TLS,
+		TLSCA:                 i.TLSCA,
+		TLSCert:               i.TLSCert,
+		TLSKey:                i.TLSKey,
+		TLSInsecureSkipVerify: i.TLSInsecureSkipVerify,
+		SASLMechanism:         i.SASLMechanism,
+		SASLUser:              i.SASLUser,
+		SASLPassword:          i.SASLPassword,
+	}
+}
+
+func (i *InputKafkaConfig) GetGroupID() string {
+	if i.GroupID == "" {
+		return "dtap"
+	}
+	return i.GroupID
+}
+
+func (i *InputKafkaConfig) GetInitialOffset() string {
+	if i.InitialOffset == "" {
+		return "newest"
+	}
+	return strings.ToLower(i.InitialOffset)
+}
+
+func (i *InputKafkaConfig) GetSource() string {
+	if i.Source == "" {
+		return "kafka:" + i.Topic
+	}
+	return i.Source
+}
+
+type OutputUnixSocketConfig struct {
+	Path string
+	// Reconnect is seconds to wait before reconnecting to the socket. default is 1.
+	Reconnect uint
+	Buffer    OutputBufferConfig
+}
+
+func (o *OutputUnixSocketConfig) Validate() *ValidationError {
+	err := NewValidationError()
+	if o.Path == "" {
+		err.Add(errors.New("Path must not be empty"))
+	}
+	return err.Err()
+}
+
+func (o *OutputUnixSocketConfig) GetPath() string {
+	return o.Path
+}
+
+func (o *OutputUnixSocketConfig) GetReconnect() time.Duration {
+	if o.Reconnect == 0 {
+		return ReconnectInterval
+	}
+	return time.Duration(o.Reconnect) * time.Second
+}
+
+type OutputFileConfig struct {
+	Path   string
+	User   string
+	Buffer OutputBufferConfig
+}
+
+func (o *OutputFileConfig) Validate() *ValidationError {
+	err := NewValidationError()
+	if o.Path == "" {
+		err.Add(errors.New("Path must not be empty"))
+	}
+	return err.Err()
+}
+
+func (o *OutputFileConfig) GetPath() string {
+	return o.Path
+}
+func (o *OutputFileConfig) GetUser() string {
+	return o.User
+}
+
+type OutputTCPSocketConfig struct {
+	Host string
+	Port uint16
+	// ConnectTimeout is seconds to wait for connecting, default 10.
+	ConnectTimeout uint
+	// WriteTimeout is seconds to wait for a blocked write before reconnecting. 0 is disable.
+	WriteTimeout uint
+	// KeepAliveInterval is seconds between TCP keepalive probes. 0 is the OS default.
+	KeepAliveInterval uint
+	Buffer            OutputBufferConfig
 }
 
 func (o *OutputTCPSocketConfig) Validate() *ValidationError {
@@ -376,12 +1079,86 @@ func (o *OutputTCPSocketConfig) GetAddress() string {
 	return host + ":" + strconv.Itoa(int(port))
 }
 
+func (o *OutputTCPSocketConfig) GetConnectTimeout() time.Duration {
+	if o.ConnectTimeout == 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(o.ConnectTimeout) * time.Second
+}
+
+func (o *OutputTCPSocketConfig) GetWriteTimeout() time.Duration {
+	return time.Duration(o.WriteTimeout) * time.Second
+}
+
+func (o *OutputTCPSocketConfig) GetKeepAliveInterval() time.Duration {
+	return time.Duration(o.KeepAliveInterval) * time.Second
+}
+
 type OutputFluentConfig struct {
-	Host   string
-	Tag    string
-	Port   uint16
-	Flat   FlatConfig
-	Buffer OutputBufferConfig
+	Host string
+	Tag  string
+	Port uint16
+	// QtypeTagMap maps qtype names to tags. Unmapped qtypes use Tag.
+	QtypeTagMap map[string]string
+	// MinLatencyMs drops responses faster than it. 0 is disable.
+	MinLatencyMs float64
+	// KeepUnknownLatency keeps responses without latency when MinLatencyMs is set.
+	KeepUnknownLatency bool
+	// MinAnswers drops responses with fewer answer records, of all rcodes. 0 is disable.
+	MinAnswers int
+	// MaxRecordBytes is max JSON size of a record, larger records drop optional fields. 0 is unlimited.
+	MaxRecordBytes int
+	// Async posts via buffer of the fluent library, BufferLimit is its size.
+	Async       bool
+	BufferLimit int
+	// OverflowPolicy is drop, block or error when the async buffer is full. default is drop.
+	OverflowPolicy string
+	// RequestAck waits for acknowledgement of each post for at-least-once delivery.
+	// It costs a round trip per record, so throughput drops by network latency.
+	// Un-acked posts are retried by the fluent library and fail the write,
+	// in Async mode they are retried in background and dropped.
+	RequestAck bool
+	// SocketFamilies posts only records of these socket families, INET or INET6. empty is all.
+	SocketFamilies []string
+	// ForwardCompression is gzip or none. gzip posts batches of BatchSize records
+	// or every FlushInterval seconds in CompressedPackedForward mode, without the fluent library,
+	// so Async, BufferLimit and OverflowPolicy are not used.
+	ForwardCompression string
+	// BatchSize is max number of records per compressed post, default 100.
+	BatchSize int
+	// FlushInterval is seconds between compressed posts, default 1.
+	FlushInterval int
+	// BatchByTag batches records per tag, each tag is posted by its own BatchSize and FlushInterval.
+	BatchByTag bool
+	// CloseTimeout is seconds to flush buffered records on reconnect and shutdown, default 5.
+	// Records not flushed in it are dropped.
+	CloseTimeout int
+	// WriteTimeout is seconds to write a post and to read its ack, default 3.
+	WriteTimeout int
+	// MaxFutureSkew is seconds a record timestamp may be ahead of now, 0 is disable.
+	MaxFutureSkew int
+	// FutureSkewPolicy is clamp or drop for records ahead of MaxFutureSkew. default is clamp.
+	// clamp sets the timestamp to now and timestamp_clamped.
+	FutureSkewPolicy string
+	Flat             FlatConfig
+	Buffer           OutputBufferConfig
+}
+
+func validateFluentTag(tag string) error {
+	r := regexp.MustCompile(`^[a-z0-9_]+$`)
+	labels := strings.Split(tag, ".")
+	for _, label := range labels {
+		if !r.MatchString(label) {
+			return errors.New("Tag characters must only include lower-case alphabets, digits underscore and dot")
+		}
+	}
+	if tag[0] == '.' {
+		return errors.New("First part of a tag is empty")
+	}
+	if tag[len(tag)-1] == '.' {
+		return errors.New("Last part of a tag is empty")
+	}
+	return nil
 }
 
 func (o *OutputFluentConfig) Validate() *ValidationError {
@@ -391,21 +1168,56 @@ func (o *OutputFluentConfig) Validate() *ValidationError {
 	}
 	if o.Tag == "" {
 		valerr.Add(errors.New("Tag must not be empty"))
-	} else {
-		r := regexp.MustCompile(`^[a-z0-9_]+$`)
-		labels := strings.Split(o.Tag, ".")
-		for _, label := range labels {
-			if r.MatchString(label) {
-				valerr.Add(errors.New("Tag characters must only include lower-case alphabets, digits underscore and dot"))
-				break
-			}
+	} else if err := validateFluentTag(o.Tag); err != nil {
+		valerr.Add(err)
+	}
+	if o.MinLatencyMs < 0 {
+		valerr.Add(errors.New("MinLatencyMs must not be negative"))
+	}
+	if o.MinAnswers < 0 {
+		valerr.Add(errors.New("MinAnswers must not be negative"))
+	}
+	if o.MaxRecordBytes < 0 {
+		valerr.Add(errors.New("MaxRecordBytes must not be negative"))
+	}
+	switch o.GetOverflowPolicy() {
+	case "drop", "block", "error":
+	default:
+		valerr.Add(errors.New("OverflowPolicy must be drop, block or error"))
+	}
+	switch o.GetForwardCompression() {
+	case "none", "gzip":
+	default:
+		valerr.Add(errors.New("ForwardCompression must be gzip or none"))
+	}
+	if o.MaxFutureSkew < 0 {
+		valerr.Add(errors.New("MaxFutureSkew must not be negative"))
+	}
+	switch o.GetFutureSkewPolicy() {
+	case "clamp", "drop":
+	default:
+		valerr.Add(errors.New("FutureSkewPolicy must be clamp or drop"))
+	}
+	tagMap := map[string]string{}
+	for qtype, tag := range o.QtypeTagMap {
+		qtype = strings.ToUpper(qtype)
+		if _, ok := dns.StringToType[qtype]; !ok {
+			valerr.Add(errors.Errorf("QtypeTagMap has unknown qtype %s", qtype))
 		}
-		if o.Tag[0] == '.' {
-			valerr.Add(errors.New("First part of a tag is empty"))
+		if tag == "" {
+			valerr.Add(errors.Errorf("QtypeTagMap tag of %s must not be empty", qtype))
+		} else if err := validateFluentTag(tag); err != nil {
+			valerr.Add(errors.Wrapf(err, "QtypeTagMap tag of %s", qtype))
 		}
-		if o.Tag[len(o.Tag)-1] == '.' {
-			valerr.Add(errors.New("Last part of a tag is empty"))
+		tagMap[qtype] = tag
+	}
+	o.QtypeTagMap = tagMap
+	for n, family := range o.SocketFamilies {
+		family = strings.ToUpper(family)
+		if _, ok := dnstap.SocketFamily_value[family]; !ok {
+			valerr.Add(errors.Errorf("SocketFamilies has unknown socket family %s", family))
 		}
+		o.SocketFamilies[n] = family
 	}
 	if err := o.Flat.Validate(); err != nil {
 		valerr.Add(err)
@@ -421,6 +1233,101 @@ func (o *OutputFluentConfig) GetTag() string {
 	return o.Tag
 }
 
+// GetQtypeTag returns the tag for qtype, or Tag when qtype is unmapped.
+func (o *OutputFluentConfig) GetQtypeTag(qtype string) string {
+	if tag, ok := o.QtypeTagMap[qtype]; ok {
+		return tag
+	}
+	return o.Tag
+}
+
+// SkipLatency reports whether the response record is dropped by MinLatencyMs.
+// Query records are never dropped.
+func (o *OutputFluentConfig) SkipLatency(data *DnstapFlatT) bool {
+	if o.MinLatencyMs <= 0 || !isResponse(data.MessageType) {
+		return false
+	}
+	if data.LatencyMs == nil {
+		return !o.KeepUnknownLatency
+	}
+	return *data.LatencyMs < o.MinLatencyMs
+}
+
+// SkipAnswers reports whether the response record is dropped by MinAnswers.
+// Query records are never dropped.
+func (o *OutputFluentConfig) SkipAnswers(data *DnstapFlatT) bool {
+	if o.MinAnswers <= 0 || !isResponse(data.MessageType) {
+		return false
+	}
+	return data.Ancount < o.MinAnswers
+}
+
+// SkipSocketFamily reports whether the record is dropped by SocketFamilies.
+func (o *OutputFluentConfig) SkipSocketFamily(data *DnstapFlatT) bool {
+	if len(o.SocketFamilies) == 0 {
+		return false
+	}
+	for _, family := range o.SocketFamilies {
+		if family == data.SocketFamily {
+			return false
+		}
+	}
+	return true
+}
+
+func (o *OutputFluentConfig) GetOverflowPolicy() string {
+	if o.OverflowPolicy == "" {
+		return "drop"
+	}
+	return strings.ToLower(o.OverflowPolicy)
+}
+
+func (o *OutputFluentConfig) GetForwardCompression() string {
+	if o.ForwardCompression == "" {
+		return "none"
+	}
+	return strings.ToLower(o.ForwardCompression)
+}
+
+func (o *OutputFluentConfig) GetBatchSize() int {
+	if o.BatchSize <= 0 {
+		return 100
+	}
+	return o.BatchSize
+}
+
+func (o *OutputFluentConfig) GetFlushInterval() int {
+	if o.FlushInterval <= 0 {
+		return 1
+	}
+	return o.FlushInterval
+}
+
+func (o *OutputFluentConfig) GetCloseTimeout() time.Duration {
+	if o.CloseTimeout <= 0 {
+		return 5 * time.Second
+	}
+	return time.Duration(o.CloseTimeout) * time.Second
+}
+
+func (o *OutputFluentConfig) GetWriteTimeout() time.Duration {
+	if o.WriteTimeout <= 0 {
+		return 3 * time.Second
+	}
+	return time.Duration(o.WriteTimeout) * time.Second
+}
+
+func (o *OutputFluentConfig) GetMaxFutureSkew() time.Duration {
+	return time.Duration(o.MaxFutureSkew) * time.Second
+}
+
+func (o *OutputFluentConfig) GetFutureSkewPolicy() string {
+	if o.FutureSkewPolicy == "" {
+		return "clamp"
+	}
+	return strings.ToLower(o.FutureSkewPolicy)
+}
+
 func (o *OutputFluentConfig) GetPort() int {
 	if o.Port == 0 {
 		return 24224
@@ -429,14 +1336,26 @@ func (o *OutputFluentConfig) GetPort() int {
 }
 
 type OutputKafkaConfig struct {
-	Hosts            []string
+	Hosts []string
+	// SchemaRegistries are Confluent Schema Registry urls for avro.
+	// empty is plain Avro binary without the schema id framing.
 	SchemaRegistries []string
 	Retry            uint
 	Topic            string
 	Key              string
 	OutputType       string
-	Buffer           OutputBufferConfig
-	Flat             FlatConfig
+	// TLS enables TLS connections to brokers.
+	TLS                   bool
+	TLSCA                 string
+	TLSCert               string
+	TLSKey                string
+	TLSInsecureSkipVerify bool
+	// SASLMechanism is PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512. empty is disable SASL.
+	SASLMechanism string
+	SASLUser      string
+	SASLPassword  string `secret:"true"`
+	Buffer        OutputBufferConfig
+	Flat          FlatConfig
 }
 
 func (o *OutputKafkaConfig) Validate() *ValidationError {
@@ -456,9 +1375,53 @@ func (o *OutputKafkaConfig) Validate() *ValidationError {
 		valerr.Add(errors.New("OutputType must be avro, json or protobuf"))
 	}
 	o.OutputType = otype
+	o.SASLMechanism = o.security().validate(valerr)
 	return valerr.Err()
 }
 
+func (o *OutputKafkaConfig) security() kafkaSecurity {
+	return kafkaSecurity{
+		TLS:                   o.TLS,
+		TLSCA:                 o.TLSCA,
+		TLSCert:               o.TLSCert,
+		TLSKey:                o.TLSKey,
+		TLSInsecureSkipVerify: o.TLSInsecureSkipVerify,
+		SASLMechanism:         o.SASLMechanism,
+		SASLUser:              o.SASLUser,
+		SASLPassword:          o.SASLPassword,
+	}
+}
+
+// kafkaSecurity is TLS and SASL settings of kafka brokers, shared by the kafka input and output.
+type kafkaSecurity struct {
+	TLS                   bool
+	TLSCA                 string
+	TLSCert               string
+	TLSKey                string
+	TLSInsecureSkipVerify bool
+	SASLMechanism         string
+	SASLUser              string
+	SASLPassword          string `secret:"true"`
+}
+
+// validate adds errors of s to valerr, and returns SASLMechanism in upper case.
+func (s kafkaSecurity) validate(valerr *ValidationError) string {
+	if (s.TLSCert == "") != (s.TLSKey == "") {
+		valerr.Add(errors.New("TLSCert and TLSKey must be set together"))
+	}
+	mechanism := strings.ToUpper(s.SASLMechanism)
+	switch mechanism {
+	case "":
+	case "PLAIN", "SCRAM-SHA-256", "SCRAM-SHA-512":
+		if s.SASLUser == "" || s.SASLPassword == "" {
+			valerr.Add(errors.New("SASLUser and SASLPassword must not be empty"))
+		}
+	default:
+		valerr.Add(errors.New("SASLMechanism must be PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512"))
+	}
+	return mechanism
+}
+
 func (o *OutputKafkaConfig) GetHosts() []string {
 	return o.Hosts
 }
@@ -474,6 +1437,17 @@ func (o *OutputKafkaConfig) GetTopic() string {
 func (o *OutputKafkaConfig) GetKey() string {
 	return o.Key
 }
+
+// GetRecordKey returns the message key of data, the configured Key wins over doc_id.
+func (o *OutputKafkaConfig) GetRecordKey(data *DnstapFlatT) string {
+	if o.Key == "" {
+		return data.DocID
+	}
+	return o.Key
+}
+func (o *OutputKafkaConfig) GetSASLMechanism() string {
+	return strings.ToUpper(o.SASLMechanism)
+}
 func (o *OutputKafkaConfig) GetOutputType() string {
 	if o.OutputType == "" {
 		return "avro"
@@ -485,14 +1459,19 @@ type OutputNatsConfig struct {
 	Host     string
 	Subject  string
 	User     string
-	Password string
-	Token    string
-	Flat     FlatConfig
-	Buffer   OutputBufferConfig
+	Password string `secret:"true"`
+	Token    string `secret:"true"`
+	// Format is json, msgpack, cbor, avro or dnstap_json.
+	Format string
+	Flat   FlatConfig
+	Buffer OutputBufferConfig
 }
 
 func (o *OutputNatsConfig) Validate() *ValidationError {
 	valerr := NewValidationError()
+	if err := validateFormat(o.Format); err != nil {
+		valerr.Add(err)
+	}
 	if err := o.Flat.Validate(); err != nil {
 		valerr.Add(err)
 	}
@@ -515,6 +1494,26 @@ func (o *OutputNatsConfig) GetPassword() string {
 func (o *OutputNatsConfig) GetToken() string {
 	return o.Token
 }
+func (o *OutputNatsConfig) GetFormat() string {
+	return getFormat(o.Format)
+}
+
+func getFormat(format string) string {
+	if format == "" {
+		return "json"
+	}
+	return strings.ToLower(format)
+}
+
+func validateFormat(format string) error {
+	if getFormat(format) == DnstapJSONFormat {
+		return nil
+	}
+	if _, err := NewSerializer(getFormat(format)); err != nil {
+		return errors.Errorf("Format must be one of %s, %s", strings.Join(SerializeFormats, ", "), DnstapJSONFormat)
+	}
+	return nil
+}
 
 type OutputPrometheus struct {
 	Counters []OutputPrometheusMetrics
@@ -534,9 +1533,10 @@ func (o *OutputPrometheus) Validate() *ValidationError {
 }
 
 type OutputPrometheusMetrics struct {
-	Name           string
-	Help           string
-	Labels         []string
+	Name   string
+	Help   string
+	Labels []string
+	// Limit is max number of label value sets, least recently used sets are deleted.
 	Limit          int
 	ExpireInterval int
 	ExpireSec      int
@@ -570,8 +1570,10 @@ type OutputStdoutConfig struct {
 	Type        string             `toml:"type"`
 	TemplateStr string             `toml:"template"`
 	template    *template.Template `toml:"-"`
-	Flat        FlatConfig
-	Buffer      OutputBufferConfig
+	// Format is json, msgpack, cbor, avro or dnstap_json for Type json.
+	Format string
+	Flat   FlatConfig
+	Buffer OutputBufferConfig
 }
 
 func (o *OutputStdoutConfig) GetType() string {
@@ -580,7 +1582,11 @@ func (o *OutputStdoutConfig) GetType() string {
 	}
 	return o.Type
 }
-func (o *OutputStdoutConfig) Validate() error {
+func (o *OutputStdoutConfig) GetFormat() string {
+	return getFormat(o.Format)
+}
+
+func (o *OutputStdoutConfig) Validate() *ValidationError {
 	valerr := NewValidationError()
 	o.Type = strings.ToLower(o.Type)
 	switch o.Type {
@@ -598,94 +1604,1816 @@ func (o *OutputStdoutConfig) Validate() error {
 	default:
 		valerr.Add(errors.New("Type must be json or gotpl"))
 	}
+	if err := validateFormat(o.Format); err != nil {
+		valerr.Add(err)
+	}
 	if err := o.Flat.Validate(); err != nil {
 		valerr.Add(err)
 	}
 	return valerr.Err()
 }
 
-type OutputBufferConfig struct {
-	BufferSize uint
+var DefaultCSVColumns = []string{
+	"timestamp", "identity", "type", "query_address", "query_port",
+	"response_address", "response_port", "qname", "qclass", "qtype", "rcode", "message_size",
 }
 
-func (o *OutputBufferConfig) GetBufferSize() uint {
-	if o.BufferSize == 0 {
-		return OutputBufferSize
-	}
-	return o.BufferSize
+type OutputCSVConfig struct {
+	// Path is output file path, empty is stdout.
+	Path    string
+	Columns []string
+	Flat    FlatConfig
+	Buffer  OutputBufferConfig
 }
 
-type FlatConfig struct {
-	IPv4Mask       uint8
-	ipv4Mask       net.IPMask
-	IPv6Mask       uint8
-	ipv6Mask       net.IPMask
-	EnableECS      bool
-	EnableHashIP   bool
-	ipHashSalt     []byte `toml:"-"`
-	IPHashSaltPath string
+func (o *OutputCSVConfig) GetPath() string {
+	return o.Path
 }
 
-func (o *FlatConfig) GetIPv4Mask() net.IPMask {
-	if o.ipv4Mask == nil {
-		if o.IPv4Mask == 0 {
-			o.IPv4Mask = 24
-		}
-		o.ipv4Mask = net.CIDRMask(int(o.IPv4Mask), 32)
+func (o *OutputCSVConfig) GetColumns() []string {
+	if len(o.Columns) == 0 {
+		return DefaultCSVColumns
 	}
-	return o.ipv4Mask
+	return o.Columns
 }
 
-func (o *FlatConfig) GetIPv6Mask() net.IPMask {
-	if o.ipv6Mask == nil {
-		if o.IPv6Mask == 0 {
-			o.IPv6Mask = 48
-		}
-		o.ipv6Mask = net.CIDRMask(int(o.IPv6Mask), 128)
+func (o *OutputCSVConfig) Validate() *ValidationError {
+	valerr := NewValidationError()
+	if err := o.Flat.Validate(); err != nil {
+		valerr.Add(err)
 	}
-	return o.ipv6Mask
+	return valerr.Err()
 }
 
-func (o *FlatConfig) GetEnableEcs() bool {
-	return o.EnableECS
+type OutputJSONConfig struct {
+	// Dir is the directory of NDJSON files named Prefix + YYYYMMDDHH of the record timestamp in UTC + .ndjson.
+	Dir string
+	// Prefix is prefix of file names, default dns-.
+	Prefix string
+	// MaxOpenFiles is max number of open hour files, default 3.
+	MaxOpenFiles int
+	Flat         FlatConfig
+	Buffer       OutputBufferConfig
 }
 
-func (o *FlatConfig) GetEnableHashIP() bool {
-	return o.EnableHashIP
+func (o *OutputJSONConfig) GetPrefix() string {
+	if o.Prefix == "" {
+		return "dns-"
+	}
+	return o.Prefix
 }
 
-func (o *FlatConfig) GetIPHashSaltPath() string {
-	return o.IPHashSaltPath
+func (o *OutputJSONConfig) GetMaxOpenFiles() int {
+	if o.MaxOpenFiles <= 0 {
+		return 3
+	}
+	return o.MaxOpenFiles
 }
 
-func (o *FlatConfig) GetIPHashSalt() []byte {
-	if o.ipHashSalt == nil {
-		if o.GetIPHashSaltPath() != "" {
-			o.LoadSalt()
-		}
+func (o *OutputJSONConfig) Validate() *ValidationError {
+	valerr := NewValidationError()
+	if o.Dir == "" {
+		valerr.Add(errors.New("Dir must not be empty"))
 	}
-	if o.ipHashSalt == nil {
-		o.ipHashSalt = make([]byte, 32)
-		rand.Read(o.ipHashSalt)
+	if strings.ContainsRune(o.Prefix, filepath.Separator) {
+		valerr.Add(errors.New("Prefix must not contain a path separator"))
 	}
-	return o.ipHashSalt
+	if err := o.Flat.Validate(); err != nil {
+		valerr.Add(err)
+	}
+	return valerr.Err()
 }
 
-func (o *FlatConfig) LoadSalt() {
-	if o.GetIPHashSaltPath() != "" {
-		o.ipHashSalt, _ = ioutil.ReadFile(o.GetIPHashSaltPath())
-	}
+// EmitConfig is destination of aggregated records.
+// Empty Host writes JSON to stdout.
+type EmitConfig struct {
+	Host string
+	Port uint16
+	Tag  string
 }
 
-func (o *FlatConfig) WatchSalt(ctx context.Context) {
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		log.Fatal(err)
+func (o *EmitConfig) GetHost() string {
+	return o.Host
+}
+
+func (o *EmitConfig) GetPort() int {
+	if o.Port == 0 {
+		return 24224
 	}
-	defer watcher.Close()
-	err = watcher.Add(o.GetIPHashSaltPath())
-	if err != nil {
-		log.Fatal(err)
+	return int(o.Port)
+}
+
+func (o *EmitConfig) GetTag() string {
+	if o.Tag == "" {
+		return "dtap.summary"
+	}
+	return o.Tag
+}
+
+type OutputTopNConfig struct {
+	N int
+	// Window is sliding window seconds.
+	Window int
+	// Interval is emit interval seconds.
+	Interval int
+	// MaxKeys is max number of tracked qnames per interval.
+	MaxKeys int
+	Emit    EmitConfig
+	Flat    FlatConfig
+	Buffer  OutputBufferConfig
+}
+
+func (o *OutputTopNConfig) GetN() int {
+	if o.N <= 0 {
+		return 10
+	}
+	return o.N
+}
+
+func (o *OutputTopNConfig) GetWindow() int {
+	if o.Window <= 0 {
+		return 60
+	}
+	return o.Window
+}
+
+func (o *OutputTopNConfig) GetInterval() int {
+	if o.Interval <= 0 {
+		return 10
+	}
+	return o.Interval
+}
+
+func (o *OutputTopNConfig) GetMaxKeys() int {
+	if o.MaxKeys <= 0 {
+		return 100000
+	}
+	return o.MaxKeys
+}
+
+func (o *OutputTopNConfig) Validate() *ValidationError {
+	valerr := NewValidationError()
+	if o.GetWindow() < o.GetInterval() {
+		valerr.Add(errors.New("Window must not be smaller than Interval"))
+	}
+	if err := o.Flat.Validate(); err != nil {
+		valerr.Add(err)
+	}
+	return valerr.Err()
+}
+
+type OutputRcodeRatioConfig struct {
+	// Window is sliding window seconds, a multiple of Interval.
+	Window int
+	// Interval is emit interval seconds.
+	Interval int
+	// PerIdentity emits ratios per dnstap identity instead of globally.
+	PerIdentity bool
+	// MaxIdentities is max number of tracked identities per interval.
+	MaxIdentities int
+	Emit          EmitConfig
+	Flat          FlatConfig
+	Buffer        OutputBufferConfig
+}
+
+func (o *OutputRcodeRatioConfig) GetWindow() int {
+	if o.Window <= 0 {
+		return 60
+	}
+	return o.Window
+}
+
+func (o *OutputRcodeRatioConfig) GetInterval() int {
+	if o.Interval <= 0 {
+		return 10
+	}
+	return o.Interval
+}
+
+func (o *OutputRcodeRatioConfig) GetMaxIdentities() int {
+	if o.MaxIdentities <= 0 {
+		return 1000
+	}
+	return o.MaxIdentities
+}
+
+func (o *OutputRcodeRatioConfig) Validate() *ValidationError {
+	valerr := NewValidationError()
+	if o.GetWindow() < o.GetInterval() {
+		valerr.Add(errors.New("Window must not be smaller than Interval"))
+	} else if o.GetWindow()%o.GetInterval() != 0 {
+		valerr.Add(errors.New("Window must be a multiple of Interval"))
+	}
+	if err := o.Flat.Validate(); err != nil {
+		valerr.Add(err)
+	}
+	return valerr.Err()
+}
+
+type OutputIdentitySummaryConfig struct {
+	// Window is sliding window seconds, a multiple of Interval, default 60.
+	Window int
+	// Interval is emit interval seconds, default 10.
+	Interval int
+	// MaxIdentities is max number of tracked identities per interval, default 1000.
+	MaxIdentities int
+	// TopQtypes is number of qtypes in snapshots, default 5.
+	TopQtypes int
+	// MaxQtypes is max number of tracked qtypes per identity and interval, default 64.
+	MaxQtypes int
+	Emit      EmitConfig
+	Flat      FlatConfig
+	Buffer    OutputBufferConfig
+}
+
+func (o *OutputIdentitySummaryConfig) GetWindow() int {
+	if o.Window <= 0 {
+		return 60
+	}
+	return o.Window
+}
+
+func (o *OutputIdentitySummaryConfig) GetInterval() int {
+	if o.Interval <= 0 {
+		return 10
+	}
+	return o.Interval
+}
+
+func (o *OutputIdentitySummaryConfig) GetMaxIdentities() int {
+	if o.MaxIdentities <= 0 {
+		return 1000
+	}
+	return o.MaxIdentities
+}
+
+func (o *OutputIdentitySummaryConfig) GetTopQtypes() int {
+	if o.TopQtypes <= 0 {
+		return 5
+	}
+	return o.TopQtypes
+}
+
+func (o *OutputIdentitySummaryConfig) GetMaxQtypes() int {
+	if o.MaxQtypes <= 0 {
+		return 64
+	}
+	return o.MaxQtypes
+}
+
+func (o *OutputIdentitySummaryConfig) Validate() *ValidationError {
+	valerr := NewValidationError()
+	if o.GetWindow() < o.GetInterval() {
+		valerr.Add(errors.New("Window must not be smaller than Interval"))
+	} else if o.GetWindow()%o.GetInterval() != 0 {
+		valerr.Add(errors.New("Window must be a multiple of Interval"))
+	}
+	if err := o.Flat.Validate(); err != nil {
+		valerr.Add(err)
+	}
+	return valerr.Err()
+}
+
+type OutputOTLPConfig struct {
+	// Endpoint is OTLP logs endpoint url, default http://localhost:4318/v1/logs for http/protobuf
+	// and http://localhost:4317 for grpc.
+	Endpoint string
+	Headers  map[string]string `secret:"true"`
+	// Protocol is export protocol, "http/protobuf" (default) or "grpc".
+	Protocol    string
+	ServiceName string
+	// BatchSize is max number of records per export request.
+	BatchSize int
+	// FlushInterval is export interval seconds.
+	FlushInterval int
+	// Timeout is export request timeout seconds.
+	Timeout int
+	Flat    FlatConfig
+	Buffer  OutputBufferConfig
+}
+
+func (o *OutputOTLPConfig) GetEndpoint() string {
+	if o.Endpoint != "" {
+		return o.Endpoint
+	}
+	if o.GetProtocol() == "grpc" {
+		return "http://localhost:4317"
+	}
+	return "http://localhost:4318/v1/logs"
+}
+
+func (o *OutputOTLPConfig) GetProtocol() string {
+	if o.Protocol == "" {
+		return "http/protobuf"
+	}
+	return o.Protocol
+}
+
+func (o *OutputOTLPConfig) GetServiceName() string {
+	if o.ServiceName == "" {
+		return "dtap"
+	}
+	return o.ServiceName
+}
+
+func (o *OutputOTLPConfig) GetBatchSize() int {
+	if o.BatchSize <= 0 {
+		return 512
+	}
+	return o.BatchSize
+}
+
+func (o *OutputOTLPConfig) GetFlushInterval() int {
+	if o.FlushInterval <= 0 {
+		return 1
+	}
+	return o.FlushInterval
+}
+
+func (o *OutputOTLPConfig) GetTimeout() int {
+	if o.Timeout <= 0 {
+		return 10
+	}
+	return o.Timeout
+}
+
+func (o *OutputOTLPConfig) Validate() *ValidationError {
+	valerr := NewValidationError()
+	switch o.GetProtocol() {
+	case "http/protobuf", "grpc":
+	default:
+		valerr.Add(errors.New("Protocol must be http/protobuf or grpc"))
+	}
+	if _, err := url.Parse(o.GetEndpoint()); err != nil {
+		valerr.Add(errors.Wrap(err, "invalid Endpoint"))
+	}
+	if err := o.Flat.Validate(); err != nil {
+		valerr.Add(err)
+	}
+	return valerr.Err()
+}
+
+type OutputLokiConfig struct {
+	URL string
+	// Labels are static stream labels.
+	Labels map[string]string
+	// LabelFields are flat fields used as stream labels.
+	LabelFields []string
+	// Tenant is sent as X-Scope-OrgID header when not empty.
+	Tenant string
+	// BatchSize is max number of lines per push request.
+	BatchSize int
+	// FlushInterval is push interval seconds.
+	FlushInterval int
+	// Timeout is push request timeout seconds.
+	Timeout int
+	// MaxRetry is number of retries on 429 Too Many Requests.
+	MaxRetry int
+	Flat     FlatConfig
+	Buffer   OutputBufferConfig
+}
+
+type OutputPubSubConfig struct {
+	Project string
+	Topic   string
+	// OrderingKey is flat field used as message ordering key, e.g. sld.
+	OrderingKey string
+	// Endpoint is host:port of the gRPC API, default pubsub.googleapis.com:443.
+	// With PUBSUB_EMULATOR_HOST, the emulator is used without authentication.
+	Endpoint string
+	// CredentialsFile is service account key or gcloud credentials,
+	// default is application default credentials.
+	CredentialsFile string
+	// BatchSize is max number of messages per publish request, up to 1000.
+	BatchSize int
+	// FlushInterval is publish interval seconds.
+	FlushInterval int
+	// Timeout is publish timeout seconds, including retries.
+	Timeout int
+	Flat    FlatConfig
+	Buffer  OutputBufferConfig
+}
+
+func (o *OutputPubSubConfig) GetBatchSize() int {
+	if o.BatchSize <= 0 {
+		return 100
+	}
+	return o.BatchSize
+}
+
+func (o *OutputPubSubConfig) GetFlushInterval() int {
+	if o.FlushInterval <= 0 {
+		return 1
+	}
+	return o.FlushInterval
+}
+
+func (o *OutputPubSubConfig) GetTimeout() int {
+	if o.Timeout <= 0 {
+		return 10
+	}
+	return o.Timeout
+}
+
+func (o *OutputPubSubConfig) Validate() *ValidationError {
+	valerr := NewValidationError()
+	if o.Project == "" {
+		valerr.Add(errors.New("Project must not be empty"))
+	}
+	if o.Topic == "" {
+		valerr.Add(errors.New("Topic must not be empty"))
+	}
+	if o.BatchSize > 1000 {
+		valerr.Add(errors.New("BatchSize must be 1000 or less"))
+	}
+	if err := o.Flat.Validate(); err != nil {
+		valerr.Add(err)
+	}
+	return valerr.Err()
+}
+
+type OutputPulsarConfig struct {
+	// ServiceURL is service URL of brokers, default pulsar://localhost:6650.
+	ServiceURL string
+	// Topic is persistent://tenant/namespace/topic, or tenant/namespace/topic as persistent.
+	Topic string
+	// Token is JWT of token authentication.
+	Token string `secret:"true"`
+	// KeyField is flat field used as message key for partitioned topics, default sld.
+	KeyField string
+	// BatchSize is max number of messages per batch.
+	BatchSize int
+	// FlushInterval is publish interval seconds.
+	FlushInterval int
+	// Timeout is operation and publish timeout seconds.
+	Timeout int
+	Flat    FlatConfig
+	Buffer  OutputBufferConfig
+}
+
+func (o *OutputPulsarConfig) GetServiceURL() string {
+	if o.ServiceURL == "" {
+		return "pulsar://localhost:6650"
+	}
+	return o.ServiceURL
+}
+
+// validateTopic checks Topic is domain://tenant/namespace/topic or tenant/namespace/topic.
+func (o *OutputPulsarConfig) validateTopic() error {
+	domain, path := "persistent", o.Topic
+	if n := strings.Index(o.Topic, "://"); n >= 0 {
+		domain, path = o.Topic[:n], o.Topic[n+3:]
+	}
+	if domain != "persistent" && domain != "non-persistent" {
+		return errors.Errorf("Topic has unknown domain %s", domain)
+	}
+	parts := strings.Split(path, "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return errors.New("Topic must be tenant/namespace/topic")
+	}
+	return nil
+}
+
+func (o *OutputPulsarConfig) GetKeyField() string {
+	if o.KeyField == "" {
+		return "sld"
+	}
+	return o.KeyField
+}
+
+func (o *OutputPulsarConfig) GetBatchSize() int {
+	if o.BatchSize <= 0 {
+		return 100
+	}
+	return o.BatchSize
+}
+
+func (o *OutputPulsarConfig) GetFlushInterval() int {
+	if o.FlushInterval <= 0 {
+		return 1
+	}
+	return o.FlushInterval
+}
+
+func (o *OutputPulsarConfig) GetTimeout() int {
+	if o.Timeout <= 0 {
+		return 10
+	}
+	return o.Timeout
+}
+
+func (o *OutputPulsarConfig) Validate() *ValidationError {
+	valerr := NewValidationError()
+	if o.Topic == "" {
+		valerr.Add(errors.New("Topic must not be empty"))
+	} else if err := o.validateTopic(); err != nil {
+		valerr.Add(err)
+	}
+	if err := o.Flat.Validate(); err != nil {
+		valerr.Add(err)
+	}
+	return valerr.Err()
+}
+
+type OutputEventHubConfig struct {
+	// ConnectionString is Endpoint=sb://<namespace>.servicebus.windows.net/;SharedAccessKeyName=..;SharedAccessKey=..;EntityPath=<hub>.
+	// It is used instead of Namespace, Hub, SharedAccessKeyName and SharedAccessKey.
+	ConnectionString string `secret:"true"`
+	// Namespace is the Event Hubs namespace, or a full endpoint URL.
+	Namespace           string
+	Hub                 string
+	SharedAccessKeyName string
+	SharedAccessKey     string `secret:"true"`
+	// PartitionKeyField is flat field used as partition key, default sld.
+	PartitionKeyField string
+	// BatchSize is max number of events per send interval.
+	BatchSize int
+	// MaxBatchBytes is max bytes of an event batch, default 1MiB, the limit of Standard tier.
+	MaxBatchBytes int
+	// FlushInterval is send interval seconds.
+	FlushInterval int
+	// Timeout is send timeout seconds.
+	Timeout int
+	Flat    FlatConfig
+	Buffer  OutputBufferConfig
+}
+
+// eventHubSettings returns endpoint, hub, key name and key of the connection string or settings.
+func (o *OutputEventHubConfig) eventHubSettings() (endpoint, hub, keyName, key string) {
+	endpoint, hub, keyName, key = o.Namespace, o.Hub, o.SharedAccessKeyName, o.SharedAccessKey
+	if o.ConnectionString != "" {
+		for _, part := range strings.Split(o.ConnectionString, ";") {
+			kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			switch strings.ToLower(kv[0]) {
+			case "endpoint":
+				endpoint = kv[1]
+			case "entitypath":
+				hub = kv[1]
+			case "sharedaccesskeyname":
+				keyName = kv[1]
+			case "sharedaccesskey":
+				key = kv[1]
+			}
+		}
+	}
+	if endpoint != "" && !strings.Contains(endpoint, "://") {
+		endpoint = "sb://" + endpoint + ".servicebus.windows.net/"
+	}
+	return endpoint, hub, keyName, key
+}
+
+// GetConnectionString returns ConnectionString with EntityPath of Hub,
+// or the connection string of Namespace, Hub, SharedAccessKeyName and SharedAccessKey.
+func (o *OutputEventHubConfig) GetConnectionString() string {
+	endpoint, hub, keyName, key := o.eventHubSettings()
+	if o.ConnectionString != "" {
+		if !strings.Contains(strings.ToLower(o.ConnectionString), "entitypath=") && hub != "" {
+			return strings.TrimSuffix(o.ConnectionString, ";") + ";EntityPath=" + hub
+		}
+		return o.ConnectionString
+	}
+	if u, err := url.Parse(endpoint); err == nil && u.Scheme != "sb" {
+		u.Scheme = "sb"
+		endpoint = u.String()
+	}
+	return fmt.Sprintf("Endpoint=%s;SharedAccessKeyName=%s;SharedAccessKey=%s;EntityPath=%s", endpoint, keyName, key, hub)
+}
+
+func (o *OutputEventHubConfig) GetPartitionKeyField() string {
+	if o.PartitionKeyField == "" {
+		return "sld"
+	}
+	return o.PartitionKeyField
+}
+
+func (o *OutputEventHubConfig) GetBatchSize() int {
+	if o.BatchSize <= 0 {
+		return 100
+	}
+	return o.BatchSize
+}
+
+func (o *OutputEventHubConfig) GetMaxBatchBytes() int {
+	if o.MaxBatchBytes <= 0 {
+		return 1 << 20
+	}
+	return o.MaxBatchBytes
+}
+
+func (o *OutputEventHubConfig) GetFlushInterval() int {
+	if o.FlushInterval <= 0 {
+		return 1
+	}
+	return o.FlushInterval
+}
+
+func (o *OutputEventHubConfig) GetTimeout() int {
+	if o.Timeout <= 0 {
+		return 10
+	}
+	return o.Timeout
+}
+
+func (o *OutputEventHubConfig) Validate() *ValidationError {
+	valerr := NewValidationError()
+	endpoint, hub, keyName, key := o.eventHubSettings()
+	if endpoint == "" || hub == "" {
+		valerr.Add(errors.New("ConnectionString with EntityPath, or Namespace and Hub must not be empty"))
+	} else if _, err := url.Parse(endpoint); err != nil {
+		valerr.Add(errors.Wrap(err, "invalid endpoint"))
+	}
+	if keyName == "" || key == "" {
+		valerr.Add(errors.New("SharedAccessKeyName and SharedAccessKey must not be empty"))
+	}
+	if err := o.Flat.Validate(); err != nil {
+		valerr.Add(err)
+	}
+	return valerr.Err()
+}
+
+type OutputLoopbackConfig struct {
+	// Size is max number of kept records, default 1000.
+	Size int
+	// Listen is address of the HTTP server of the records, empty is disabled.
+	Listen string
+	Flat   FlatConfig
+	Buffer OutputBufferConfig
+}
+
+func (o *OutputLoopbackConfig) GetSize() int {
+	if o.Size <= 0 {
+		return 1000
+	}
+	return o.Size
+}
+
+func (o *OutputLoopbackConfig) Validate() *ValidationError {
+	valerr := NewValidationError()
+	if o.Listen != "" {
+		if _, _, err := net.SplitHostPort(o.Listen); err != nil {
+			valerr.Add(errors.Wrap(err, "invalid Listen"))
+		}
+	}
+	if err := o.Flat.Validate(); err != nil {
+		valerr.Add(err)
+	}
+	return valerr.Err()
+}
+
+type OutputQueryAPIConfig struct {
+	// Listen is address of the HTTP API, default 127.0.0.1:9522.
+	Listen string
+	// Size is max number of kept records, default 100000.
+	Size int
+	// Retention is seconds to keep records, default 300.
+	Retention uint
+	// Limit is max number of records of a response, default 1000.
+	Limit  int
+	Flat   FlatConfig
+	Buffer OutputBufferConfig
+}
+
+func (o *OutputQueryAPIConfig) GetListen() string {
+	if o.Listen == "" {
+		return "127.0.0.1:9522"
+	}
+	return o.Listen
+}
+
+func (o *OutputQueryAPIConfig) GetSize() int {
+	if o.Size <= 0 {
+		return 100000
+	}
+	return o.Size
+}
+
+func (o *OutputQueryAPIConfig) GetRetention() time.Duration {
+	if o.Retention == 0 {
+		return 300 * time.Second
+	}
+	return time.Duration(o.Retention) * time.Second
+}
+
+func (o *OutputQueryAPIConfig) GetLimit() int {
+	if o.Limit <= 0 {
+		return 1000
+	}
+	return o.Limit
+}
+
+func (o *OutputQueryAPIConfig) Validate() *ValidationError {
+	valerr := NewValidationError()
+	if _, _, err := net.SplitHostPort(o.GetListen()); err != nil {
+		valerr.Add(errors.Wrap(err, "invalid Listen"))
+	}
+	if err := o.Flat.Validate(); err != nil {
+		valerr.Add(err)
+	}
+	return valerr.Err()
+}
+
+type OutputSSEConfig struct {
+	// Listen is address of the SSE endpoint /events, default 127.0.0.1:9523.
+	Listen string
+	// ClientBuffer is max number of records buffered per client, default 1000.
+	ClientBuffer int
+	// MaxClients is max number of connected clients, default 100.
+	MaxClients int
+	Flat       FlatConfig
+	Buffer     OutputBufferConfig
+}
+
+func (o *OutputSSEConfig) GetListen() string {
+	if o.Listen == "" {
+		return "127.0.0.1:9523"
+	}
+	return o.Listen
+}
+
+func (o *OutputSSEConfig) GetClientBuffer() int {
+	if o.ClientBuffer <= 0 {
+		return 1000
+	}
+	return o.ClientBuffer
+}
+
+func (o *OutputSSEConfig) GetMaxClients() int {
+	if o.MaxClients <= 0 {
+		return 100
+	}
+	return o.MaxClients
+}
+
+func (o *OutputSSEConfig) Validate() *ValidationError {
+	valerr := NewValidationError()
+	if _, _, err := net.SplitHostPort(o.GetListen()); err != nil {
+		valerr.Add(errors.Wrap(err, "invalid Listen"))
+	}
+	if err := o.Flat.Validate(); err != nil {
+		valerr.Add(err)
+	}
+	return valerr.Err()
+}
+
+type OutputGRPCConfig struct {
+	// Endpoint is host:port of the gRPC server.
+	Endpoint string
+	// Method is the full method name of the client-streaming RPC, default /dtap.RecordService/Send.
+	Method string
+	// TLS enables TLS, otherwise plaintext.
+	TLS                   bool
+	TLSCA                 string
+	TLSCert               string
+	TLSKey                string
+	TLSInsecureSkipVerify bool
+	// Metadata is sent as request metadata of streams, e.g. authorization.
+	Metadata map[string]string `secret:"true"`
+	// BatchSize is max number of records per write to the stream, default 512.
+	BatchSize int
+	// FlushInterval is write interval seconds, default 1.
+	FlushInterval int
+	// StreamMaxRecords ends the stream for the server status after the number of records, default 100000.
+	StreamMaxRecords int
+	// StreamMaxAge ends the stream after seconds, default 60.
+	StreamMaxAge int
+	// DialTimeout is connect timeout seconds, default 10.
+	DialTimeout int
+	// SendTimeout is timeout seconds to send a batch to the stream, default 10.
+	SendTimeout int
+	Flat        FlatConfig
+	Buffer      OutputBufferConfig
+}
+
+func (o *OutputGRPCConfig) GetMethod() string {
+	if o.Method == "" {
+		return "/dtap.RecordService/Send"
+	}
+	return o.Method
+}
+
+func (o *OutputGRPCConfig) GetBatchSize() int {
+	if o.BatchSize <= 0 {
+		return 512
+	}
+	return o.BatchSize
+}
+
+func (o *OutputGRPCConfig) GetFlushInterval() int {
+	if o.FlushInterval <= 0 {
+		return 1
+	}
+	return o.FlushInterval
+}
+
+func (o *OutputGRPCConfig) GetStreamMaxRecords() int {
+	if o.StreamMaxRecords <= 0 {
+		return 100000
+	}
+	return o.StreamMaxRecords
+}
+
+func (o *OutputGRPCConfig) GetStreamMaxAge() int {
+	if o.StreamMaxAge <= 0 {
+		return 60
+	}
+	return o.StreamMaxAge
+}
+
+func (o *OutputGRPCConfig) GetDialTimeout() int {
+	if o.DialTimeout <= 0 {
+		return 10
+	}
+	return o.DialTimeout
+}
+
+func (o *OutputGRPCConfig) GetSendTimeout() int {
+	if o.SendTimeout <= 0 {
+		return 10
+	}
+	return o.SendTimeout
+}
+
+func (o *OutputGRPCConfig) Validate() *ValidationError {
+	valerr := NewValidationError()
+	if _, _, err := net.SplitHostPort(o.Endpoint); err != nil {
+		valerr.Add(errors.Wrap(err, "invalid Endpoint"))
+	}
+	if !strings.HasPrefix(o.GetMethod(), "/") {
+		valerr.Add(errors.New("Method must start with /"))
+	}
+	if (o.TLSCert == "") != (o.TLSKey == "") {
+		valerr.Add(errors.New("TLSCert and TLSKey must be set together"))
+	}
+	if err := o.Flat.Validate(); err != nil {
+		valerr.Add(err)
+	}
+	return valerr.Err()
+}
+
+type OutputS3Config struct {
+	// Endpoint is URL of the S3 compatible service, default is the Amazon S3 endpoint of Region.
+	Endpoint string
+	// Region is the signing region, default us-east-1.
+	Region string
+	Bucket string
+	// VirtualHost puts Bucket in the host name of Endpoint, otherwise in the path (path-style, e.g. MinIO).
+	VirtualHost bool
+	// Prefix is prefix of object keys with strftime format of the object creation time in UTC and {identity},
+	// default dnstap/%Y/%m/%d/%H/.
+	Prefix string
+	// AccessKeyID, SecretAccessKey and SessionToken are static credentials,
+	// default is the credential chain of the AWS SDK, e.g. environment variables, shared config and instance roles.
+	AccessKeyID     string
+	SecretAccessKey string `secret:"true"`
+	SessionToken    string `secret:"true"`
+	// PartSize is bytes of multipart upload parts, default 8MiB, at least 5MiB.
+	PartSize int
+	// ObjectSize completes the object after bytes, default 128MiB.
+	ObjectSize int
+	// ObjectMaxAge completes the object after seconds, default 300.
+	ObjectMaxAge int
+	// MaxRetry is number of retries of requests by the SDK, default 3.
+	MaxRetry int
+	// Timeout is request timeout seconds, default 60.
+	Timeout int
+	Flat    FlatConfig
+	Buffer  OutputBufferConfig
+}
+
+// S3MinPartSize is min bytes of multipart upload parts except the last one.
+const S3MinPartSize = 5 * 1024 * 1024
+
+func (o *OutputS3Config) GetRegion() string {
+	if o.Region == "" {
+		return "us-east-1"
+	}
+	return o.Region
+}
+
+func (o *OutputS3Config) GetPrefix() string {
+	if o.Prefix == "" {
+		return "dnstap/%Y/%m/%d/%H/"
+	}
+	return o.Prefix
+}
+
+func (o *OutputS3Config) GetPartSize() int {
+	if o.PartSize <= 0 {
+		return 8 * 1024 * 1024
+	}
+	return o.PartSize
+}
+
+func (o *OutputS3Config) GetObjectSize() int {
+	if o.ObjectSize <= 0 {
+		return 128 * 1024 * 1024
+	}
+	return o.ObjectSize
+}
+
+func (o *OutputS3Config) GetObjectMaxAge() int {
+	if o.ObjectMaxAge <= 0 {
+		return 300
+	}
+	return o.ObjectMaxAge
+}
+
+func (o *OutputS3Config) GetMaxRetry() int {
+	if o.MaxRetry <= 0 {
+		return 3
+	}
+	return o.MaxRetry
+}
+
+func (o *OutputS3Config) GetTimeout() int {
+	if o.Timeout <= 0 {
+		return 60
+	}
+	return o.Timeout
+}
+
+func (o *OutputS3Config) Validate() *ValidationError {
+	valerr := NewValidationError()
+	if o.Bucket == "" {
+		valerr.Add(errors.New("Bucket must not be empty"))
+	}
+	if o.Endpoint != "" {
+		if u, err := url.Parse(o.Endpoint); err != nil || u.Host == "" {
+			valerr.Add(errors.Errorf("invalid Endpoint %s", o.Endpoint))
+		}
+	}
+	if (o.AccessKeyID == "") != (o.SecretAccessKey == "") {
+		valerr.Add(errors.New("AccessKeyID and SecretAccessKey must be set together"))
+	}
+	if o.GetPartSize() < S3MinPartSize {
+		valerr.Add(errors.New("PartSize must not small 5MiB"))
+	}
+	if err := o.Flat.Validate(); err != nil {
+		valerr.Add(err)
+	}
+	return valerr.Err()
+}
+
+type OutputStatsDConfig struct {
+	// Address is UDP address of the StatsD server, default 127.0.0.1:8125.
+	Address string
+	// Prefix is prefix of metric names, default dns.
+	Prefix string
+	// Format is dogstatsd (tags as |#key:value, default) or statsd (tag values in the metric name).
+	Format string
+	// Tags are flat fields used as tags, default qtype, rcode and identity.
+	Tags []string
+	// ConstantTags are static tags of all metrics.
+	ConstantTags map[string]string
+	// MaxSeries is max number of tag sets per flush, others are sent with tag values "other". default 1000.
+	MaxSeries int
+	// FlushInterval is send interval seconds.
+	FlushInterval int
+	Flat          FlatConfig
+	Buffer        OutputBufferConfig
+}
+
+var DefaultStatsDTags = []string{"qtype", "rcode", "identity"}
+
+func (o *OutputStatsDConfig) GetAddress() string {
+	if o.Address == "" {
+		return "127.0.0.1:8125"
+	}
+	return o.Address
+}
+
+func (o *OutputStatsDConfig) GetPrefix() string {
+	if o.Prefix == "" {
+		return "dns"
+	}
+	return o.Prefix
+}
+
+func (o *OutputStatsDConfig) GetFormat() string {
+	if o.Format == "" {
+		return "dogstatsd"
+	}
+	return o.Format
+}
+
+func (o *OutputStatsDConfig) GetTags() []string {
+	if len(o.Tags) == 0 {
+		return DefaultStatsDTags
+	}
+	return o.Tags
+}
+
+func (o *OutputStatsDConfig) GetMaxSeries() int {
+	if o.MaxSeries <= 0 {
+		return 1000
+	}
+	return o.MaxSeries
+}
+
+func (o *OutputStatsDConfig) GetFlushInterval() int {
+	if o.FlushInterval <= 0 {
+		return 1
+	}
+	return o.FlushInterval
+}
+
+func (o *OutputStatsDConfig) Validate() *ValidationError {
+	valerr := NewValidationError()
+	if f := o.GetFormat(); f != "dogstatsd" && f != "statsd" {
+		valerr.Add(errors.Errorf("Format must be dogstatsd or statsd, got %s", f))
+	}
+	if err := o.Flat.Validate(); err != nil {
+		valerr.Add(err)
+	}
+	return valerr.Err()
+}
+
+var DefaultLokiLabelFields = []string{"type", "identity"}
+
+func (o *OutputLokiConfig) GetURL() string {
+	if o.URL == "" {
+		return "http://localhost:3100/loki/api/v1/push"
+	}
+	return o.URL
+}
+
+func (o *OutputLokiConfig) GetLabelFields() []string {
+	if len(o.LabelFields) == 0 {
+		return DefaultLokiLabelFields
+	}
+	return o.LabelFields
+}
+
+func (o *OutputLokiConfig) GetBatchSize() int {
+	if o.BatchSize <= 0 {
+		return 1000
+	}
+	return o.BatchSize
+}
+
+func (o *OutputLokiConfig) GetFlushInterval() int {
+	if o.FlushInterval <= 0 {
+		return 1
+	}
+	return o.FlushInterval
+}
+
+func (o *OutputLokiConfig) GetTimeout() int {
+	if o.Timeout <= 0 {
+		return 10
+	}
+	return o.Timeout
+}
+
+func (o *OutputLokiConfig) GetMaxRetry() int {
+	if o.MaxRetry <= 0 {
+		return 5
+	}
+	return o.MaxRetry
+}
+
+func (o *OutputLokiConfig) Validate() *ValidationError {
+	valerr := NewValidationError()
+	r := regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	for k := range o.Labels {
+		if !r.MatchString(k) {
+			valerr.Add(errors.Errorf("invalid label name %s", k))
+		}
+	}
+	for _, k := range o.LabelFields {
+		if !r.MatchString(k) {
+			valerr.Add(errors.Errorf("invalid label field %s", k))
+		}
+	}
+	if err := o.Flat.Validate(); err != nil {
+		valerr.Add(err)
+	}
+	return valerr.Err()
+}
+
+type OutputBufferConfig struct {
+	BufferSize uint
+	// SampleRate is ratio of frames sent to this output (0 < rate <= 1).
+	// Unset means all frames.
+	SampleRate float64
+	// DiskBufferDir buffers frames in segment files of the directory instead of memory,
+	// unsent frames are replayed after restart.
+	DiskBufferDir string
+	// DiskBufferMaxSize is max MiB of the disk buffer, default 1024.
+	DiskBufferMaxSize int64
+	// Stream names the stream of the output, frames are counted by stream.
+	Stream string
+	// Full marks the stream as the full stream, it receives all frames and SampleRate must not be set.
+	// Frames are never dropped for a full buffer: the output waits for room of the memory buffer,
+	// or buffers them on disk with DiskBufferDir.
+	Full bool
+	// DedupExactWindow is seconds to drop byte-identical frames, e.g. of double taps. 0 is disabled.
+	DedupExactWindow uint
+	// DedupExactSize is max number of frame hashes held for DedupExactWindow, default 100000.
+	DedupExactSize int
+}
+
+func (o *OutputBufferConfig) GetDedupExactWindow() time.Duration {
+	return time.Duration(o.DedupExactWindow) * time.Second
+}
+
+func (o *OutputBufferConfig) GetDiskBufferMaxSize() int64 {
+	if o.DiskBufferMaxSize <= 0 {
+		return DefaultDiskBufferMaxSize
+	}
+	return o.DiskBufferMaxSize << 20
+}
+
+func (o *OutputBufferConfig) GetSampleRate() float64 {
+	if o.SampleRate <= 0 {
+		return 1
+	}
+	return o.SampleRate
+}
+
+func (o *OutputBufferConfig) GetBufferSize() uint {
+	if o.BufferSize == 0 {
+		return OutputBufferSize
+	}
+	return o.BufferSize
+}
+
+type FlatConfig struct {
+	IPv4Mask       uint8
+	ipv4Mask       net.IPMask
+	IPv6Mask       uint8
+	ipv6Mask       net.IPMask
+	EnableECS      bool
+	EnableHashIP   bool
+	ipHashSalt     []byte `toml:"-"`
+	IPHashSaltPath string
+	// CanonicalEndpoints adds src and dst address and port by direction of the message.
+	CanonicalEndpoints bool
+	// IncludeMessageTypeShort adds is_response and message_type_short, a two letter code of the message type.
+	IncludeMessageTypeShort bool
+	// AnonymizeHash is the hash algorithm of EnableHashIP, sha256 (default), sha1, blake2b or siphash.
+	AnonymizeHash string
+	addressHasher AddressHasher
+	// PrefixPreservingAnonymization pseudonymizes addresses by Crypto-PAn instead of masking.
+	PrefixPreservingAnonymization bool
+	// AnonymizationKeyPath is the file of the 32 bytes key, raw or hex.
+	AnonymizationKeyPath string
+	anonymizer           *IPAnonymizer
+	// IncludeWireDebug adds dns_id and flags_hex for pcap correlation.
+	IncludeWireDebug bool
+	// IncludeReceivedAt adds received_at, the time the input decoded the frame.
+	IncludeReceivedAt bool
+	// IncludeCollector adds collector, CollectorID.
+	IncludeCollector bool
+	// CollectorID is collector of IncludeCollector, default is CollectorID of the config or the hostname.
+	CollectorID string
+	// TypeNames maps dnstap message type names like CLIENT_QUERY to names of type.
+	// Unmapped types use the default name.
+	TypeNames map[string]string
+	// IncludeTransportAddress adds transport_client_address and transport_client_port,
+	// the peer of the TCP or HTTP input connection, masked like query_address.
+	IncludeTransportAddress bool
+	// IncludeSocketCodes adds socket_family_code and socket_protocol_code, the dnstap enum values.
+	IncludeSocketCodes bool
+	// ExtraParser parses extra into extra_parsed, "json", "kv" or "none" (default).
+	ExtraParser string
+	// ParseMode is "strict" (default), "lenient" keeping sections parsed before an error,
+	// or "header_only" parsing only the header and questions.
+	ParseMode string
+	// PartialParse falls back to the header and questions when a message fails to parse in strict or lenient mode,
+	// and adds parse_partial.
+	PartialParse bool
+	// RecoverTruncatedCapture keeps records before the end of messages cut at a capture length
+	// in strict or lenient mode, and adds capture_truncated.
+	RecoverTruncatedCapture bool
+	// IncludeEpoch adds timestamp_epoch, the timestamp as a number.
+	IncludeEpoch bool
+	// IncludeSequence adds seq, a sequence number of records of the output, and seq_epoch, the start time of it.
+	IncludeSequence bool
+	sequence        *Sequence
+	// EpochUnit is unit of timestamp_epoch, "s" float seconds (default) or "ns" integer nanoseconds.
+	EpochUnit string
+	// NumbersAsStrings emits ports, sizes and codes as strings
+	// for consumers that can't handle typed numbers.
+	NumbersAsStrings bool
+	// KeyCase is snake (default) or camel, the case of record keys of JSON based encoders.
+	KeyCase string
+	// HijackRules flags responses answering addresses out of expected CIDRs.
+	HijackRules []*HijackRule
+	// ExplodeQuestions makes a record per question for multi question messages.
+	ExplodeQuestions bool
+	// LegacyLabels uses old tld/sld/thirdld/fourthld extraction and doesn't set subdomain.
+	LegacyLabels bool
+	// ClassifyTLD adds tld_class, gtld, cctld, new_gtld, special or unknown by the bundled TLD table.
+	ClassifyTLD bool
+	// IncludeReversedQname adds qname_reversed, labels of qname in reverse order for suffix scans.
+	IncludeReversedQname bool
+	// DecodeIDN adds qname_unicode, the IDNA2008 Unicode form of qname.
+	DecodeIDN bool
+	// IdempotencyKey adds doc_id, a deterministic record id for deduplication.
+	IdempotencyKey bool
+	// EnableSVCB parses SVCB/HTTPS answers into svcb.
+	EnableSVCB bool
+	// AlwaysIncludeTXT adds full TXT answers into txt_records.
+	AlwaysIncludeTXT bool
+	// ParseBoth uses response message for header and answers and query message for question
+	// when response type message has both.
+	ParseBoth bool
+	// SplitCombined emits a query record and a response record
+	// from response type message has both.
+	SplitCombined bool
+	// EnableNSID adds nsid from the OPT record.
+	EnableNSID bool
+	// EnableKeepalive adds edns_keepalive and edns_expire from the OPT record.
+	EnableKeepalive bool
+	// EnableExtendedRcode adds edns_version and extended_rcode from the OPT record.
+	EnableExtendedRcode bool
+	// DropZoneTransfers drops AXFR/IXFR records.
+	DropZoneTransfers bool
+	// TagZoneTransfers keeps AXFR/IXFR records with zone_transfer instead of dropping.
+	TagZoneTransfers bool
+	// Rcodes keeps only responses of the rcode names, empty keeps all.
+	Rcodes []string
+	// RcodeFilterQueries drops queries too when Rcodes is set.
+	RcodeFilterQueries bool
+	// QtypeSampleRates keeps records by the sample rate of the qtype name, 0 to 1,
+	// the "*" key is the rate of unlisted qtypes, default 1.
+	QtypeSampleRates map[string]float64
+	qtypeSampler     *QtypeSampler
+	// PerQnameLimit is max number of records per qname in PerQnameWindow, 0 is unlimited.
+	PerQnameLimit int
+	// PerQnameWindow is seconds of the PerQnameLimit window, default 60.
+	PerQnameWindow uint
+	qnameLimiter   *QnameLimiter
+	// CollapseIdenticalWithin is seconds to collapse records of identical type, qname, qtype
+	// and query address after the first one into a summary record with occurrences, 0 is disabled.
+	CollapseIdenticalWithin uint
+	// CollapseSize is the max number of collapse windows, default 100000.
+	CollapseSize int
+	collapser    *Collapser
+	// AssembleZoneTransfers emits a summary record per AXFR/IXFR transfer instead of records of its responses.
+	AssembleZoneTransfers bool
+	// ZoneTransferTimeout is seconds to wait for the next message of a transfer, default 30.
+	ZoneTransferTimeout uint
+	// ZoneTransferSize is the max number of transfers assembled at once, default 1000.
+	ZoneTransferSize  int
+	transferAssembler *TransferAssembler
+	// MaxFieldLength is max bytes of a string value, longer values are cut
+	// and listed in truncated_fields. 0 is unlimited.
+	MaxFieldLength int
+	// ReverseDNS adds query_ptr, best-effort PTR name of the unmasked query address.
+	// It is empty until the background lookup is cached.
+	ReverseDNS bool
+	// ReverseDNSCacheSize is the max number of cached names, default 10000.
+	ReverseDNSCacheSize int
+	// ReverseDNSTTL is the cache ttl seconds, default 3600.
+	ReverseDNSTTL uint
+	reverseDNS    *ReverseDNS
+	// Correlate emits a record combining a query and the matched response.
+	Correlate bool
+	// CorrelateTimeout is seconds to hold queries, default 5.
+	CorrelateTimeout uint
+	// CorrelateSize is the max number of held queries, default 100000.
+	CorrelateSize int
+	correlator    *Correlator
+	// UseECSForClient sets client_address from the ECS subnet when present,
+	// otherwise the query address. Both are masked by IPv4Mask/IPv6Mask.
+	UseECSForClient bool
+	// EnableEDNSOptions adds edns_options, codes and names of options in the OPT record.
+	EnableEDNSOptions bool
+	// IncludeDNSCookie adds client_cookie and server_cookie of the OPT record as hex.
+	IncludeDNSCookie bool
+	// DecodePTR adds ptr_target, masked address of in-addr.arpa and ip6.arpa qnames.
+	DecodePTR bool
+	// IncludeAllSections adds records, resource records of answer, authority
+	// and additional sections except OPT.
+	IncludeAllSections bool
+	// MaxAnswers is max number of records across sections. 0 is unlimited.
+	MaxAnswers int
+	// SubdomainEntropy adds subdomain_entropy, Shannon entropy of the leftmost label
+	// of qnames with a subdomain, and random_subdomain_suspected above RandomSubdomainThreshold.
+	SubdomainEntropy bool
+	// RandomSubdomainThreshold is entropy bits of random_subdomain_suspected, default 3.5.
+	RandomSubdomainThreshold float64
+	// BlocklistFile adds blocklisted and blocklist_match of qnames matching the domains
+	// or /regexp/ patterns of the file, reloaded on SIGHUP.
+	BlocklistFile string
+	blocklist     *Blocklist
+	// Filter drops records when the expression is not true.
+	Filter string
+	// FilterDryRun keeps records filters would drop, with would_drop and would_drop_reason.
+	FilterDryRun bool
+	// Set adds derived fields by name. See Expr for the expression syntax.
+	Set       map[string]string
+	transform *Transform
+	// IncludeCorrelationID adds correlation_id, the same for a query and its response.
+	IncludeCorrelationID bool
+	// AnswerStats adds answer_ip_count and large_response to responses for amplification monitoring.
+	AnswerStats bool
+	// LargeResponseBytes is message size threshold of large_response, default 512.
+	LargeResponseBytes int
+	now                func() time.Time
+}
+
+// HijackRule maps a qname pattern to the expected answer CIDRs.
+// Qname is an exact name, or "*.example.com" for any subdomain.
+type HijackRule struct {
+	Qname string
+	CIDRs []string
+	once  sync.Once
+	nets  []*net.IPNet
+}
+
+func (h *HijackRule) Match(qname string) bool {
+	pattern := dns.Fqdn(strings.ToLower(h.Qname))
+	qname = dns.Fqdn(strings.ToLower(qname))
+	if strings.HasPrefix(pattern, "*.") {
+		return strings.HasSuffix(qname, pattern[1:])
+	}
+	return qname == pattern
+}
+
+func (h *HijackRule) Contains(ip net.IP) bool {
+	h.once.Do(func() {
+		for _, cidr := range h.CIDRs {
+			if _, n, err := net.ParseCIDR(cidr); err == nil {
+				h.nets = append(h.nets, n)
+			}
+		}
+	})
+	for _, n := range h.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *HijackRule) Validate() error {
+	if h.Qname == "" {
+		return errors.New("HijackRules Qname must not be empty")
+	}
+	for _, cidr := range h.CIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return errors.Wrapf(err, "HijackRules invalid CIDR %s", cidr)
+		}
+	}
+	return nil
+}
+
+func (o *FlatConfig) GetIPv4Mask() net.IPMask {
+	if o.ipv4Mask == nil {
+		if o.IPv4Mask == 0 {
+			o.IPv4Mask = 24
+		}
+		o.ipv4Mask = net.CIDRMask(int(o.IPv4Mask), 32)
+	}
+	return o.ipv4Mask
+}
+
+func (o *FlatConfig) GetIPv6Mask() net.IPMask {
+	if o.ipv6Mask == nil {
+		if o.IPv6Mask == 0 {
+			o.IPv6Mask = 48
+		}
+		o.ipv6Mask = net.CIDRMask(int(o.IPv6Mask), 128)
+	}
+	return o.ipv6Mask
+}
+
+func (o *FlatConfig) GetEnableEcs() bool {
+	return o.EnableECS
+}
+
+func (o *FlatConfig) GetEnableHashIP() bool {
+	return o.EnableHashIP
+}
+
+func (o *FlatConfig) GetIncludeWireDebug() bool {
+	return o.IncludeWireDebug
+}
+
+func (o *FlatConfig) GetIncludeSocketCodes() bool {
+	return o.IncludeSocketCodes
+}
+
+// GetTypeName returns the name of type t by TypeNames.
+func (o *FlatConfig) GetTypeName(t string) string {
+	if name, ok := o.TypeNames[t]; ok {
+		return name
+	}
+	return t
+}
+
+func (o *FlatConfig) GetMaxFieldLength() int {
+	return o.MaxFieldLength
+}
+
+func (o *FlatConfig) GetIncludeTransportAddress() bool {
+	return o.IncludeTransportAddress
+}
+
+func (o *FlatConfig) GetIncludeReceivedAt() bool {
+	return o.IncludeReceivedAt
+}
+
+func (o *FlatConfig) GetIncludeCollector() bool {
+	return o.IncludeCollector
+}
+
+func (o *FlatConfig) GetCollectorID() string {
+	if o.CollectorID == "" {
+		return DefaultCollectorID
+	}
+	return o.CollectorID
+}
+
+func (o *FlatConfig) GetPartialParse() bool {
+	return o.PartialParse
+}
+
+func (o *FlatConfig) GetRecoverTruncatedCapture() bool {
+	return o.RecoverTruncatedCapture
+}
+
+func (o *FlatConfig) GetParseMode() string {
+	if o.ParseMode == "" {
+		return "strict"
+	}
+	return o.ParseMode
+}
+
+func (o *FlatConfig) GetExtraParser() string {
+	if o.ExtraParser == "" {
+		return "none"
+	}
+	return o.ExtraParser
+}
+
+func (o *FlatConfig) GetIncludeEpoch() bool {
+	return o.IncludeEpoch
+}
+
+func (o *FlatConfig) GetEpochUnit() string {
+	if o.EpochUnit == "" {
+		return "s"
+	}
+	return o.EpochUnit
+}
+
+func (o *FlatConfig) GetNumbersAsStrings() bool {
+	return o.NumbersAsStrings
+}
+
+func (o *FlatConfig) GetKeyCase() string {
+	if o.KeyCase == "" {
+		return "snake"
+	}
+	return strings.ToLower(o.KeyCase)
+}
+
+func (o *FlatConfig) GetExplodeQuestions() bool {
+	return o.ExplodeQuestions
+}
+
+// SetNow replaces the clock used for estimated timestamps, for tests.
+func (o *FlatConfig) SetNow(now func() time.Time) {
+	o.now = now
+}
+
+func (o *FlatConfig) Now() time.Time {
+	if o.now == nil {
+		return time.Now()
+	}
+	return o.now()
+}
+
+func (o *FlatConfig) GetDecodePTR() bool {
+	return o.DecodePTR
+}
+
+func (o *FlatConfig) GetIncludeAllSections() bool {
+	return o.IncludeAllSections
+}
+
+func (o *FlatConfig) GetMaxAnswers() int {
+	return o.MaxAnswers
+}
+
+func (o *FlatConfig) GetIncludeCorrelationID() bool {
+	return o.IncludeCorrelationID
+}
+
+func (o *FlatConfig) GetAnswerStats() bool {
+	return o.AnswerStats
+}
+
+func (o *FlatConfig) GetLargeResponseBytes() int {
+	if o.LargeResponseBytes <= 0 {
+		return 512
+	}
+	return o.LargeResponseBytes
+}
+
+func (o *FlatConfig) GetIncludeDNSCookie() bool {
+	return o.IncludeDNSCookie
+}
+
+func (o *FlatConfig) GetEnableEDNSOptions() bool {
+	return o.EnableEDNSOptions
+}
+
+func (o *FlatConfig) GetUseECSForClient() bool {
+	return o.UseECSForClient
+}
+
+func (o *FlatConfig) GetSubdomainEntropy() bool {
+	return o.SubdomainEntropy
+}
+
+func (o *FlatConfig) GetRandomSubdomainThreshold() float64 {
+	if o.RandomSubdomainThreshold <= 0 {
+		return 3.5
+	}
+	return o.RandomSubdomainThreshold
+}
+
+// GetBlocklist returns the Blocklist of BlocklistFile, nil when it is not set or can't be loaded.
+func (o *FlatConfig) GetBlocklist() *Blocklist {
+	if o.BlocklistFile == "" {
+		return nil
+	}
+	if o.blocklist == nil {
+		b, err := LoadBlocklist(o.BlocklistFile)
+		if err != nil {
+			log.Errorf("blocklist error: %s", err)
+			return nil
+		}
+		o.blocklist = b
+	}
+	return o.blocklist
+}
+
+func (o *FlatConfig) GetFilterDryRun() bool {
+	return o.FilterDryRun
+}
+
+// GetTransform returns compiled Filter and Set, nil when both are empty.
+func (o *FlatConfig) GetTransform() *Transform {
+	if o.Filter == "" && len(o.Set) == 0 {
+		return nil
+	}
+	if o.transform == nil {
+		t, err := NewTransform(o.Filter, o.Set)
+		if err != nil {
+			log.Errorf("transform is disabled: %s", err)
+			t = &Transform{}
+		}
+		o.transform = t
+	}
+	return o.transform
+}
+
+// GetCorrelator returns query/response correlator, nil when Correlate is disabled.
+func (o *FlatConfig) GetCorrelator() *Correlator {
+	if !o.Correlate {
+		return nil
+	}
+	if o.correlator == nil {
+		timeout := DefaultCorrelateTimeout
+		if o.CorrelateTimeout > 0 {
+			timeout = time.Duration(o.CorrelateTimeout) * time.Second
+		}
+		o.correlator = NewCorrelator(o.CorrelateSize, timeout, o.Now)
+	}
+	return o.correlator
+}
+
+// GetQtypeSampler returns the sampler of QtypeSampleRates, nil when it is empty.
+func (o *FlatConfig) GetQtypeSampler() *QtypeSampler {
+	if len(o.QtypeSampleRates) == 0 {
+		return nil
+	}
+	if o.qtypeSampler == nil {
+		o.qtypeSampler = NewQtypeSampler(o.QtypeSampleRates)
+	}
+	return o.qtypeSampler
+}
+
+// GetQnameLimiter returns the per qname limiter, nil when PerQnameLimit is unset.
+func (o *FlatConfig) GetQnameLimiter() *QnameLimiter {
+	if o.PerQnameLimit <= 0 {
+		return nil
+	}
+	if o.qnameLimiter == nil {
+		window := DefaultPerQnameWindow
+		if o.PerQnameWindow > 0 {
+			window = time.Duration(o.PerQnameWindow) * time.Second
+		}
+		o.qnameLimiter = NewQnameLimiter(o.PerQnameLimit, window, o.Now)
+	}
+	return o.qnameLimiter
+}
+
+// GetSequence returns the sequence of records, nil when IncludeSequence is disabled.
+func (o *FlatConfig) GetSequence() *Sequence {
+	if !o.IncludeSequence {
+		return nil
+	}
+	if o.sequence == nil {
+		o.sequence = NewSequence(o.Now())
+	}
+	return o.sequence
+}
+
+// GetCollapser returns the collapser, nil when CollapseIdenticalWithin is unset.
+func (o *FlatConfig) GetCollapser() *Collapser {
+	if o.CollapseIdenticalWithin == 0 {
+		return nil
+	}
+	if o.collapser == nil {
+		o.collapser = NewCollapser(time.Duration(o.CollapseIdenticalWithin)*time.Second, o.CollapseSize, o.Now)
+	}
+	return o.collapser
+}
+
+// GetTransferAssembler returns the transfer assembler, nil when AssembleZoneTransfers is disabled.
+func (o *FlatConfig) GetTransferAssembler() *TransferAssembler {
+	if !o.AssembleZoneTransfers {
+		return nil
+	}
+	if o.transferAssembler == nil {
+		o.transferAssembler = NewTransferAssembler(time.Duration(o.ZoneTransferTimeout)*time.Second, o.ZoneTransferSize, o.Now)
+	}
+	return o.transferAssembler
+}
+
+// GetReverseDNS returns shared PTR cache, nil when ReverseDNS is disabled.
+func (o *FlatConfig) GetReverseDNS() *ReverseDNS {
+	if !o.ReverseDNS {
+		return nil
+	}
+	if o.reverseDNS == nil {
+		size := o.ReverseDNSCacheSize
+		if size <= 0 {
+			size = DefaultReverseDNSCacheSize
+		}
+		ttl := DefaultReverseDNSTTL
+		if o.ReverseDNSTTL > 0 {
+			ttl = time.Duration(o.ReverseDNSTTL) * time.Second
+		}
+		o.reverseDNS = NewReverseDNS(size, ttl)
+	}
+	return o.reverseDNS
+}
+
+func (o *FlatConfig) GetCanonicalEndpoints() bool {
+	return o.CanonicalEndpoints
+}
+
+func (o *FlatConfig) GetIncludeMessageTypeShort() bool {
+	return o.IncludeMessageTypeShort
+}
+
+func (o *FlatConfig) GetAnonymizeHash() string {
+	if o.AnonymizeHash == "" {
+		return "sha256"
+	}
+	return o.AnonymizeHash
+}
+
+// GetAddressHasher returns the AddressHasher of AnonymizeHash, sha256 when it is unknown.
+func (o *FlatConfig) GetAddressHasher() AddressHasher {
+	if o.addressHasher == nil {
+		h, err := NewAddressHasher(o.GetAnonymizeHash())
+		if err != nil {
+			h, _ = NewAddressHasher("sha256")
+		}
+		o.addressHasher = h
+	}
+	return o.addressHasher
+}
+
+// GetAnonymizer returns the key loaded IPAnonymizer, nil when PrefixPreservingAnonymization is disabled.
+// When the key can't be loaded, the error is logged once and addresses are dropped instead of masked.
+func (o *FlatConfig) GetAnonymizer() *IPAnonymizer {
+	if !o.PrefixPreservingAnonymization {
+		return nil
+	}
+	if o.anonymizer == nil {
+		a, err := LoadIPAnonymizer(o.AnonymizationKeyPath)
+		if err != nil {
+			log.Errorf("anonymizer error, addresses are dropped: %s", err)
+			a = failedIPAnonymizer
+		}
+		o.anonymizer = a
+	}
+	return o.anonymizer
+}
+
+func (o *FlatConfig) GetDropZoneTransfers() bool {
+	return o.DropZoneTransfers
+}
+
+func (o *FlatConfig) GetTagZoneTransfers() bool {
+	return o.TagZoneTransfers
+}
+
+func (o *FlatConfig) GetRcodes() []string {
+	return o.Rcodes
+}
+
+func (o *FlatConfig) GetRcodeFilterQueries() bool {
+	return o.RcodeFilterQueries
+}
+
+func (o *FlatConfig) GetEnableNSID() bool {
+	return o.EnableNSID
+}
+
+func (o *FlatConfig) GetEnableKeepalive() bool {
+	return o.EnableKeepalive
+}
+
+func (o *FlatConfig) GetEnableExtendedRcode() bool {
+	return o.EnableExtendedRcode
+}
+
+func (o *FlatConfig) GetParseBoth() bool {
+	return o.ParseBoth
+}
+
+func (o *FlatConfig) GetSplitCombined() bool {
+	return o.SplitCombined
+}
+
+func (o *FlatConfig) GetAlwaysIncludeTXT() bool {
+	return o.AlwaysIncludeTXT
+}
+
+func (o *FlatConfig) GetEnableSVCB() bool {
+	return o.EnableSVCB
+}
+
+func (o *FlatConfig) GetIdempotencyKey() bool {
+	return o.IdempotencyKey
+}
+
+func (o *FlatConfig) GetLegacyLabels() bool {
+	return o.LegacyLabels
+}
+
+func (o *FlatConfig) GetClassifyTLD() bool {
+	return o.ClassifyTLD
+}
+
+func (o *FlatConfig) GetIncludeReversedQname() bool {
+	return o.IncludeReversedQname
+}
+
+func (o *FlatConfig) GetDecodeIDN() bool {
+	return o.DecodeIDN
+}
+
+func (o *FlatConfig) GetHijackRules() []*HijackRule {
+	return o.HijackRules
+}
+
+func (o *FlatConfig) GetIPHashSaltPath() string {
+	return o.IPHashSaltPath
+}
+
+func (o *FlatConfig) GetIPHashSalt() []byte {
+	if o.ipHashSalt == nil {
+		if o.GetIPHashSaltPath() != "" {
+			o.LoadSalt()
+		}
+	}
+	if o.ipHashSalt == nil {
+		o.ipHashSalt = make([]byte, 32)
+		rand.Read(o.ipHashSalt)
+	}
+	return o.ipHashSalt
+}
+
+func (o *FlatConfig) LoadSalt() {
+	if o.GetIPHashSaltPath() != "" {
+		o.ipHashSalt, _ = ioutil.ReadFile(o.GetIPHashSaltPath())
+	}
+}
+
+func (o *FlatConfig) WatchSalt(ctx context.Context) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer watcher.Close()
+	err = watcher.Add(o.GetIPHashSaltPath())
+	if err != nil {
+		log.Fatal(err)
 	}
 L:
 	for {
@@ -709,6 +3437,9 @@ L:
 
 func (o *FlatConfig) Validate() *ValidationError {
 	valerr := NewValidationError()
+	if _, err := NewAddressHasher(o.GetAnonymizeHash()); err != nil {
+		valerr.Add(errors.Errorf("AnonymizeHash must be one of %s", strings.Join(AnonymizeHashes, ", ")))
+	}
 	if o.IPv4Mask != 0 {
 		if o.IPv4Mask > 32 {
 			valerr.Add(errors.New("IPv4Mask must include range 0 to 32"))
@@ -719,5 +3450,79 @@ func (o *FlatConfig) Validate() *ValidationError {
 			valerr.Add(errors.New("IPv4Mask must include range 0 to 128"))
 		}
 	}
+	for _, rule := range o.HijackRules {
+		if err := rule.Validate(); err != nil {
+			valerr.Add(err)
+		}
+	}
+	for _, rcode := range o.Rcodes {
+		if _, ok := dns.StringToRcode[strings.ToUpper(rcode)]; !ok {
+			valerr.Add(errors.Errorf("unknown rcode %s in Rcodes", rcode))
+		}
+	}
+	for qtype, rate := range o.QtypeSampleRates {
+		if _, ok := dns.StringToType[strings.ToUpper(qtype)]; !ok && qtype != QtypeSampleDefaultKey {
+			valerr.Add(errors.Errorf("unknown qtype %s in QtypeSampleRates", qtype))
+		}
+		if rate < 0 || rate > 1 {
+			valerr.Add(errors.Errorf("QtypeSampleRates of %s must include range 0 to 1", qtype))
+		}
+	}
+	if o.PerQnameLimit < 0 {
+		valerr.Add(errors.New("PerQnameLimit must not be negative"))
+	}
+	typeNames := map[string]string{}
+	for t, name := range o.TypeNames {
+		t = strings.ToUpper(t)
+		if _, ok := dnstap.Message_Type_value[t]; !ok {
+			valerr.Add(errors.Errorf("TypeNames has unknown type %s", t))
+		}
+		if name == "" {
+			valerr.Add(errors.Errorf("TypeNames name of %s must not be empty", t))
+		}
+		typeNames[t] = name
+	}
+	o.TypeNames = typeNames
+	if o.MaxFieldLength < 0 {
+		valerr.Add(errors.New("MaxFieldLength must not be negative"))
+	}
+	switch o.GetParseMode() {
+	case "strict", "lenient", "header_only":
+	default:
+		valerr.Add(errors.Errorf("ParseMode must be strict, lenient or header_only, got %s", o.ParseMode))
+	}
+	switch o.GetExtraParser() {
+	case "json", "kv", "none":
+	default:
+		valerr.Add(errors.Errorf("ExtraParser must be json, kv or none, got %s", o.ExtraParser))
+	}
+	if u := o.GetEpochUnit(); u != "s" && u != "ns" {
+		valerr.Add(errors.Errorf("EpochUnit must be s or ns, got %s", u))
+	}
+	if c := o.GetKeyCase(); c != "snake" && c != "camel" {
+		valerr.Add(errors.Errorf("KeyCase must be snake or camel, got %s", c))
+	}
+	if o.PrefixPreservingAnonymization {
+		a, err := LoadIPAnonymizer(o.AnonymizationKeyPath)
+		if err != nil {
+			valerr.Add(err)
+			a = failedIPAnonymizer
+		}
+		o.anonymizer = a
+	}
+	if o.BlocklistFile != "" {
+		b, err := LoadBlocklist(o.BlocklistFile)
+		if err != nil {
+			valerr.Add(err)
+		}
+		o.blocklist = b
+	}
+	if o.Filter != "" || len(o.Set) > 0 {
+		t, err := NewTransform(o.Filter, o.Set)
+		if err != nil {
+			valerr.Add(err)
+		}
+		o.transform = t
+	}
 	return valerr.Err()
 }
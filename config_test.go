@@ -19,11 +19,15 @@ package dtap_test
 import (
 	"bytes"
 	"context"
+	"io/ioutil"
 	"net"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	dnstap "github.com/dnstap/golang-dnstap"
 	"github.com/mimuret/dtap"
 	"github.com/stretchr/testify/assert"
 )
@@ -102,3 +106,311 @@ User="unbound"
 	assert.Equal(t, c.OutputNats[0].Flat.GetIPHashSalt(), []byte{20, 30, 40, 50})
 	cancel()
 }
+
+func TestHijackRulesConfig(t *testing.T) {
+	cfg := `[[OutputStdout]]
+	[OutputStdout.flat]
+		[[OutputStdout.flat.HijackRules]]
+			Qname = "*.example.com"
+			CIDRs = ["192.0.2.0/24"]
+`
+	c, err := dtap.NewConfigFromReader(bytes.NewBufferString(cfg))
+	assert.NoError(t, err)
+	rules := c.OutputStdout[0].Flat.GetHijackRules()
+	assert.Len(t, rules, 1)
+	assert.True(t, rules[0].Match("www.example.com."))
+	assert.False(t, rules[0].Match("example.com."))
+	assert.True(t, rules[0].Contains(net.ParseIP("192.0.2.1")))
+	assert.Nil(t, c.OutputStdout[0].Flat.Validate())
+}
+
+func TestOutputKafkaConfigSASL(t *testing.T) {
+	c := &dtap.OutputKafkaConfig{
+		Hosts:         []string{"localhost:9092"},
+		Topic:         "dnstap",
+		OutputType:    "json",
+		SASLMechanism: "scram-sha-512",
+	}
+	assert.NotNil(t, c.Validate())
+	c.SASLUser = "dtap"
+	c.SASLPassword = "secret"
+	assert.Nil(t, c.Validate())
+	assert.Equal(t, "SCRAM-SHA-512", c.GetSASLMechanism())
+
+	c.SASLMechanism = "GSSAPI"
+	assert.NotNil(t, c.Validate())
+
+	c.SASLMechanism = ""
+	c.TLSCert = "/etc/dtap/client.crt"
+	assert.NotNil(t, c.Validate())
+}
+
+func TestConfigCollectorID(t *testing.T) {
+	hostname, _ := os.Hostname()
+	assert.Equal(t, hostname, (&dtap.Config{}).GetCollectorID())
+	assert.Equal(t, hostname, (&dtap.FlatConfig{}).GetCollectorID())
+	c, err := dtap.NewConfigFromReader(strings.NewReader(`
+CollectorID = "collector1"
+[[OutputCSV]]
+Path = "out.csv"
+[[OutputCSV]]
+Path = "out2.csv"
+[OutputCSV.Flat]
+CollectorID = "collector2"
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, "collector1", c.OutputCSV[0].Flat.GetCollectorID())
+	assert.Equal(t, "collector2", c.OutputCSV[1].Flat.GetCollectorID())
+}
+
+func TestOutputKafkaConfigRecordKey(t *testing.T) {
+	c := &dtap.OutputKafkaConfig{}
+	data := &dtap.DnstapFlatT{DocID: "0123abcd"}
+	assert.Equal(t, "0123abcd", c.GetRecordKey(data))
+	assert.Equal(t, "", c.GetRecordKey(&dtap.DnstapFlatT{}))
+	c.Key = "dnstap"
+	assert.Equal(t, "dnstap", c.GetRecordKey(data))
+}
+
+func TestOutputFluentConfigQtypeTagMap(t *testing.T) {
+	cfg := `[[OutputFluent]]
+	Host = "localhost"
+	Tag = "dnstap.other"
+	[OutputFluent.QtypeTagMap]
+		A = "dnstap.address"
+		aaaa = "dnstap.address"
+`
+	c, err := dtap.NewConfigFromReader(bytes.NewBufferString(cfg))
+	assert.NoError(t, err)
+	o := c.OutputFluent[0]
+	assert.Nil(t, o.Validate())
+	assert.Equal(t, "dnstap.address", o.GetQtypeTag("A"))
+	assert.Equal(t, "dnstap.address", o.GetQtypeTag("AAAA"))
+	assert.Equal(t, "dnstap.other", o.GetQtypeTag("MX"))
+	assert.Equal(t, "dnstap.other", o.GetQtypeTag(""))
+
+	o.QtypeTagMap = map[string]string{"NOTYPE": "dnstap.x", "TXT": "Bad Tag"}
+	assert.NotNil(t, o.Validate())
+}
+
+func TestOutputFluentConfigSkipLatency(t *testing.T) {
+	fast, slow := 2.0, 120.0
+	query := &dtap.DnstapFlatT{MessageType: dnstap.Message_CLIENT_QUERY}
+	testcases := []struct {
+		data     *dtap.DnstapFlatT
+		keep     bool
+		expected bool
+	}{
+		{query, false, false},
+		{&dtap.DnstapFlatT{MessageType: dnstap.Message_CLIENT_RESPONSE, LatencyMs: &fast}, false, true},
+		{&dtap.DnstapFlatT{MessageType: dnstap.Message_CLIENT_RESPONSE, LatencyMs: &slow}, false, false},
+		{&dtap.DnstapFlatT{MessageType: dnstap.Message_CLIENT_RESPONSE}, false, true},
+		{&dtap.DnstapFlatT{MessageType: dnstap.Message_CLIENT_RESPONSE}, true, false},
+	}
+	for n, tc := range testcases {
+		c := &dtap.OutputFluentConfig{MinLatencyMs: 100, KeepUnknownLatency: tc.keep}
+		assert.Equal(t, tc.expected, c.SkipLatency(tc.data), n)
+	}
+	c := &dtap.OutputFluentConfig{}
+	assert.False(t, c.SkipLatency(&dtap.DnstapFlatT{MessageType: dnstap.Message_CLIENT_RESPONSE, LatencyMs: &fast}))
+}
+
+func TestOutputFluentConfigSkipAnswers(t *testing.T) {
+	c := &dtap.OutputFluentConfig{MinAnswers: 2}
+	assert.False(t, c.SkipAnswers(&dtap.DnstapFlatT{MessageType: dnstap.Message_CLIENT_QUERY}))
+	assert.True(t, c.SkipAnswers(&dtap.DnstapFlatT{MessageType: dnstap.Message_CLIENT_RESPONSE, Ancount: 0, Rcode: "NXDOMAIN"}))
+	assert.True(t, c.SkipAnswers(&dtap.DnstapFlatT{MessageType: dnstap.Message_CLIENT_RESPONSE, Ancount: 1}))
+	assert.False(t, c.SkipAnswers(&dtap.DnstapFlatT{MessageType: dnstap.Message_CLIENT_RESPONSE, Ancount: 2}))
+	assert.False(t, c.SkipAnswers(&dtap.DnstapFlatT{MessageType: dnstap.Message_CLIENT_RESPONSE, Ancount: 3}))
+
+	c = &dtap.OutputFluentConfig{}
+	assert.False(t, c.SkipAnswers(&dtap.DnstapFlatT{MessageType: dnstap.Message_CLIENT_RESPONSE}))
+	c = &dtap.OutputFluentConfig{Host: "localhost", Tag: "dnstap", MinAnswers: -1}
+	assert.NotNil(t, c.Validate())
+}
+
+func TestOutputFluentConfigOverflowPolicy(t *testing.T) {
+	c := &dtap.OutputFluentConfig{Host: "localhost", Tag: "dnstap"}
+	assert.Nil(t, c.Validate())
+	assert.Equal(t, "drop", c.GetOverflowPolicy())
+	c.OverflowPolicy = "Block"
+	assert.Nil(t, c.Validate())
+	assert.Equal(t, "block", c.GetOverflowPolicy())
+	c.OverflowPolicy = "wait"
+	assert.NotNil(t, c.Validate())
+}
+
+func TestOutputNatsConfigFormat(t *testing.T) {
+	o := &dtap.OutputNatsConfig{}
+	assert.Nil(t, o.Validate())
+	assert.Equal(t, "json", o.GetFormat())
+	o.Format = "CBOR"
+	assert.Nil(t, o.Validate())
+	assert.Equal(t, "cbor", o.GetFormat())
+	o.Format = "xml"
+	assert.NotNil(t, o.Validate())
+}
+
+func TestOutputStdoutConfigFormat(t *testing.T) {
+	o := &dtap.OutputStdoutConfig{Format: "dnstap_json"}
+	assert.Nil(t, o.Validate())
+	assert.Equal(t, dtap.DnstapJSONFormat, o.GetFormat())
+}
+
+func TestOutputRcodeRatioConfigWindow(t *testing.T) {
+	assert.Nil(t, (&dtap.OutputRcodeRatioConfig{}).Validate())
+	assert.Nil(t, (&dtap.OutputRcodeRatioConfig{Window: 60, Interval: 20}).Validate())
+	assert.NotNil(t, (&dtap.OutputRcodeRatioConfig{Window: 60, Interval: 25}).Validate())
+	assert.NotNil(t, (&dtap.OutputRcodeRatioConfig{Window: 10, Interval: 20}).Validate())
+	assert.Nil(t, (&dtap.OutputIdentitySummaryConfig{Window: 300, Interval: 60}).Validate())
+	assert.NotNil(t, (&dtap.OutputIdentitySummaryConfig{Window: 90, Interval: 60}).Validate())
+}
+
+func TestOutputFluentConfigSocketFamilies(t *testing.T) {
+	o := &dtap.OutputFluentConfig{Host: "localhost", Tag: "dnstap"}
+	assert.Nil(t, o.Validate())
+	assert.False(t, o.SkipSocketFamily(&dtap.DnstapFlatT{SocketFamily: "INET"}))
+
+	o.SocketFamilies = []string{"inet6"}
+	assert.Nil(t, o.Validate())
+	assert.True(t, o.SkipSocketFamily(&dtap.DnstapFlatT{SocketFamily: "INET"}))
+	assert.False(t, o.SkipSocketFamily(&dtap.DnstapFlatT{SocketFamily: "INET6"}))
+
+	o.SocketFamilies = []string{"IPX"}
+	assert.NotNil(t, o.Validate())
+}
+
+func TestOutputFluentConfigWriteTimeout(t *testing.T) {
+	o := &dtap.OutputFluentConfig{Host: "localhost", Tag: "dnstap"}
+	assert.Equal(t, 3*time.Second, o.GetWriteTimeout())
+	o.WriteTimeout = 10
+	assert.Equal(t, 10*time.Second, o.GetWriteTimeout())
+}
+
+func TestNewConfigFromDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dtap-config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	write := func(name, cfg string) {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(cfg), 0644))
+	}
+	write("10-input.toml", `
+InputMsgBuffer = 500
+[[InputUnix]]
+Path = "/var/run/dtap.sock"
+`)
+	write("20-output.toml", `
+[[OutputNats]]
+Host = "nats://127.0.0.1:4222"
+Subject = "a"
+[[OutputNats]]
+Host = "nats://127.0.0.1:4222"
+Subject = "b"
+`)
+	write("30-output.toml", `
+[[OutputNats]]
+Host = "nats://127.0.0.1:4222"
+Subject = "c"
+[[InputUnix]]
+Path = "/var/run/dtap2.sock"
+`)
+	write("README", `not a config`)
+	c, err := dtap.NewConfigFromPath(dir)
+	if assert.NoError(t, err) {
+		assert.Equal(t, uint(500), c.InputMsgBuffer)
+		if assert.Len(t, c.InputUnix, 2) {
+			assert.Equal(t, "/var/run/dtap.sock", c.InputUnix[0].Path)
+			assert.Equal(t, "/var/run/dtap2.sock", c.InputUnix[1].Path)
+		}
+		if assert.Len(t, c.OutputNats, 3) {
+			assert.Equal(t, "a", c.OutputNats[0].Subject)
+			assert.Equal(t, "c", c.OutputNats[2].Subject)
+		}
+	}
+
+	write("40-buffer.toml", `InputMsgBuffer = 1000`)
+	_, err = dtap.NewConfigFromDir(dir)
+	assert.Error(t, err)
+
+	empty, err := ioutil.TempDir("", "dtap-config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(empty)
+	_, err = dtap.NewConfigFromDir(empty)
+	assert.Error(t, err)
+}
+
+func TestConfigStrict(t *testing.T) {
+	cfg := `
+InputMsgBuffer = 1000
+[[OutputNats]]
+Host = "nats://127.0.0.1:4222"
+Subjct = "dnstap"
+`
+	c, err := dtap.NewConfigFromReader(bytes.NewBufferString(cfg))
+	assert.NoError(t, err)
+	assert.Equal(t, "", c.OutputNats[0].Subject)
+
+	_, err = dtap.NewConfigFromReader(bytes.NewBufferString("Strict = true\n" + cfg))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "Subjct")
+	}
+
+	c, err = dtap.NewConfigFromReader(bytes.NewBufferString("Strict = true\nInputMsgBuffer = 1000\n[[OutputNats]]\nHost = \"nats://127.0.0.1:4222\"\n"))
+	assert.NoError(t, err)
+	assert.True(t, c.Strict)
+}
+
+func TestConfigStreams(t *testing.T) {
+	c := &dtap.Config{
+		InputMsgBuffer: 1000,
+		OutputStdout: []*dtap.OutputStdoutConfig{
+			{Buffer: dtap.OutputBufferConfig{Stream: "archive", Full: true}},
+		},
+		OutputCSV: []*dtap.OutputCSVConfig{
+			{Path: "/tmp/a.csv", Buffer: dtap.OutputBufferConfig{Stream: "index", SampleRate: 0.1}},
+			{Path: "/tmp/b.csv", Buffer: dtap.OutputBufferConfig{Stream: "index", SampleRate: 0.1}},
+		},
+	}
+	assert.Empty(t, c.Validate())
+
+	c.OutputStdout[0].Buffer.SampleRate = 0.5
+	c.OutputCSV[1].Buffer.SampleRate = 0.2
+	errs := c.Validate()
+	if assert.Len(t, errs, 2) {
+		assert.Contains(t, errs[0].Error(), "OutputStdout[0]")
+		assert.Contains(t, errs[1].Error(), "OutputCSV[1]")
+	}
+}
+
+func TestConfigSummary(t *testing.T) {
+	cfg := `
+[[InputTCP]]
+Address = "127.0.0.1"
+[[OutputNats]]
+Host = "nats://127.0.0.1:4222"
+Subject = "dnstap"
+Password = "secret"
+[[OutputS3]]
+Bucket = "dnstap"
+SecretAccessKey = "secret"
+[[OutputGRPC]]
+Endpoint = "127.0.0.1:50051"
+[OutputGRPC.Metadata]
+authorization = "Bearer secret"
+`
+	c, err := dtap.NewConfigFromReader(bytes.NewBufferString(cfg))
+	assert.NoError(t, err)
+	lines := c.Summary()
+	if assert.Len(t, lines, 5) {
+		assert.Contains(t, lines[0], `"InputMsgBuffer":10000`)
+		assert.Contains(t, lines[1], `InputTCP[0] {`)
+		assert.Contains(t, lines[1], `"Address":"127.0.0.1"`)
+		assert.Contains(t, lines[2], `OutputNats[0] {`)
+		assert.Contains(t, lines[2], `"Password":"***"`)
+		assert.NotContains(t, lines[2], "secret")
+		for _, line := range lines[3:] {
+			assert.NotContains(t, line, "secret")
+		}
+		assert.Contains(t, strings.Join(lines, ""), `"Metadata":{"authorization":"***"}`)
+	}
+}
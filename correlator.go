@@ -0,0 +1,108 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"sync"
+	"time"
+)
+
+var (
+	DefaultCorrelateTimeout = 5 * time.Second
+	// CorrelateExpireInterval is the min interval of scanning expired queries.
+	CorrelateExpireInterval = time.Second
+)
+
+// Correlator pairs queries and matched responses into one record.
+// Queries are held until the response, or emitted alone with unmatched
+// when they expire by timeout or are evicted by size.
+// Unmatched queries are emitted with the records of a later frame.
+type Correlator struct {
+	cache       *Cache
+	now         func() time.Time
+	mux         sync.Mutex
+	unmatched   []*DnstapFlatT
+	lastExpired time.Time
+}
+
+func NewCorrelator(size int, timeout time.Duration, now func() time.Time) *Correlator {
+	c := &Correlator{
+		cache: NewCache("correlator", size, timeout),
+		now:   now,
+	}
+	c.cache.SetNow(now)
+	c.cache.OnEvict = func(key string, value interface{}) {
+		c.mux.Lock()
+		defer c.mux.Unlock()
+		for _, data := range value.([]*DnstapFlatT) {
+			data.Unmatched = true
+			c.unmatched = append(c.unmatched, data)
+		}
+	}
+	return c
+}
+
+// Correlate returns records to emit for records of a message.
+// Queries are held and responses are merged with the held query of key.
+func (c *Correlator) Correlate(key string, records []*DnstapFlatT, response bool) []*DnstapFlatT {
+	if now := c.now(); now.Sub(c.lastExpired) >= CorrelateExpireInterval {
+		c.lastExpired = now
+		c.cache.Expire()
+	}
+	if !response {
+		c.cache.Set(key, records)
+		return c.takeUnmatched()
+	}
+	if v, ok := c.cache.Get(key); ok {
+		c.cache.Delete(key)
+		queries := v.([]*DnstapFlatT)
+		for i, data := range records {
+			if i < len(queries) {
+				mergeQuery(data, queries[i])
+			} else {
+				mergeQuery(data, queries[len(queries)-1])
+			}
+		}
+	}
+	return append(c.takeUnmatched(), records...)
+}
+
+func (c *Correlator) takeUnmatched() []*DnstapFlatT {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	res := c.unmatched
+	c.unmatched = nil
+	return res
+}
+
+// mergeQuery sets query side fields of q into response data.
+func mergeQuery(data, q *DnstapFlatT) {
+	data.Paired = true
+	data.QueryTime = q.QueryTime
+	size := q.MessageSize
+	data.QueryMessageSize = &size
+	queryTime, err := time.Parse(time.RFC3339Nano, q.QueryTime)
+	if err != nil {
+		return
+	}
+	responseTime, err := time.Parse(time.RFC3339Nano, data.ResponseTime)
+	if err != nil {
+		return
+	}
+	latency := float64(responseTime.Sub(queryTime)) / float64(time.Millisecond)
+	data.LatencyMs = &latency
+}
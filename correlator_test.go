@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"testing"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/golang/protobuf/proto"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+func TestFlatFrameCorrelate(t *testing.T) {
+	clock := time.Unix(1546300800, 0)
+	flat := &dtap.FlatConfig{Correlate: true, CorrelateTimeout: 5}
+	flat.SetNow(func() time.Time { return clock })
+	columns := []string{"qname", "type", "paired", "unmatched", "latency_ms", "query_message_size"}
+
+	q := newTestQuery("www.example.com.", dns.TypeA)
+	query := newTestDnstap(t, dnstap.Message_CLIENT_QUERY, q)
+	query.Message.QueryTimeNsec = proto.Uint32(500000000)
+	// response carries only the query time of second
+	response := newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, newTestResponse(q))
+	lost := newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("lost.example.com.", dns.TypeA))
+	lost.Message.QueryPort = proto.Uint32(53001)
+	rows := flatFrameRows(t, flat, columns, newTestMessage(t, query), newTestMessage(t, response), newTestMessage(t, lost))
+
+	clock = clock.Add(10 * time.Second)
+	next := newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("next.example.com.", dns.TypeA))
+	next.Message.QueryPort = proto.Uint32(53002)
+	rows = append(rows, flatFrameRows(t, flat, columns, newTestMessage(t, next))...)
+
+	assert.Equal(t, [][]string{
+		{"www.example.com.", "CLIENT_RESPONSE", "true", "", "500", "33"},
+		{"lost.example.com.", "CLIENT_QUERY", "", "true", "", ""},
+	}, rows)
+}
+
+func TestFlatFrameCorrelateSplitCombined(t *testing.T) {
+	flat := &dtap.FlatConfig{Correlate: true, SplitCombined: true}
+	columns := []string{"qname", "type", "paired", "unmatched"}
+
+	q := newTestQuery("www.example.com.", dns.TypeA)
+	// a combined message of the same key does not take the held query
+	combined := newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, newTestResponse(q))
+	var err error
+	combined.Message.QueryMessage, err = q.Pack()
+	assert.NoError(t, err)
+	rows := flatFrameRows(t, flat, columns,
+		newTestMessage(t, newTestDnstap(t, dnstap.Message_CLIENT_QUERY, q)),
+		newTestMessage(t, combined),
+		newTestMessage(t, newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, newTestResponse(q))),
+	)
+
+	assert.Equal(t, [][]string{
+		{"www.example.com.", "CLIENT_QUERY", "", ""},
+		{"www.example.com.", "CLIENT_RESPONSE", "", ""},
+		{"www.example.com.", "CLIENT_RESPONSE", "true", ""},
+	}, rows)
+}
@@ -0,0 +1,393 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// DefaultDiskBufferMaxSize is the default max bytes of segments of a disk buffer.
+	DefaultDiskBufferMaxSize int64 = 1 << 30
+	// MaxDiskBufferSegmentSize is the max bytes of a segment file.
+	MaxDiskBufferSegmentSize int64 = 16 << 20
+	// DiskBufferSyncInterval is the max interval of fsync of the segment and the cursor.
+	DiskBufferSyncInterval = time.Second
+)
+
+const (
+	diskBufferSegmentExt = ".seg"
+	diskBufferCursor     = "cursor"
+	// record header is frame length and received time in unix nano.
+	// With diskBufferSourceFlag in the length, the source length and source precede the frame.
+	// With diskBufferAddrFlag, the transport address length and address follow them.
+	diskBufferHeaderSize = 12
+	diskBufferSourceFlag = 1 << 31
+	diskBufferAddrFlag   = 1 << 30
+	diskBufferFlags      = diskBufferSourceFlag | diskBufferAddrFlag
+)
+
+// DiskBuffer is a write-ahead buffer of frames in segment files of dir.
+// Frames are read in order and removed by Ack, unacked frames are read again after restart.
+// When the segments exceed maxSize, the oldest segment is dropped.
+type DiskBuffer struct {
+	dir         string
+	maxSize     int64
+	segmentSize int64
+	lost        prometheus.Counter
+
+	mux      sync.Mutex
+	notify   chan struct{}
+	segments []uint64
+	sizes    map[uint64]int64
+	size     int64
+	w        *os.File
+	wID      uint64
+	wOff     int64
+	r        *os.File
+	rID      uint64
+	rOff     int64
+	// next is the offset after the record returned by Read.
+	next   int64
+	cursor *os.File
+	// dirty is true when writes or acks are not fsynced since synced.
+	dirty  bool
+	synced time.Time
+}
+
+// NewDiskBuffer opens the disk buffer of dir, maxSize <= 0 is DefaultDiskBufferMaxSize.
+// Frames dropped by maxSize are counted by lost.
+func NewDiskBuffer(dir string, maxSize int64, lost prometheus.Counter) (*DiskBuffer, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultDiskBufferMaxSize
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrapf(err, "can't create disk buffer dir %s", dir)
+	}
+	b := &DiskBuffer{
+		dir:         dir,
+		maxSize:     maxSize,
+		segmentSize: maxSize / 8,
+		lost:        lost,
+		notify:      make(chan struct{}, 1),
+		sizes:       map[uint64]int64{},
+	}
+	if b.segmentSize > MaxDiskBufferSegmentSize {
+		b.segmentSize = MaxDiskBufferSegmentSize
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't read disk buffer dir %s", dir)
+	}
+	for _, f := range files {
+		if !strings.HasSuffix(f.Name(), diskBufferSegmentExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(f.Name(), diskBufferSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		b.segments = append(b.segments, id)
+		b.sizes[id] = f.Size()
+		b.size += f.Size()
+	}
+	sort.Slice(b.segments, func(i, j int) bool { return b.segments[i] < b.segments[j] })
+
+	b.cursor, err = os.OpenFile(filepath.Join(dir, diskBufferCursor), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't open disk buffer cursor")
+	}
+	buf := make([]byte, 16)
+	if n, _ := b.cursor.ReadAt(buf, 0); n == len(buf) {
+		b.rID = binary.BigEndian.Uint64(buf)
+		b.rOff = int64(binary.BigEndian.Uint64(buf[8:]))
+	}
+	// segments before the cursor are acked already.
+	for len(b.segments) > 0 && b.segments[0] < b.rID {
+		b.removeOldest()
+	}
+
+	// always write a new segment, the last one may have a torn record.
+	if len(b.segments) > 0 {
+		b.wID = b.segments[len(b.segments)-1] + 1
+	}
+	if err := b.roll(); err != nil {
+		return nil, err
+	}
+	if b.segments[0] != b.rID {
+		b.rID, b.rOff = b.segments[0], 0
+	}
+	return b, nil
+}
+
+func (b *DiskBuffer) segmentPath(id uint64) string {
+	return filepath.Join(b.dir, fmt.Sprintf("%020d%s", id, diskBufferSegmentExt))
+}
+
+// roll starts the segment of wID.
+func (b *DiskBuffer) roll() error {
+	if b.w != nil {
+		b.w.Sync()
+		b.w.Close()
+		b.wID++
+	}
+	f, err := os.OpenFile(b.segmentPath(b.wID), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "can't create disk buffer segment")
+	}
+	b.w = f
+	b.wOff = 0
+	b.segments = append(b.segments, b.wID)
+	b.sizes[b.wID] = 0
+	return nil
+}
+
+// removeOldest deletes the oldest segment.
+func (b *DiskBuffer) removeOldest() {
+	id := b.segments[0]
+	if b.r != nil && b.rID == id {
+		b.r.Close()
+		b.r = nil
+	}
+	os.Remove(b.segmentPath(id))
+	b.size -= b.sizes[id]
+	delete(b.sizes, id)
+	b.segments = b.segments[1:]
+}
+
+// Write appends m to the buffer.
+func (b *DiskBuffer) Write(m *Message) error {
+	source := m.Source
+	if len(source) > 0xffff {
+		source = source[:0xffff]
+	}
+	var addr string
+	if m.TransportAddr != nil {
+		addr = m.TransportAddr.String()
+	}
+	rec := make([]byte, diskBufferHeaderSize, diskBufferHeaderSize+3+len(source)+len(addr)+len(m.Frame))
+	length := uint32(len(m.Frame))
+	if source != "" {
+		length |= diskBufferSourceFlag
+		rec = append(rec, byte(len(source)>>8), byte(len(source)))
+		rec = append(rec, source...)
+	}
+	if addr != "" {
+		length |= diskBufferAddrFlag
+		rec = append(rec, byte(len(addr)))
+		rec = append(rec, addr...)
+	}
+	binary.BigEndian.PutUint32(rec, length)
+	if !m.ReceivedAt.IsZero() {
+		binary.BigEndian.PutUint64(rec[4:], uint64(m.ReceivedAt.UnixNano()))
+	}
+	rec = append(rec, m.Frame...)
+
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if b.wOff > 0 && b.wOff+int64(len(rec)) > b.segmentSize {
+		if err := b.roll(); err != nil {
+			return err
+		}
+	}
+	for b.size+int64(len(rec)) > b.maxSize && len(b.segments) > 1 {
+		if b.lost != nil {
+			b.lost.Add(float64(b.unread()))
+		}
+		b.removeOldest()
+		b.rID, b.rOff, b.next = b.segments[0], 0, 0
+	}
+	if _, err := b.w.Write(rec); err != nil {
+		return errors.Wrap(err, "can't write disk buffer segment")
+	}
+	b.wOff += int64(len(rec))
+	b.sizes[b.wID] += int64(len(rec))
+	b.size += int64(len(rec))
+	b.dirty = true
+	b.sync(false)
+	select {
+	case b.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Read returns the first unacked frame, it blocks until a frame is written or ctx is done.
+func (b *DiskBuffer) Read(ctx context.Context) (*Message, error) {
+	for {
+		m, err := b.read()
+		if m != nil || err != nil {
+			return m, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-b.notify:
+		}
+	}
+}
+
+func (b *DiskBuffer) read() (*Message, error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	for {
+		if b.r == nil {
+			f, err := os.Open(b.segmentPath(b.rID))
+			if err != nil {
+				return nil, errors.Wrapf(err, "can't open disk buffer segment")
+			}
+			b.r = f
+		}
+		if size, header := b.recordAt(b.rOff); header != nil {
+			rec := make([]byte, size-diskBufferHeaderSize)
+			if n, _ := b.r.ReadAt(rec, b.rOff+diskBufferHeaderSize); n == len(rec) {
+				m := &Message{Frame: rec}
+				flags := binary.BigEndian.Uint32(header) & diskBufferFlags
+				if flags&diskBufferSourceFlag != 0 {
+					n := 2 + int(binary.BigEndian.Uint16(m.Frame))
+					m.Source, m.Frame = string(m.Frame[2:n]), m.Frame[n:]
+				}
+				if flags&diskBufferAddrFlag != 0 {
+					n := 1 + int(m.Frame[0])
+					m.TransportAddr, _ = net.ResolveTCPAddr("tcp", string(m.Frame[1:n]))
+					m.Frame = m.Frame[n:]
+				}
+				if ts := int64(binary.BigEndian.Uint64(header[4:])); ts != 0 {
+					m.ReceivedAt = time.Unix(0, ts)
+				}
+				b.next = b.rOff + size
+				return m, nil
+			}
+		}
+		if b.rID == b.wID {
+			return nil, nil
+		}
+		// end of a finished segment, or its torn record.
+		b.removeOldest()
+		b.rID, b.rOff = b.segments[0], 0
+		b.saveCursor()
+	}
+}
+
+// recordAt returns size and header of the record at off of the read segment,
+// nil header when the record is not complete.
+func (b *DiskBuffer) recordAt(off int64) (int64, []byte) {
+	header := make([]byte, diskBufferHeaderSize)
+	if n, _ := b.r.ReadAt(header, off); n != len(header) {
+		return 0, nil
+	}
+	length := binary.BigEndian.Uint32(header)
+	size := diskBufferHeaderSize + int64(length&^diskBufferFlags)
+	if length&diskBufferSourceFlag != 0 {
+		buf := make([]byte, 2)
+		if n, _ := b.r.ReadAt(buf, off+diskBufferHeaderSize); n != len(buf) {
+			return 0, nil
+		}
+		size += 2 + int64(binary.BigEndian.Uint16(buf))
+	}
+	if length&diskBufferAddrFlag != 0 {
+		buf := make([]byte, 1)
+		if n, _ := b.r.ReadAt(buf, off+size-int64(length&^diskBufferFlags)); n != len(buf) {
+			return 0, nil
+		}
+		size += 1 + int64(buf[0])
+	}
+	if off+size > b.sizes[b.rID] {
+		return 0, nil
+	}
+	return size, header
+}
+
+// unread returns the number of unacked frames of the read segment.
+func (b *DiskBuffer) unread() int {
+	if b.r == nil {
+		f, err := os.Open(b.segmentPath(b.rID))
+		if err != nil {
+			return 0
+		}
+		b.r = f
+	}
+	count := 0
+	for off := b.rOff; ; count++ {
+		size, header := b.recordAt(off)
+		if header == nil {
+			return count
+		}
+		off += size
+	}
+}
+
+// Ack removes the frame returned by Read.
+func (b *DiskBuffer) Ack() {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if b.next > b.rOff {
+		b.rOff = b.next
+		b.saveCursor()
+		b.dirty = true
+		b.sync(false)
+	}
+}
+
+// sync fsyncs the segment and the cursor when DiskBufferSyncInterval passed since the last one, or force.
+func (b *DiskBuffer) sync(force bool) {
+	if !b.dirty || (!force && time.Since(b.synced) < DiskBufferSyncInterval) {
+		return
+	}
+	b.w.Sync()
+	b.cursor.Sync()
+	b.dirty, b.synced = false, time.Now()
+}
+
+func (b *DiskBuffer) saveCursor() {
+	buf := make([]byte, 16)
+	binary.BigEndian.PutUint64(buf, b.rID)
+	binary.BigEndian.PutUint64(buf[8:], uint64(b.rOff))
+	b.cursor.WriteAt(buf, 0)
+}
+
+// Size returns bytes of the segments including acked frames of the oldest one.
+func (b *DiskBuffer) Size() int64 {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.size
+}
+
+func (b *DiskBuffer) Close() error {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if b.r != nil {
+		b.r.Close()
+	}
+	b.sync(true)
+	b.cursor.Close()
+	return b.w.Close()
+}
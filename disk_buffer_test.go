@@ -0,0 +1,161 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	framestream "github.com/farsightsec/golang-framestream"
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+func readDiskBuffer(t *testing.T, b *dtap.DiskBuffer) *dtap.Message {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	m, err := b.Read(ctx)
+	assert.NoError(t, err)
+	return m
+}
+
+func TestDiskBufferReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dtap")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	b, err := dtap.NewDiskBuffer(dir, 0, nil)
+	assert.NoError(t, err)
+	receivedAt := time.Unix(1546300800, 0)
+	addr := &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 53000}
+	for _, frame := range []string{"a", "b", "c"} {
+		assert.NoError(t, b.Write(&dtap.Message{Frame: []byte(frame), ReceivedAt: receivedAt, Source: "unix:/tmp/" + frame, TransportAddr: addr}))
+	}
+	m := readDiskBuffer(t, b)
+	assert.Equal(t, []byte("a"), m.Frame)
+	assert.True(t, receivedAt.Equal(m.ReceivedAt))
+	assert.Equal(t, "unix:/tmp/a", m.Source)
+	assert.Equal(t, addr.String(), m.TransportAddr.String())
+	b.Ack()
+	// b is read but not acked at crash
+	assert.Equal(t, []byte("b"), readDiskBuffer(t, b).Frame)
+
+	// crash without Close, with a torn record
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.seg"))
+	assert.Len(t, matches, 1)
+	f, err := os.OpenFile(matches[0], os.O_WRONLY|os.O_APPEND, 0600)
+	assert.NoError(t, err)
+	f.Write([]byte{0, 0, 0, 8, 0})
+	f.Close()
+
+	b, err = dtap.NewDiskBuffer(dir, 0, nil)
+	assert.NoError(t, err)
+	defer b.Close()
+	assert.NoError(t, b.Write(dtap.NewMessage([]byte("d"))))
+	for _, frame := range []string{"b", "c", "d"} {
+		m := readDiskBuffer(t, b)
+		if assert.NotNil(t, m) {
+			assert.Equal(t, []byte(frame), m.Frame)
+		}
+		b.Ack()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = b.Read(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestDiskBufferMaxSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dtap")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	lost := prometheus.NewCounter(prometheus.CounterOpts{Name: "test_disk_lost"})
+	b, err := dtap.NewDiskBuffer(dir, 8*1024, lost)
+	assert.NoError(t, err)
+	defer b.Close()
+	frame := make([]byte, 100)
+	for n := 0; n < 200; n++ {
+		frame[0] = byte(n)
+		assert.NoError(t, b.Write(&dtap.Message{Frame: frame}))
+	}
+	assert.True(t, b.Size() <= 8*1024)
+	// the oldest frames are dropped
+	m := readDiskBuffer(t, b)
+	assert.NotEqual(t, byte(0), m.Frame[0])
+	assert.Equal(t, int(m.Frame[0]), int(testutil.ToFloat64(lost)))
+}
+
+func TestDnstapOutputDiskBuffer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dtap")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	bufferDir := filepath.Join(dir, "buffer")
+	path := filepath.Join(dir, "out.fstrm")
+
+	newOutput := func() dtap.Output {
+		params := newTestOutputParams()
+		params.DiskBufferDir = bufferDir
+		return dtap.NewDnstapFstrmFileOutput(&dtap.OutputFileConfig{Path: path}, params)
+	}
+	frame := newTestFrame(t, newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("www.example.com.", dns.TypeA)))
+	// frames are buffered while the output is not running, then dtap crashes.
+	o := newOutput()
+	o.SetMessage(dtap.NewMessage(frame))
+	o.SetMessage(dtap.NewMessage(frame))
+
+	o = newOutput()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		o.Run(ctx)
+		close(done)
+	}()
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+	<-done
+
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	dec, err := framestream.NewDecoder(f, &framestream.DecoderOptions{ContentType: dnstap.FSContentType})
+	assert.NoError(t, err)
+	count := 0
+	for {
+		got, err := dec.Decode()
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(t, err) {
+			break
+		}
+		assert.Equal(t, frame, got)
+		count++
+	}
+	assert.Equal(t, 2, count)
+}
@@ -0,0 +1,481 @@
+// DNS record messages of the gRPC output of dtap.
+// Fields are the flat record fields of the same names,
+// fields without a number here are sent in fields as strings.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.5
+// 	protoc        (unknown)
+// source: dns_record.proto
+
+package dnsrecord
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type DNSRecord struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Timestamp       string                 `protobuf:"bytes,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	QueryTime       string                 `protobuf:"bytes,2,opt,name=query_time,json=queryTime,proto3" json:"query_time,omitempty"`
+	ResponseTime    string                 `protobuf:"bytes,3,opt,name=response_time,json=responseTime,proto3" json:"response_time,omitempty"`
+	QueryAddress    string                 `protobuf:"bytes,4,opt,name=query_address,json=queryAddress,proto3" json:"query_address,omitempty"`
+	QueryPort       uint32                 `protobuf:"varint,5,opt,name=query_port,json=queryPort,proto3" json:"query_port,omitempty"`
+	ResponseAddress string                 `protobuf:"bytes,6,opt,name=response_address,json=responseAddress,proto3" json:"response_address,omitempty"`
+	ResponsePort    uint32                 `protobuf:"varint,7,opt,name=response_port,json=responsePort,proto3" json:"response_port,omitempty"`
+	Identity        string                 `protobuf:"bytes,8,opt,name=identity,proto3" json:"identity,omitempty"`
+	Type            string                 `protobuf:"bytes,9,opt,name=type,proto3" json:"type,omitempty"`
+	SocketFamily    string                 `protobuf:"bytes,10,opt,name=socket_family,json=socketFamily,proto3" json:"socket_family,omitempty"`
+	SocketProtocol  string                 `protobuf:"bytes,11,opt,name=socket_protocol,json=socketProtocol,proto3" json:"socket_protocol,omitempty"`
+	Qname           string                 `protobuf:"bytes,12,opt,name=qname,proto3" json:"qname,omitempty"`
+	Qclass          string                 `protobuf:"bytes,13,opt,name=qclass,proto3" json:"qclass,omitempty"`
+	Qtype           string                 `protobuf:"bytes,14,opt,name=qtype,proto3" json:"qtype,omitempty"`
+	Rcode           string                 `protobuf:"bytes,15,opt,name=rcode,proto3" json:"rcode,omitempty"`
+	MessageSize     uint32                 `protobuf:"varint,16,opt,name=message_size,json=messageSize,proto3" json:"message_size,omitempty"`
+	Txid            uint32                 `protobuf:"varint,17,opt,name=txid,proto3" json:"txid,omitempty"`
+	Qdcount         uint32                 `protobuf:"varint,18,opt,name=qdcount,proto3" json:"qdcount,omitempty"`
+	Ancount         uint32                 `protobuf:"varint,19,opt,name=ancount,proto3" json:"ancount,omitempty"`
+	Nscount         uint32                 `protobuf:"varint,20,opt,name=nscount,proto3" json:"nscount,omitempty"`
+	Arcount         uint32                 `protobuf:"varint,21,opt,name=arcount,proto3" json:"arcount,omitempty"`
+	Aa              bool                   `protobuf:"varint,22,opt,name=aa,proto3" json:"aa,omitempty"`
+	Tc              bool                   `protobuf:"varint,23,opt,name=tc,proto3" json:"tc,omitempty"`
+	Rd              bool                   `protobuf:"varint,24,opt,name=rd,proto3" json:"rd,omitempty"`
+	Ra              bool                   `protobuf:"varint,25,opt,name=ra,proto3" json:"ra,omitempty"`
+	Ad              bool                   `protobuf:"varint,26,opt,name=ad,proto3" json:"ad,omitempty"`
+	Cd              bool                   `protobuf:"varint,27,opt,name=cd,proto3" json:"cd,omitempty"`
+	Tld             string                 `protobuf:"bytes,28,opt,name=tld,proto3" json:"tld,omitempty"`
+	Sld             string                 `protobuf:"bytes,29,opt,name=sld,proto3" json:"sld,omitempty"`
+	LatencyMs       float64                `protobuf:"fixed64,30,opt,name=latency_ms,json=latencyMs,proto3" json:"latency_ms,omitempty"`
+	Fields          map[string]string      `protobuf:"bytes,100,rep,name=fields,proto3" json:"fields,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *DNSRecord) Reset() {
+	*x = DNSRecord{}
+	mi := &file_dns_record_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DNSRecord) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DNSRecord) ProtoMessage() {}
+
+func (x *DNSRecord) ProtoReflect() protoreflect.Message {
+	mi := &file_dns_record_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DNSRecord.ProtoReflect.Descriptor instead.
+func (*DNSRecord) Descriptor() ([]byte, []int) {
+	return file_dns_record_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *DNSRecord) GetTimestamp() string {
+	if x != nil {
+		return x.Timestamp
+	}
+	return ""
+}
+
+func (x *DNSRecord) GetQueryTime() string {
+	if x != nil {
+		return x.QueryTime
+	}
+	return ""
+}
+
+func (x *DNSRecord) GetResponseTime() string {
+	if x != nil {
+		return x.ResponseTime
+	}
+	return ""
+}
+
+func (x *DNSRecord) GetQueryAddress() string {
+	if x != nil {
+		return x.QueryAddress
+	}
+	return ""
+}
+
+func (x *DNSRecord) GetQueryPort() uint32 {
+	if x != nil {
+		return x.QueryPort
+	}
+	return 0
+}
+
+func (x *DNSRecord) GetResponseAddress() string {
+	if x != nil {
+		return x.ResponseAddress
+	}
+	return ""
+}
+
+func (x *DNSRecord) GetResponsePort() uint32 {
+	if x != nil {
+		return x.ResponsePort
+	}
+	return 0
+}
+
+func (x *DNSRecord) GetIdentity() string {
+	if x != nil {
+		return x.Identity
+	}
+	return ""
+}
+
+func (x *DNSRecord) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *DNSRecord) GetSocketFamily() string {
+	if x != nil {
+		return x.SocketFamily
+	}
+	return ""
+}
+
+func (x *DNSRecord) GetSocketProtocol() string {
+	if x != nil {
+		return x.SocketProtocol
+	}
+	return ""
+}
+
+func (x *DNSRecord) GetQname() string {
+	if x != nil {
+		return x.Qname
+	}
+	return ""
+}
+
+func (x *DNSRecord) GetQclass() string {
+	if x != nil {
+		return x.Qclass
+	}
+	return ""
+}
+
+func (x *DNSRecord) GetQtype() string {
+	if x != nil {
+		return x.Qtype
+	}
+	return ""
+}
+
+func (x *DNSRecord) GetRcode() string {
+	if x != nil {
+		return x.Rcode
+	}
+	return ""
+}
+
+func (x *DNSRecord) GetMessageSize() uint32 {
+	if x != nil {
+		return x.MessageSize
+	}
+	return 0
+}
+
+func (x *DNSRecord) GetTxid() uint32 {
+	if x != nil {
+		return x.Txid
+	}
+	return 0
+}
+
+func (x *DNSRecord) GetQdcount() uint32 {
+	if x != nil {
+		return x.Qdcount
+	}
+	return 0
+}
+
+func (x *DNSRecord) GetAncount() uint32 {
+	if x != nil {
+		return x.Ancount
+	}
+	return 0
+}
+
+func (x *DNSRecord) GetNscount() uint32 {
+	if x != nil {
+		return x.Nscount
+	}
+	return 0
+}
+
+func (x *DNSRecord) GetArcount() uint32 {
+	if x != nil {
+		return x.Arcount
+	}
+	return 0
+}
+
+func (x *DNSRecord) GetAa() bool {
+	if x != nil {
+		return x.Aa
+	}
+	return false
+}
+
+func (x *DNSRecord) GetTc() bool {
+	if x != nil {
+		return x.Tc
+	}
+	return false
+}
+
+func (x *DNSRecord) GetRd() bool {
+	if x != nil {
+		return x.Rd
+	}
+	return false
+}
+
+func (x *DNSRecord) GetRa() bool {
+	if x != nil {
+		return x.Ra
+	}
+	return false
+}
+
+func (x *DNSRecord) GetAd() bool {
+	if x != nil {
+		return x.Ad
+	}
+	return false
+}
+
+func (x *DNSRecord) GetCd() bool {
+	if x != nil {
+		return x.Cd
+	}
+	return false
+}
+
+func (x *DNSRecord) GetTld() string {
+	if x != nil {
+		return x.Tld
+	}
+	return ""
+}
+
+func (x *DNSRecord) GetSld() string {
+	if x != nil {
+		return x.Sld
+	}
+	return ""
+}
+
+func (x *DNSRecord) GetLatencyMs() float64 {
+	if x != nil {
+		return x.LatencyMs
+	}
+	return 0
+}
+
+func (x *DNSRecord) GetFields() map[string]string {
+	if x != nil {
+		return x.Fields
+	}
+	return nil
+}
+
+type SendResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// accepted is the number of records the server took from the stream.
+	Accepted      uint64 `protobuf:"varint,1,opt,name=accepted,proto3" json:"accepted,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SendResponse) Reset() {
+	*x = SendResponse{}
+	mi := &file_dns_record_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SendResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SendResponse) ProtoMessage() {}
+
+func (x *SendResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_dns_record_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SendResponse.ProtoReflect.Descriptor instead.
+func (*SendResponse) Descriptor() ([]byte, []int) {
+	return file_dns_record_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *SendResponse) GetAccepted() uint64 {
+	if x != nil {
+		return x.Accepted
+	}
+	return 0
+}
+
+var File_dns_record_proto protoreflect.FileDescriptor
+
+var file_dns_record_proto_rawDesc = string([]byte{
+	0x0a, 0x10, 0x64, 0x6e, 0x73, 0x5f, 0x72, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x2e, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x12, 0x04, 0x64, 0x74, 0x61, 0x70, 0x22, 0x8b, 0x07, 0x0a, 0x09, 0x44, 0x4e, 0x53,
+	0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x12, 0x1c, 0x0a, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74,
+	0x61, 0x6d, 0x70, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73,
+	0x74, 0x61, 0x6d, 0x70, 0x12, 0x1d, 0x0a, 0x0a, 0x71, 0x75, 0x65, 0x72, 0x79, 0x5f, 0x74, 0x69,
+	0x6d, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x71, 0x75, 0x65, 0x72, 0x79, 0x54,
+	0x69, 0x6d, 0x65, 0x12, 0x23, 0x0a, 0x0d, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x5f,
+	0x74, 0x69, 0x6d, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x72, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x54, 0x69, 0x6d, 0x65, 0x12, 0x23, 0x0a, 0x0d, 0x71, 0x75, 0x65, 0x72,
+	0x79, 0x5f, 0x61, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x0c, 0x71, 0x75, 0x65, 0x72, 0x79, 0x41, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x12, 0x1d, 0x0a,
+	0x0a, 0x71, 0x75, 0x65, 0x72, 0x79, 0x5f, 0x70, 0x6f, 0x72, 0x74, 0x18, 0x05, 0x20, 0x01, 0x28,
+	0x0d, 0x52, 0x09, 0x71, 0x75, 0x65, 0x72, 0x79, 0x50, 0x6f, 0x72, 0x74, 0x12, 0x29, 0x0a, 0x10,
+	0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x5f, 0x61, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73,
+	0x18, 0x06, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0f, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
+	0x41, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x12, 0x23, 0x0a, 0x0d, 0x72, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x5f, 0x70, 0x6f, 0x72, 0x74, 0x18, 0x07, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0c,
+	0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x50, 0x6f, 0x72, 0x74, 0x12, 0x1a, 0x0a, 0x08,
+	0x69, 0x64, 0x65, 0x6e, 0x74, 0x69, 0x74, 0x79, 0x18, 0x08, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08,
+	0x69, 0x64, 0x65, 0x6e, 0x74, 0x69, 0x74, 0x79, 0x12, 0x12, 0x0a, 0x04, 0x74, 0x79, 0x70, 0x65,
+	0x18, 0x09, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x74, 0x79, 0x70, 0x65, 0x12, 0x23, 0x0a, 0x0d,
+	0x73, 0x6f, 0x63, 0x6b, 0x65, 0x74, 0x5f, 0x66, 0x61, 0x6d, 0x69, 0x6c, 0x79, 0x18, 0x0a, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x0c, 0x73, 0x6f, 0x63, 0x6b, 0x65, 0x74, 0x46, 0x61, 0x6d, 0x69, 0x6c,
+	0x79, 0x12, 0x27, 0x0a, 0x0f, 0x73, 0x6f, 0x63, 0x6b, 0x65, 0x74, 0x5f, 0x70, 0x72, 0x6f, 0x74,
+	0x6f, 0x63, 0x6f, 0x6c, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0e, 0x73, 0x6f, 0x63, 0x6b,
+	0x65, 0x74, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x12, 0x14, 0x0a, 0x05, 0x71, 0x6e,
+	0x61, 0x6d, 0x65, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x71, 0x6e, 0x61, 0x6d, 0x65,
+	0x12, 0x16, 0x0a, 0x06, 0x71, 0x63, 0x6c, 0x61, 0x73, 0x73, 0x18, 0x0d, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x06, 0x71, 0x63, 0x6c, 0x61, 0x73, 0x73, 0x12, 0x14, 0x0a, 0x05, 0x71, 0x74, 0x79, 0x70,
+	0x65, 0x18, 0x0e, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x71, 0x74, 0x79, 0x70, 0x65, 0x12, 0x14,
+	0x0a, 0x05, 0x72, 0x63, 0x6f, 0x64, 0x65, 0x18, 0x0f, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x72,
+	0x63, 0x6f, 0x64, 0x65, 0x12, 0x21, 0x0a, 0x0c, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x5f,
+	0x73, 0x69, 0x7a, 0x65, 0x18, 0x10, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0b, 0x6d, 0x65, 0x73, 0x73,
+	0x61, 0x67, 0x65, 0x53, 0x69, 0x7a, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x74, 0x78, 0x69, 0x64, 0x18,
+	0x11, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x04, 0x74, 0x78, 0x69, 0x64, 0x12, 0x18, 0x0a, 0x07, 0x71,
+	0x64, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x18, 0x12, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x07, 0x71, 0x64,
+	0x63, 0x6f, 0x75, 0x6e, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x61, 0x6e, 0x63, 0x6f, 0x75, 0x6e, 0x74,
+	0x18, 0x13, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x07, 0x61, 0x6e, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x12,
+	0x18, 0x0a, 0x07, 0x6e, 0x73, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x18, 0x14, 0x20, 0x01, 0x28, 0x0d,
+	0x52, 0x07, 0x6e, 0x73, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x61, 0x72, 0x63,
+	0x6f, 0x75, 0x6e, 0x74, 0x18, 0x15, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x07, 0x61, 0x72, 0x63, 0x6f,
+	0x75, 0x6e, 0x74, 0x12, 0x0e, 0x0a, 0x02, 0x61, 0x61, 0x18, 0x16, 0x20, 0x01, 0x28, 0x08, 0x52,
+	0x02, 0x61, 0x61, 0x12, 0x0e, 0x0a, 0x02, 0x74, 0x63, 0x18, 0x17, 0x20, 0x01, 0x28, 0x08, 0x52,
+	0x02, 0x74, 0x63, 0x12, 0x0e, 0x0a, 0x02, 0x72, 0x64, 0x18, 0x18, 0x20, 0x01, 0x28, 0x08, 0x52,
+	0x02, 0x72, 0x64, 0x12, 0x0e, 0x0a, 0x02, 0x72, 0x61, 0x18, 0x19, 0x20, 0x01, 0x28, 0x08, 0x52,
+	0x02, 0x72, 0x61, 0x12, 0x0e, 0x0a, 0x02, 0x61, 0x64, 0x18, 0x1a, 0x20, 0x01, 0x28, 0x08, 0x52,
+	0x02, 0x61, 0x64, 0x12, 0x0e, 0x0a, 0x02, 0x63, 0x64, 0x18, 0x1b, 0x20, 0x01, 0x28, 0x08, 0x52,
+	0x02, 0x63, 0x64, 0x12, 0x10, 0x0a, 0x03, 0x74, 0x6c, 0x64, 0x18, 0x1c, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x03, 0x74, 0x6c, 0x64, 0x12, 0x10, 0x0a, 0x03, 0x73, 0x6c, 0x64, 0x18, 0x1d, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x03, 0x73, 0x6c, 0x64, 0x12, 0x1d, 0x0a, 0x0a, 0x6c, 0x61, 0x74, 0x65, 0x6e,
+	0x63, 0x79, 0x5f, 0x6d, 0x73, 0x18, 0x1e, 0x20, 0x01, 0x28, 0x01, 0x52, 0x09, 0x6c, 0x61, 0x74,
+	0x65, 0x6e, 0x63, 0x79, 0x4d, 0x73, 0x12, 0x33, 0x0a, 0x06, 0x66, 0x69, 0x65, 0x6c, 0x64, 0x73,
+	0x18, 0x64, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x1b, 0x2e, 0x64, 0x74, 0x61, 0x70, 0x2e, 0x44, 0x4e,
+	0x53, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x2e, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x73, 0x45, 0x6e,
+	0x74, 0x72, 0x79, 0x52, 0x06, 0x66, 0x69, 0x65, 0x6c, 0x64, 0x73, 0x1a, 0x39, 0x0a, 0x0b, 0x46,
+	0x69, 0x65, 0x6c, 0x64, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65,
+	0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05,
+	0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x76, 0x61, 0x6c,
+	0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x22, 0x2a, 0x0a, 0x0c, 0x53, 0x65, 0x6e, 0x64, 0x52, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x61, 0x63, 0x63, 0x65, 0x70, 0x74,
+	0x65, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x04, 0x52, 0x08, 0x61, 0x63, 0x63, 0x65, 0x70, 0x74,
+	0x65, 0x64, 0x32, 0x3e, 0x0a, 0x0d, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x53, 0x65, 0x72, 0x76,
+	0x69, 0x63, 0x65, 0x12, 0x2d, 0x0a, 0x04, 0x53, 0x65, 0x6e, 0x64, 0x12, 0x0f, 0x2e, 0x64, 0x74,
+	0x61, 0x70, 0x2e, 0x44, 0x4e, 0x53, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x1a, 0x12, 0x2e, 0x64,
+	0x74, 0x61, 0x70, 0x2e, 0x53, 0x65, 0x6e, 0x64, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
+	0x28, 0x01, 0x42, 0x23, 0x5a, 0x21, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d,
+	0x2f, 0x6d, 0x69, 0x6d, 0x75, 0x72, 0x65, 0x74, 0x2f, 0x64, 0x74, 0x61, 0x70, 0x2f, 0x64, 0x6e,
+	0x73, 0x72, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+})
+
+var (
+	file_dns_record_proto_rawDescOnce sync.Once
+	file_dns_record_proto_rawDescData []byte
+)
+
+func file_dns_record_proto_rawDescGZIP() []byte {
+	file_dns_record_proto_rawDescOnce.Do(func() {
+		file_dns_record_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_dns_record_proto_rawDesc), len(file_dns_record_proto_rawDesc)))
+	})
+	return file_dns_record_proto_rawDescData
+}
+
+var file_dns_record_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_dns_record_proto_goTypes = []any{
+	(*DNSRecord)(nil),    // 0: dtap.DNSRecord
+	(*SendResponse)(nil), // 1: dtap.SendResponse
+	nil,                  // 2: dtap.DNSRecord.FieldsEntry
+}
+var file_dns_record_proto_depIdxs = []int32{
+	2, // 0: dtap.DNSRecord.fields:type_name -> dtap.DNSRecord.FieldsEntry
+	0, // 1: dtap.RecordService.Send:input_type -> dtap.DNSRecord
+	1, // 2: dtap.RecordService.Send:output_type -> dtap.SendResponse
+	2, // [2:3] is the sub-list for method output_type
+	1, // [1:2] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_dns_record_proto_init() }
+func file_dns_record_proto_init() {
+	if File_dns_record_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_dns_record_proto_rawDesc), len(file_dns_record_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   3,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_dns_record_proto_goTypes,
+		DependencyIndexes: file_dns_record_proto_depIdxs,
+		MessageInfos:      file_dns_record_proto_msgTypes,
+	}.Build()
+	File_dns_record_proto = out.File
+	file_dns_record_proto_goTypes = nil
+	file_dns_record_proto_depIdxs = nil
+}
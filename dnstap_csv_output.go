@@ -0,0 +1,102 @@
+/*
+ * Copyright (c) 2019 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+type DnstapCSVOutput struct {
+	config        *OutputCSVConfig
+	flatOption    DnstapFlatOption
+	writer        io.WriteCloser
+	csv           *csv.Writer
+	headerWritten bool
+}
+
+func NewDnstapCSVOutput(config *OutputCSVConfig, params *DnstapOutputParams) *DnstapOutput {
+	params.Handler = &DnstapCSVOutput{
+		config:     config,
+		flatOption: &config.Flat,
+	}
+	return NewDnstapOutput(params)
+}
+
+// open writes the header row once to stdout, or to the file when it is new or empty,
+// so appending to an existing file or reopening it does not repeat the header.
+func (o *DnstapCSVOutput) open() error {
+	if o.config.GetPath() == "" {
+		o.writer = os.Stdout
+	} else {
+		f, err := os.OpenFile(o.config.GetPath(), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+		if err != nil {
+			return errors.Wrapf(err, "can't create file %s", o.config.GetPath())
+		}
+		st, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return errors.Wrapf(err, "can't stat file %s", o.config.GetPath())
+		}
+		o.headerWritten = st.Size() > 0
+		o.writer = f
+	}
+	o.csv = csv.NewWriter(o.writer)
+	if !o.headerWritten {
+		if err := o.csv.Write(o.config.GetColumns()); err != nil {
+			return err
+		}
+		o.headerWritten = true
+	}
+	return nil
+}
+
+func (o *DnstapCSVOutput) write(m *Message) error {
+	records, err := flatFrame(m, o.flatOption)
+	if err != nil {
+		return err
+	}
+	for _, data := range records {
+		m := data.ToMapString()
+		columns := o.config.GetColumns()
+		record := make([]string, len(columns))
+		for n, c := range columns {
+			if v, ok := m[c]; ok && v != nil {
+				record[n] = fmt.Sprint(v)
+			}
+		}
+		if err := o.csv.Write(record); err != nil {
+			return err
+		}
+		o.csv.Flush()
+		if err := o.csv.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *DnstapCSVOutput) close() {
+	o.csv.Flush()
+	if o.writer != os.Stdout {
+		o.writer.Close()
+	}
+}
@@ -0,0 +1,138 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"context"
+	"encoding/csv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/golang/protobuf/proto"
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+func newTestOutputParams() *dtap.DnstapOutputParams {
+	return &dtap.DnstapOutputParams{
+		BufferSize:  128,
+		InCounter:   prometheus.NewCounter(prometheus.CounterOpts{Name: "test_in"}),
+		LostCounter: prometheus.NewCounter(prometheus.CounterOpts{Name: "test_lost"}),
+	}
+}
+
+func newTestFrame(t *testing.T, dt *dnstap.Dnstap) []byte {
+	bs, err := proto.Marshal(dt)
+	assert.NoError(t, err)
+	return bs
+}
+
+func newTestMessage(t *testing.T, dt *dnstap.Dnstap) *dtap.Message {
+	return dtap.NewMessage(newTestFrame(t, dt))
+}
+
+// runTestCSVOutput writes messages by a CSV output to config.Path and returns the rows of the file.
+// The output is stopped after the writer has read all messages, it writes them and flushes on close.
+func runTestCSVOutput(t *testing.T, config *dtap.OutputCSVConfig, messages ...*dtap.Message) [][]string {
+	params := newTestOutputParams()
+	params.Name = t.Name()
+	o := dtap.NewDnstapCSVOutput(config, params)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		o.Run(ctx)
+		close(done)
+	}()
+	for _, m := range messages {
+		o.SetMessage(m)
+	}
+	for i := 0; i < 300 && outputMetric(t, "dtap_output_buffer_depth", params.Name).GetGauge().GetValue() > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	f, err := os.Open(config.Path)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	assert.NoError(t, err)
+	return records
+}
+
+func TestDnstapCSVOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dtap")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	config := &dtap.OutputCSVConfig{
+		Path:    filepath.Join(dir, "out.csv"),
+		Columns: []string{"qname", "qtype", "query_port", "rd"},
+	}
+	records := runTestCSVOutput(t, config,
+		newTestMessage(t, newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("a,b.example.com.", dns.TypeA))),
+		newTestMessage(t, newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("www.example.com.", dns.TypeAAAA))),
+	)
+	assert.Equal(t, [][]string{
+		{"qname", "qtype", "query_port", "rd"},
+		{"a,b.example.com.", "A", "53000", "true"},
+		{"www.example.com.", "AAAA", "53000", "true"},
+	}, records)
+}
+
+func TestDnstapCSVOutputAppendHeader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dtap")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	config := &dtap.OutputCSVConfig{
+		Path:    filepath.Join(dir, "out.csv"),
+		Columns: []string{"qname", "qtype"},
+	}
+	// each run appends to the file of the last run.
+	var records [][]string
+	for _, qname := range []string{"a.example.com.", "b.example.com."} {
+		records = runTestCSVOutput(t, config, newTestMessage(t, newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery(qname, dns.TypeA))))
+	}
+	assert.Equal(t, [][]string{
+		{"qname", "qtype"},
+		{"a.example.com.", "A"},
+		{"b.example.com.", "A"},
+	}, records)
+}
+
+func TestDnstapCSVOutputProbe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dtap")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "out.csv")
+
+	o := dtap.NewDnstapCSVOutput(&dtap.OutputCSVConfig{Path: path}, newTestOutputParams())
+	assert.ErrorIs(t, o.Probe(), dtap.ErrNotProbed)
+	// the probe doesn't create the file.
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,176 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/messaging/azeventhubs/v2"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "github.com/sirupsen/logrus"
+)
+
+var eventHubSendErrors = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "dtap_eventhub_send_errors_total",
+	Help: "The total number of records failed to send to Event Hubs.",
+})
+
+// DnstapEventHubOutput sends flat records as JSON to Azure Event Hubs
+// by the producer client of azeventhubs with SAS authentication.
+type DnstapEventHubOutput struct {
+	config     *OutputEventHubConfig
+	logger     log.FieldLogger
+	flatOption DnstapFlatOption
+	producer   *azeventhubs.ProducerClient
+	batcher    *Batcher
+}
+
+type eventHubEvent struct {
+	body         []byte
+	partitionKey string
+}
+
+func NewDnstapEventHubOutput(config *OutputEventHubConfig, params *DnstapOutputParams) *DnstapOutput {
+	o := &DnstapEventHubOutput{
+		config:     config,
+		logger:     params.GetLogger(),
+		flatOption: &config.Flat,
+	}
+	o.batcher = NewBatcher(config.GetBatchSize(), time.Duration(config.GetFlushInterval())*time.Second, o.send)
+	o.batcher.SetLogger(o.logger)
+	params.Handler = o
+	return NewDnstapOutput(params)
+}
+
+func (o *DnstapEventHubOutput) open() error {
+	producer, err := azeventhubs.NewProducerClientFromConnectionString(o.config.GetConnectionString(), "", nil)
+	if err != nil {
+		return errors.Wrap(err, "can't create event hubs producer")
+	}
+	o.producer = producer
+	o.batcher.Start()
+	return nil
+}
+
+func (o *DnstapEventHubOutput) write(m *Message) error {
+	records, err := flatFrame(m, o.flatOption)
+	if err != nil {
+		return err
+	}
+	for _, data := range records {
+		buf, err := MarshalFlatJSON(data, o.flatOption)
+		if err != nil {
+			return err
+		}
+		e := &eventHubEvent{body: buf}
+		if v, ok := data.ToMapString()[o.config.GetPartitionKeyField()]; ok && v != nil && v != "" {
+			e.partitionKey = fmt.Sprint(v)
+		}
+		if err := o.batcher.Add(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send sends records in batches per partition key within MaxBatchBytes.
+func (o *DnstapEventHubOutput) send(records []interface{}) error {
+	var keys []string
+	events := map[string][]*eventHubEvent{}
+	for _, v := range records {
+		e := v.(*eventHubEvent)
+		if _, ok := events[e.partitionKey]; !ok {
+			keys = append(keys, e.partitionKey)
+		}
+		events[e.partitionKey] = append(events[e.partitionKey], e)
+	}
+	var firstErr error
+	for _, key := range keys {
+		if err := o.sendPartition(key, events[key]); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+func (o *DnstapEventHubOutput) sendPartition(key string, events []*eventHubEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(o.config.GetTimeout())*time.Second)
+	defer cancel()
+	options := &azeventhubs.EventDataBatchOptions{MaxBytes: uint64(o.config.GetMaxBatchBytes())}
+	if key != "" {
+		options.PartitionKey = &key
+	}
+	var batch *azeventhubs.EventDataBatch
+	for n := 0; n < len(events); {
+		if batch == nil {
+			var err error
+			if batch, err = o.producer.NewEventDataBatch(ctx, options); err != nil {
+				eventHubSendErrors.Add(float64(len(events) - n))
+				return errors.Wrap(err, "can't create event hubs batch")
+			}
+		}
+		err := batch.AddEventData(&azeventhubs.EventData{Body: events[n].body}, nil)
+		switch {
+		case err == nil:
+			n++
+		case errors.Is(err, azeventhubs.ErrEventDataTooLarge) && batch.NumEvents() > 0:
+			if err := o.sendBatch(ctx, batch); err != nil {
+				eventHubSendErrors.Add(float64(len(events) - n))
+				return err
+			}
+			batch = nil
+		default:
+			// the event is larger than MaxBatchBytes.
+			eventHubSendErrors.Inc()
+			o.logger.Warnf("event hubs event is dropped: %s", err)
+			n++
+		}
+	}
+	if batch != nil && batch.NumEvents() > 0 {
+		return o.sendBatch(ctx, batch)
+	}
+	return nil
+}
+
+func (o *DnstapEventHubOutput) sendBatch(ctx context.Context, batch *azeventhubs.EventDataBatch) error {
+	if err := o.producer.SendEventDataBatch(ctx, batch, nil); err != nil {
+		eventHubSendErrors.Add(float64(batch.NumEvents()))
+		return errors.Wrap(err, "event hubs send failed")
+	}
+	return nil
+}
+
+func (o *DnstapEventHubOutput) close() {
+	if err := o.batcher.Stop(); err != nil {
+		o.logger.Warnf("event hubs send error: %s", err)
+	}
+	if o.producer == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(o.config.GetTimeout())*time.Second)
+	defer cancel()
+	if err := o.producer.Close(ctx); err != nil {
+		o.logger.Warnf("event hubs close error: %s", err)
+	}
+	o.producer = nil
+}
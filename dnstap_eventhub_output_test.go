@@ -0,0 +1,58 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+func TestOutputEventHubConfig(t *testing.T) {
+	testcases := []struct {
+		config *dtap.OutputEventHubConfig
+		conn   string
+	}{
+		{
+			&dtap.OutputEventHubConfig{ConnectionString: "Endpoint=sb://dtap.servicebus.windows.net/;SharedAccessKeyName=send;SharedAccessKey=a2V5;EntityPath=dnstap"},
+			"Endpoint=sb://dtap.servicebus.windows.net/;SharedAccessKeyName=send;SharedAccessKey=a2V5;EntityPath=dnstap",
+		},
+		{
+			&dtap.OutputEventHubConfig{ConnectionString: "Endpoint=sb://dtap.servicebus.windows.net/;SharedAccessKeyName=send;SharedAccessKey=a2V5", Hub: "dnstap"},
+			"Endpoint=sb://dtap.servicebus.windows.net/;SharedAccessKeyName=send;SharedAccessKey=a2V5;EntityPath=dnstap",
+		},
+		{
+			&dtap.OutputEventHubConfig{Namespace: "dtap", Hub: "dnstap", SharedAccessKeyName: "send", SharedAccessKey: "a2V5"},
+			"Endpoint=sb://dtap.servicebus.windows.net/;SharedAccessKeyName=send;SharedAccessKey=a2V5;EntityPath=dnstap",
+		},
+		{
+			&dtap.OutputEventHubConfig{Namespace: "https://dtap.servicebus.windows.net/", Hub: "dnstap", SharedAccessKeyName: "send", SharedAccessKey: "a2V5"},
+			"Endpoint=sb://dtap.servicebus.windows.net/;SharedAccessKeyName=send;SharedAccessKey=a2V5;EntityPath=dnstap",
+		},
+	}
+	for _, tc := range testcases {
+		assert.Nil(t, tc.config.Validate())
+		assert.Equal(t, tc.conn, tc.config.GetConnectionString())
+	}
+
+	o := &dtap.OutputEventHubConfig{ConnectionString: "Endpoint=sb://dtap.servicebus.windows.net/;EntityPath=dnstap"}
+	assert.NotNil(t, o.Validate())
+	o = &dtap.OutputEventHubConfig{Namespace: "dtap", SharedAccessKeyName: "send", SharedAccessKey: "a2V5"}
+	assert.NotNil(t, o.Validate())
+}
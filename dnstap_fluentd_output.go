@@ -17,39 +17,114 @@
 package dtap
 
 import (
-	dnstap "github.com/dnstap/golang-dnstap"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
 	framestream "github.com/farsightsec/golang-framestream"
 	"github.com/pkg/errors"
 
 	"github.com/fluent/fluent-logger-golang/fluent"
-	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "github.com/sirupsen/logrus"
 )
 
+var fluentPostRecords = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "dtap_fluent_post_records_total",
+	Help: "The total number of records posted to fluent.",
+})
+
+var fluentLatencyFiltered = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "dtap_fluent_latency_filtered_total",
+	Help: "The total number of responses dropped by MinLatencyMs.",
+})
+
+var fluentAnswersFiltered = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "dtap_fluent_answers_filtered_total",
+	Help: "The total number of responses dropped by MinAnswers.",
+})
+
+var fluentSocketFamilyFiltered = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "dtap_fluent_socket_family_filtered_total",
+	Help: "The total number of records dropped by SocketFamilies.",
+})
+
+var fluentRecordTrimmed = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "dtap_fluent_record_trimmed_total",
+	Help: "The total number of records trimmed by MaxRecordBytes.",
+})
+
+var fluentBufferFull = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "dtap_fluent_buffer_full_total",
+	Help: "The total number of records hit the full async buffer.",
+})
+
+var fluentCloseTimeout = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "dtap_fluent_close_timeout_total",
+	Help: "The total number of closes which dropped buffered records by CloseTimeout.",
+})
+
+var fluentFutureSkew = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "dtap_fluent_future_skew_total",
+	Help: "The total number of records clamped or dropped by MaxFutureSkew.",
+})
+
+// the fluent library has no error value for it.
+var fluentBufferFullWant = "Buffer full"
+
 type DnstapFluentdOutput struct {
 	config      *OutputFluentConfig
+	logger      log.FieldLogger
 	fluetConfig fluent.Config
 	enc         *framestream.Encoder
 	client      *fluent.Fluent
 	flatOption  DnstapFlatOption
-	tag         string
+	forward     *forwardClient
+	batcher     *KeyedBatcher
+	now         func() time.Time
+	// pending is the number of records in the async buffer of client.
+	pending int64
 }
 
 func NewDnstapFluentdOutput(config *OutputFluentConfig, params *DnstapOutputParams) *DnstapOutput {
-	params.Handler = &DnstapFluentdOutput{
+	o := &DnstapFluentdOutput{
 		config:     config,
 		flatOption: &config.Flat,
-		fluetConfig: fluent.Config{
-			FluentHost: config.GetHost(),
-			FluentPort: config.GetPort(),
-			Async:      false},
-		tag: config.GetTag(),
+		logger:     params.GetLogger(),
+		now:        params.GetNow(),
 	}
-
+	// writes and acks time out, and Close stops sending the async buffer,
+	// so close is not blocked by a wedged server after CloseTimeout.
+	o.fluetConfig = fluent.Config{
+		FluentHost:         config.GetHost(),
+		FluentPort:         config.GetPort(),
+		Async:              config.Async,
+		BufferLimit:        config.BufferLimit,
+		RequestAck:         config.RequestAck,
+		WriteTimeout:       config.GetWriteTimeout(),
+		ReadTimeout:        config.GetWriteTimeout(),
+		ForceStopAsyncSend: true,
+		AsyncResultCallback: func([]byte, error) {
+			atomic.AddInt64(&o.pending, -1)
+		},
+	}
+	params.Handler = o
 	return NewDnstapOutput(params)
 }
 
 func (o *DnstapFluentdOutput) open() error {
 	var err error
+	if o.config.GetForwardCompression() == "gzip" {
+		address := net.JoinHostPort(o.config.GetHost(), strconv.Itoa(o.config.GetPort()))
+		o.forward = newForwardClient(address, o.config.GetWriteTimeout(), o.config.RequestAck)
+		o.batcher = NewKeyedBatcher(o.config.GetBatchSize(), time.Duration(o.config.GetFlushInterval())*time.Second, o.forward.send)
+		o.batcher.SetLogger(o.logger)
+		return nil
+	}
 	o.client, err = fluent.New(o.fluetConfig)
 	if err != nil {
 		return errors.Wrapf(err, "can't create fluent logger")
@@ -58,21 +133,184 @@ func (o *DnstapFluentdOutput) open() error {
 	return nil
 }
 
-func (o *DnstapFluentdOutput) write(frame []byte) error {
-	dt := dnstap.Dnstap{}
-	if err := proto.Unmarshal(frame, &dt); err != nil {
-		return err
+func (o *DnstapFluentdOutput) Probe() error {
+	address := net.JoinHostPort(o.config.GetHost(), strconv.Itoa(o.config.GetPort()))
+	conn, err := net.DialTimeout("tcp", address, ProbeTimeout)
+	if err != nil {
+		return errors.Wrapf(err, "can't connect fluent host, address: %s", address)
 	}
-	data, err := FlatDnstap(&dt, o.flatOption)
+	conn.Close()
+	return nil
+}
+
+func (o *DnstapFluentdOutput) write(m *Message) error {
+	return o.writeContext(context.Background(), m)
+}
+
+// writeContext writes m, the block OverflowPolicy waits for the async buffer until ctx is done.
+func (o *DnstapFluentdOutput) writeContext(ctx context.Context, m *Message) error {
+	records, err := flatFrameRecords(m, o.flatOption)
 	if err != nil {
 		return err
 	}
-	if err := o.client.Post(o.tag, *data); err != nil {
-		return errors.Wrapf(err, "failed to post fluent message, tag: %s", o.tag)
+	f := newRecordFilter(o.flatOption)
+	for _, data := range records {
+		if !f.keep(data, DropReasonSocketFamily, fluentSocketFamilyFiltered, func() bool { return !o.config.SkipSocketFamily(data) }) {
+			continue
+		}
+		if !f.keep(data, DropReasonLatency, fluentLatencyFiltered, func() bool { return !o.config.SkipLatency(data) }) {
+			continue
+		}
+		if !f.keep(data, DropReasonAnswers, fluentAnswersFiltered, func() bool { return !o.config.SkipAnswers(data) }) {
+			continue
+		}
+		if !f.keep(data, DropReasonFutureSkew, fluentFutureSkew, func() bool { return o.checkFutureSkew(data) }) {
+			continue
+		}
+		setSequence(data, o.flatOption)
+		if o.config.MaxRecordBytes > 0 {
+			ok, err := TrimFlatRecord(data, o.flatOption, o.config.MaxRecordBytes)
+			if err != nil {
+				return err
+			}
+			if data.RecordTrimmed {
+				fluentRecordTrimmed.Inc()
+			}
+			if !ok {
+				o.logger.Debugf("record is larger than MaxRecordBytes after trimming, qname: %s", data.Qname)
+			}
+		}
+		tag := o.config.GetQtypeTag(data.Qtype)
+		if o.batcher != nil {
+			e, err := newForwardEntry(tag, o.now(), flatMap(data, o.flatOption))
+			if err != nil {
+				return err
+			}
+			key := ""
+			if o.config.BatchByTag {
+				key = tag
+			}
+			if err := o.batcher.Add(key, e); err != nil {
+				return err
+			}
+			continue
+		}
+		message, err := flatMessage(data, o.flatOption)
+		if err != nil {
+			return err
+		}
+		posted, err := o.post(ctx, tag, message)
+		if err != nil {
+			return errors.Wrapf(err, "failed to post fluent message, tag: %s", tag)
+		}
+		if posted {
+			fluentPostRecords.Inc()
+		}
 	}
 	return nil
 }
 
+// checkFutureSkew returns false when data is ahead of now by more than MaxFutureSkew
+// and dropped by FutureSkewPolicy, or clamps its timestamp to now.
+// Drops are counted by the caller, so FilterDryRun can keep them.
+func (o *DnstapFluentdOutput) checkFutureSkew(data *DnstapFlatT) bool {
+	if o.config.MaxFutureSkew <= 0 {
+		return true
+	}
+	now := o.now()
+	ts, err := time.Parse(time.RFC3339Nano, data.Timestamp)
+	if err != nil || !ts.After(now.Add(o.config.GetMaxFutureSkew())) {
+		return true
+	}
+	if o.config.GetFutureSkewPolicy() == "drop" {
+		return false
+	}
+	fluentFutureSkew.Inc()
+	data.Timestamp = now.Format(time.RFC3339Nano)
+	data.TimestampClamped = true
+	if data.TimestampEpoch != nil {
+		data.TimestampEpoch = timestampEpoch(data.Timestamp, o.flatOption.GetEpochUnit())
+	}
+	return true
+}
+
+// post returns false when the message is dropped by OverflowPolicy.
+// The block policy returns the error of ctx when it is done while waiting.
+func (o *DnstapFluentdOutput) post(ctx context.Context, tag string, message interface{}) (bool, error) {
+	full := false
+	for {
+		if o.config.Async {
+			atomic.AddInt64(&o.pending, 1)
+		}
+		err := o.client.Post(tag, message)
+		if err == nil {
+			return true, nil
+		}
+		if o.config.Async {
+			atomic.AddInt64(&o.pending, -1)
+		}
+		if !strings.Contains(err.Error(), fluentBufferFullWant) {
+			return false, err
+		}
+		if !full {
+			fluentBufferFull.Inc()
+			full = true
+		}
+		switch o.config.GetOverflowPolicy() {
+		case "block":
+			select {
+			case <-ctx.Done():
+				return false, ctx.Err()
+			case <-time.After(10 * time.Millisecond):
+			}
+		case "error":
+			return false, err
+		default:
+			return false, nil
+		}
+	}
+}
+
+// close flushes buffered records to the current connection before closing it,
+// on reconnect and shutdown alike. When it takes longer than CloseTimeout,
+// the flush is canceled and the left records are dropped.
 func (o *DnstapFluentdOutput) close() {
-	o.client.Close()
+	deadline := time.Now().Add(o.config.GetCloseTimeout())
+	flushed := true
+	if o.batcher != nil {
+		done := make(chan struct{})
+		go func(batcher *KeyedBatcher) {
+			defer close(done)
+			if err := batcher.Stop(); err != nil {
+				o.logger.Warnf("fluent flush error: %s", err)
+			}
+		}(o.batcher)
+		timer := time.NewTimer(time.Until(deadline))
+		select {
+		case <-done:
+		case <-timer.C:
+			flushed = false
+			// fails the write in flight and the left sends without connecting again.
+			o.forward.abort()
+			<-done
+		}
+		timer.Stop()
+		o.forward.close()
+	} else if o.client != nil {
+		for atomic.LoadInt64(&o.pending) > 0 {
+			if !time.Now().Before(deadline) {
+				flushed = false
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		// ForceStopAsyncSend drops records left in the async buffer.
+		o.client.Close()
+		atomic.StoreInt64(&o.pending, 0)
+	}
+	if !flushed {
+		fluentCloseTimeout.Inc()
+		o.logger.Warnf("fluent buffered records are not flushed in %s, dropped", o.config.GetCloseTimeout())
+	}
+	o.batcher, o.forward, o.client = nil, nil, nil
 }
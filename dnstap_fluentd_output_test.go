@@ -0,0 +1,539 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/golang/protobuf/proto"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/tinylib/msgp/msgp"
+
+	"github.com/mimuret/dtap"
+)
+
+func TestDnstapFluentdOutputRequestAck(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+	received := make(chan []interface{}, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := msgp.NewReader(conn)
+		for {
+			v, err := r.ReadIntf()
+			if err != nil {
+				return
+			}
+			msg := v.([]interface{})
+			option := msg[3].(map[string]interface{})
+			ack, err := msgp.AppendMapStrIntf(nil, map[string]interface{}{"ack": option["chunk"]})
+			assert.NoError(t, err)
+			conn.Write(ack)
+			received <- msg
+		}
+	}()
+
+	config := &dtap.OutputFluentConfig{
+		Host:       "127.0.0.1",
+		Port:       uint16(l.Addr().(*net.TCPAddr).Port),
+		Tag:        "dnstap",
+		RequestAck: true,
+	}
+	assert.Nil(t, config.Validate())
+	o := dtap.NewDnstapFluentdOutput(config, newTestOutputParams())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go o.Run(ctx)
+	o.SetMessage(newTestMessage(t, newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("www.example.com.", dns.TypeA))))
+
+	select {
+	case msg := <-received:
+		assert.Equal(t, "dnstap", msg[0])
+		assert.NotEmpty(t, msg[3].(map[string]interface{})["chunk"])
+		record := msg[2].(map[string]interface{})
+		assert.Equal(t, "www.example.com.", record["qname"])
+	case <-time.After(5 * time.Second):
+		t.Fatal("no fluent message")
+	}
+}
+
+func TestDnstapFluentdOutputForwardCompression(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+	received := make(chan []interface{}, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := msgp.NewReader(conn)
+		for {
+			v, err := r.ReadIntf()
+			if err != nil {
+				return
+			}
+			msg := v.([]interface{})
+			option := msg[2].(map[string]interface{})
+			ack, err := msgp.AppendMapStrIntf(nil, map[string]interface{}{"ack": option["chunk"]})
+			assert.NoError(t, err)
+			conn.Write(ack)
+			received <- msg
+		}
+	}()
+
+	config := &dtap.OutputFluentConfig{
+		Host:               "127.0.0.1",
+		Port:               uint16(l.Addr().(*net.TCPAddr).Port),
+		Tag:                "dnstap",
+		RequestAck:         true,
+		ForwardCompression: "gzip",
+		BatchSize:          2,
+	}
+	assert.Nil(t, config.Validate())
+	o := dtap.NewDnstapFluentdOutput(config, newTestOutputParams())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go o.Run(ctx)
+	for _, qname := range []string{"a.example.com.", "b.example.com."} {
+		o.SetMessage(newTestMessage(t, newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery(qname, dns.TypeA))))
+	}
+
+	select {
+	case msg := <-received:
+		assert.Equal(t, "dnstap", msg[0])
+		option := msg[2].(map[string]interface{})
+		assert.Equal(t, "gzip", option["compressed"])
+		assert.NotEmpty(t, option["chunk"])
+		zr, err := gzip.NewReader(bytes.NewReader(msg[1].([]byte)))
+		assert.NoError(t, err)
+		entries, err := ioutil.ReadAll(zr)
+		assert.NoError(t, err)
+		r := msgp.NewReader(bytes.NewReader(entries))
+		for _, qname := range []string{"a.example.com.", "b.example.com."} {
+			v, err := r.ReadIntf()
+			if assert.NoError(t, err) {
+				record := v.([]interface{})[1].(map[string]interface{})
+				assert.Equal(t, qname, record["qname"])
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no fluent message")
+	}
+
+	assert.NotNil(t, (&dtap.OutputFluentConfig{Host: "127.0.0.1", Tag: "dnstap", ForwardCompression: "zstd"}).Validate())
+}
+
+func TestDnstapFluentdOutputCloseTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	config := &dtap.OutputFluentConfig{
+		Host:         "127.0.0.1",
+		Port:         uint16(port),
+		Tag:          "dnstap",
+		Async:        true,
+		BufferLimit:  16,
+		CloseTimeout: 1,
+	}
+	assert.Nil(t, config.Validate())
+	o := dtap.NewDnstapFluentdOutput(config, newTestOutputParams())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		o.Run(ctx)
+		close(done)
+	}()
+	o.SetMessage(newTestMessage(t, newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("www.example.com.", dns.TypeA))))
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("close is not bounded by CloseTimeout")
+	}
+
+	// the forward flush to a server never acking is canceled, closing its connection.
+	l, err = net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+	closed := make(chan struct{})
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		ioutil.ReadAll(conn)
+		close(closed)
+	}()
+	config = &dtap.OutputFluentConfig{
+		Host:               "127.0.0.1",
+		Port:               uint16(l.Addr().(*net.TCPAddr).Port),
+		Tag:                "dnstap",
+		RequestAck:         true,
+		ForwardCompression: "gzip",
+		BatchSize:          100,
+		FlushInterval:      60,
+		CloseTimeout:       1,
+	}
+	assert.Nil(t, config.Validate())
+	o = dtap.NewDnstapFluentdOutput(config, newTestOutputParams())
+	ctx, cancel = context.WithCancel(context.Background())
+	done = make(chan struct{})
+	go func() {
+		o.Run(ctx)
+		close(done)
+	}()
+	o.SetMessage(newTestMessage(t, newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("www.example.com.", dns.TypeA))))
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2500 * time.Millisecond):
+		t.Fatal("forward flush is not canceled by CloseTimeout")
+	}
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("forward connection is left open")
+	}
+}
+
+// newTestFluentAckServer returns a fluent server acking RequestAck posts of message and forward modes.
+func newTestFluentAckServer(t *testing.T) (net.Listener, chan []interface{}) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	received := make(chan []interface{}, 16)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := msgp.NewReader(conn)
+		for {
+			v, err := r.ReadIntf()
+			if err != nil {
+				return
+			}
+			msg := v.([]interface{})
+			option := msg[len(msg)-1].(map[string]interface{})
+			ack, err := msgp.AppendMapStrIntf(nil, map[string]interface{}{"ack": option["chunk"]})
+			assert.NoError(t, err)
+			conn.Write(ack)
+			received <- msg
+		}
+	}()
+	return l, received
+}
+
+func TestDnstapFluentdOutputCloseFlush(t *testing.T) {
+	testcases := []struct {
+		name   string
+		config dtap.OutputFluentConfig
+	}{
+		{"async", dtap.OutputFluentConfig{Async: true}},
+		{"forward", dtap.OutputFluentConfig{ForwardCompression: "gzip", BatchSize: 100, FlushInterval: 60}},
+	}
+	for _, tc := range testcases {
+		l, received := newTestFluentAckServer(t)
+		config := tc.config
+		config.Host = "127.0.0.1"
+		config.Port = uint16(l.Addr().(*net.TCPAddr).Port)
+		config.Tag = "dnstap"
+		config.RequestAck = true
+		assert.Nil(t, config.Validate())
+		o := dtap.NewDnstapFluentdOutput(&config, newTestOutputParams())
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			o.Run(ctx)
+			close(done)
+		}()
+		for _, qname := range []string{"a.example.com.", "b.example.com.", "c.example.com."} {
+			o.SetMessage(newTestMessage(t, newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery(qname, dns.TypeA))))
+		}
+		time.Sleep(100 * time.Millisecond)
+		// the records buffered by the client are flushed to the live server on close.
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("output is not closed", tc.name)
+		}
+		records := 0
+		for len(received) > 0 {
+			msg := <-received
+			if size, ok := msg[len(msg)-1].(map[string]interface{})["size"]; ok {
+				n, _ := size.(int64)
+				records += int(n)
+			} else {
+				records++
+			}
+		}
+		assert.Equal(t, 3, records, tc.name)
+		l.Close()
+	}
+}
+
+func TestDnstapFluentdOutputMaxFutureSkew(t *testing.T) {
+	// the test query is timestamped an hour ahead of the clock.
+	now := time.Unix(1546300800, 0).Add(-time.Hour)
+	for _, policy := range []string{"clamp", "drop"} {
+		l, received := newTestFluentAckServer(t)
+		config := &dtap.OutputFluentConfig{
+			Host:             "127.0.0.1",
+			Port:             uint16(l.Addr().(*net.TCPAddr).Port),
+			Tag:              "dnstap",
+			RequestAck:       true,
+			MaxFutureSkew:    60,
+			FutureSkewPolicy: policy,
+		}
+		assert.Nil(t, config.Validate())
+		params := newTestOutputParams()
+		params.Now = func() time.Time { return now }
+		o := dtap.NewDnstapFluentdOutput(config, params)
+		ctx, cancel := context.WithCancel(context.Background())
+		go o.Run(ctx)
+		o.SetMessage(newTestMessage(t, newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("future.example.com.", dns.TypeA))))
+		dt := newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("www.example.com.", dns.TypeA))
+		sec := uint64(now.Unix())
+		dt.Message.QueryTimeSec = &sec
+		o.SetMessage(newTestMessage(t, dt))
+
+		select {
+		case msg := <-received:
+			record := msg[2].(map[string]interface{})
+			if policy == "clamp" {
+				assert.Equal(t, "future.example.com.", record["qname"])
+				assert.Equal(t, true, record["timestamp_clamped"])
+				ts, err := time.Parse(time.RFC3339Nano, record["timestamp"].(string))
+				assert.NoError(t, err)
+				assert.True(t, ts.Before(time.Unix(1546300800, 0)))
+			} else {
+				assert.Equal(t, "www.example.com.", record["qname"])
+				assert.NotEqual(t, true, record["timestamp_clamped"])
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no fluent message")
+		}
+		cancel()
+		l.Close()
+	}
+
+	assert.NotNil(t, (&dtap.OutputFluentConfig{Host: "127.0.0.1", Tag: "dnstap", FutureSkewPolicy: "ignore"}).Validate())
+}
+
+func TestDnstapFluentdOutputSequence(t *testing.T) {
+	l, received := newTestFluentAckServer(t)
+	defer l.Close()
+	config := &dtap.OutputFluentConfig{
+		Host:       "127.0.0.1",
+		Port:       uint16(l.Addr().(*net.TCPAddr).Port),
+		Tag:        "dnstap",
+		RequestAck: true,
+		MinAnswers: 1,
+		Flat:       dtap.FlatConfig{IncludeSequence: true},
+	}
+	assert.Nil(t, config.Validate())
+	o := dtap.NewDnstapFluentdOutput(config, newTestOutputParams())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go o.Run(ctx)
+	q := newTestQuery("www.example.com.", dns.TypeA)
+	o.SetMessage(newTestMessage(t, newTestDnstap(t, dnstap.Message_CLIENT_QUERY, q)))
+	// the response without answers is dropped by MinAnswers and not numbered.
+	o.SetMessage(newTestMessage(t, newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, newTestResponse(q))))
+	o.SetMessage(newTestMessage(t, newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, newTestResponse(q, "www.example.com. 300 IN A 192.0.2.1"))))
+
+	for _, seq := range []int{1, 2} {
+		select {
+		case msg := <-received:
+			record := msg[2].(map[string]interface{})
+			assert.EqualValues(t, seq, record["seq"])
+		case <-time.After(5 * time.Second):
+			t.Fatal("no fluent message")
+		}
+	}
+}
+
+func TestDnstapFluentdOutputFilterDryRun(t *testing.T) {
+	l, received := newTestFluentAckServer(t)
+	defer l.Close()
+	config := &dtap.OutputFluentConfig{
+		Host:       "127.0.0.1",
+		Port:       uint16(l.Addr().(*net.TCPAddr).Port),
+		Tag:        "dnstap",
+		RequestAck: true,
+		MinAnswers: 1,
+		Flat:       dtap.FlatConfig{FilterDryRun: true},
+	}
+	assert.Nil(t, config.Validate())
+	o := dtap.NewDnstapFluentdOutput(config, newTestOutputParams())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go o.Run(ctx)
+	q := newTestQuery("www.example.com.", dns.TypeA)
+	o.SetMessage(newTestMessage(t, newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, newTestResponse(q))))
+
+	select {
+	case msg := <-received:
+		record := msg[2].(map[string]interface{})
+		assert.Equal(t, true, record["would_drop"])
+		assert.Equal(t, dtap.DropReasonAnswers, record["would_drop_reason"])
+	case <-time.After(5 * time.Second):
+		t.Fatal("no fluent message")
+	}
+}
+
+// benchmarkFluentdOutput measures CPU per record and bytes on the wire per record
+// of posting typical query records to a server discarding them.
+func benchmarkFluentdOutput(b *testing.B, compression string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer l.Close()
+	var received int64
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		received, _ = io.Copy(ioutil.Discard, conn)
+	}()
+
+	config := &dtap.OutputFluentConfig{
+		Host:               "127.0.0.1",
+		Port:               uint16(l.Addr().(*net.TCPAddr).Port),
+		Tag:                "dnstap",
+		ForwardCompression: compression,
+		BatchSize:          500,
+	}
+	if err := config.Validate(); err != nil {
+		b.Fatal(err)
+	}
+	params := newTestOutputParams()
+	params.Block = true
+	o := dtap.NewDnstapFluentdOutput(config, params)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		o.Run(ctx)
+		close(done)
+	}()
+	// queries of distinct qnames, clients and times, not to overstate compression.
+	var frames [][]byte
+	for i := 0; i < 256; i++ {
+		mt := dnstap.Message_CLIENT_QUERY
+		bs, _ := newTestQuery(fmt.Sprintf("host%x.zone%d.example.com.", i*7919, i%13), dns.TypeA).Pack()
+		frame, err := proto.Marshal(&dnstap.Dnstap{
+			Type: dnstap.Dnstap_MESSAGE.Enum(),
+			Message: &dnstap.Message{
+				Type:          &mt,
+				SocketFamily:  dnstap.SocketFamily_INET.Enum(),
+				QueryAddress:  net.IPv4(192, 0, 2, byte(i)).To4(),
+				QueryPort:     proto.Uint32(uint32(1024 + i*211)),
+				QueryTimeSec:  proto.Uint64(1546300800 + uint64(i)),
+				QueryTimeNsec: proto.Uint32(uint32(i * 3907)),
+				QueryMessage:  bs,
+			},
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		frames = append(frames, frame)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		o.SetMessage(dtap.NewMessage(frames[i%len(frames)]))
+	}
+	cancel()
+	<-done
+	b.StopTimer()
+	// the output may be canceled before it connects in a short run.
+	l.Close()
+	<-served
+	b.ReportMetric(float64(received)/float64(b.N), "B/record")
+}
+
+func BenchmarkDnstapFluentdOutputMessage(b *testing.B) {
+	benchmarkFluentdOutput(b, "none")
+}
+
+func BenchmarkDnstapFluentdOutputGzip(b *testing.B) {
+	benchmarkFluentdOutput(b, "gzip")
+}
+
+func TestDnstapFluentdOutputBlockCanceled(t *testing.T) {
+	// the async buffer is never sent, as the server is down.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	config := &dtap.OutputFluentConfig{
+		Host:           "127.0.0.1",
+		Port:           uint16(port),
+		Tag:            "dnstap",
+		Async:          true,
+		BufferLimit:    1,
+		OverflowPolicy: "block",
+		CloseTimeout:   1,
+	}
+	assert.Nil(t, config.Validate())
+	o := dtap.NewDnstapFluentdOutput(config, newTestOutputParams())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		o.Run(ctx)
+		close(done)
+	}()
+	for i := 0; i < 4; i++ {
+		o.SetMessage(newTestMessage(t, newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("www.example.com.", dns.TypeA))))
+	}
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("block policy is not canceled by ctx")
+	}
+}
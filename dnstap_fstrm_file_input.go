@@ -80,6 +80,7 @@ func NewDnstapFstrmFileInput(config *InputFileConfig) (*DnstapFstrmFileInput, er
 		return nil, errors.Wrapf(err, "failed to create fstrm input, path: %s", config.GetPath())
 	}
 
+	input.SetSource(config.GetSource())
 	i := &DnstapFstrmFileInput{
 		config: config,
 		input:  input,
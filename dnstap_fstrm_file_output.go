@@ -30,6 +30,7 @@ import (
 
 type DnstapFstrmFileOutput struct {
 	config          *OutputFileConfig
+	logger          log.FieldLogger
 	currentFilename string
 	enc             *framestream.Encoder
 	writer          io.WriteCloser
@@ -39,13 +40,14 @@ type DnstapFstrmFileOutput struct {
 func NewDnstapFstrmFileOutput(config *OutputFileConfig, params *DnstapOutputParams) *DnstapOutput {
 	params.Handler = &DnstapFstrmFileOutput{
 		config: config,
+		logger: params.GetLogger(),
 	}
 	return NewDnstapOutput(params)
 }
 
 func (o *DnstapFstrmFileOutput) open() error {
 	filename := strftime.Format(o.config.GetPath(), time.Now())
-	log.Debugf("open output file %s\n", filename)
+	o.logger.Debugf("open output file %s\n", filename)
 
 	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
 	if err != nil {
@@ -82,8 +84,11 @@ func (o *DnstapFstrmFileOutput) open() error {
 	return nil
 }
 
-func (o *DnstapFstrmFileOutput) write(frame []byte) error {
-	if _, err := o.enc.Write(frame); err != nil {
+func (o *DnstapFstrmFileOutput) write(m *Message) error {
+	if m.flush {
+		return nil
+	}
+	if _, err := o.enc.Write(m.Frame); err != nil {
 		o.close()
 		return err
 	}
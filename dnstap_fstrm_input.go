@@ -19,7 +19,9 @@ package dtap
 import (
 	"context"
 	"io"
+	"net"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/pkg/errors"
 
 	dnstap "github.com/dnstap/golang-dnstap"
@@ -32,6 +34,12 @@ type DnstapFstrmInput struct {
 	rc        io.ReadCloser
 	readError chan error
 	finished  bool
+	source    string
+	// transportAddr is the peer of the connection.
+	transportAddr *net.TCPAddr
+	// identity is set to frames, only to frames without identity unless override.
+	identity string
+	override bool
 }
 
 func NewDnstapFstrmInput(rc io.ReadCloser, bi bool) (*DnstapFstrmInput, error) {
@@ -48,6 +56,40 @@ func NewDnstapFstrmInput(rc io.ReadCloser, bi bool) (*DnstapFstrmInput, error) {
 		readError: make(chan error),
 	}, nil
 }
+
+// SetSource sets the source label of messages.
+func (i *DnstapFstrmInput) SetSource(source string) {
+	i.source = source
+}
+
+// SetTransportAddr sets the transport address of messages.
+func (i *DnstapFstrmInput) SetTransportAddr(addr *net.TCPAddr) {
+	i.transportAddr = addr
+}
+
+// SetIdentity sets identity of frames, with override false only of frames without identity.
+func (i *DnstapFstrmInput) SetIdentity(identity string, override bool) {
+	i.identity = identity
+	i.override = override
+}
+
+// stampIdentity returns frame with identity, malformed frames are returned as is.
+func stampIdentity(frame []byte, identity string, override bool) []byte {
+	dt := &dnstap.Dnstap{}
+	if err := proto.Unmarshal(frame, dt); err != nil {
+		return frame
+	}
+	if !override && len(dt.GetIdentity()) > 0 {
+		return frame
+	}
+	dt.Identity = []byte(identity)
+	buf, err := proto.Marshal(dt)
+	if err != nil {
+		return frame
+	}
+	return buf
+}
+
 func (i *DnstapFstrmInput) read(rbuf *RBuf) {
 	for {
 		buf, err := i.decoder.Decode()
@@ -61,17 +103,25 @@ func (i *DnstapFstrmInput) read(rbuf *RBuf) {
 		}
 		newbuf := make([]byte, len(buf))
 		copy(newbuf, buf)
-		rbuf.Write(newbuf)
+		if i.identity != "" {
+			newbuf = stampIdentity(newbuf, i.identity, i.override)
+		}
+		m := NewMessage(newbuf)
+		m.Source = i.source
+		m.TransportAddr = i.transportAddr
+		rbuf.Write(m)
 	}
 }
 func (i *DnstapFstrmInput) Read(ctx context.Context, rbuf *RBuf) error {
 	var err error
 	go i.read(rbuf)
+	done := ctx.Done()
 L:
 	for {
 		select {
-		case <-ctx.Done():
+		case <-done:
 			i.rc.Close()
+			done = nil
 		case err = <-i.readError:
 			break L
 		}
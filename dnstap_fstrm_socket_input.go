@@ -18,33 +18,126 @@ package dtap
 
 import (
 	"context"
+	"crypto/tls"
 	"net"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	log "github.com/sirupsen/logrus"
 )
 
 var closeWant string = "use of closed network connection"
 
+// TLSHandshakeTimeout is max duration of the TLS handshake of TLS identity connections.
+var TLSHandshakeTimeout = 10 * time.Second
+
+var (
+	inputConnections = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "dtap_input_connections",
+		Help: "Current number of socket input connections.",
+	}, []string{"listen"})
+	inputConnectionsRefused = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "dtap_input_connections_refused_total",
+		Help: "Total number of socket input connections refused by MaxConnections.",
+	}, []string{"listen"})
+)
+
 type DnstapFstrmSocketInput struct {
-	listener  net.Listener
-	readError chan error
+	listener    net.Listener
+	readTimeout time.Duration
+	readError   chan error
+	wg          sync.WaitGroup
+	// conns limits concurrent connections, nil is unlimited.
+	conns       chan struct{}
+	connections prometheus.Gauge
+	refused     prometheus.Counter
+	source      string
+	// tlsIdentity sets identity of frames by the client certificate, only to empty ones by tlsIdentityDefault.
+	tlsIdentity        bool
+	tlsIdentityDefault bool
+}
+
+// NewDnstapFstrmSocketInput returns input of listener.
+// Connections over maxConnections are closed on accept, 0 is unlimited.
+func NewDnstapFstrmSocketInput(listener net.Listener, readTimeout time.Duration, maxConnections int) (*DnstapFstrmSocketInput, error) {
+	listen := listener.Addr().String()
+	i := &DnstapFstrmSocketInput{
+		listener:    listener,
+		readTimeout: readTimeout,
+		readError:   make(chan error, 1),
+		connections: inputConnections.WithLabelValues(listen),
+		refused:     inputConnectionsRefused.WithLabelValues(listen),
+		source:      listener.Addr().Network() + ":" + listen,
+	}
+	if maxConnections > 0 {
+		i.conns = make(chan struct{}, maxConnections)
+	}
+	return i, nil
+}
+
+// SetSource sets the source label of messages, empty keeps network:address of the listener.
+func (i *DnstapFstrmSocketInput) SetSource(source string) {
+	if source != "" {
+		i.source = source
+	}
+}
+
+// SetTLSIdentity sets identity of frames to the CN, or the first DNS SAN, of the verified client certificate.
+// With onlyEmpty, identity of frames is set only when it is empty.
+// Connections without a client certificate are closed.
+func (i *DnstapFstrmSocketInput) SetTLSIdentity(onlyEmpty bool) {
+	i.tlsIdentity = true
+	i.tlsIdentityDefault = onlyEmpty
+}
+
+// tlsIdentity returns the identity of the client certificate of conn.
+func tlsIdentity(conn net.Conn) (string, error) {
+	if c, ok := conn.(*timeoutConn); ok {
+		conn = c.Conn
+	}
+	tc, ok := conn.(*tls.Conn)
+	if !ok {
+		return "", errors.New("not a TLS connection")
+	}
+	tc.SetDeadline(time.Now().Add(TLSHandshakeTimeout))
+	if err := tc.Handshake(); err != nil {
+		return "", errors.Wrap(err, "TLS handshake error")
+	}
+	tc.SetDeadline(time.Time{})
+	certs := tc.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return "", errors.New("no client certificate")
+	}
+	if cn := certs[0].Subject.CommonName; cn != "" {
+		return cn, nil
+	}
+	if len(certs[0].DNSNames) > 0 {
+		return certs[0].DNSNames[0], nil
+	}
+	return "", errors.New("no CN or DNS SAN in client certificate")
 }
 
-func NewDnstapFstrmSocketInput(listener net.Listener) (*DnstapFstrmSocketInput, error) {
-	return &DnstapFstrmSocketInput{
-		listener:  listener,
-		readError: make(chan error),
-	}, nil
+// timeoutConn extends the read deadline before each read.
+type timeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *timeoutConn) Read(p []byte) (int, error) {
+	if err := c.Conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(p)
 }
 
 func (i *DnstapFstrmSocketInput) runRead(ctx context.Context, rbuf *RBuf) {
-	readCtx, readCancel := context.WithCancel(ctx)
 	for {
 		conn, err := i.listener.Accept()
 		if err != nil {
-			readCancel()
 			if strings.Contains(err.Error(), closeWant) {
 				i.readError <- nil
 				return
@@ -52,27 +145,79 @@ func (i *DnstapFstrmSocketInput) runRead(ctx context.Context, rbuf *RBuf) {
 			i.readError <- errors.Wrapf(err, "can't accept socket")
 			return
 		}
-		input, err := NewDnstapFstrmInput(conn, true)
-		if err != nil {
-			log.Debugf("can't create NewDnstapFstrmInput: %s", err)
-			continue
+		if i.conns != nil {
+			select {
+			case i.conns <- struct{}{}:
+			default:
+				i.refused.Inc()
+				log.Debugf("refuse connection from %s, too many connections", conn.RemoteAddr())
+				conn.Close()
+				continue
+			}
+		}
+		if i.readTimeout > 0 {
+			conn = &timeoutConn{Conn: conn, timeout: i.readTimeout}
 		}
-		childCtx, _ := context.WithCancel(readCtx)
-		go input.Read(childCtx, rbuf)
+		i.wg.Add(1)
+		go i.handle(ctx, conn, rbuf)
+	}
+}
+
+func (i *DnstapFstrmSocketInput) handle(ctx context.Context, conn net.Conn, rbuf *RBuf) {
+	defer i.wg.Done()
+	i.connections.Inc()
+	defer i.connections.Dec()
+	if i.conns != nil {
+		defer func() { <-i.conns }()
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		conn.Close()
+	}()
+	var identity string
+	if i.tlsIdentity {
+		var err error
+		if identity, err = tlsIdentity(conn); err != nil {
+			log.Debugf("refuse connection from %s: %s", conn.RemoteAddr(), err)
+			return
+		}
+	}
+	input, err := NewDnstapFstrmInput(conn, true)
+	if err != nil {
+		log.Debugf("can't create NewDnstapFstrmInput: %s", err)
+		return
+	}
+	input.SetSource(i.source)
+	if identity != "" {
+		input.SetIdentity(identity, !i.tlsIdentityDefault)
+	}
+	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		input.SetTransportAddr(addr)
+	}
+	if err := input.Read(ctx, rbuf); err != nil && ctx.Err() == nil {
+		// producer closed or crashed in the middle of a frame
+		log.Debugf("reset connection from %s: %s", conn.RemoteAddr(), err)
 	}
-	return
 }
 
 func (i *DnstapFstrmSocketInput) Run(ctx context.Context, rbuf *RBuf) error {
 	var err error
-	childCtx, _ := context.WithCancel(ctx)
+	childCtx, cancel := context.WithCancel(ctx)
 	go i.runRead(childCtx, rbuf)
 	select {
 	case <-ctx.Done():
 		i.listener.Close()
+		err = <-i.readError
 	case err = <-i.readError:
-		break
+		i.listener.Close()
 	}
+	cancel()
+	i.wg.Wait()
 	log.Info("finish input")
 	return err
 }
@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) 2019 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+func TestDnstapFstrmSocketInputPartialRead(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	input, err := dtap.NewDnstapFstrmSocketInput(l, 200*time.Millisecond, 0)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- input.Run(ctx, dtap.NewRbuf(8, nil, nil))
+	}()
+
+	// partial control frame, then producer crash
+	conn, err := net.Dial("tcp", l.Addr().String())
+	assert.NoError(t, err)
+	conn.Write([]byte{0, 0, 0, 0, 0, 0})
+	conn.Close()
+
+	// idle connection is closed by read timeout
+	conn, err = net.Dial("tcp", l.Addr().String())
+	assert.NoError(t, err)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = ioutil.ReadAll(conn)
+	assert.NoError(t, err)
+	conn.Close()
+
+	// still accepting
+	conn, err = net.Dial("tcp", l.Addr().String())
+	assert.NoError(t, err)
+
+	cancel()
+	select {
+	case err := <-errCh:
+		assert.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("input did not finish")
+	}
+	conn.Close()
+}
+
+func TestDnstapFstrmSocketInputMaxConnections(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	input, err := dtap.NewDnstapFstrmSocketInput(l, 0, 1)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go input.Run(ctx, dtap.NewRbuf(8, nil, nil))
+
+	// accepted connections wait for the handshake, refused ones are closed.
+	accepted := func() bool {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if !assert.NoError(t, err) {
+			return false
+		}
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		_, err = ioutil.ReadAll(conn)
+		return err != nil
+	}
+	first, err := net.Dial("tcp", l.Addr().String())
+	assert.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+	assert.False(t, accepted())
+
+	first.Close()
+	ok := false
+	for n := 0; n < 10 && !ok; n++ {
+		ok = accepted()
+	}
+	assert.True(t, ok)
+}
@@ -17,15 +17,20 @@
 package dtap
 
 import (
+	"net"
+	"sync"
 	"time"
 
+	dnstap "github.com/dnstap/golang-dnstap"
 	framestream "github.com/farsightsec/golang-framestream"
 	"github.com/pkg/errors"
 )
 
 type DnstapFstrmSocketOutput struct {
 	handler SocketOutput
+	mux     sync.Mutex
 	enc     *framestream.Encoder
+	conn    net.Conn
 	opened  chan bool
 }
 
@@ -36,38 +41,79 @@ func NewDnstapFstrmSocketOutput(handler SocketOutput, params *DnstapOutputParams
 	return NewDnstapOutput(params)
 }
 
+// newFstrmEncoder does the bidirectional handshake on conn within HandshakeTimeout.
+func newFstrmEncoder(conn net.Conn) (*framestream.Encoder, error) {
+	conn.SetDeadline(time.Now().Add(HandshakeTimeout))
+	enc, err := framestream.NewEncoder(conn, &framestream.EncoderOptions{ContentType: dnstap.FSContentType, Bidirectional: true})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return enc, nil
+}
+
 func (o *DnstapFstrmSocketOutput) open() error {
-	var err error
-	if o.enc, err = o.handler.newConnect(); err != nil {
+	enc, conn, err := o.handler.newConnect()
+	if err != nil {
+		time.Sleep(o.handler.reconnectInterval())
 		return errors.Wrapf(err, "can't connect socket")
 	}
+	o.enc = enc
+	o.conn = conn
 	o.opened = make(chan bool)
-	go func() {
+	go func(opened chan bool) {
 		ticker := time.NewTicker(FlushTimeout)
+		defer ticker.Stop()
 		for {
 			select {
-			case <-o.opened:
+			case <-opened:
 				return
 			case <-ticker.C:
-				if err := o.enc.Flush(); err != nil {
+				o.mux.Lock()
+				err := enc.Flush()
+				o.mux.Unlock()
+				if err != nil {
 					return
 				}
 			}
 		}
-	}()
+	}(o.opened)
 	return nil
 }
 
-func (o *DnstapFstrmSocketOutput) write(frame []byte) error {
-	if _, err := o.enc.Write(frame); err != nil {
-		o.close()
+// Probe dials the socket and closes it without the handshake.
+func (o *DnstapFstrmSocketOutput) Probe() error {
+	conn, err := o.handler.dial()
+	if err != nil {
 		return err
 	}
+	conn.Close()
 	return nil
 }
 
+func (o *DnstapFstrmSocketOutput) write(m *Message) error {
+	if m.flush {
+		return nil
+	}
+	o.mux.Lock()
+	defer o.mux.Unlock()
+	_, err := o.enc.Write(m.Frame)
+	return err
+}
+
 func (o *DnstapFstrmSocketOutput) close() {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+	if o.enc == nil {
+		return
+	}
+	close(o.opened)
+	// bounds flush and waiting FINISH on a wedged peer.
+	o.conn.SetDeadline(time.Now().Add(HandshakeTimeout))
 	o.enc.Flush()
 	o.enc.Close()
-	close(o.opened)
+	o.conn.Close()
+	o.enc = nil
+	o.conn = nil
 }
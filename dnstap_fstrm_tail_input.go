@@ -112,6 +112,7 @@ func (i *DnstapFstrmTailInput) runReadFile(ctx context.Context, filename string,
 	if err != nil {
 		return err
 	}
+	input.SetSource(i.config.GetSource())
 	for {
 		input.Read(ctx, rbuf)
 		timer := time.NewTimer(5 * time.Minute)
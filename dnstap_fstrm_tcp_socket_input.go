@@ -17,15 +17,56 @@
 package dtap
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
 	"net"
 
 	"github.com/pkg/errors"
 )
 
 func NewDnstapFstrmTCPSocketInput(config *InputTCPSocketConfig) (*DnstapFstrmSocketInput, error) {
-	l, err := net.Listen("tcp", config.GetNet())
+	lc := net.ListenConfig{KeepAlive: config.GetKeepAliveInterval()}
+	l, err := lc.Listen(context.Background(), "tcp", config.GetNet())
 	if err != nil {
 		return nil, errors.Wrapf(err, "can't listen %s", config.GetNet())
 	}
-	return NewDnstapFstrmSocketInput(l)
+	if config.TLSCert != "" {
+		tlsConfig, err := inputTLSConfig(config)
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+		l = tls.NewListener(l, tlsConfig)
+	}
+	i, err := NewDnstapFstrmSocketInput(l, config.GetReadTimeout(), config.MaxConnections)
+	if err != nil {
+		return nil, err
+	}
+	i.SetSource(config.GetSource())
+	if config.UseTLSIdentity {
+		i.SetTLSIdentity(config.TLSIdentityDefault)
+	}
+	return i, nil
+}
+
+func inputTLSConfig(config *InputTCPSocketConfig) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(config.TLSCert, config.TLSKey)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't load server certificate")
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if config.TLSClientCA != "" {
+		ca, err := ioutil.ReadFile(config.TLSClientCA)
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't read TLSClientCA file: %s", config.TLSClientCA)
+		}
+		tlsConfig.ClientCAs = x509.NewCertPool()
+		if !tlsConfig.ClientCAs.AppendCertsFromPEM(ca) {
+			return nil, errors.Errorf("no certificate in TLSClientCA file: %s", config.TLSClientCA)
+		}
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
 }
@@ -0,0 +1,150 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	framestream "github.com/farsightsec/golang-framestream"
+	"github.com/golang/protobuf/proto"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+// newTestCert returns a certificate signed by parent, self-signed when parent is nil.
+func newTestCert(t *testing.T, template *x509.Certificate, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	signer, signerKey := template, interface{}(key)
+	if parent != nil {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	assert.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func writeTestCert(t *testing.T, dir, name string, cert tls.Certificate) {
+	keyDER, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	assert.NoError(t, err)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name+".pem"), certPEM, 0600))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name+"-key.pem"), keyPEM, 0600))
+}
+
+func TestDnstapFstrmTCPSocketInputTLSIdentity(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dtap")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	ca := newTestCert(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test ca"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+	server := newTestCert(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "dtap"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, &ca)
+	client := newTestCert(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "ns1.example.jp"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, &ca)
+	writeTestCert(t, dir, "ca", ca)
+	writeTestCert(t, dir, "server", server)
+
+	config := &dtap.InputTCPSocketConfig{
+		Address:        "127.0.0.1",
+		Port:           uint16(30000 + time.Now().UnixNano()%10000),
+		TLSCert:        filepath.Join(dir, "server.pem"),
+		TLSKey:         filepath.Join(dir, "server-key.pem"),
+		TLSClientCA:    filepath.Join(dir, "ca.pem"),
+		UseTLSIdentity: true,
+	}
+	assert.Nil(t, config.Validate())
+	input, err := dtap.NewDnstapFstrmTCPSocketInput(config)
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rbuf := newTestRbuf(8)
+	go input.Run(ctx, rbuf)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Leaf)
+	send := func(certs []tls.Certificate) error {
+		conn, err := tls.Dial("tcp", config.GetNet(), &tls.Config{RootCAs: roots, Certificates: certs})
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		enc, err := framestream.NewEncoder(conn, &framestream.EncoderOptions{ContentType: dnstap.FSContentType, Bidirectional: true})
+		if err != nil {
+			return err
+		}
+		dt := newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("www.example.com.", dns.TypeA))
+		dt.Identity = []byte("spoofed")
+		if _, err := enc.Write(newTestFrame(t, dt)); err != nil {
+			return err
+		}
+		return enc.Close()
+	}
+
+	assert.NoError(t, send([]tls.Certificate{client}))
+	select {
+	case m := <-rbuf.Read():
+		dt := &dnstap.Dnstap{}
+		assert.NoError(t, proto.Unmarshal(m.Frame, dt))
+		assert.Equal(t, "ns1.example.jp", string(dt.GetIdentity()))
+	case <-time.After(2 * time.Second):
+		t.Fatal("no frame")
+	}
+
+	// without a client certificate
+	send(nil)
+	select {
+	case <-rbuf.Read():
+		t.Fatal("frame without a client certificate")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	assert.NotNil(t, (&dtap.InputTCPSocketConfig{Address: "127.0.0.1", UseTLSIdentity: true}).Validate())
+	assert.NotNil(t, (&dtap.InputTCPSocketConfig{Address: "127.0.0.1", TLSCert: "cert.pem"}).Validate())
+}
@@ -18,8 +18,8 @@ package dtap
 
 import (
 	"net"
+	"time"
 
-	dnstap "github.com/dnstap/golang-dnstap"
 	framestream "github.com/farsightsec/golang-framestream"
 	"github.com/pkg/errors"
 )
@@ -33,16 +33,45 @@ func NewDnstapFstrmTCPSocketOutput(config *OutputTCPSocketConfig, params *Dnstap
 	return NewDnstapFstrmSocketOutput(tcp, params)
 }
 
-func (o *DnstapFstrmTCPSocketOutput) newConnect() (*framestream.Encoder, error) {
-	w, err := net.Dial("tcp", o.config.GetAddress())
+func (o *DnstapFstrmTCPSocketOutput) dial() (net.Conn, error) {
+	d := net.Dialer{Timeout: o.config.GetConnectTimeout(), KeepAlive: o.config.GetKeepAliveInterval()}
+	w, err := d.Dial("tcp", o.config.GetAddress())
 	if err != nil {
-
 		return nil, errors.Wrapf(err, "can't connect tcp socket, address: %s", o.config.GetAddress())
 	}
-	enc, err := framestream.NewEncoder(w, &framestream.EncoderOptions{ContentType: dnstap.FSContentType, Bidirectional: true})
+	return w, nil
+}
+
+func (o *DnstapFstrmTCPSocketOutput) newConnect() (*framestream.Encoder, net.Conn, error) {
+	w, err := o.dial()
 	if err != nil {
+		return nil, nil, err
+	}
+	if o.config.GetWriteTimeout() > 0 {
+		w = &writeTimeoutConn{Conn: w, timeout: o.config.GetWriteTimeout()}
+	}
+	enc, err := newFstrmEncoder(w)
+	if err != nil {
+
+		return nil, nil, errors.Wrapf(err, "can't create fstrm encorder, address: %s", o.config.GetAddress())
+	}
+	return enc, w, nil
+}
+
+func (o *DnstapFstrmTCPSocketOutput) reconnectInterval() time.Duration {
+	return ReconnectInterval
+}
+
+// writeTimeoutConn extends the write deadline before each write,
+// so a peer that stops reading fails the write instead of blocking forever.
+type writeTimeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
 
-		return nil, errors.Wrapf(err, "can't create fstrm encorder, address: %s", o.config.GetAddress())
+func (c *writeTimeoutConn) Write(p []byte) (int, error) {
+	if err := c.Conn.SetWriteDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
 	}
-	return enc, nil
+	return c.Conn.Write(p)
 }
@@ -0,0 +1,146 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	framestream "github.com/farsightsec/golang-framestream"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+func TestDnstapFstrmTCPSocketOutputWriteTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			// handshake, then stop reading like a wedged peer.
+			if _, err := framestream.NewDecoder(conn, &framestream.DecoderOptions{ContentType: dnstap.FSContentType, Bidirectional: true}); err != nil {
+				conn.Close()
+				continue
+			}
+			accepted <- conn
+		}
+	}()
+
+	config := &dtap.OutputTCPSocketConfig{
+		Host:              "127.0.0.1",
+		Port:              uint16(l.Addr().(*net.TCPAddr).Port),
+		ConnectTimeout:    1,
+		WriteTimeout:      1,
+		KeepAliveInterval: 1,
+	}
+	assert.Nil(t, config.Validate())
+	o := dtap.NewDnstapFstrmTCPSocketOutput(config, newTestOutputParams())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go o.Run(ctx)
+
+	frame := make([]byte, 64*1024)
+	timeout := time.After(20 * time.Second)
+	for n := 0; n < 2; {
+		select {
+		case conn := <-accepted:
+			defer conn.Close()
+			n++
+		case <-timeout:
+			t.Fatal("output doesn't reconnect from the wedged peer")
+		default:
+			o.SetMessage(dtap.NewMessage(frame))
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+func TestDnstapOutputShutdownTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			framestream.NewDecoder(conn, &framestream.DecoderOptions{ContentType: dnstap.FSContentType, Bidirectional: true})
+		}
+	}()
+
+	config := &dtap.OutputTCPSocketConfig{
+		Host: "127.0.0.1",
+		Port: uint16(l.Addr().(*net.TCPAddr).Port),
+	}
+	assert.Nil(t, config.Validate())
+	logger, hook := test.NewNullLogger()
+	params := newTestOutputParams().WithLogger(logger)
+	params.ShutdownTimeout = time.Second
+	o := dtap.NewDnstapFstrmTCPSocketOutput(config, params)
+	ctx, cancel := context.WithCancel(context.Background())
+	finished := make(chan struct{})
+	go func() {
+		o.Run(ctx)
+		close(finished)
+	}()
+	// the wedged peer blocks writes without WriteTimeout.
+	frame := make([]byte, 64*1024)
+	for n := 0; n < 128; n++ {
+		o.SetMessage(dtap.NewMessage(frame))
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("output doesn't exit on shutdown timeout")
+	}
+	if assert.NotNil(t, hook.LastEntry()) {
+		assert.Contains(t, hook.LastEntry().Message, "shutdown timeout exceeded")
+	}
+}
+
+func TestOutputTCPSocketConfigTimeout(t *testing.T) {
+	config := &dtap.OutputTCPSocketConfig{Host: "127.0.0.1"}
+	assert.Equal(t, 10*time.Second, config.GetConnectTimeout())
+	assert.Equal(t, time.Duration(0), config.GetWriteTimeout())
+	config.WriteTimeout = 3
+	assert.Equal(t, 3*time.Second, config.GetWriteTimeout())
+}
+
+func TestDnstapFstrmTCPSocketOutputProbe(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	port := uint16(l.Addr().(*net.TCPAddr).Port)
+	o := dtap.NewDnstapFstrmTCPSocketOutput(&dtap.OutputTCPSocketConfig{Host: "127.0.0.1", Port: port}, newTestOutputParams())
+	assert.NoError(t, o.Probe())
+
+	l.Close()
+	assert.Error(t, o.Probe())
+}
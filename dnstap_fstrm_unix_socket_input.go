@@ -45,5 +45,10 @@ func NewDnstapFstrmUnixSocketInput(config *InputUnixSocketConfig) (*DnstapFstrmS
 			}
 		}
 	}
-	return NewDnstapFstrmSocketInput(l)
+	i, err := NewDnstapFstrmSocketInput(l, config.GetReadTimeout(), config.MaxConnections)
+	if err != nil {
+		return nil, err
+	}
+	i.SetSource(config.GetSource())
+	return i, nil
 }
@@ -18,10 +18,10 @@ package dtap
 
 import (
 	"net"
+	"time"
 
 	"github.com/pkg/errors"
 
-	dnstap "github.com/dnstap/golang-dnstap"
 	framestream "github.com/farsightsec/golang-framestream"
 )
 
@@ -36,16 +36,27 @@ func NewDnstapFstrmUnixSockOutput(config *OutputUnixSocketConfig, params *Dnstap
 	return NewDnstapFstrmSocketOutput(unix, params)
 }
 
-func (o *DnstapFstrmUnixSockOutput) newConnect() (*framestream.Encoder, error) {
-	w, err := net.Dial("unix", o.config.GetPath())
+func (o *DnstapFstrmUnixSockOutput) dial() (net.Conn, error) {
+	w, err := net.DialTimeout("unix", o.config.GetPath(), ProbeTimeout)
 	if err != nil {
-
 		return nil, errors.Wrapf(err, "can't connect unix socket, path: %s", o.config.GetPath())
 	}
-	enc, err := framestream.NewEncoder(w, &framestream.EncoderOptions{ContentType: dnstap.FSContentType, Bidirectional: true})
+	return w, nil
+}
+
+func (o *DnstapFstrmUnixSockOutput) newConnect() (*framestream.Encoder, net.Conn, error) {
+	w, err := o.dial()
+	if err != nil {
+		return nil, nil, err
+	}
+	enc, err := newFstrmEncoder(w)
 	if err != nil {
 
-		return nil, errors.Wrapf(err, "can't create fstrm encorder, path: %s", o.config.GetPath())
+		return nil, nil, errors.Wrapf(err, "can't create fstrm encorder, path: %s", o.config.GetPath())
 	}
-	return enc, nil
+	return enc, w, nil
+}
+
+func (o *DnstapFstrmUnixSockOutput) reconnectInterval() time.Duration {
+	return o.config.GetReconnect()
 }
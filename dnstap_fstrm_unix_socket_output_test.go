@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+func newTestRbuf(size uint) *dtap.RBuf {
+	return dtap.NewRbuf(size, prometheus.NewCounter(prometheus.CounterOpts{Name: "in"}), prometheus.NewCounter(prometheus.CounterOpts{Name: "lost"}))
+}
+
+func startTestUnixInput(t *testing.T, path string, rbuf *dtap.RBuf) context.CancelFunc {
+	input, err := dtap.NewDnstapFstrmUnixSocketInput(&dtap.InputUnixSocketConfig{Path: path})
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		input.Run(ctx, rbuf)
+		close(done)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// receiveWhile sends frame until it is received, for reconnecting output.
+func receiveWhile(t *testing.T, o dtap.Output, frame []byte, rbuf *dtap.RBuf) {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	timeout := time.After(5 * time.Second)
+	for {
+		o.SetMessage(dtap.NewMessage(frame))
+		select {
+		case got := <-rbuf.Read():
+			assert.Equal(t, frame, got.Frame)
+			return
+		case <-ticker.C:
+		case <-timeout:
+			t.Fatal("frame is not relayed")
+		}
+	}
+}
+
+func TestDnstapFstrmUnixSockOutputReconnect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dtap")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dnstap.sock")
+
+	rbuf := newTestRbuf(16)
+	stop := startTestUnixInput(t, path, rbuf)
+
+	o := dtap.NewDnstapFstrmUnixSockOutput(&dtap.OutputUnixSocketConfig{Path: path, Reconnect: 1}, newTestOutputParams())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go o.Run(ctx)
+
+	frame := newTestFrame(t, newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("www.example.com.", dns.TypeA)))
+	receiveWhile(t, o, frame, rbuf)
+
+	// downstream socket disappears and comes back
+	stop()
+	os.Remove(path)
+	stop = startTestUnixInput(t, path, rbuf)
+	defer stop()
+	receiveWhile(t, o, frame, rbuf)
+}
+
+func TestDnstapFstrmUnixSockOutputProbe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dtap")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dnstap.sock")
+
+	o := dtap.NewDnstapFstrmUnixSockOutput(&dtap.OutputUnixSocketConfig{Path: path}, newTestOutputParams())
+	assert.Error(t, o.Probe())
+
+	cancel := startTestUnixInput(t, path, newTestRbuf(16))
+	defer cancel()
+	assert.NoError(t, o.Probe())
+}
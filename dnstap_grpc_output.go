@@ -0,0 +1,315 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/mimuret/dtap/dnsrecord"
+)
+
+var errGRPCStreamClosed = errors.New("grpc stream closed")
+
+// NewDNSRecord returns a flat record map as DNSRecord of assets/dns_record.proto.
+// Keys without a field are set in fields as strings, zero values are omitted like proto3.
+func NewDNSRecord(m map[string]interface{}) *dnsrecord.DNSRecord {
+	r := &dnsrecord.DNSRecord{}
+	pr := r.ProtoReflect()
+	fields := pr.Descriptor().Fields()
+	known := make(map[string]struct{}, fields.Len())
+	for i := 0; i < fields.Len(); i++ {
+		f := fields.Get(i)
+		if f.IsMap() {
+			continue
+		}
+		name := string(f.Name())
+		known[name] = struct{}{}
+		v, ok := m[name]
+		if !ok {
+			v = m[camelCase(name)]
+		}
+		switch f.Kind() {
+		case protoreflect.StringKind:
+			if s := grpcString(v); s != "" {
+				pr.Set(f, protoreflect.ValueOfString(s))
+			}
+		case protoreflect.Uint32Kind:
+			if n := grpcNumber(v); n > 0 {
+				pr.Set(f, protoreflect.ValueOfUint32(uint32(n)))
+			}
+		case protoreflect.BoolKind:
+			if t, _ := v.(bool); t {
+				pr.Set(f, protoreflect.ValueOfBool(true))
+			}
+		case protoreflect.DoubleKind:
+			if n := grpcNumber(v); n != 0 {
+				pr.Set(f, protoreflect.ValueOfFloat64(n))
+			}
+		}
+	}
+	for k, v := range m {
+		if _, ok := known[k]; ok || v == nil {
+			continue
+		}
+		if r.Fields == nil {
+			r.Fields = map[string]string{}
+		}
+		r.Fields[k] = grpcString(v)
+	}
+	return r
+}
+
+func grpcString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	}
+	return fmt.Sprint(v)
+}
+
+// grpcNumber returns the number of v, numbers made strings by NumbersAsStrings are parsed back.
+func grpcNumber(v interface{}) float64 {
+	switch v := exprValue(v).(type) {
+	case float64:
+		return v
+	case string:
+		n, _ := strconv.ParseFloat(v, 64)
+		return n
+	}
+	return 0
+}
+
+type grpcStream struct {
+	client  grpc.ClientStreamingClient[dnsrecord.DNSRecord, dnsrecord.SendResponse]
+	cancel  context.CancelFunc
+	records int
+	opened  time.Time
+}
+
+// DnstapGRPCOutput streams flat records as DNSRecord messages of assets/dns_record.proto
+// to a client-streaming RPC by google.golang.org/grpc, plaintext or TLS.
+// A stream is kept open across batches and ended after StreamMaxRecords or StreamMaxAge,
+// when the server responds with the status. The stream is canceled when a batch isn't sent in SendTimeout.
+// When a stream breaks, the rest of the batch is sent to a new stream once, records already
+// sent to the broken stream are not sent again not to duplicate them, so they may be lost.
+type DnstapGRPCOutput struct {
+	config     *OutputGRPCConfig
+	logger     log.FieldLogger
+	flatOption DnstapFlatOption
+	creds      credentials.TransportCredentials
+	conn       *grpc.ClientConn
+	batcher    *Batcher
+	now        func() time.Time
+	mux        sync.Mutex
+	stream     *grpcStream
+}
+
+func NewDnstapGRPCOutput(config *OutputGRPCConfig, params *DnstapOutputParams) (*DnstapOutput, error) {
+	creds := insecure.NewCredentials()
+	if config.TLS {
+		tlsConfig, err := newClientTLSConfig(config.TLSCA, config.TLSCert, config.TLSKey, config.TLSInsecureSkipVerify)
+		if err != nil {
+			return nil, err
+		}
+		creds = credentials.NewTLS(tlsConfig)
+	}
+	o := &DnstapGRPCOutput{
+		config:     config,
+		logger:     params.GetLogger(),
+		flatOption: &config.Flat,
+		creds:      creds,
+		now:        params.GetNow(),
+	}
+	// the endpoint is checked here, the connection is made by open.
+	conn, err := o.newClient()
+	if err != nil {
+		return nil, err
+	}
+	o.conn = conn
+	o.batcher = NewBatcher(config.GetBatchSize(), time.Duration(config.GetFlushInterval())*time.Second, o.send)
+	o.batcher.SetLogger(o.logger)
+	params.Handler = o
+	return NewDnstapOutput(params), nil
+}
+
+func (o *DnstapGRPCOutput) newClient() (*grpc.ClientConn, error) {
+	conn, err := grpc.NewClient(o.config.Endpoint,
+		grpc.WithTransportCredentials(o.creds),
+		grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff:           backoff.DefaultConfig,
+			MinConnectTimeout: time.Duration(o.config.GetDialTimeout()) * time.Second,
+		}),
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't create grpc client, endpoint: %s", o.config.Endpoint)
+	}
+	return conn, nil
+}
+
+// open makes a new connection when close has closed the last one.
+func (o *DnstapGRPCOutput) open() error {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+	if o.conn == nil {
+		conn, err := o.newClient()
+		if err != nil {
+			return err
+		}
+		o.conn = conn
+	}
+	o.batcher.Start()
+	return nil
+}
+
+// Probe connects to the endpoint and waits for the connection up to DialTimeout.
+func (o *DnstapGRPCOutput) Probe() error {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(o.config.GetDialTimeout())*time.Second)
+	defer cancel()
+	o.conn.Connect()
+	for {
+		state := o.conn.GetState()
+		if state == connectivity.Ready {
+			return nil
+		}
+		if !o.conn.WaitForStateChange(ctx, state) {
+			return errors.Errorf("can't connect grpc endpoint, endpoint: %s, state: %s", o.config.Endpoint, state)
+		}
+	}
+}
+
+func (o *DnstapGRPCOutput) write(m *Message) error {
+	records, err := flatFrame(m, o.flatOption)
+	if err != nil {
+		return err
+	}
+	for _, data := range records {
+		if err := o.batcher.Add(NewDNSRecord(data.ToMapString())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openStream starts the RPC with Metadata, it waits for the connection up to DialTimeout.
+func (o *DnstapGRPCOutput) openStream() (*grpcStream, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if len(o.config.Metadata) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, metadata.New(o.config.Metadata))
+	}
+	cs, err := o.conn.NewStream(ctx, &dnsrecord.RecordService_ServiceDesc.Streams[0], o.config.GetMethod())
+	if err != nil {
+		cancel()
+		return nil, errors.Wrapf(err, "can't open grpc stream, endpoint: %s", o.config.Endpoint)
+	}
+	return &grpcStream{
+		client: &grpc.GenericClientStream[dnsrecord.DNSRecord, dnsrecord.SendResponse]{ClientStream: cs},
+		cancel: cancel,
+		opened: o.now(),
+	}, nil
+}
+
+// finishStream ends the stream and returns the error of the status of the server.
+func (o *DnstapGRPCOutput) finishStream() error {
+	s := o.stream
+	o.stream = nil
+	defer s.cancel()
+	timer := time.AfterFunc(time.Duration(o.config.GetSendTimeout())*time.Second, s.cancel)
+	defer timer.Stop()
+	res, err := s.client.CloseAndRecv()
+	if err != nil {
+		return errors.Wrapf(err, "grpc stream failed, endpoint: %s", o.config.Endpoint)
+	}
+	o.logger.Debugf("grpc server accepted %d records", res.GetAccepted())
+	return nil
+}
+
+// writeStream sends records to the stream, the stream is canceled when they aren't sent in SendTimeout.
+// It returns the number of the sent records, the stream is ended by an error.
+func (o *DnstapGRPCOutput) writeStream(records []interface{}) (int, error) {
+	if o.stream == nil {
+		s, err := o.openStream()
+		if err != nil {
+			return 0, err
+		}
+		o.stream = s
+	}
+	timer := time.AfterFunc(time.Duration(o.config.GetSendTimeout())*time.Second, o.stream.cancel)
+	defer timer.Stop()
+	for n, r := range records {
+		if err := o.stream.client.Send(r.(*dnsrecord.DNSRecord)); err != nil {
+			// the cause of the error is the status of the stream.
+			if err := o.finishStream(); err != nil {
+				return n, err
+			}
+			return n, errGRPCStreamClosed
+		}
+		o.stream.records++
+	}
+	return len(records), nil
+}
+
+func (o *DnstapGRPCOutput) send(records []interface{}) error {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+	n, err := o.writeStream(records)
+	if err != nil {
+		o.logger.Warnf("grpc stream broken, send the rest to a new stream: %s", err)
+		if _, err := o.writeStream(records[n:]); err != nil {
+			return err
+		}
+	}
+	if o.stream.records >= o.config.GetStreamMaxRecords() ||
+		o.now().Sub(o.stream.opened) >= time.Duration(o.config.GetStreamMaxAge())*time.Second {
+		return o.finishStream()
+	}
+	return nil
+}
+
+func (o *DnstapGRPCOutput) close() {
+	if err := o.batcher.Stop(); err != nil {
+		o.logger.Warnf("grpc send error: %s", err)
+	}
+	o.mux.Lock()
+	defer o.mux.Unlock()
+	if o.stream != nil {
+		if err := o.finishStream(); err != nil {
+			o.logger.Warnf("grpc stream error: %s", err)
+		}
+	}
+	if err := o.conn.Close(); err != nil {
+		o.logger.Warnf("grpc close error: %s", err)
+	}
+	o.conn = nil
+}
@@ -0,0 +1,267 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/mimuret/dtap"
+	"github.com/mimuret/dtap/dnsrecord"
+)
+
+func TestNewDNSRecord(t *testing.T) {
+	r := dtap.NewDNSRecord(map[string]interface{}{
+		"timestamp":    "2019-01-01T00:00:00Z",
+		"query_port":   int64(53000),
+		"qname":        "www.example.com.",
+		"message_size": "33",
+		"rd":           true,
+		"tc":           false,
+		"latency_ms":   1.5,
+		"edns_version": 0,
+		"none":         nil,
+	})
+	assert.Equal(t, "2019-01-01T00:00:00Z", r.Timestamp)
+	assert.Equal(t, uint32(53000), r.QueryPort)
+	assert.Equal(t, "www.example.com.", r.Qname)
+	assert.Equal(t, uint32(33), r.MessageSize)
+	assert.True(t, r.Rd)
+	assert.False(t, r.Tc)
+	assert.Equal(t, 1.5, r.LatencyMs)
+	assert.Equal(t, map[string]string{"edns_version": "0"}, r.Fields)
+}
+
+// testRecordServer receives records, Abort ends the first stream with an error after the number of records.
+type testRecordServer struct {
+	dnsrecord.UnimplementedRecordServiceServer
+	records chan *dnsrecord.DNSRecord
+	Abort   int
+	Block   bool
+	// Fail is the number of first streams failed before receiving records.
+	Fail    int32
+	streams int32
+}
+
+func (s *testRecordServer) Send(stream grpc.ClientStreamingServer[dnsrecord.DNSRecord, dnsrecord.SendResponse]) error {
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	if v := md.Get("authorization"); len(v) != 1 || v[0] != "Bearer test" {
+		return status.Error(codes.Unauthenticated, "no token")
+	}
+	count := atomic.AddInt32(&s.streams, 1)
+	if count <= s.Fail {
+		return status.Error(codes.Unavailable, "fail")
+	}
+	first := count == 1
+	if s.Block {
+		<-stream.Context().Done()
+		return stream.Context().Err()
+	}
+	var n uint64
+	for {
+		r, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&dnsrecord.SendResponse{Accepted: n})
+		}
+		if err != nil {
+			return err
+		}
+		s.records <- r
+		n++
+		if first && int(n) == s.Abort {
+			return status.Error(codes.Unavailable, "abort")
+		}
+	}
+}
+
+func runTestRecordServer(t *testing.T, s *testRecordServer) (string, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	s.records = make(chan *dnsrecord.DNSRecord, 16)
+	srv := grpc.NewServer()
+	dnsrecord.RegisterRecordServiceServer(srv, s)
+	go srv.Serve(l)
+	return l.Addr().String(), srv.Stop
+}
+
+func setTestGRPCRecords(t *testing.T, o *dtap.DnstapOutput, qnames ...string) {
+	for _, qname := range qnames {
+		o.SetMessage(newTestMessage(t, newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery(qname, dns.TypeA))))
+	}
+}
+
+func receiveTestGRPCRecord(t *testing.T, s *testRecordServer) *dnsrecord.DNSRecord {
+	select {
+	case r := <-s.records:
+		return r
+	case <-time.After(3 * time.Second):
+		t.Fatal("no grpc record")
+	}
+	return nil
+}
+
+func TestDnstapGRPCOutput(t *testing.T) {
+	s := &testRecordServer{}
+	endpoint, stop := runTestRecordServer(t, s)
+	defer stop()
+
+	config := &dtap.OutputGRPCConfig{
+		Endpoint:         endpoint,
+		Metadata:         map[string]string{"authorization": "Bearer test"},
+		BatchSize:        2,
+		StreamMaxRecords: 2,
+	}
+	assert.Nil(t, config.Validate())
+	o, err := dtap.NewDnstapGRPCOutput(config, newTestOutputParams())
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go o.Run(ctx)
+	setTestGRPCRecords(t, o, "www.example.com.", "www.example.com.", "www.example.com.", "www.example.com.")
+
+	for i := 0; i < 4; i++ {
+		r := receiveTestGRPCRecord(t, s)
+		assert.Equal(t, "www.example.com.", r.Qname)
+		assert.Equal(t, "A", r.Qtype)
+		assert.Equal(t, "CLIENT_QUERY", r.Type)
+	}
+}
+
+func TestDnstapGRPCOutputReconnect(t *testing.T) {
+	s := &testRecordServer{Abort: 1}
+	endpoint, stop := runTestRecordServer(t, s)
+	defer stop()
+
+	config := &dtap.OutputGRPCConfig{
+		Endpoint:  endpoint,
+		Metadata:  map[string]string{"authorization": "Bearer test"},
+		BatchSize: 2,
+	}
+	o, err := dtap.NewDnstapGRPCOutput(config, newTestOutputParams())
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		o.Run(ctx)
+		close(done)
+	}()
+	setTestGRPCRecords(t, o, "a.example.", "b.example.")
+	assert.Equal(t, "a.example.", receiveTestGRPCRecord(t, s).Qname)
+	time.Sleep(200 * time.Millisecond)
+	// the first record is sent to the aborted stream, the rest of the batch to a new stream.
+	setTestGRPCRecords(t, o, "c.example.", "d.example.")
+	assert.Equal(t, "c.example.", receiveTestGRPCRecord(t, s).Qname)
+	assert.Equal(t, "d.example.", receiveTestGRPCRecord(t, s).Qname)
+	cancel()
+	<-done
+	// b was sent to the aborted stream, records are never sent twice.
+	select {
+	case r := <-s.records:
+		t.Fatalf("duplicated record %s", r.Qname)
+	default:
+	}
+}
+
+func TestDnstapGRPCOutputReopen(t *testing.T) {
+	s := &testRecordServer{Fail: 1}
+	endpoint, stop := runTestRecordServer(t, s)
+	defer stop()
+
+	config := &dtap.OutputGRPCConfig{
+		Endpoint:         endpoint,
+		Metadata:         map[string]string{"authorization": "Bearer test"},
+		BatchSize:        1,
+		StreamMaxRecords: 1,
+	}
+	o, err := dtap.NewDnstapGRPCOutput(config, newTestOutputParams())
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		o.Run(ctx)
+		close(done)
+	}()
+	// the failed stream returns the error to the output, which closes and opens the handler.
+	setTestGRPCRecords(t, o, "a.example.")
+	time.Sleep(200 * time.Millisecond)
+	setTestGRPCRecords(t, o, "b.example.")
+	assert.Equal(t, "b.example.", receiveTestGRPCRecord(t, s).Qname)
+	cancel()
+	<-done
+}
+
+func TestDnstapGRPCOutputSendTimeout(t *testing.T) {
+	s := &testRecordServer{Block: true}
+	endpoint, stop := runTestRecordServer(t, s)
+	defer stop()
+
+	config := &dtap.OutputGRPCConfig{
+		Endpoint:    endpoint,
+		Metadata:    map[string]string{"authorization": "Bearer test"},
+		BatchSize:   4096,
+		SendTimeout: 1,
+	}
+	o, err := dtap.NewDnstapGRPCOutput(config, newTestOutputParams())
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		o.Run(ctx)
+		close(done)
+	}()
+	// more records than the flow control window of the blocked stream.
+	for i := 0; i < 4096; i++ {
+		setTestGRPCRecords(t, o, fmt.Sprintf("%d.example.", i))
+	}
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("grpc output is blocked by the stream")
+	}
+}
+
+func TestDnstapGRPCOutputProbe(t *testing.T) {
+	endpoint, stop := runTestRecordServer(t, &testRecordServer{})
+	config := &dtap.OutputGRPCConfig{Endpoint: endpoint, DialTimeout: 1}
+	o, err := dtap.NewDnstapGRPCOutput(config, newTestOutputParams())
+	assert.NoError(t, err)
+	assert.NoError(t, o.Probe())
+	stop()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	l.Close()
+	config = &dtap.OutputGRPCConfig{Endpoint: l.Addr().String(), DialTimeout: 1}
+	o, err = dtap.NewDnstapGRPCOutput(config, newTestOutputParams())
+	assert.NoError(t, err)
+	assert.Error(t, o.Probe())
+}
@@ -0,0 +1,185 @@
+/*
+* Copyright (c) 2018 Manabu Sonoda
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+* Unless required by applicable law or agreed to in writing, software
+* distributed under the License is distributed on an "AS IS" BASIS,
+* WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+* See the License for the specific language governing permissions and
+* limitations under the License.
+ */
+
+package dtap
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	framestream "github.com/farsightsec/golang-framestream"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// MaxHTTPInputBodySize is the max size of a POSTed body.
+const MaxHTTPInputBodySize = 16 * 1024 * 1024
+
+// HTTPInputShutdownTimeout is the time for in-flight requests to finish on shutdown,
+// connections left after it, e.g. new or idle keep-alive ones, are closed.
+var HTTPInputShutdownTimeout = time.Second
+
+type DnstapHTTPInput struct {
+	config   *InputHTTPConfig
+	listener net.Listener
+	rbuf     *RBuf
+}
+
+func NewDnstapHTTPInput(config *InputHTTPConfig) (*DnstapHTTPInput, error) {
+	l, err := net.Listen("tcp", config.GetNet())
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't listen %s", config.GetNet())
+	}
+	return &DnstapHTTPInput{
+		config:   config,
+		listener: l,
+	}, nil
+}
+
+// Addr returns the listen address.
+func (i *DnstapHTTPInput) Addr() net.Addr {
+	return i.listener.Addr()
+}
+
+func (i *DnstapHTTPInput) Run(ctx context.Context, rbuf *RBuf) error {
+	i.rbuf = rbuf
+	mux := http.NewServeMux()
+	mux.Handle(i.config.GetPath(), i)
+	srv := &http.Server{Handler: mux}
+	serveError := make(chan error, 1)
+	go func() {
+		serveError <- srv.Serve(i.listener)
+	}()
+	var err error
+	select {
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), HTTPInputShutdownTimeout)
+		if srv.Shutdown(shutdownCtx) != nil {
+			srv.Close()
+		}
+		cancel()
+	case err = <-serveError:
+		if err != http.ErrServerClosed {
+			err = errors.Wrapf(err, "http input stopped")
+		} else {
+			err = nil
+		}
+	}
+	log.Info("finish input")
+	return err
+}
+
+func (i *DnstapHTTPInput) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if token := i.config.GetToken(); token != "" {
+		auth := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(auth, []byte("Bearer "+token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, MaxHTTPInputBodySize))
+	if err != nil {
+		http.Error(w, "can't read body", http.StatusBadRequest)
+		return
+	}
+	frames, err := decodeHTTPBody(body)
+	if err != nil {
+		log.Debugf("malformed http input body from %s: %s", r.RemoteAddr, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	addr, _ := net.ResolveTCPAddr("tcp", r.RemoteAddr)
+	for _, frame := range frames {
+		m := NewMessage(frame)
+		m.Source = i.config.GetSource()
+		m.TransportAddr = addr
+		i.rbuf.Write(m)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// decodeHTTPBody decodes frame-stream or length-delimited protobuf body,
+// and returns frames only when all of them are valid dnstap messages.
+func decodeHTTPBody(body []byte) ([][]byte, error) {
+	var frames [][]byte
+	var err error
+	// frame-stream begins with an escape sequence of the control frame
+	if len(body) >= 4 && bytes.Equal(body[:4], []byte{0, 0, 0, 0}) {
+		frames, err = decodeFstrmBody(body)
+	} else {
+		frames, err = decodeDelimitedBody(body)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(frames) == 0 {
+		return nil, errors.New("no dnstap message")
+	}
+	for _, frame := range frames {
+		dt := dnstap.Dnstap{}
+		if err := proto.Unmarshal(frame, &dt); err != nil {
+			return nil, errors.Wrap(err, "can't parse dnstap message")
+		}
+	}
+	return frames, nil
+}
+
+func decodeFstrmBody(body []byte) ([][]byte, error) {
+	decoder, err := framestream.NewDecoder(bytes.NewReader(body), &framestream.DecoderOptions{
+		ContentType: dnstap.FSContentType,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create framestream Decoder")
+	}
+	var frames [][]byte
+	for {
+		buf, err := decoder.Decode()
+		if err == io.EOF {
+			return frames, nil
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "decode error")
+		}
+		frame := make([]byte, len(buf))
+		copy(frame, buf)
+		frames = append(frames, frame)
+	}
+}
+
+func decodeDelimitedBody(body []byte) ([][]byte, error) {
+	var frames [][]byte
+	for len(body) > 0 {
+		l, n := proto.DecodeVarint(body)
+		if n == 0 || uint64(len(body)-n) < l {
+			return nil, errors.New("can't read length-delimited message")
+		}
+		frames = append(frames, body[n:n+int(l)])
+		body = body[n+int(l):]
+	}
+	return frames, nil
+}
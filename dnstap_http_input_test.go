@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2019 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	framestream "github.com/farsightsec/golang-framestream"
+	"github.com/golang/protobuf/proto"
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+func TestDnstapHTTPInput(t *testing.T) {
+	defer func(d time.Duration) { dtap.HTTPInputShutdownTimeout = d }(dtap.HTTPInputShutdownTimeout)
+	dtap.HTTPInputShutdownTimeout = 100 * time.Millisecond
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	config := &dtap.InputHTTPConfig{Address: "127.0.0.1", Port: uint16(port), Token: "secret"}
+	assert.Nil(t, config.Validate())
+	input, err := dtap.NewDnstapHTTPInput(config)
+	assert.NoError(t, err)
+	rbuf := dtap.NewRbuf(16, prometheus.NewCounter(prometheus.CounterOpts{Name: "in"}), prometheus.NewCounter(prometheus.CounterOpts{Name: "lost"}))
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- input.Run(ctx, rbuf)
+	}()
+
+	frame := newTestFrame(t, newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("www.example.com.", dns.TypeA)))
+	url := "http://" + input.Addr().String() + "/dnstap"
+	post := func(body []byte, token string) int {
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+		assert.NoError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if !assert.NoError(t, err) {
+			return 0
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	// length-delimited protobuf
+	delimited := append(proto.EncodeVarint(uint64(len(frame))), frame...)
+	assert.Equal(t, http.StatusOK, post(append(delimited, delimited...), "secret"))
+	m := <-rbuf.Read()
+	assert.Equal(t, frame, m.Frame)
+	assert.False(t, m.ReceivedAt.IsZero())
+	assert.Equal(t, "http:"+config.GetNet(), m.Source)
+	if assert.NotNil(t, m.TransportAddr) {
+		assert.True(t, m.TransportAddr.IP.IsLoopback())
+	}
+	assert.Equal(t, frame, (<-rbuf.Read()).Frame)
+
+	// frame-stream
+	buf := &bytes.Buffer{}
+	enc, err := framestream.NewEncoder(buf, &framestream.EncoderOptions{ContentType: dnstap.FSContentType})
+	assert.NoError(t, err)
+	enc.Write(frame)
+	enc.Close()
+	assert.Equal(t, http.StatusOK, post(buf.Bytes(), "secret"))
+	assert.Equal(t, frame, (<-rbuf.Read()).Frame)
+
+	assert.Equal(t, http.StatusUnauthorized, post(delimited, "bad"))
+	assert.Equal(t, http.StatusBadRequest, post(delimited[:len(delimited)-2], "secret"))
+	assert.Equal(t, http.StatusBadRequest, post([]byte{3, 1, 2, 3}, "secret"))
+	assert.Len(t, rbuf.Read(), 0)
+
+	// a new connection without request is closed after HTTPInputShutdownTimeout.
+	conn, err := net.Dial("tcp", input.Addr().String())
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	cancel()
+	select {
+	case err := <-errCh:
+		assert.NoError(t, err)
+	case <-time.After(3 * time.Second):
+		t.Fatal("input did not finish")
+	}
+}
@@ -0,0 +1,206 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// IdentitySummaryOther is the key of identities over MaxIdentities, and of qtypes over MaxQtypes.
+const IdentitySummaryOther = "other"
+
+// IdentitySummary is counts of records of an identity.
+type IdentitySummary struct {
+	Queries   uint64
+	Responses uint64
+	// Rcodes are response counts by rcode class, see RcodeClass.
+	Rcodes map[string]uint64
+	Qtypes map[string]uint64
+}
+
+func newIdentitySummary() *IdentitySummary {
+	return &IdentitySummary{Rcodes: map[string]uint64{}, Qtypes: map[string]uint64{}}
+}
+
+func (s *IdentitySummary) add(o *IdentitySummary) {
+	s.Queries += o.Queries
+	s.Responses += o.Responses
+	for k, v := range o.Rcodes {
+		s.Rcodes[k] += v
+	}
+	for k, v := range o.Qtypes {
+		s.Qtypes[k] += v
+	}
+}
+
+// QtypeCount is a qtype of IdentitySummaryRecords.
+type QtypeCount struct {
+	Qtype string `json:"qtype"`
+	Count uint64 `json:"count"`
+}
+
+// TopQtypes returns the n most counted qtypes.
+func (s *IdentitySummary) TopQtypes(n int) []QtypeCount {
+	res := make([]QtypeCount, 0, len(s.Qtypes))
+	for k, v := range s.Qtypes {
+		res = append(res, QtypeCount{Qtype: k, Count: v})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Count == res[j].Count {
+			return res[i].Qtype < res[j].Qtype
+		}
+		return res[i].Count > res[j].Count
+	})
+	if len(res) > n {
+		res = res[:n]
+	}
+	return res
+}
+
+// RcodeClass returns noerror, nxdomain, servfail, refused or other of the rcode name.
+func RcodeClass(rcode string) string {
+	switch rcode {
+	case "NOERROR", "NXDOMAIN", "SERVFAIL", "REFUSED":
+		return strings.ToLower(rcode)
+	}
+	return "other"
+}
+
+// IdentitySummaryCounter counts records by identity over sliding window made of fixed buckets.
+// Each bucket tracks at most maxKeys identities and maxQtypes qtypes per identity,
+// new ones over the limits are counted as IdentitySummaryOther.
+type IdentitySummaryCounter struct {
+	*windowCounter[IdentitySummary]
+	maxQtypes int
+}
+
+func NewIdentitySummaryCounter(buckets int, maxKeys int, maxQtypes int) *IdentitySummaryCounter {
+	return &IdentitySummaryCounter{
+		windowCounter: newWindowCounter(buckets, maxKeys, IdentitySummaryOther,
+			newIdentitySummary, (*IdentitySummary).add),
+		maxQtypes: maxQtypes,
+	}
+}
+
+// Inc counts a record of identity, rcode is counted only for responses.
+func (c *IdentitySummaryCounter) Inc(identity string, response bool, rcode string, qtype string) {
+	c.update(identity, func(s *IdentitySummary) {
+		if response {
+			s.Responses++
+			s.Rcodes[RcodeClass(rcode)]++
+		} else {
+			s.Queries++
+		}
+		if _, ok := s.Qtypes[qtype]; !ok && c.maxQtypes > 0 && len(s.Qtypes) >= c.maxQtypes {
+			qtype = IdentitySummaryOther
+		}
+		s.Qtypes[qtype]++
+	})
+}
+
+// Summaries returns summaries of identities over the whole window.
+func (c *IdentitySummaryCounter) Summaries() map[string]*IdentitySummary {
+	return c.total()
+}
+
+// IdentitySummaryRecords returns emitted snapshots of summaries sorted by identity,
+// with the topQtypes most counted qtypes.
+func IdentitySummaryRecords(summaries map[string]*IdentitySummary, topQtypes int, window int, interval int, now time.Time) []map[string]interface{} {
+	keys := make([]string, 0, len(summaries))
+	for k := range summaries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	res := make([]map[string]interface{}, 0, len(keys))
+	for _, k := range keys {
+		s := summaries[k]
+		res = append(res, map[string]interface{}{
+			"timestamp":  now.Format(time.RFC3339Nano),
+			"window":     window,
+			"interval":   interval,
+			"identity":   k,
+			"queries":    s.Queries,
+			"responses":  s.Responses,
+			"rcodes":     s.Rcodes,
+			"top_qtypes": s.TopQtypes(topQtypes),
+		})
+	}
+	return res
+}
+
+// DnstapIdentitySummaryOutput counts records per identity over sliding Window seconds,
+// and emits a snapshot of each identity every Interval seconds.
+type DnstapIdentitySummaryOutput struct {
+	config     *OutputIdentitySummaryConfig
+	logger     log.FieldLogger
+	flatOption DnstapFlatOption
+	counter    *IdentitySummaryCounter
+	emitter    Emitter
+	ticker     windowTicker
+	now        func() time.Time
+}
+
+func NewDnstapIdentitySummaryOutput(config *OutputIdentitySummaryConfig, params *DnstapOutputParams) *DnstapOutput {
+	params.Handler = &DnstapIdentitySummaryOutput{
+		config:     config,
+		logger:     params.GetLogger(),
+		flatOption: &config.Flat,
+		counter:    NewIdentitySummaryCounter(config.GetWindow()/config.GetInterval(), config.GetMaxIdentities(), config.GetMaxQtypes()),
+		emitter:    NewEmitter(&config.Emit),
+		now:        params.GetNow(),
+	}
+	return NewDnstapOutput(params)
+}
+
+func (o *DnstapIdentitySummaryOutput) open() error {
+	if err := o.emitter.open(); err != nil {
+		return err
+	}
+	o.ticker.start(time.Duration(o.config.GetInterval())*time.Second, o.emit, o.counter.Rotate)
+	return nil
+}
+
+func (o *DnstapIdentitySummaryOutput) emit() {
+	records := IdentitySummaryRecords(o.counter.Summaries(), o.config.GetTopQtypes(),
+		o.config.GetWindow(), o.config.GetInterval(), o.now())
+	for _, m := range records {
+		if err := o.emitter.emit(m); err != nil {
+			o.logger.Warnf("identity summary emit error: %v", err)
+		}
+	}
+}
+
+func (o *DnstapIdentitySummaryOutput) write(m *Message) error {
+	records, err := flatFrame(m, o.flatOption)
+	if err != nil {
+		return err
+	}
+	for _, data := range records {
+		response := isResponse(data.MessageType)
+		o.counter.Inc(data.Identity, response, data.Rcode, data.Qtype)
+	}
+	return nil
+}
+
+func (o *DnstapIdentitySummaryOutput) close() {
+	o.ticker.stop()
+	o.emitter.close()
+}
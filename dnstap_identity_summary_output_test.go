@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+func TestIdentitySummaryCounter(t *testing.T) {
+	c := dtap.NewIdentitySummaryCounter(2, 2, 2)
+	c.Inc("ns1", false, "", "A")
+	c.Inc("ns1", true, "NOERROR", "A")
+	c.Inc("ns1", true, "NXDOMAIN", "AAAA")
+	c.Inc("ns1", true, "FORMERR", "MX")
+	c.Inc("ns2", true, "REFUSED", "A")
+	// over MaxIdentities
+	c.Inc("ns3", false, "", "A")
+	s := c.Summaries()
+	assert.Len(t, s, 3)
+	assert.Equal(t, &dtap.IdentitySummary{
+		Queries:   1,
+		Responses: 3,
+		Rcodes:    map[string]uint64{"noerror": 1, "nxdomain": 1, "other": 1},
+		Qtypes:    map[string]uint64{"A": 2, "AAAA": 1, dtap.IdentitySummaryOther: 1},
+	}, s["ns1"])
+	assert.Equal(t, uint64(1), s["ns2"].Rcodes["refused"])
+	assert.Equal(t, uint64(1), s[dtap.IdentitySummaryOther].Queries)
+
+	c.Rotate()
+	c.Inc("ns1", false, "", "A")
+	assert.Equal(t, uint64(2), c.Summaries()["ns1"].Queries)
+
+	// first bucket is expired
+	c.Rotate()
+	s = c.Summaries()
+	assert.Len(t, s, 1)
+	assert.Equal(t, uint64(1), s["ns1"].Queries)
+	assert.Equal(t, uint64(0), s["ns1"].Responses)
+}
+
+func TestIdentitySummaryRecords(t *testing.T) {
+	now := time.Unix(1546300800, 0).UTC()
+	summaries := map[string]*dtap.IdentitySummary{
+		"ns2": {Queries: 1, Rcodes: map[string]uint64{}, Qtypes: map[string]uint64{"A": 1}},
+		"ns1": {
+			Queries:   3,
+			Responses: 2,
+			Rcodes:    map[string]uint64{"noerror": 2},
+			Qtypes:    map[string]uint64{"A": 2, "AAAA": 2, "MX": 1},
+		},
+	}
+	records := dtap.IdentitySummaryRecords(summaries, 2, 60, 10, now)
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, map[string]interface{}{
+			"timestamp":  "2019-01-01T00:00:00Z",
+			"window":     60,
+			"interval":   10,
+			"identity":   "ns1",
+			"queries":    uint64(3),
+			"responses":  uint64(2),
+			"rcodes":     map[string]uint64{"noerror": 2},
+			"top_qtypes": []dtap.QtypeCount{{Qtype: "A", Count: 2}, {Qtype: "AAAA", Count: 2}},
+		}, records[0])
+		assert.Equal(t, "ns2", records[1]["identity"])
+	}
+}
@@ -0,0 +1,139 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// jsonHourFormat is the hour of file names, in UTC.
+const jsonHourFormat = "2006010215"
+
+// DnstapJSONOutput writes flat records as NDJSON to a file per hour of the record timestamp.
+// Files of the latest MaxOpenFiles hours are kept open for late records,
+// records of older hours reopen their file to append.
+type DnstapJSONOutput struct {
+	config     *OutputJSONConfig
+	logger     log.FieldLogger
+	flatOption DnstapFlatOption
+	files      map[string]*jsonHourFile
+}
+
+type jsonHourFile struct {
+	f *os.File
+	w *bufio.Writer
+}
+
+func NewDnstapJSONOutput(config *OutputJSONConfig, params *DnstapOutputParams) *DnstapOutput {
+	params.Handler = &DnstapJSONOutput{
+		config:     config,
+		logger:     params.GetLogger(),
+		flatOption: &config.Flat,
+		files:      map[string]*jsonHourFile{},
+	}
+	return NewDnstapOutput(params)
+}
+
+func (o *DnstapJSONOutput) open() error {
+	if err := os.MkdirAll(o.config.Dir, 0755); err != nil {
+		return errors.Wrapf(err, "can't create dir %s", o.config.Dir)
+	}
+	return nil
+}
+
+// path returns the file path of hour.
+func (o *DnstapJSONOutput) path(hour string) string {
+	return filepath.Join(o.config.Dir, o.config.GetPrefix()+hour+".ndjson")
+}
+
+// file returns the open file of hour, closing the oldest one over MaxOpenFiles.
+func (o *DnstapJSONOutput) file(hour string) (*jsonHourFile, error) {
+	if f, ok := o.files[hour]; ok {
+		return f, nil
+	}
+	if len(o.files) >= o.config.GetMaxOpenFiles() {
+		oldest := ""
+		for h := range o.files {
+			if oldest == "" || h < oldest {
+				oldest = h
+			}
+		}
+		o.closeFile(oldest)
+	}
+	f, err := os.OpenFile(o.path(hour), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't create file %s", o.path(hour))
+	}
+	hf := &jsonHourFile{f: f, w: bufio.NewWriter(f)}
+	o.files[hour] = hf
+	return hf, nil
+}
+
+func (o *DnstapJSONOutput) closeFile(hour string) {
+	hf := o.files[hour]
+	if err := hf.w.Flush(); err != nil {
+		o.logger.Warnf("can't write file %s: %s", o.path(hour), err)
+	}
+	hf.f.Close()
+	delete(o.files, hour)
+}
+
+// recordHour returns the hour of the timestamp of data, or the current hour when it is invalid.
+func recordHour(data *DnstapFlatT) string {
+	t, err := time.Parse(time.RFC3339Nano, data.Timestamp)
+	if err != nil {
+		t = time.Now()
+	}
+	return t.UTC().Format(jsonHourFormat)
+}
+
+func (o *DnstapJSONOutput) write(m *Message) error {
+	records, err := flatFrame(m, o.flatOption)
+	if err != nil {
+		return err
+	}
+	for _, data := range records {
+		buf, err := MarshalFlatJSON(data, o.flatOption)
+		if err != nil {
+			return err
+		}
+		hf, err := o.file(recordHour(data))
+		if err != nil {
+			return err
+		}
+		hf.w.Write(buf)
+		hf.w.WriteByte('\n')
+	}
+	for _, hf := range o.files {
+		if err := hf.w.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *DnstapJSONOutput) close() {
+	for hour := range o.files {
+		o.closeFile(hour)
+	}
+}
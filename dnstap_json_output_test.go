@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/golang/protobuf/proto"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+func TestDnstapJSONOutputHourFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dtap")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	config := &dtap.OutputJSONConfig{Dir: dir, MaxOpenFiles: 1}
+	assert.Nil(t, config.Validate())
+	o := dtap.NewDnstapJSONOutput(config, newTestOutputParams())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		o.Run(ctx)
+		close(done)
+	}()
+	// 2019-01-01 00:00, 01:00 and a late record of 00:30.
+	for _, c := range []struct {
+		qname string
+		sec   uint64
+	}{
+		{"a.example.com.", 1546300800},
+		{"b.example.com.", 1546304400},
+		{"c.example.com.", 1546302600},
+	} {
+		dt := newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery(c.qname, dns.TypeA))
+		dt.Message.QueryTimeSec = proto.Uint64(c.sec)
+		o.SetMessage(newTestMessage(t, dt))
+	}
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-done
+
+	qnames := func(name string) []string {
+		buf, err := ioutil.ReadFile(filepath.Join(dir, name))
+		assert.NoError(t, err)
+		var res []string
+		for _, line := range strings.Split(strings.TrimSpace(string(buf)), "\n") {
+			m := map[string]interface{}{}
+			assert.NoError(t, json.Unmarshal([]byte(line), &m))
+			res = append(res, m["qname"].(string))
+		}
+		return res
+	}
+	assert.Equal(t, []string{"a.example.com.", "c.example.com."}, qnames("dns-2019010100.ndjson"))
+	assert.Equal(t, []string{"b.example.com."}, qnames("dns-2019010101.ndjson"))
+
+	assert.NotNil(t, (&dtap.OutputJSONConfig{}).Validate())
+	assert.NotNil(t, (&dtap.OutputJSONConfig{Dir: dir, Prefix: "a/b"}).Validate())
+}
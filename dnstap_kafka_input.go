@@ -0,0 +1,104 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"context"
+
+	"github.com/Shopify/sarama"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// DnstapKafkaInput consumes dnstap protobuf messages of a kafka topic in a consumer group,
+// like the protobuf OutputType of the kafka output produces.
+// Offsets are marked after messages are accepted by the input buffer, waiting for room of it, and committed
+// every second and on rebalance and shutdown.
+type DnstapKafkaInput struct {
+	config      *InputKafkaConfig
+	kafkaConfig *sarama.Config
+	rbuf        *RBuf
+}
+
+func NewDnstapKafkaInput(config *InputKafkaConfig) (*DnstapKafkaInput, error) {
+	kafkaConfig := sarama.NewConfig()
+	// consumer groups need kafka 0.10.2 or later.
+	kafkaConfig.Version = sarama.V0_10_2_0
+	kafkaConfig.Consumer.Return.Errors = true
+	if config.GetInitialOffset() == "oldest" {
+		kafkaConfig.Consumer.Offsets.Initial = sarama.OffsetOldest
+	}
+	if err := setKafkaSecurity(kafkaConfig, config.security()); err != nil {
+		return nil, err
+	}
+	return &DnstapKafkaInput{
+		config:      config,
+		kafkaConfig: kafkaConfig,
+	}, nil
+}
+
+func (i *DnstapKafkaInput) Run(ctx context.Context, rbuf *RBuf) error {
+	i.rbuf = rbuf
+	group, err := sarama.NewConsumerGroup(i.config.Hosts, i.config.GetGroupID(), i.kafkaConfig)
+	if err != nil {
+		return errors.Wrapf(err, "can't create kafka consumer group")
+	}
+	// Close commits the marked offsets.
+	defer group.Close()
+	go func() {
+		for err := range group.Errors() {
+			log.Warnf("kafka consumer error: %s", err)
+		}
+	}()
+	for {
+		// Consume returns on rebalance, join the group again.
+		if err := group.Consume(ctx, []string{i.config.Topic}, i); err != nil {
+			return errors.Wrapf(err, "kafka consume error")
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+func (i *DnstapKafkaInput) Setup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (i *DnstapKafkaInput) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (i *DnstapKafkaInput) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for {
+		select {
+		case <-sess.Context().Done():
+			return nil
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			m := NewMessage(msg.Value)
+			m.Source = i.config.GetSource()
+			// wait for room of the buffer, the offset is marked only for accepted frames.
+			if !i.rbuf.WriteWait(sess.Context().Done(), m) {
+				return nil
+			}
+			sess.MarkMessage(msg, "")
+		}
+	}
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/golang/protobuf/proto"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+func TestDnstapKafkaInput(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+	assignment := &sarama.SyncGroupRequest{}
+	assert.NoError(t, assignment.AddGroupAssignmentMember("m1", &sarama.ConsumerGroupMemberAssignment{
+		Topics: map[string][]int32{"dnstap": {0}},
+	}))
+	fetch := sarama.NewMockFetchResponse(t, 2).SetVersion(3).SetHighWaterMark("dnstap", 0, 2)
+	for n, qname := range []string{"a.example.com.", "b.example.com."} {
+		frame := newTestFrame(t, newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery(qname, dns.TypeA)))
+		fetch.SetMessage("dnstap", 0, int64(n), sarama.ByteEncoder(frame))
+	}
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("dnstap", 0, broker.BrokerID()),
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(t).
+			SetCoordinator(sarama.CoordinatorGroup, "dtap", broker),
+		"JoinGroupRequest": sarama.NewMockWrapper(&sarama.JoinGroupResponse{
+			GenerationId: 1, GroupProtocol: "range", LeaderId: "leader", MemberId: "m1",
+		}),
+		"SyncGroupRequest": sarama.NewMockWrapper(&sarama.SyncGroupResponse{
+			MemberAssignment: assignment.GroupAssignments["m1"],
+		}),
+		"HeartbeatRequest":  sarama.NewMockWrapper(&sarama.HeartbeatResponse{}),
+		"LeaveGroupRequest": sarama.NewMockWrapper(&sarama.LeaveGroupResponse{}),
+		"OffsetFetchRequest": sarama.NewMockOffsetFetchResponse(t).
+			SetOffset("dtap", "dnstap", 0, -1, "", sarama.ErrNoError),
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).SetVersion(1).
+			SetOffset("dnstap", 0, sarama.OffsetOldest, 0).
+			SetOffset("dnstap", 0, sarama.OffsetNewest, 2),
+		"FetchRequest": fetch,
+		"OffsetCommitRequest": sarama.NewMockOffsetCommitResponse(t).
+			SetError("dtap", "dnstap", 0, sarama.ErrNoError),
+	})
+
+	config := &dtap.InputKafkaConfig{
+		Hosts:         []string{broker.Addr()},
+		Topic:         "dnstap",
+		InitialOffset: "oldest",
+	}
+	assert.Nil(t, config.Validate())
+	i, err := dtap.NewDnstapKafkaInput(config)
+	assert.NoError(t, err)
+	// the full buffer waits for room instead of dropping a.example.com.
+	rbuf := newTestRbuf(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- i.Run(ctx, rbuf)
+	}()
+	time.Sleep(500 * time.Millisecond)
+	for _, qname := range []string{"a.example.com.", "b.example.com."} {
+		select {
+		case m := <-rbuf.Read():
+			assert.Equal(t, "kafka:dnstap", m.Source)
+			dt := &dnstap.Dnstap{}
+			assert.NoError(t, proto.Unmarshal(m.Frame, dt))
+			data, err := dtap.FlatDnstap(dt, &dtap.FlatConfig{})
+			if assert.NoError(t, err) {
+				assert.Equal(t, qname, data.Qname)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("no kafka message")
+		}
+	}
+	cancel()
+	assert.NoError(t, <-done)
+
+	committed := false
+	for _, rr := range broker.History() {
+		if _, ok := rr.Request.(*sarama.OffsetCommitRequest); ok {
+			committed = true
+		}
+	}
+	assert.True(t, committed)
+
+	assert.NotNil(t, (&dtap.InputKafkaConfig{Hosts: []string{"127.0.0.1:9092"}}).Validate())
+	assert.NotNil(t, (&dtap.InputKafkaConfig{Hosts: []string{"127.0.0.1:9092"}, Topic: "dnstap", InitialOffset: "latest"}).Validate())
+}
@@ -17,43 +17,34 @@
 package dtap
 
 import (
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/binary"
-	"encoding/json"
+	"hash"
 	"io/ioutil"
+	"strings"
 
 	"github.com/dangkaka/go-kafka-avro"
 	"github.com/linkedin/goavro"
-	"github.com/rakyll/statik/fs"
 
 	"github.com/Shopify/sarama"
-	dnstap "github.com/dnstap/golang-dnstap"
-	"github.com/golang/protobuf/proto"
-	_ "github.com/mimuret/dtap/statik"
 	"github.com/pkg/errors"
+	"github.com/xdg/scram"
 )
 
-var schemaStr string
-
-func init() {
-	statikFS, _ := fs.New()
-	f, _ := statikFS.Open("/flat.avsc")
-	b, _ := ioutil.ReadAll(f)
-	schemaStr = string(b)
-}
-
 type KafkaClient interface {
 	Add(string, string, []byte, []byte) error
 }
 
 type DnstapKafkaOutput struct {
-	config        *OutputKafkaConfig
-	kafkaConfig   *sarama.Config
-	producer      sarama.SyncProducer
-	registry      *kafka.CachedSchemaRegistryClient
-	valueCodec    *goavro.Codec
-	valueSchemaID []byte
-	keyCodec      *goavro.Codec
-	keySchemaID   []byte
+	config      *OutputKafkaConfig
+	kafkaConfig *sarama.Config
+	producer    sarama.SyncProducer
+	registry    *kafka.CachedSchemaRegistryClient
+	value       *AvroSerializer
+	keyCodec    *goavro.Codec
+	keySchemaID []byte
 }
 
 func NewDnstapKafkaOutput(config *OutputKafkaConfig, params *DnstapOutputParams) (*DnstapOutput, error) {
@@ -61,13 +52,16 @@ func NewDnstapKafkaOutput(config *OutputKafkaConfig, params *DnstapOutputParams)
 	kafkaConfig.Producer.Return.Successes = true
 	kafkaConfig.Producer.Return.Errors = true
 	kafkaConfig.Producer.Retry.Max = int(config.GetRetry())
+	if err := setKafkaSecurity(kafkaConfig, config.security()); err != nil {
+		return nil, err
+	}
 
 	keyCodec, err := goavro.NewCodec(`{"type": "string"}`)
 	if err != nil {
 		return nil, err
 	}
 
-	valueCodec, err := goavro.NewCodec(schemaStr)
+	value, err := NewAvroSerializer()
 	if err != nil {
 		return nil, err
 	}
@@ -76,36 +70,132 @@ func NewDnstapKafkaOutput(config *OutputKafkaConfig, params *DnstapOutputParams)
 		config:      config,
 		kafkaConfig: kafkaConfig,
 		keyCodec:    keyCodec,
-		valueCodec:  valueCodec,
+		value:       value,
 	}
 	return NewDnstapOutput(params), nil
 }
 
+// newClientTLSConfig returns the TLS config of clients verifying servers by the ca file,
+// system roots when it is empty, with the client certificate when cert is set.
+func newClientTLSConfig(ca, cert, key string, insecure bool) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: insecure,
+	}
+	if ca != "" {
+		pem, err := ioutil.ReadFile(ca)
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't read TLSCA file: %s", ca)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no certificate in TLSCA file: %s", ca)
+		}
+	}
+	if cert != "" {
+		c, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't load client certificate")
+		}
+		tlsConfig.Certificates = []tls.Certificate{c}
+	}
+	return tlsConfig, nil
+}
+
+func setKafkaSecurity(kafkaConfig *sarama.Config, config kafkaSecurity) error {
+	if config.TLS {
+		tlsConfig, err := newClientTLSConfig(config.TLSCA, config.TLSCert, config.TLSKey, config.TLSInsecureSkipVerify)
+		if err != nil {
+			return err
+		}
+		kafkaConfig.Net.TLS.Enable = true
+		kafkaConfig.Net.TLS.Config = tlsConfig
+	}
+	mechanism := strings.ToUpper(config.SASLMechanism)
+	if mechanism == "" {
+		return nil
+	}
+	kafkaConfig.Net.SASL.Enable = true
+	kafkaConfig.Net.SASL.Handshake = true
+	kafkaConfig.Net.SASL.User = config.SASLUser
+	kafkaConfig.Net.SASL.Password = config.SASLPassword
+	kafkaConfig.Net.SASL.Mechanism = sarama.SASLMechanism(mechanism)
+	switch mechanism {
+	case sarama.SASLTypeSCRAMSHA256:
+		kafkaConfig.Net.SASL.SCRAMClient = &scramClient{HashGeneratorFcn: scram.SHA256}
+	case sarama.SASLTypeSCRAMSHA512:
+		kafkaConfig.Net.SASL.SCRAMClient = &scramClient{HashGeneratorFcn: scramSHA512}
+	}
+	if mechanism != sarama.SASLTypePlaintext && !kafkaConfig.Version.IsAtLeast(sarama.V1_0_0_0) {
+		// SCRAM needs SaslHandshake v1
+		kafkaConfig.Version = sarama.V1_0_0_0
+	}
+	return kafkaConfig.Validate()
+}
+
+var scramSHA512 scram.HashGeneratorFcn = func() hash.Hash { return sha512.New() }
+
+type scramClient struct {
+	*scram.ClientConversation
+	scram.HashGeneratorFcn
+}
+
+func (c *scramClient) Begin(userName, password, authzID string) error {
+	client, err := c.HashGeneratorFcn.NewClient(userName, password, authzID)
+	if err != nil {
+		return err
+	}
+	c.ClientConversation = client.NewConversation()
+	return nil
+}
+
+func (c *scramClient) Step(challenge string) (string, error) {
+	return c.ClientConversation.Step(challenge)
+}
+
+func (c *scramClient) Done() bool {
+	return c.ClientConversation.Done()
+}
+
 func (o *DnstapKafkaOutput) open() error {
 	var err error
 	o.producer, err = sarama.NewSyncProducer(o.config.Hosts, o.kafkaConfig)
 	if err != nil {
 		return errors.Wrapf(err, "can't create kafka producer")
 	}
-	if o.config.GetOutputType() == "avro" {
-		if o.valueSchemaID, err = o.getSchemaID(o.config.GetTopic()+"-value", o.valueCodec); err != nil {
+	// without schema registries, avro records are plain Avro binary of the flat schema.
+	if o.config.GetOutputType() == "avro" && len(o.config.GetSchemaRegistries()) > 0 {
+		valueSchemaID, err := o.getSchemaID(o.config.GetTopic()+"-value", o.value.Codec())
+		if err != nil {
 			return errors.Wrapf(err, "can't get schema id")
 		}
-		if o.keySchemaID, err = o.getSchemaID(o.config.GetTopic()+"-key", o.keyCodec); err != nil {
+		o.value.SetSchemaID(valueSchemaID)
+		keySchemaID, err := o.getSchemaID(o.config.GetTopic()+"-key", o.keyCodec)
+		if err != nil {
 			return errors.Wrapf(err, "can't get schema id")
 		}
+		o.keySchemaID = make([]byte, 4)
+		binary.BigEndian.PutUint32(o.keySchemaID, keySchemaID)
+	}
+	return nil
+}
+
+// Probe connects to the brokers and fetches metadata, then closes the client.
+func (o *DnstapKafkaOutput) Probe() error {
+	client, err := sarama.NewClient(o.config.Hosts, o.kafkaConfig)
+	if err != nil {
+		return errors.Wrapf(err, "can't connect kafka brokers, hosts: %s", strings.Join(o.config.Hosts, ","))
 	}
+	client.Close()
 	return nil
 }
-func (o *DnstapKafkaOutput) getSchemaID(subject string, codec *goavro.Codec) ([]byte, error) {
+
+func (o *DnstapKafkaOutput) getSchemaID(subject string, codec *goavro.Codec) (uint32, error) {
 	registry := kafka.NewCachedSchemaRegistryClient(o.config.GetSchemaRegistries())
 	schemaID, err := registry.CreateSubject(subject, codec)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	val := make([]byte, 4)
-	binary.BigEndian.PutUint32(val, uint32(schemaID))
-	return val, nil
+	return uint32(schemaID), nil
 }
 
 func (o *DnstapKafkaOutput) GetEncoder(v interface{}, codec *goavro.Codec, schemaID []byte) (sarama.Encoder, error) {
@@ -124,39 +214,47 @@ func (o *DnstapKafkaOutput) GetEncoder(v interface{}, codec *goavro.Codec, schem
 	return sarama.ByteEncoder(binaryMsg), nil
 }
 
-func (o *DnstapKafkaOutput) write(frame []byte) error {
-	var v, k sarama.Encoder
+func (o *DnstapKafkaOutput) write(m *Message) error {
 	if o.config.GetOutputType() == "protobuf" {
-		k = sarama.ByteEncoder(o.config.GetKey())
-		v = sarama.ByteEncoder(frame)
-	} else {
-		dt := dnstap.Dnstap{}
-		if err := proto.Unmarshal(frame, &dt); err != nil {
-			return err
-		}
-		data, err := FlatDnstap(&dt, &o.config.Flat)
-		if err != nil {
-			return err
+		if m.flush {
+			return nil
 		}
+		return o.send(sarama.ByteEncoder(o.config.GetKey()), sarama.ByteEncoder(m.Frame))
+	}
+	records, err := flatFrame(m, &o.config.Flat)
+	if err != nil {
+		return err
+	}
+	for _, data := range records {
+		var v, k sarama.Encoder
+		key := o.config.GetRecordKey(data)
 		if o.config.GetOutputType() == "avro" {
-			var err error
-			mapString := data.ToMapString()
-			if v, err = o.GetEncoder(mapString, o.valueCodec, o.valueSchemaID); err != nil {
+			buf, err := o.value.Serialize(data.ToMapString())
+			if err != nil {
 				return err
 			}
-			if k, err = o.GetEncoder(o.config.GetKey(), o.keyCodec, o.keySchemaID); err != nil {
+			v = sarama.ByteEncoder(buf)
+			if o.keySchemaID == nil {
+				k = sarama.StringEncoder(key)
+			} else if k, err = o.GetEncoder(key, o.keyCodec, o.keySchemaID); err != nil {
 				return err
 			}
 		} else {
-			buf, err := json.Marshal(data)
+			buf, err := MarshalFlatJSON(data, &o.config.Flat)
 			if err != nil {
 				return err
 			}
-			k = sarama.StringEncoder(o.config.GetKey())
+			k = sarama.StringEncoder(key)
 			v = sarama.StringEncoder(buf)
 		}
+		if err := o.send(k, v); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
+func (o *DnstapKafkaOutput) send(k, v sarama.Encoder) error {
 	msg := &sarama.ProducerMessage{
 		Topic: o.config.GetTopic(),
 		Key:   k,
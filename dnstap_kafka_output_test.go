@@ -0,0 +1,49 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+func TestDnstapKafkaOutputProbe(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("dnstap", 0, broker.BrokerID()),
+	})
+	config := &dtap.OutputKafkaConfig{Hosts: []string{broker.Addr()}, Topic: "dnstap", OutputType: "json"}
+	o, err := dtap.NewDnstapKafkaOutput(config, newTestOutputParams())
+	assert.NoError(t, err)
+	assert.NoError(t, o.Probe())
+	broker.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	l.Close()
+	config = &dtap.OutputKafkaConfig{Hosts: []string{l.Addr().String()}, Topic: "dnstap", OutputType: "json"}
+	o, err = dtap.NewDnstapKafkaOutput(config, newTestOutputParams())
+	assert.NoError(t, err)
+	assert.Error(t, o.Probe())
+}
@@ -0,0 +1,199 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// DnstapLokiOutput pushes flat records as JSON log lines to Grafana Loki.
+type DnstapLokiOutput struct {
+	config     *OutputLokiConfig
+	logger     log.FieldLogger
+	flatOption DnstapFlatOption
+	client     *http.Client
+	batcher    *Batcher
+	now        func() time.Time
+	// backoff is the first wait on 429, doubled on each retry.
+	backoff time.Duration
+}
+
+type lokiLine struct {
+	labels map[string]string
+	ts     string
+	line   string
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+func NewDnstapLokiOutput(config *OutputLokiConfig, params *DnstapOutputParams) *DnstapOutput {
+	o := &DnstapLokiOutput{
+		config:     config,
+		logger:     params.GetLogger(),
+		flatOption: &config.Flat,
+		client:     &http.Client{Timeout: time.Duration(config.GetTimeout()) * time.Second},
+		now:        params.GetNow(),
+		backoff:    500 * time.Millisecond,
+	}
+	o.batcher = NewBatcher(config.GetBatchSize(), time.Duration(config.GetFlushInterval())*time.Second, o.send)
+	o.batcher.SetLogger(params.GetLogger())
+	params.Handler = o
+	return NewDnstapOutput(params)
+}
+
+func (o *DnstapLokiOutput) newLine(data *DnstapFlatT) (*lokiLine, error) {
+	buf, err := MarshalFlatJSON(data, o.flatOption)
+	if err != nil {
+		return nil, err
+	}
+	ts := o.now()
+	if t, err := time.Parse(time.RFC3339Nano, data.Timestamp); err == nil {
+		ts = t
+	}
+	labels := map[string]string{}
+	for k, v := range o.config.Labels {
+		labels[k] = v
+	}
+	m := data.ToMapString()
+	for _, k := range o.config.GetLabelFields() {
+		if v, ok := m[k]; ok && v != nil {
+			labels[k] = fmt.Sprint(v)
+		}
+	}
+	return &lokiLine{
+		labels: labels,
+		ts:     strconv.FormatInt(ts.UnixNano(), 10),
+		line:   string(buf),
+	}, nil
+}
+
+func (o *DnstapLokiOutput) open() error {
+	o.batcher.Start()
+	return nil
+}
+
+func (o *DnstapLokiOutput) write(m *Message) error {
+	records, err := flatFrame(m, o.flatOption)
+	if err != nil {
+		return err
+	}
+	for _, data := range records {
+		l, err := o.newLine(data)
+		if err != nil {
+			return err
+		}
+		if err := o.batcher.Add(l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func lokiStreamKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s=%q,", k, labels[k])
+	}
+	return b.String()
+}
+
+func (o *DnstapLokiOutput) send(records []interface{}) error {
+	streams := []*lokiStream{}
+	index := map[string]*lokiStream{}
+	for _, r := range records {
+		l := r.(*lokiLine)
+		key := lokiStreamKey(l.labels)
+		s, ok := index[key]
+		if !ok {
+			s = &lokiStream{Stream: l.labels}
+			index[key] = s
+			streams = append(streams, s)
+		}
+		s.Values = append(s.Values, [2]string{l.ts, l.line})
+	}
+	buf, err := json.Marshal(map[string]interface{}{"streams": streams})
+	if err != nil {
+		return err
+	}
+	backoff := o.backoff
+	for retry := 0; ; retry++ {
+		wait, err := o.push(buf)
+		if err == nil || wait == 0 || retry >= o.config.GetMaxRetry() {
+			return err
+		}
+		if wait < 0 {
+			wait = backoff
+			backoff *= 2
+		}
+		o.logger.Debugf("loki rate limited, retry after %s", wait)
+		time.Sleep(wait)
+	}
+}
+
+// push returns non-zero wait when the request is rate limited,
+// negative wait means no Retry-After header.
+func (o *DnstapLokiOutput) push(buf []byte) (time.Duration, error) {
+	req, err := http.NewRequest(http.MethodPost, o.config.GetURL(), bytes.NewReader(buf))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if o.config.Tenant != "" {
+		req.Header.Set("X-Scope-OrgID", o.config.Tenant)
+	}
+	res, err := o.client.Do(req)
+	if err != nil {
+		return 0, errors.Wrapf(err, "can't push loki streams, url: %s", o.config.GetURL())
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+	if res.StatusCode == http.StatusTooManyRequests {
+		wait := time.Duration(-1)
+		if sec, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil && sec > 0 {
+			wait = time.Duration(sec) * time.Second
+		}
+		return wait, errors.Errorf("loki push rate limited, url: %s", o.config.GetURL())
+	}
+	if res.StatusCode/100 != 2 {
+		return 0, errors.Errorf("loki push failed, url: %s, status: %s", o.config.GetURL(), res.Status)
+	}
+	return 0, nil
+}
+
+func (o *DnstapLokiOutput) close() {
+	o.batcher.Stop()
+}
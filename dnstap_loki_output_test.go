@@ -0,0 +1,124 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+type testLokiPush struct {
+	Streams []struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	} `json:"streams"`
+}
+
+func TestDnstapLokiOutput(t *testing.T) {
+	var requests int32
+	bodies := make(chan *testLokiPush, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "tenant1", r.Header.Get("X-Scope-OrgID"))
+		// first push is rate limited
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		m := &testLokiPush{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(m))
+		w.WriteHeader(http.StatusNoContent)
+		bodies <- m
+	}))
+	defer srv.Close()
+
+	config := &dtap.OutputLokiConfig{
+		URL:       srv.URL,
+		Labels:    map[string]string{"job": "dtap"},
+		Tenant:    "tenant1",
+		BatchSize: 2,
+	}
+	assert.Nil(t, config.Validate())
+	o := dtap.NewDnstapLokiOutput(config, newTestOutputParams())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go o.Run(ctx)
+	q := newTestQuery("www.example.com.", dns.TypeA)
+	o.SetMessage(newTestMessage(t, newTestDnstap(t, dnstap.Message_CLIENT_QUERY, q)))
+	o.SetMessage(newTestMessage(t, newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, newTestResponse(q))))
+
+	select {
+	case m := <-bodies:
+		assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+		assert.Len(t, m.Streams, 2)
+		s := m.Streams[0]
+		assert.Equal(t, "dtap", s.Stream["job"])
+		assert.Equal(t, "CLIENT_QUERY", s.Stream["type"])
+		assert.NotEmpty(t, s.Stream["identity"])
+		assert.Len(t, s.Values, 1)
+		assert.Equal(t, "1546300800000000000", s.Values[0][0])
+		assert.Contains(t, s.Values[0][1], `"qname":"www.example.com."`)
+		assert.Equal(t, "CLIENT_RESPONSE", m.Streams[1].Stream["type"])
+		assert.Equal(t, "1546300801000000000", m.Streams[1].Values[0][0])
+	case <-time.After(5 * time.Second):
+		t.Fatal("no push request")
+	}
+}
+
+func TestDnstapLokiOutputReceivedAt(t *testing.T) {
+	bodies := make(chan *testLokiPush, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m := &testLokiPush{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(m))
+		w.WriteHeader(http.StatusNoContent)
+		bodies <- m
+	}))
+	defer srv.Close()
+
+	config := &dtap.OutputLokiConfig{
+		URL:       srv.URL,
+		BatchSize: 1,
+		Flat:      dtap.FlatConfig{IncludeReceivedAt: true},
+	}
+	assert.Nil(t, config.Validate())
+	o := dtap.NewDnstapLokiOutput(config, newTestOutputParams())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go o.Run(ctx)
+	m := newTestMessage(t, newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("www.example.com.", dns.TypeA)))
+	m.ReceivedAt = time.Unix(1546300805, 0).UTC()
+	o.SetMessage(m)
+
+	select {
+	case m := <-bodies:
+		// timestamp is the event time, received_at is the decode time of the input
+		assert.Equal(t, "1546300800000000000", m.Streams[0].Values[0][0])
+		assert.Contains(t, m.Streams[0].Values[0][1], `"received_at":"2019-01-01T00:00:05Z"`)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no push request")
+	}
+}
@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) 2019 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// DnstapLoopbackOutput keeps the last Size flat records in memory,
+// to inspect what the pipeline produced in tests and demos.
+// Records are returned by Records, and served as a JSON array on Listen when it is set.
+type DnstapLoopbackOutput struct {
+	*DnstapOutput
+	config     *OutputLoopbackConfig
+	logger     log.FieldLogger
+	flatOption DnstapFlatOption
+	mux        sync.Mutex
+	ring       []map[string]interface{}
+	next       int
+	full       bool
+	srv        *http.Server
+}
+
+func NewDnstapLoopbackOutput(config *OutputLoopbackConfig, params *DnstapOutputParams) *DnstapLoopbackOutput {
+	o := &DnstapLoopbackOutput{
+		config:     config,
+		logger:     params.GetLogger(),
+		flatOption: &config.Flat,
+		ring:       make([]map[string]interface{}, config.GetSize()),
+	}
+	params.Handler = o
+	o.DnstapOutput = NewDnstapOutput(params)
+	return o
+}
+
+func (o *DnstapLoopbackOutput) open() error {
+	if o.config.Listen == "" {
+		return nil
+	}
+	l, err := net.Listen("tcp", o.config.Listen)
+	if err != nil {
+		return errors.Wrapf(err, "can't listen %s", o.config.Listen)
+	}
+	o.srv = &http.Server{Handler: o}
+	go func(srv *http.Server) {
+		if err := srv.Serve(l); err != nil && err != http.ErrServerClosed {
+			o.logger.Warnf("loopback http server error: %s", err)
+		}
+	}(o.srv)
+	return nil
+}
+
+func (o *DnstapLoopbackOutput) write(m *Message) error {
+	records, err := flatFrame(m, o.flatOption)
+	if err != nil {
+		return err
+	}
+	o.mux.Lock()
+	defer o.mux.Unlock()
+	for _, data := range records {
+		o.ring[o.next] = flatMap(data, o.flatOption)
+		o.next = (o.next + 1) % len(o.ring)
+		if o.next == 0 {
+			o.full = true
+		}
+	}
+	return nil
+}
+
+// Records returns the kept records, oldest first.
+func (o *DnstapLoopbackOutput) Records() []map[string]interface{} {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+	if !o.full {
+		return append([]map[string]interface{}{}, o.ring[:o.next]...)
+	}
+	return append(append([]map[string]interface{}{}, o.ring[o.next:]...), o.ring[:o.next]...)
+}
+
+// Reset removes the kept records.
+func (o *DnstapLoopbackOutput) Reset() {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+	o.ring = make([]map[string]interface{}, len(o.ring))
+	o.next, o.full = 0, false
+}
+
+// ServeHTTP writes Records as a JSON array.
+func (o *DnstapLoopbackOutput) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(o.Records()); err != nil {
+		o.logger.Warnf("loopback http write error: %s", err)
+	}
+}
+
+func (o *DnstapLoopbackOutput) close() {
+	if o.srv == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	o.srv.Shutdown(ctx)
+	o.srv = nil
+}
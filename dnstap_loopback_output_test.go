@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+func TestDnstapLoopbackOutput(t *testing.T) {
+	config := &dtap.OutputLoopbackConfig{
+		Size: 2,
+		Flat: dtap.FlatConfig{Filter: "qtype != 'MX'"},
+	}
+	o := dtap.NewDnstapLoopbackOutput(config, newTestOutputParams())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		o.Run(ctx)
+		close(done)
+	}()
+	for _, qname := range []string{"a.example.", "b.example.", "c.example."} {
+		o.SetMessage(newTestMessage(t, newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery(qname, dns.TypeA))))
+	}
+	o.SetMessage(newTestMessage(t, newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("mx.example.", dns.TypeMX))))
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	<-done
+
+	records := o.Records()
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, "b.example.", records[0]["qname"])
+		assert.Equal(t, "c.example.", records[1]["qname"])
+	}
+
+	rec := httptest.NewRecorder()
+	o.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var served []map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &served))
+	if assert.Len(t, served, 2) {
+		assert.Equal(t, "c.example.", served[1]["qname"])
+	}
+
+	o.Reset()
+	assert.Len(t, o.Records(), 0)
+}
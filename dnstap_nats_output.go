@@ -22,22 +22,22 @@ import (
 	"sync"
 	"time"
 
-	dnstap "github.com/dnstap/golang-dnstap"
 	framestream "github.com/farsightsec/golang-framestream"
-	"github.com/golang/protobuf/proto"
 	nats "github.com/nats-io/go-nats"
 	"github.com/pkg/errors"
-	"github.com/prometheus/common/log"
+	log "github.com/sirupsen/logrus"
 )
 
 type DnstapNatsOutput struct {
 	config          *OutputNatsConfig
+	logger          log.FieldLogger
 	enc             *framestream.Encoder
 	con             *nats.Conn
 	mux             *sync.Mutex
 	dataString      []byte
 	data            []*DnstapFlatT
 	flatOption      DnstapFlatOption
+	serializer      Serializer
 	flushCancelFunc context.CancelFunc
 	closeCh         chan struct{}
 }
@@ -45,6 +45,7 @@ type DnstapNatsOutput struct {
 func NewDnstapNatsOutput(config *OutputNatsConfig, params *DnstapOutputParams) *DnstapOutput {
 	params.Handler = &DnstapNatsOutput{
 		config:     config,
+		logger:     params.GetLogger(),
 		flatOption: &config.Flat,
 		data:       []*DnstapFlatT{},
 		mux:        new(sync.Mutex),
@@ -52,15 +53,34 @@ func NewDnstapNatsOutput(config *OutputNatsConfig, params *DnstapOutputParams) *
 	return NewDnstapOutput(params)
 }
 
-func (o *DnstapNatsOutput) open() error {
-	var err error
+func (o *DnstapNatsOutput) connect(options ...nats.Option) (*nats.Conn, error) {
 	if o.config.Token != "" {
-		o.con, err = nats.Connect(o.config.GetHost(), nats.Token(o.config.GetToken()))
+		options = append(options, nats.Token(o.config.GetToken()))
 	} else if o.config.User != "" {
-		o.con, err = nats.Connect(o.config.GetHost(), nats.UserInfo(o.config.GetUser(), o.config.GetPassword()))
-	} else {
-		o.con, err = nats.Connect(o.config.GetHost())
+		options = append(options, nats.UserInfo(o.config.GetUser(), o.config.GetPassword()))
+	}
+	return nats.Connect(o.config.GetHost(), options...)
+}
+
+// Probe connects and authenticates to the server, then closes the connection.
+func (o *DnstapNatsOutput) Probe() error {
+	con, err := o.connect(nats.Timeout(ProbeTimeout))
+	if err != nil {
+		return errors.Wrapf(err, "can't connect nats server, host: %s", o.config.GetHost())
+	}
+	con.Close()
+	return nil
+}
+
+func (o *DnstapNatsOutput) open() error {
+	var err error
+	if o.config.GetFormat() != DnstapJSONFormat {
+		o.serializer, err = NewSerializer(o.config.GetFormat())
+		if err != nil {
+			return err
+		}
 	}
+	o.con, err = o.connect()
 	if err != nil {
 		return errors.Wrapf(err, "can't create nats producer")
 	}
@@ -71,18 +91,26 @@ func (o *DnstapNatsOutput) open() error {
 	return nil
 }
 
-func (o *DnstapNatsOutput) write(frame []byte) error {
-	dt := dnstap.Dnstap{}
-	if err := proto.Unmarshal(frame, &dt); err != nil {
-		return err
+func (o *DnstapNatsOutput) write(m *Message) error {
+	if o.config.GetFormat() == DnstapJSONFormat {
+		if m.flush {
+			return nil
+		}
+		buf, err := MarshalDnstapJSON(m.Frame)
+		if err != nil {
+			return err
+		}
+		return o.con.Publish(o.config.GetSubject(), buf)
 	}
-	data, err := FlatDnstap(&dt, o.flatOption)
+	records, err := flatFrame(m, o.flatOption)
 	if err != nil {
 		return err
 	}
-	o.mux.Lock()
-	o.data = append(o.data, data)
-	o.mux.Unlock()
+	for _, data := range records {
+		o.mux.Lock()
+		o.data = append(o.data, data)
+		o.mux.Unlock()
+	}
 	return nil
 }
 
@@ -105,15 +133,47 @@ func (o *DnstapNatsOutput) publish() {
 		o.mux.Unlock()
 		return
 	}
-	buf, err := json.Marshal(o.data)
+	if o.config.GetFormat() != "json" {
+		o.publishEach()
+		return
+	}
+	records := make([]json.RawMessage, 0, len(o.data))
+	for _, data := range o.data {
+		buf, err := MarshalFlatJSON(data, o.flatOption)
+		if err != nil {
+			o.logger.Debug(err)
+			continue
+		}
+		records = append(records, buf)
+	}
+	buf, err := json.Marshal(records)
 	if err != nil {
-		log.Debug(err)
+		o.mux.Unlock()
+		o.logger.Debug(err)
 		return
 	}
 	o.data = []*DnstapFlatT{}
 	o.mux.Unlock()
 	if err := o.con.Publish(o.config.GetSubject(), buf); err != nil {
-		log.Warnf("publish error: %v", err)
+		o.logger.Warnf("publish error: %v", err)
+	}
+}
+
+// publishEach publishes a message per record, binary formats have no JSON array.
+// It must be called with mux locked.
+func (o *DnstapNatsOutput) publishEach() {
+	records := o.data
+	o.data = []*DnstapFlatT{}
+	o.mux.Unlock()
+	for _, data := range records {
+		buf, err := o.serializer.Serialize(flatMap(data, o.flatOption))
+		if err != nil {
+			o.logger.Debug(err)
+			continue
+		}
+		if err := o.con.Publish(o.config.GetSubject(), buf); err != nil {
+			o.logger.Warnf("publish error: %v", err)
+		}
 	}
 }
 
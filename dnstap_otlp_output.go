@@ -0,0 +1,166 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	otellog "go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// DnstapOTLPOutput exports flat records as OpenTelemetry log records
+// by the OpenTelemetry SDK, OTLP/HTTP protobuf or OTLP/gRPC.
+type DnstapOTLPOutput struct {
+	config     *OutputOTLPConfig
+	logger     log.FieldLogger
+	flatOption DnstapFlatOption
+	provider   *sdklog.LoggerProvider
+	otlpLogger otellog.Logger
+	now        func() time.Time
+}
+
+func NewDnstapOTLPOutput(config *OutputOTLPConfig, params *DnstapOutputParams) *DnstapOutput {
+	o := &DnstapOTLPOutput{
+		config:     config,
+		logger:     params.GetLogger(),
+		flatOption: &config.Flat,
+		now:        params.GetNow(),
+	}
+	params.Handler = o
+	return NewDnstapOutput(params)
+}
+
+func otlpValue(v interface{}) (attribute.Value, bool) {
+	switch t := v.(type) {
+	case string:
+		return attribute.StringValue(t), true
+	case bool:
+		return attribute.BoolValue(t), true
+	case int:
+		return attribute.IntValue(t), true
+	case int32:
+		return attribute.Int64Value(int64(t)), true
+	case int64:
+		return attribute.Int64Value(t), true
+	case uint16:
+		return attribute.Int64Value(int64(t)), true
+	case uint32:
+		return attribute.Int64Value(int64(t)), true
+	case uint64:
+		return attribute.Int64Value(int64(t)), true
+	case float64:
+		return attribute.Float64Value(t), true
+	case fmt.Stringer:
+		return attribute.StringValue(t.String()), true
+	}
+	return attribute.Value{}, false
+}
+
+func newOTLPLogRecord(data *DnstapFlatT, now time.Time) otellog.Record {
+	ts := now
+	if t, err := time.Parse(time.RFC3339Nano, data.Timestamp); err == nil {
+		ts = t
+	}
+	var r otellog.Record
+	r.SetTimestamp(ts)
+	r.SetObservedTimestamp(now)
+	r.SetSeverity(otellog.SeverityInfo)
+	r.SetSeverityText("INFO")
+	r.SetBody(attribute.StringValue(data.Qname))
+	m := data.ToMapString()
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		if k != "qname" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if v, ok := otlpValue(m[k]); ok {
+			r.AddAttributes(attribute.KeyValue{Key: attribute.Key(k), Value: v})
+		}
+	}
+	return r
+}
+
+func (o *DnstapOTLPOutput) newExporter() (sdklog.Exporter, error) {
+	timeout := time.Duration(o.config.GetTimeout()) * time.Second
+	if o.config.GetProtocol() == "grpc" {
+		return otlploggrpc.New(context.Background(),
+			otlploggrpc.WithEndpointURL(o.config.GetEndpoint()),
+			otlploggrpc.WithHeaders(o.config.Headers),
+			otlploggrpc.WithTimeout(timeout),
+		)
+	}
+	return otlploghttp.New(context.Background(),
+		otlploghttp.WithEndpointURL(o.config.GetEndpoint()),
+		otlploghttp.WithHeaders(o.config.Headers),
+		otlploghttp.WithTimeout(timeout),
+	)
+}
+
+func (o *DnstapOTLPOutput) open() error {
+	exporter, err := o.newExporter()
+	if err != nil {
+		return errors.Wrapf(err, "can't create otlp exporter, endpoint: %s", o.config.GetEndpoint())
+	}
+	processor := sdklog.NewBatchProcessor(exporter,
+		sdklog.WithExportMaxBatchSize(o.config.GetBatchSize()),
+		sdklog.WithExportInterval(time.Duration(o.config.GetFlushInterval())*time.Second),
+		sdklog.WithMaxQueueSize(o.config.GetBatchSize()*10),
+	)
+	o.provider = sdklog.NewLoggerProvider(
+		sdklog.WithProcessor(processor),
+		sdklog.WithResource(resource.NewSchemaless(attribute.String("service.name", o.config.GetServiceName()))),
+	)
+	o.otlpLogger = o.provider.Logger("dtap")
+	return nil
+}
+
+func (o *DnstapOTLPOutput) write(m *Message) error {
+	records, err := flatFrame(m, o.flatOption)
+	if err != nil {
+		return err
+	}
+	for _, data := range records {
+		o.otlpLogger.Emit(context.Background(), newOTLPLogRecord(data, o.now()))
+	}
+	return nil
+}
+
+func (o *DnstapOTLPOutput) close() {
+	if o.provider == nil {
+		return
+	}
+	// Shutdown exports remaining records.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(o.config.GetTimeout())*time.Second)
+	defer cancel()
+	if err := o.provider.Shutdown(ctx); err != nil {
+		o.logger.Warnf("otlp export error: %s", err)
+	}
+	o.provider = nil
+}
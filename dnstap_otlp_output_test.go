@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2019 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/mimuret/dtap"
+)
+
+func runTestOTLPOutput(t *testing.T, config *dtap.OutputOTLPConfig, requests chan *collogspb.ExportLogsServiceRequest) {
+	config.Headers = map[string]string{"authorization": "Bearer test"}
+	config.BatchSize = 2
+	assert.Nil(t, config.Validate())
+	params := newTestOutputParams()
+	params.Now = func() time.Time { return time.Unix(1546300900, 0) }
+	o := dtap.NewDnstapOTLPOutput(config, params)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go o.Run(ctx)
+	for i := 0; i < 2; i++ {
+		o.SetMessage(newTestMessage(t, newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("www.example.com.", dns.TypeA))))
+	}
+
+	select {
+	case req := <-requests:
+		rl := req.ResourceLogs[0]
+		assert.Equal(t, "service.name", rl.Resource.Attributes[0].Key)
+		assert.Equal(t, "dtap", rl.Resource.Attributes[0].Value.GetStringValue())
+		records := rl.ScopeLogs[0].LogRecords
+		assert.Len(t, records, 2)
+		r := records[0]
+		assert.Equal(t, "www.example.com.", r.Body.GetStringValue())
+		assert.Equal(t, uint64(1546300800000000000), r.TimeUnixNano)
+		assert.Equal(t, uint64(1546300900000000000), r.ObservedTimeUnixNano)
+		attrs := map[string]interface{}{}
+		for _, kv := range r.Attributes {
+			attrs[kv.Key] = kv.Value.GetValue()
+		}
+		assert.Contains(t, attrs, "qtype")
+		assert.NotContains(t, attrs, "qname")
+	case <-time.After(5 * time.Second):
+		t.Fatal("no export request")
+	}
+}
+
+func TestDnstapOTLPOutputHTTP(t *testing.T) {
+	requests := make(chan *collogspb.ExportLogsServiceRequest, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/logs", r.URL.Path)
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		assert.Equal(t, "Bearer test", r.Header.Get("Authorization"))
+		buf, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		req := &collogspb.ExportLogsServiceRequest{}
+		assert.NoError(t, proto.Unmarshal(buf, req))
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		requests <- req
+	}))
+	defer srv.Close()
+
+	runTestOTLPOutput(t, &dtap.OutputOTLPConfig{Endpoint: srv.URL + "/v1/logs"}, requests)
+}
+
+type testLogsServer struct {
+	collogspb.UnimplementedLogsServiceServer
+	requests chan *collogspb.ExportLogsServiceRequest
+}
+
+func (s *testLogsServer) Export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get("authorization"); len(v) == 1 && v[0] == "Bearer test" {
+		s.requests <- req
+	}
+	return &collogspb.ExportLogsServiceResponse{}, nil
+}
+
+func TestDnstapOTLPOutputGRPC(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	s := &testLogsServer{requests: make(chan *collogspb.ExportLogsServiceRequest, 1)}
+	srv := grpc.NewServer()
+	collogspb.RegisterLogsServiceServer(srv, s)
+	go srv.Serve(l)
+	defer srv.Stop()
+
+	runTestOTLPOutput(t, &dtap.OutputOTLPConfig{Protocol: "grpc", Endpoint: "http://" + l.Addr().String()}, s.requests)
+}
+
+func TestOutputOTLPConfig(t *testing.T) {
+	o := &dtap.OutputOTLPConfig{}
+	assert.Nil(t, o.Validate())
+	assert.Equal(t, "http://localhost:4318/v1/logs", o.GetEndpoint())
+	o.Protocol = "grpc"
+	assert.Equal(t, "http://localhost:4317", o.GetEndpoint())
+	o.Protocol = "http/json"
+	assert.NotNil(t, o.Validate())
+}
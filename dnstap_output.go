@@ -18,78 +18,382 @@ package dtap
 
 import (
 	"context"
+	"fmt"
+	"strings"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	log "github.com/sirupsen/logrus"
 )
 
+// ErrNotProbed is returned by Probe of outputs without a connectivity check.
+var ErrNotProbed = errors.New("not probed")
+
+var (
+	outputPostSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "dtap_output_post_seconds",
+		Help:    "Time from dequeue to successful write of a frame.",
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"output"})
+	outputBufferDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "dtap_output_buffer_depth",
+		Help: "Current number of frames in output buffer.",
+	}, []string{"output"})
+	outputDiskBufferBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "dtap_output_disk_buffer_bytes",
+		Help: "Current bytes of segment files of output disk buffer.",
+	}, []string{"output"})
+)
+
 type DnstapOutputParams struct {
+	// Name is output label of metrics. default is handler type name.
+	Name        string
 	BufferSize  uint
 	InCounter   prometheus.Counter
 	LostCounter prometheus.Counter
 	Handler     OutputHandler
+	// Now returns current time for handlers. default is time.Now.
+	Now func() time.Time
+	// DiskBufferDir enables the disk buffer instead of the memory buffer.
+	DiskBufferDir string
+	// DiskBufferMaxSize is max bytes of the disk buffer, default is DefaultDiskBufferMaxSize.
+	DiskBufferMaxSize int64
+	// ShutdownTimeout bounds writing buffered frames and closing the handler on shutdown, 0 is unlimited.
+	ShutdownTimeout time.Duration
+	// Logger is the logger of the output, default is the standard logger.
+	Logger log.FieldLogger
+	// DedupExactWindow drops byte-identical frames within it, 0 is disabled.
+	DedupExactWindow time.Duration
+	// DedupExactSize is max number of frame hashes of DedupExactWindow, default is DefaultDedupExactSize.
+	DedupExactSize int
+	// Block waits for room of the memory buffer instead of dropping the oldest frame,
+	// it is set for the outputs of the full stream.
+	Block bool
+	// ErrorLogLevels are log levels of errors by category, default is DefaultErrorLogLevels.
+	ErrorLogLevels map[ErrorCategory]string
+}
+
+// WithLogger sets the logger of the output, for embedding dtap into an application.
+func (p *DnstapOutputParams) WithLogger(logger log.FieldLogger) *DnstapOutputParams {
+	p.Logger = logger
+	return p
+}
+
+func (p *DnstapOutputParams) GetLogger() log.FieldLogger {
+	if p.Logger == nil {
+		return log.StandardLogger()
+	}
+	return p.Logger
+}
+
+func (p *DnstapOutputParams) GetNow() func() time.Time {
+	if p.Now == nil {
+		return time.Now
+	}
+	return p.Now
+}
+
+// GetErrorLogLevel returns the log level of errors of category.
+func (p *DnstapOutputParams) GetErrorLogLevel(category ErrorCategory) string {
+	if level, ok := p.ErrorLogLevels[category]; ok {
+		return level
+	}
+	return DefaultErrorLogLevels[category]
 }
 
 type DnstapOutput struct {
-	handler OutputHandler
-	rbuf    *RBuf
+	name        string
+	handler     OutputHandler
+	rbuf        *RBuf
+	postSeconds prometheus.Observer
+	depth       prometheus.Gauge
+	errors      map[ErrorCategory]*ErrorAggregator
+	// disk is the disk buffer used instead of rbuf when DiskBufferDir is set.
+	disk            *DiskBuffer
+	diskBytes       prometheus.Gauge
+	shutdownTimeout time.Duration
+	logger          log.FieldLogger
+	dedup           *FrameDeduper
+	dedupDropped    prometheus.Counter
+	// block waits in SetMessage for room of rbuf until done is closed by the end of Run.
+	block bool
+	done  chan struct{}
 }
 
 func NewDnstapOutput(params *DnstapOutputParams) *DnstapOutput {
-	return &DnstapOutput{
-		handler: params.Handler,
-		rbuf:    NewRbuf(params.BufferSize, params.InCounter, params.LostCounter),
+	name := params.Name
+	if name == "" {
+		name = strings.TrimPrefix(fmt.Sprintf("%T", params.Handler), "*dtap.")
+	}
+	logger := params.GetLogger()
+	errs := map[ErrorCategory]*ErrorAggregator{}
+	for category, kind := range map[ErrorCategory]string{
+		ErrorCategoryParse:   "parse",
+		ErrorCategoryPost:    "writer",
+		ErrorCategoryConnect: "open",
+	} {
+		logf, kind := errorLogf(logger, params.GetErrorLogLevel(category)), kind
+		errs[category] = NewErrorAggregator(DefaultErrorLogInterval, func(format string, args ...interface{}) {
+			logf("%s %s error: %s", name, kind, fmt.Sprintf(format, args...))
+		})
+		errs[category].SetNow(params.GetNow())
 	}
+	o := &DnstapOutput{
+		name:            name,
+		handler:         params.Handler,
+		rbuf:            NewRbuf(params.BufferSize, params.InCounter, params.LostCounter),
+		postSeconds:     outputPostSeconds.WithLabelValues(name),
+		depth:           outputBufferDepth.WithLabelValues(name),
+		errors:          errs,
+		shutdownTimeout: params.ShutdownTimeout,
+		logger:          logger,
+		block:           params.Block,
+		done:            make(chan struct{}),
+	}
+	o.rbuf.SetDepthGauge(o.depth)
+	if params.DedupExactWindow > 0 {
+		o.dedup = NewFrameDeduper(params.DedupExactWindow, params.DedupExactSize, params.GetNow())
+		o.dedupDropped = dedupExactDropped.WithLabelValues(name)
+	}
+	if params.DiskBufferDir != "" {
+		disk, err := NewDiskBuffer(params.DiskBufferDir, params.DiskBufferMaxSize, params.LostCounter)
+		if err != nil {
+			logger.Errorf("%s disk buffer error, use memory buffer: %s", name, err)
+		} else {
+			o.disk = disk
+			o.diskBytes = outputDiskBufferBytes.WithLabelValues(name)
+			o.diskBytes.Set(float64(disk.Size()))
+		}
+	}
+	return o
+}
+
+// Buffer returns the frame buffer of the output, nil with the disk buffer, Block or DedupExactWindow,
+// so inputs don't write to it directly and drop frames or skip deduplication.
+func (o *DnstapOutput) Buffer() *RBuf {
+	if o.disk != nil || o.block || o.dedup != nil {
+		return nil
+	}
+	return o.rbuf
 }
 
 func (o *DnstapOutput) Run(ctx context.Context) {
-	log.Debug("start output run")
+	o.logger.Debug("start output run")
+	defer close(o.done)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		o.loop(ctx)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		if !o.waitShutdown(done) {
+			return
+		}
+	}
+	if o.disk != nil {
+		o.disk.Close()
+	}
+	return
+}
+
+// waitShutdown waits writing buffered frames and closing the handler within shutdownTimeout.
+// When it is exceeded, the handler is abandoned and left frames are counted as lost,
+// frames of the disk buffer are kept for restart instead.
+func (o *DnstapOutput) waitShutdown(done chan struct{}) bool {
+	if o.shutdownTimeout <= 0 {
+		<-done
+		return true
+	}
+	timer := time.NewTimer(o.shutdownTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+	}
+	if o.disk != nil {
+		o.logger.Warnf("%s shutdown timeout exceeded, frames are kept in the disk buffer", o.name)
+		return false
+	}
+	lost := o.rbuf.Len()
+	if o.rbuf.lostCounter != nil {
+		o.rbuf.lostCounter.Add(float64(lost))
+	}
+	o.logger.Warnf("%s shutdown timeout exceeded, %d frames are lost", o.name, lost)
+	return false
+}
+
+func (o *DnstapOutput) loop(ctx context.Context) {
 L:
 	for {
 		select {
 		case <-ctx.Done():
-			log.Debug("Run ctx done")
+			o.logger.Debug("Run ctx done")
 			break L
 		default:
 			if err := o.handler.open(); err != nil {
-				log.Debug(err)
+				o.logError(WithCategory(err, ErrorCategoryConnect))
 				continue
 			}
-			log.Debug("success open")
+			o.logger.Debug("success open")
 			childCtx, _ := context.WithCancel(ctx)
 			err := o.run(childCtx)
-			log.Debug("close handle close")
+			if err == nil {
+				if o.disk == nil {
+					o.drain(ctx)
+				}
+				if err := o.handler.write(&Message{flush: true}); err != nil {
+					o.logError(err)
+					o.flushErrors()
+				}
+			}
+			o.logger.Debug("close handle close")
 			o.handler.close()
 
 			if err != nil {
-				log.Debug(err)
+				o.logger.Debug(err)
 			} else {
 				break L
 			}
 		}
 	}
-	return
 }
+
+// logError logs err by the aggregator of its category.
+func (o *DnstapOutput) logError(err error) {
+	o.errors[Category(err)].Add(err)
+}
+
+func (o *DnstapOutput) flushErrors() {
+	for _, errs := range o.errors {
+		errs.Flush()
+	}
+}
+
 func (o *DnstapOutput) run(ctx context.Context) error {
-	log.Debug("start writer")
+	o.logger.Debug("start writer")
+	if o.disk != nil {
+		return o.runDisk(ctx)
+	}
 L:
 	for {
 		select {
 		case <-ctx.Done():
 			break L
-		case frame := <-o.rbuf.Read():
-			if frame != nil {
-				if err := o.handler.write(frame); err != nil {
-					log.Debugf("writer error: %v", err)
+		case m := <-o.rbuf.Read():
+			o.depth.Set(float64(o.rbuf.Len()))
+			if m != nil {
+				start := time.Now()
+				if err := o.write(ctx, m); err != nil {
+					o.logError(err)
 					return err
 				}
+				o.postSeconds.Observe(time.Since(start).Seconds())
 			}
 		}
 	}
-	log.Debug("end writer")
+	o.logger.Debug("end writer")
+	o.flushErrors()
+	return nil
+}
+
+// write writes m by the handler, waits of a contextHandler end with ctx.
+func (o *DnstapOutput) write(ctx context.Context, m *Message) error {
+	if h, ok := o.handler.(contextHandler); ok {
+		return h.writeContext(ctx, m)
+	}
+	return o.handler.write(m)
+}
+
+// drain writes frames left in the buffer until it is empty.
+func (o *DnstapOutput) drain(ctx context.Context) {
+	for {
+		select {
+		case m := <-o.rbuf.Read():
+			if m == nil {
+				return
+			}
+			if err := o.write(ctx, m); err != nil {
+				o.logError(err)
+				o.flushErrors()
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// runDisk writes frames of the disk buffer, a frame is acked after the write succeeds.
+// The failed frame stays in the buffer, and is written again after reopen.
+func (o *DnstapOutput) runDisk(ctx context.Context) error {
+	for {
+		m, err := o.disk.Read(ctx)
+		if ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			o.logError(err)
+			return err
+		}
+		start := time.Now()
+		if err := o.write(ctx, m); err != nil {
+			o.logError(err)
+			return err
+		}
+		o.disk.Ack()
+		o.postSeconds.Observe(time.Since(start).Seconds())
+		o.diskBytes.Set(float64(o.disk.Size()))
+	}
+	o.logger.Debug("end writer")
+	o.flushErrors()
 	return nil
 }
 
-func (o *DnstapOutput) SetMessage(b []byte) {
-	o.rbuf.Write(b)
+// Probe checks that the output can reach its sink.
+// Handlers without own Probe are not opened, as opening creates files or sends data,
+// so they return ErrNotProbed and are checked by the config validation only.
+func (o *DnstapOutput) Probe() error {
+	if p, ok := o.handler.(Prober); ok {
+		return p.Probe()
+	}
+	return ErrNotProbed
+}
+
+// Name returns the name of the output, the label of its metrics.
+func (o *DnstapOutput) Name() string {
+	return o.name
+}
+
+func (o *DnstapOutput) SetMessage(m *Message) {
+	if o.dedup != nil && o.dedup.Duplicate(m.Frame) {
+		o.dedupDropped.Inc()
+		return
+	}
+	if o.disk != nil {
+		if o.rbuf.inCounter != nil {
+			o.rbuf.inCounter.Inc()
+		}
+		if err := o.disk.Write(m); err != nil {
+			if o.rbuf.lostCounter != nil {
+				o.rbuf.lostCounter.Inc()
+			}
+			o.logError(err)
+		}
+		o.diskBytes.Set(float64(o.disk.Size()))
+		return
+	}
+	if o.block {
+		if !o.rbuf.WriteWait(o.done, m) {
+			// the output is finished, count the frame like Write does for dropped ones.
+			o.rbuf.inCounter.Inc()
+			o.rbuf.lostCounter.Inc()
+		}
+	} else {
+		o.rbuf.Write(m)
+	}
 }
@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) 2019 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var outputStreamFrames = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "dtap_output_stream_frames_total",
+	Help: "The total number of frames sent to outputs of the stream.",
+}, []string{"stream"})
+
+type outputMuxSink struct {
+	output Output
+	rate   float64
+	rand   *rand.Rand
+	frames prometheus.Counter
+}
+
+// OutputMux fans out frames to outputs,
+// each output is sampled independently by own rate.
+type OutputMux struct {
+	sinks []*outputMuxSink
+}
+
+func NewOutputMux() *OutputMux {
+	return &OutputMux{}
+}
+
+// Add registers output with sample rate, rate >= 1 receives all frames.
+func (m *OutputMux) Add(o Output, rate float64) {
+	m.AddStream(o, "", rate)
+}
+
+// AddStream registers output of the named stream with sample rate,
+// frames sent to the stream are counted unless stream is empty.
+func (m *OutputMux) AddStream(o Output, stream string, rate float64) {
+	s := &outputMuxSink{
+		output: o,
+		rate:   rate,
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano() + int64(len(m.sinks)))),
+	}
+	if stream != "" {
+		s.frames = outputStreamFrames.WithLabelValues(stream)
+	}
+	m.sinks = append(m.sinks, s)
+}
+
+func (m *OutputMux) Outputs() []Output {
+	outputs := make([]Output, 0, len(m.sinks))
+	for _, s := range m.sinks {
+		outputs = append(outputs, s.output)
+	}
+	return outputs
+}
+
+// Direct returns the buffer of the only output when it receives all frames,
+// so inputs can write to it without fan-out. Otherwise it returns nil.
+// Outputs of a stream are not direct, SetMessage counts their frames.
+func (m *OutputMux) Direct() *RBuf {
+	if len(m.sinks) != 1 || m.sinks[0].rate < 1 || m.sinks[0].frames != nil {
+		return nil
+	}
+	if b, ok := m.sinks[0].output.(interface{ Buffer() *RBuf }); ok {
+		return b.Buffer()
+	}
+	return nil
+}
+
+func (m *OutputMux) SetMessage(msg *Message) {
+	for _, s := range m.sinks {
+		if s.rate >= 1 || s.rand.Float64() < s.rate {
+			s.output.SetMessage(msg)
+			if s.frames != nil {
+				s.frames.Inc()
+			}
+		}
+	}
+}
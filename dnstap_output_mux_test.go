@@ -0,0 +1,226 @@
+/*
+ * Copyright (c) 2019 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+type stubOutput struct {
+	count int
+}
+
+func (s *stubOutput) Run(context.Context)      {}
+func (s *stubOutput) SetMessage(*dtap.Message) { s.count++ }
+func (s *stubOutput) Probe() error             { return nil }
+
+func TestOutputMux(t *testing.T) {
+	full := &stubOutput{}
+	sampled := &stubOutput{}
+	mux := dtap.NewOutputMux()
+	mux.Add(full, 1)
+	mux.Add(sampled, 0.05)
+	assert.Len(t, mux.Outputs(), 2)
+
+	n := 100000
+	for i := 0; i < n; i++ {
+		mux.SetMessage(dtap.NewMessage([]byte{}))
+	}
+	assert.Equal(t, n, full.count)
+	assert.InDelta(t, 0.05, float64(sampled.count)/float64(n), 0.005)
+}
+
+func TestOutputMuxStreams(t *testing.T) {
+	archive := &stubOutput{}
+	index := &stubOutput{}
+	mux := dtap.NewOutputMux()
+	mux.AddStream(archive, "archive", 1)
+	mux.AddStream(index, "index", 0.1)
+
+	n := 10000
+	for i := 0; i < n; i++ {
+		mux.SetMessage(dtap.NewMessage([]byte{}))
+	}
+	assert.Equal(t, n, archive.count)
+	assert.True(t, index.count > 0 && index.count < n)
+}
+
+func TestOutputMuxDirect(t *testing.T) {
+	mux := dtap.NewOutputMux()
+	assert.Nil(t, mux.Direct())
+
+	params := newTestOutputParams()
+	params.Name = "test_direct"
+	o := dtap.NewDnstapOutput(params)
+	mux.Add(o, 1)
+	assert.Equal(t, o.Buffer(), mux.Direct())
+
+	in := prometheus.NewCounter(prometheus.CounterOpts{Name: "in"})
+	rbuf := dtap.NewRbufTo(mux.Direct(), in)
+	rbuf.Write(dtap.NewMessage([]byte{1}))
+	assert.Equal(t, 1, o.Buffer().Len())
+	// frames written directly are in the depth gauge of the output.
+	assert.Equal(t, 1.0, outputMetric(t, "dtap_output_buffer_depth", params.Name).GetGauge().GetValue())
+	assert.Equal(t, []byte{1}, (<-o.Buffer().Read()).Frame)
+
+	sampled := dtap.NewOutputMux()
+	sampled.Add(o, 0.5)
+	assert.Nil(t, sampled.Direct())
+
+	multi := dtap.NewOutputMux()
+	multi.Add(o, 1)
+	multi.Add(&stubOutput{}, 1)
+	assert.Nil(t, multi.Direct())
+
+	// frames of a stream are counted by the mux.
+	stream := dtap.NewOutputMux()
+	stream.AddStream(o, "test_direct", 1)
+	assert.Nil(t, stream.Direct())
+}
+
+// benchmarkPipeline measures delivery of frames from input buffer to n outputs,
+// buffers are large enough not to lose frames.
+func benchmarkPipeline(b *testing.B, n int, direct bool) {
+	mux := dtap.NewOutputMux()
+	params := newTestOutputParams()
+	params.BufferSize = uint(b.N)
+	var bufs []*dtap.RBuf
+	for i := 0; i < n; i++ {
+		o := dtap.NewDnstapOutput(params)
+		mux.Add(o, 1)
+		bufs = append(bufs, o.Buffer())
+	}
+	wg := &sync.WaitGroup{}
+	for _, buf := range bufs {
+		wg.Add(1)
+		go func(buf *dtap.RBuf) {
+			for i := 0; i < b.N; i++ {
+				<-buf.Read()
+			}
+			wg.Done()
+		}(buf)
+	}
+	in := prometheus.NewCounter(prometheus.CounterOpts{Name: "in"})
+	var irbuf *dtap.RBuf
+	if d := mux.Direct(); direct && d != nil {
+		irbuf = dtap.NewRbufTo(d, in)
+	} else {
+		irbuf = dtap.NewRbuf(uint(b.N), in, prometheus.NewCounter(prometheus.CounterOpts{Name: "lost"}))
+		go func() {
+			for m := range irbuf.Read() {
+				mux.SetMessage(m)
+			}
+		}()
+	}
+	frame := make([]byte, 256)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		irbuf.Write(dtap.NewMessage(frame))
+	}
+	wg.Wait()
+	b.StopTimer()
+	irbuf.Close()
+}
+
+func BenchmarkPipelineSingleOutputDirect(b *testing.B) {
+	benchmarkPipeline(b, 1, true)
+}
+
+func BenchmarkPipelineSingleOutputMux(b *testing.B) {
+	benchmarkPipeline(b, 1, false)
+}
+
+func BenchmarkPipelineMultiOutput(b *testing.B) {
+	benchmarkPipeline(b, 2, false)
+}
+
+func TestOutputMuxFullStream(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dtap")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "out.csv")
+
+	lost := prometheus.NewCounter(prometheus.CounterOpts{Name: "test_lost"})
+	params := newTestOutputParams()
+	params.BufferSize = 2
+	params.LostCounter = lost
+	params.Block = true
+	o := dtap.NewDnstapCSVOutput(&dtap.OutputCSVConfig{Path: path, Columns: []string{"qname"}}, params)
+	mux := dtap.NewOutputMux()
+	mux.AddStream(o, "archive", 1)
+	assert.Nil(t, mux.Direct())
+
+	// the output isn't running yet, so the buffer is saturated after 2 frames.
+	n := 20
+	sent := make(chan struct{})
+	go func() {
+		for i := 0; i < n; i++ {
+			mux.SetMessage(newTestMessage(t, newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery(fmt.Sprintf("%d.example.com.", i), dns.TypeA))))
+		}
+		close(sent)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case <-sent:
+		t.Fatal("frames are sent to the saturated buffer")
+	default:
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		o.Run(ctx)
+		close(done)
+	}()
+	select {
+	case <-sent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("frames are not sent after the output runs")
+	}
+	var records [][]string
+	for i := 0; i < 100 && len(records) < n+1; i++ {
+		time.Sleep(10 * time.Millisecond)
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		records, _ = csv.NewReader(f).ReadAll()
+		f.Close()
+	}
+	cancel()
+	<-done
+
+	assert.Len(t, records, n+1)
+	assert.Equal(t, float64(0), testutil.ToFloat64(lost))
+}
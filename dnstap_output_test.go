@@ -0,0 +1,93 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+// outputMetric returns the metric of name labeled by output, nil when it is not found.
+func outputMetric(t *testing.T, name, output string) *dto.Metric {
+	mfs, err := prometheus.DefaultGatherer.Gather()
+	assert.NoError(t, err)
+	for _, mf := range mfs {
+		if mf.GetName() != name {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "output" && l.GetValue() == output {
+					return m
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func TestDnstapOutputPostSecondsAndDepth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dtap")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	params := newTestOutputParams()
+	params.Name = "test_post_seconds"
+	o := dtap.NewDnstapCSVOutput(&dtap.OutputCSVConfig{
+		Path:    filepath.Join(dir, "out.csv"),
+		Columns: []string{"qname"},
+	}, params)
+	posted := outputMetric(t, "dtap_output_post_seconds", params.Name).GetHistogram().GetSampleCount()
+	for i := 0; i < 3; i++ {
+		o.SetMessage(newTestMessage(t, newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("www.example.com.", dns.TypeA))))
+	}
+	// frames wait in the buffer until the output runs.
+	assert.Equal(t, 3.0, outputMetric(t, "dtap_output_buffer_depth", params.Name).GetGauge().GetValue())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		o.Run(ctx)
+		close(done)
+	}()
+	for i := 0; i < 100; i++ {
+		if outputMetric(t, "dtap_output_post_seconds", params.Name).GetHistogram().GetSampleCount() == posted+3 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	// a sample per written frame.
+	h := outputMetric(t, "dtap_output_post_seconds", params.Name).GetHistogram()
+	assert.Equal(t, posted+3, h.GetSampleCount())
+	assert.Less(t, h.GetSampleSum(), 5.0)
+	assert.Equal(t, 0.0, outputMetric(t, "dtap_output_buffer_depth", params.Name).GetGauge().GetValue())
+}
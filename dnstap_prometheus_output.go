@@ -27,14 +27,13 @@ import (
 	"reflect"
 	"strconv"
 
-	dnstap "github.com/dnstap/golang-dnstap"
-	"github.com/golang/protobuf/proto"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
 type DnstapPrometheusOutput struct {
 	config  *OutputPrometheus
+	logger  log.FieldLogger
 	Metrics []*DnstapPrometheusOutputMetrics
 }
 
@@ -42,7 +41,7 @@ type DnstapPrometheusOutputMetrics struct {
 	Name        string
 	Vec         *prometheus.CounterVec
 	LabelKeys   []string
-	LabelValues map[string]*DnstapPrometheusOutputMetricsValues
+	LabelValues *Cache
 	Interval    int
 	Expire      int
 	CancelFunc  context.CancelFunc
@@ -62,31 +61,32 @@ func (d *DnstapPrometheusOutputMetrics) GetExpire() int {
 	return d.Expire
 }
 
-type DnstapPrometheusOutputMetricsValues struct {
-	Values     []string
-	LastUpdate time.Time
-}
-
 func NewDnstapPrometheusOutputMetrics(counterConfig OutputPrometheusMetrics) *DnstapPrometheusOutputMetrics {
-	return &DnstapPrometheusOutputMetrics{
+	d := &DnstapPrometheusOutputMetrics{
 		Name: counterConfig.GetName(),
 		Vec: promauto.NewCounterVec(prometheus.CounterOpts{
 			Name: counterConfig.GetName(),
 			Help: counterConfig.GetHelp(),
 		}, counterConfig.GetLabels()),
-		LabelKeys:   counterConfig.GetLabels(),
-		LabelValues: map[string]*DnstapPrometheusOutputMetricsValues{},
-		Expire:      counterConfig.GetExpireSec(),
-		Interval:    counterConfig.GetExpireInterval(),
+		LabelKeys: counterConfig.GetLabels(),
+		Expire:    counterConfig.GetExpireSec(),
+		Interval:  counterConfig.GetExpireInterval(),
+	}
+	var ttl time.Duration
+	if d.GetInterval() > 0 && d.GetExpire() > 0 {
+		ttl = time.Second * time.Duration(d.Expire)
+	}
+	// bound label values, evicted values are deleted from vec.
+	d.LabelValues = NewCache(counterConfig.GetName(), counterConfig.GetLimit(), ttl)
+	d.LabelValues.OnEvict = func(key string, value interface{}) {
+		d.Vec.DeleteLabelValues(value.([]string)...)
 	}
+	return d
 }
 
 func (d *DnstapPrometheusOutputMetrics) Inc(values []string) {
 	d.Vec.WithLabelValues(values...).Inc()
-	d.LabelValues[strings.Join(values, ",")] = &DnstapPrometheusOutputMetricsValues{
-		Values:     values,
-		LastUpdate: time.Now(),
-	}
+	d.LabelValues.Set(strings.Join(values, ","), values)
 }
 
 func (d *DnstapPrometheusOutputMetrics) Flush(ctx context.Context) {
@@ -96,12 +96,7 @@ func (d *DnstapPrometheusOutputMetrics) Flush(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			for k, value := range d.LabelValues {
-				if time.Now().Sub(value.LastUpdate) > time.Second*time.Duration(d.Expire) {
-					d.Vec.DeleteLabelValues(value.Values...)
-					delete(d.LabelValues, k)
-				}
-			}
+			d.LabelValues.Expire()
 		}
 	}
 }
@@ -109,6 +104,7 @@ func (d *DnstapPrometheusOutputMetrics) Flush(ctx context.Context) {
 func NewDnstapPrometheusOutput(config *OutputPrometheus, params *DnstapOutputParams) *DnstapOutput {
 	p := &DnstapPrometheusOutput{
 		config:  config,
+		logger:  params.GetLogger(),
 		Metrics: []*DnstapPrometheusOutputMetrics{},
 	}
 	for _, counterConfig := range config.GetCounters() {
@@ -129,15 +125,18 @@ func (o *DnstapPrometheusOutput) open() error {
 	return nil
 }
 
-func (o *DnstapPrometheusOutput) write(frame []byte) error {
-	dt := dnstap.Dnstap{}
-	if err := proto.Unmarshal(frame, &dt); err != nil {
-		return err
-	}
-	data, err := FlatDnstap(&dt, &o.config.Flat)
+func (o *DnstapPrometheusOutput) write(m *Message) error {
+	records, err := flatFrame(m, &o.config.Flat)
 	if err != nil {
 		return err
 	}
+	for _, data := range records {
+		o.inc(data)
+	}
+	return nil
+}
+
+func (o *DnstapPrometheusOutput) inc(data *DnstapFlatT) {
 	e := reflect.ValueOf(data).Elem()
 	m := make(map[string]string)
 	for i := 0; i < e.NumField(); i++ {
@@ -170,12 +169,11 @@ func (o *DnstapPrometheusOutput) write(frame []byte) error {
 			if v, ok := m[l]; ok {
 				labelValues = append(labelValues, v)
 			} else {
-				log.Warnf("can't get metrics: %v, %v", l, counter.Name)
+				o.logger.Warnf("can't get metrics: %v, %v", l, counter.Name)
 			}
 		}
 		counter.Inc(labelValues)
 	}
-	return nil
 }
 
 func (o *DnstapPrometheusOutput) close() {
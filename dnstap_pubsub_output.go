@@ -0,0 +1,141 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/pubsub/v2"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/api/option"
+)
+
+var pubsubPublishErrors = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "dtap_pubsub_publish_errors_total",
+	Help: "The total number of records failed to publish to Pub/Sub.",
+})
+
+type pubsubResult struct {
+	result      *pubsub.PublishResult
+	orderingKey string
+}
+
+// DnstapPubSubOutput publishes flat records as JSON to Google Cloud Pub/Sub
+// by cloud.google.com/go/pubsub, records are batched by the publisher of the client.
+type DnstapPubSubOutput struct {
+	config     *OutputPubSubConfig
+	logger     log.FieldLogger
+	flatOption DnstapFlatOption
+	client     *pubsub.Client
+	publisher  *pubsub.Publisher
+	results    chan *pubsubResult
+	done       chan struct{}
+}
+
+func NewDnstapPubSubOutput(config *OutputPubSubConfig, params *DnstapOutputParams) *DnstapOutput {
+	o := &DnstapPubSubOutput{
+		config:     config,
+		logger:     params.GetLogger(),
+		flatOption: &config.Flat,
+	}
+	params.Handler = o
+	return NewDnstapOutput(params)
+}
+
+func (o *DnstapPubSubOutput) open() error {
+	var opts []option.ClientOption
+	if o.config.Endpoint != "" {
+		opts = append(opts, option.WithEndpoint(o.config.Endpoint))
+	}
+	if o.config.CredentialsFile != "" {
+		opts = append(opts, option.WithCredentialsFile(o.config.CredentialsFile))
+	}
+	client, err := pubsub.NewClient(context.Background(), o.config.Project, opts...)
+	if err != nil {
+		return errors.Wrapf(err, "can't create pubsub client, project: %s", o.config.Project)
+	}
+	o.client = client
+	o.publisher = client.Publisher(o.config.Topic)
+	o.publisher.EnableMessageOrdering = o.config.OrderingKey != ""
+	o.publisher.PublishSettings.CountThreshold = o.config.GetBatchSize()
+	o.publisher.PublishSettings.DelayThreshold = time.Duration(o.config.GetFlushInterval()) * time.Second
+	o.publisher.PublishSettings.Timeout = time.Duration(o.config.GetTimeout()) * time.Second
+	// Publish blocks while the records of 10 batches are outstanding.
+	o.publisher.PublishSettings.FlowControlSettings = pubsub.FlowControlSettings{
+		MaxOutstandingMessages: o.config.GetBatchSize() * 10,
+		MaxOutstandingBytes:    -1,
+		LimitExceededBehavior:  pubsub.FlowControlBlock,
+	}
+	o.results = make(chan *pubsubResult, o.config.GetBatchSize()*10)
+	o.done = make(chan struct{})
+	go o.collect()
+	return nil
+}
+
+// collect counts and logs failed records, publishing of the ordering key of a failed record is resumed.
+func (o *DnstapPubSubOutput) collect() {
+	defer close(o.done)
+	for r := range o.results {
+		if _, err := r.result.Get(context.Background()); err != nil {
+			pubsubPublishErrors.Inc()
+			o.logger.Warnf("pubsub publish error, topic: %s, error: %s", o.config.Topic, err)
+			if r.orderingKey != "" {
+				o.publisher.ResumePublish(r.orderingKey)
+			}
+		}
+	}
+}
+
+func (o *DnstapPubSubOutput) write(m *Message) error {
+	records, err := flatFrame(m, o.flatOption)
+	if err != nil {
+		return err
+	}
+	for _, data := range records {
+		buf, err := MarshalFlatJSON(data, o.flatOption)
+		if err != nil {
+			return err
+		}
+		msg := &pubsub.Message{Data: buf}
+		if o.config.OrderingKey != "" {
+			if v, ok := data.ToMapString()[o.config.OrderingKey]; ok && v != nil {
+				msg.OrderingKey = fmt.Sprint(v)
+			}
+		}
+		o.results <- &pubsubResult{result: o.publisher.Publish(context.Background(), msg), orderingKey: msg.OrderingKey}
+	}
+	return nil
+}
+
+func (o *DnstapPubSubOutput) close() {
+	if o.publisher == nil {
+		return
+	}
+	// Stop sends remaining records and waits for their results.
+	o.publisher.Stop()
+	close(o.results)
+	<-o.done
+	if err := o.client.Close(); err != nil {
+		o.logger.Warnf("pubsub close error: %s", err)
+	}
+	o.client, o.publisher = nil, nil
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub/v2/apiv1/pubsubpb"
+	"cloud.google.com/go/pubsub/v2/pstest"
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+func TestDnstapPubSubOutput(t *testing.T) {
+	srv := pstest.NewServer()
+	defer srv.Close()
+	_, err := srv.GServer.CreateTopic(context.Background(), &pubsubpb.Topic{Name: "projects/project1/topics/dnstap"})
+	assert.NoError(t, err)
+	os.Setenv("PUBSUB_EMULATOR_HOST", srv.Addr)
+	defer os.Unsetenv("PUBSUB_EMULATOR_HOST")
+
+	config := &dtap.OutputPubSubConfig{
+		Project:     "project1",
+		Topic:       "dnstap",
+		OrderingKey: "sld",
+		BatchSize:   2,
+	}
+	assert.Nil(t, config.Validate())
+	o := dtap.NewDnstapPubSubOutput(config, newTestOutputParams())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		o.Run(ctx)
+		close(done)
+	}()
+	q := newTestQuery("www.example.com.", dns.TypeA)
+	o.SetMessage(newTestMessage(t, newTestDnstap(t, dnstap.Message_CLIENT_QUERY, q)))
+	o.SetMessage(newTestMessage(t, newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, newTestResponse(q))))
+
+	timeout := time.After(5 * time.Second)
+	for len(srv.Messages()) < 2 {
+		select {
+		case <-timeout:
+			t.Fatal("no published message")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	cancel()
+	<-done
+	msgs := srv.Messages()
+	assert.Len(t, msgs, 2)
+	types := map[string]bool{}
+	for _, m := range msgs {
+		assert.Equal(t, "example.com", m.OrderingKey)
+		data := map[string]interface{}{}
+		assert.NoError(t, json.Unmarshal(m.Data, &data))
+		assert.Equal(t, "www.example.com.", data["qname"])
+		types[data["type"].(string)] = true
+	}
+	assert.Equal(t, map[string]bool{"CLIENT_QUERY": true, "CLIENT_RESPONSE": true}, types)
+}
+
+func TestOutputPubSubConfig(t *testing.T) {
+	o := &dtap.OutputPubSubConfig{}
+	assert.NotNil(t, o.Validate())
+	o = &dtap.OutputPubSubConfig{Project: "p", Topic: "t"}
+	assert.Nil(t, o.Validate())
+	o.BatchSize = 1001
+	assert.NotNil(t, o.Validate())
+}
@@ -0,0 +1,132 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/apache/pulsar-client-go/pulsar"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "github.com/sirupsen/logrus"
+)
+
+var pulsarPublishErrors = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "dtap_pulsar_publish_errors_total",
+	Help: "The total number of records failed to publish to Pulsar.",
+})
+
+// DnstapPulsarOutput publishes flat records as JSON to Apache Pulsar by pulsar-client-go,
+// the producer batches records and reconnects to the broker.
+type DnstapPulsarOutput struct {
+	config     *OutputPulsarConfig
+	logger     log.FieldLogger
+	flatOption DnstapFlatOption
+	client     pulsar.Client
+	producer   pulsar.Producer
+}
+
+func NewDnstapPulsarOutput(config *OutputPulsarConfig, params *DnstapOutputParams) *DnstapOutput {
+	o := &DnstapPulsarOutput{
+		config:     config,
+		logger:     params.GetLogger(),
+		flatOption: &config.Flat,
+	}
+	params.Handler = o
+	return NewDnstapOutput(params)
+}
+
+// NewPulsarMessage returns the STRING schema message of data, keyed by keyField
+// and its event time is the timestamp of data.
+func NewPulsarMessage(data *DnstapFlatT, opt DnstapFlatOption, keyField string) (*pulsar.ProducerMessage, error) {
+	buf, err := MarshalFlatJSON(data, opt)
+	if err != nil {
+		return nil, err
+	}
+	msg := &pulsar.ProducerMessage{Value: string(buf)}
+	if t, err := time.Parse(time.RFC3339Nano, data.Timestamp); err == nil {
+		msg.EventTime = t
+	}
+	if v, ok := data.ToMapString()[keyField]; ok && v != nil {
+		msg.Key = fmt.Sprint(v)
+	}
+	return msg, nil
+}
+
+func (o *DnstapPulsarOutput) open() error {
+	timeout := time.Duration(o.config.GetTimeout()) * time.Second
+	options := pulsar.ClientOptions{
+		URL:              o.config.GetServiceURL(),
+		OperationTimeout: timeout,
+	}
+	if o.config.Token != "" {
+		options.Authentication = pulsar.NewAuthenticationToken(o.config.Token)
+	}
+	client, err := pulsar.NewClient(options)
+	if err != nil {
+		return errors.Wrapf(err, "can't create pulsar client, url: %s", o.config.GetServiceURL())
+	}
+	producer, err := client.CreateProducer(pulsar.ProducerOptions{
+		Topic:                   o.config.Topic,
+		Schema:                  pulsar.NewStringSchema(nil),
+		SendTimeout:             timeout,
+		BatchingMaxMessages:     uint(o.config.GetBatchSize()),
+		BatchingMaxPublishDelay: time.Duration(o.config.GetFlushInterval()) * time.Second,
+	})
+	if err != nil {
+		client.Close()
+		return errors.Wrapf(err, "can't create pulsar producer, topic: %s", o.config.Topic)
+	}
+	o.client, o.producer = client, producer
+	return nil
+}
+
+func (o *DnstapPulsarOutput) write(m *Message) error {
+	records, err := flatFrame(m, o.flatOption)
+	if err != nil {
+		return err
+	}
+	for _, data := range records {
+		msg, err := NewPulsarMessage(data, o.flatOption, o.config.GetKeyField())
+		if err != nil {
+			return err
+		}
+		// SendAsync waits while the pending queue of the producer is full.
+		o.producer.SendAsync(context.Background(), msg, func(_ pulsar.MessageID, _ *pulsar.ProducerMessage, err error) {
+			if err != nil {
+				pulsarPublishErrors.Inc()
+				o.logger.Warnf("pulsar publish error, topic: %s, error: %s", o.config.Topic, err)
+			}
+		})
+	}
+	return nil
+}
+
+func (o *DnstapPulsarOutput) close() {
+	if o.producer == nil {
+		return
+	}
+	if err := o.producer.Flush(); err != nil {
+		o.logger.Warnf("pulsar flush error: %s", err)
+	}
+	o.producer.Close()
+	o.client.Close()
+	o.client, o.producer = nil, nil
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+func TestNewPulsarMessage(t *testing.T) {
+	opt := &dtap.FlatConfig{}
+	q := newTestQuery("www.example.com.", dns.TypeA)
+	data, err := dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_CLIENT_QUERY, q), opt)
+	assert.NoError(t, err)
+	msg, err := dtap.NewPulsarMessage(data, opt, "sld")
+	assert.NoError(t, err)
+	assert.Equal(t, "example.com", msg.Key)
+	assert.Equal(t, time.Unix(1546300800, 0).UTC(), msg.EventTime.UTC())
+	m := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal([]byte(msg.Value.(string)), &m))
+	assert.Equal(t, "www.example.com.", m["qname"])
+	assert.Equal(t, "CLIENT_QUERY", m["type"])
+
+	msg, err = dtap.NewPulsarMessage(data, opt, "none")
+	assert.NoError(t, err)
+	assert.Empty(t, msg.Key)
+}
+
+func TestOutputPulsarConfig(t *testing.T) {
+	testcases := []struct {
+		topic string
+		valid bool
+	}{
+		{"public/default/dnstap", true},
+		{"persistent://public/default/dnstap", true},
+		{"non-persistent://public/default/dnstap", true},
+		{"", false},
+		{"dnstap", false},
+		{"file://public/default/dnstap", false},
+	}
+	for _, tc := range testcases {
+		o := &dtap.OutputPulsarConfig{Topic: tc.topic}
+		if tc.valid {
+			assert.Nil(t, o.Validate(), tc.topic)
+		} else {
+			assert.NotNil(t, o.Validate(), tc.topic)
+		}
+	}
+	assert.Equal(t, "pulsar://localhost:6650", (&dtap.OutputPulsarConfig{}).GetServiceURL())
+}
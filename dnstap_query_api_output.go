@@ -0,0 +1,256 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// RecordQuery selects records of DnstapQueryAPIOutput, empty fields match all.
+type RecordQuery struct {
+	// Qname matches case-insensitively, with or without the trailing dot.
+	Qname string
+	// Zone matches qnames of the zone and its subdomains.
+	Zone  string
+	Qtype string
+	Rcode string
+	// Address is an IP address or a CIDR of query_address.
+	Address string
+	// Since matches records received within the duration.
+	Since time.Duration
+	// Limit is max number of records, newest first. 0 is unlimited.
+	Limit int
+}
+
+type queryAPIEntry struct {
+	at      time.Time
+	qname   string
+	qtype   string
+	rcode   string
+	address net.IP
+	record  map[string]interface{}
+}
+
+// DnstapQueryAPIOutput keeps recent flat records within Size and Retention,
+// indexed by qname, and serves them by an HTTP API on Listen.
+type DnstapQueryAPIOutput struct {
+	*DnstapOutput
+	config     *OutputQueryAPIConfig
+	logger     log.FieldLogger
+	flatOption DnstapFlatOption
+	now        func() time.Time
+	mux        sync.RWMutex
+	entries    []*queryAPIEntry
+	byQname    map[string][]*queryAPIEntry
+	srv        *http.Server
+}
+
+func NewDnstapQueryAPIOutput(config *OutputQueryAPIConfig, params *DnstapOutputParams) *DnstapQueryAPIOutput {
+	o := &DnstapQueryAPIOutput{
+		config:     config,
+		logger:     params.GetLogger(),
+		flatOption: &config.Flat,
+		now:        params.GetNow(),
+		byQname:    map[string][]*queryAPIEntry{},
+	}
+	params.Handler = o
+	o.DnstapOutput = NewDnstapOutput(params)
+	return o
+}
+
+func queryAPIName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+func (o *DnstapQueryAPIOutput) open() error {
+	l, err := net.Listen("tcp", o.config.GetListen())
+	if err != nil {
+		return errors.Wrapf(err, "can't listen %s", o.config.GetListen())
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/records", o)
+	o.srv = &http.Server{Handler: mux}
+	go func(srv *http.Server) {
+		if err := srv.Serve(l); err != nil && err != http.ErrServerClosed {
+			o.logger.Warnf("query api http server error: %s", err)
+		}
+	}(o.srv)
+	return nil
+}
+
+func (o *DnstapQueryAPIOutput) write(m *Message) error {
+	records, err := flatFrame(m, o.flatOption)
+	if err != nil {
+		return err
+	}
+	now := o.now()
+	o.mux.Lock()
+	defer o.mux.Unlock()
+	o.expire(now)
+	for _, data := range records {
+		if len(o.entries) >= o.config.GetSize() {
+			o.removeOldest()
+		}
+		e := &queryAPIEntry{
+			at:      now,
+			qname:   queryAPIName(data.Qname),
+			qtype:   data.Qtype,
+			rcode:   data.Rcode,
+			address: data.QueryAddress,
+			record:  flatMap(data, o.flatOption),
+		}
+		o.entries = append(o.entries, e)
+		o.byQname[e.qname] = append(o.byQname[e.qname], e)
+	}
+	return nil
+}
+
+// expire removes records older than Retention.
+func (o *DnstapQueryAPIOutput) expire(now time.Time) {
+	for len(o.entries) > 0 && now.Sub(o.entries[0].at) >= o.config.GetRetention() {
+		o.removeOldest()
+	}
+}
+
+func (o *DnstapQueryAPIOutput) removeOldest() {
+	e := o.entries[0]
+	o.entries[0] = nil
+	o.entries = o.entries[1:]
+	// the oldest entry is the first one of its qname too.
+	if list := o.byQname[e.qname]; len(list) <= 1 {
+		delete(o.byQname, e.qname)
+	} else {
+		o.byQname[e.qname] = list[1:]
+	}
+}
+
+// Query returns records matching q, newest first.
+func (o *DnstapQueryAPIOutput) Query(q RecordQuery) ([]map[string]interface{}, error) {
+	var network *net.IPNet
+	var address net.IP
+	if q.Address != "" {
+		if strings.Contains(q.Address, "/") {
+			_, n, err := net.ParseCIDR(q.Address)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid address %s", q.Address)
+			}
+			network = n
+		} else if address = net.ParseIP(q.Address); address == nil {
+			return nil, errors.Errorf("invalid address %s", q.Address)
+		}
+	}
+	zone := queryAPIName(q.Zone)
+	now := o.now()
+
+	o.mux.RLock()
+	defer o.mux.RUnlock()
+	candidates := o.entries
+	if q.Qname != "" {
+		candidates = o.byQname[queryAPIName(q.Qname)]
+	}
+	res := []map[string]interface{}{}
+	for i := len(candidates) - 1; i >= 0; i-- {
+		e := candidates[i]
+		if now.Sub(e.at) >= o.config.GetRetention() || q.Since > 0 && now.Sub(e.at) > q.Since {
+			break
+		}
+		if zone != "" && e.qname != zone && !strings.HasSuffix(e.qname, "."+zone) {
+			continue
+		}
+		if q.Qtype != "" && !strings.EqualFold(q.Qtype, e.qtype) {
+			continue
+		}
+		if q.Rcode != "" && !strings.EqualFold(q.Rcode, e.rcode) {
+			continue
+		}
+		if network != nil && (e.address == nil || !network.Contains(e.address)) {
+			continue
+		}
+		if address != nil && !address.Equal(e.address) {
+			continue
+		}
+		res = append(res, e.record)
+		if q.Limit > 0 && len(res) >= q.Limit {
+			break
+		}
+	}
+	return res, nil
+}
+
+// ServeHTTP serves GET /records with qname, zone, qtype, rcode, address, since (seconds) and limit parameters.
+func (o *DnstapQueryAPIOutput) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	params := r.URL.Query()
+	q := RecordQuery{
+		Qname:   params.Get("qname"),
+		Zone:    params.Get("zone"),
+		Qtype:   params.Get("qtype"),
+		Rcode:   params.Get("rcode"),
+		Address: params.Get("address"),
+		Limit:   o.config.GetLimit(),
+	}
+	if v := params.Get("since"); v != "" {
+		sec, err := strconv.ParseFloat(v, 64)
+		if err != nil || sec < 0 {
+			http.Error(w, "invalid since", http.StatusBadRequest)
+			return
+		}
+		q.Since = time.Duration(sec * float64(time.Second))
+	}
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		if limit < q.Limit {
+			q.Limit = limit
+		}
+	}
+	records, err := o.Query(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"records": records}); err != nil {
+		o.logger.Warnf("query api http write error: %s", err)
+	}
+}
+
+func (o *DnstapQueryAPIOutput) close() {
+	if o.srv == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	o.srv.Shutdown(ctx)
+	o.srv = nil
+}
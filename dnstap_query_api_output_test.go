@@ -0,0 +1,104 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+func TestDnstapQueryAPIOutput(t *testing.T) {
+	now := time.Unix(1546300800, 0)
+	config := &dtap.OutputQueryAPIConfig{Listen: "127.0.0.1:0", Size: 4, Retention: 60}
+	assert.Nil(t, config.Validate())
+	params := newTestOutputParams()
+	params.Now = func() time.Time { return now }
+	o := dtap.NewDnstapQueryAPIOutput(config, params)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		o.Run(ctx)
+		close(done)
+	}()
+	nx := newTestResponse(newTestQuery("www.example.com.", dns.TypeA))
+	nx.Rcode = dns.RcodeNameError
+	for _, dt := range []*dnstap.Dnstap{
+		newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("old.example.net.", dns.TypeA)),
+		newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("WWW.example.com.", dns.TypeA)),
+		newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, nx),
+		newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("mail.example.com.", dns.TypeMX)),
+		newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("example.org.", dns.TypeAAAA)),
+	} {
+		o.SetMessage(newTestMessage(t, dt))
+	}
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	<-done
+
+	testcases := []struct {
+		q      dtap.RecordQuery
+		qnames []string
+	}{
+		{dtap.RecordQuery{}, []string{"example.org.", "mail.example.com.", "www.example.com.", "WWW.example.com."}},
+		{dtap.RecordQuery{Qname: "www.example.com"}, []string{"www.example.com.", "WWW.example.com."}},
+		{dtap.RecordQuery{Zone: "Example.com."}, []string{"mail.example.com.", "www.example.com.", "WWW.example.com."}},
+		{dtap.RecordQuery{Qtype: "mx"}, []string{"mail.example.com."}},
+		{dtap.RecordQuery{Rcode: "NXDOMAIN"}, []string{"www.example.com."}},
+		{dtap.RecordQuery{Address: "192.0.2.0/24", Limit: 1}, []string{"example.org."}},
+		{dtap.RecordQuery{Address: "192.0.2.2"}, nil},
+	}
+	for n, tc := range testcases {
+		records, err := o.Query(tc.q)
+		assert.NoError(t, err)
+		var qnames []string
+		for _, r := range records {
+			qnames = append(qnames, r["qname"].(string))
+		}
+		assert.Equal(t, tc.qnames, qnames, n)
+	}
+	_, err := o.Query(dtap.RecordQuery{Address: "192.0.2"})
+	assert.Error(t, err)
+
+	rec := httptest.NewRecorder()
+	o.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/records?qname=mail.example.com&qtype=MX", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var res struct {
+		Records []map[string]interface{} `json:"records"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	if assert.Len(t, res.Records, 1) {
+		assert.Equal(t, "mail.example.com.", res.Records[0]["qname"])
+	}
+	rec = httptest.NewRecorder()
+	o.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/records?since=x", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	now = now.Add(time.Minute)
+	records, err := o.Query(dtap.RecordQuery{})
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+}
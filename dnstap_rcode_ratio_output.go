@@ -0,0 +1,180 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RcodeRatioOther is the key of identities over MaxIdentities.
+const RcodeRatioOther = "other"
+
+// RcodeCounts are response counts by rcode.
+type RcodeCounts struct {
+	Total    uint64
+	NoError  uint64
+	ServFail uint64
+	NXDomain uint64
+}
+
+func (c *RcodeCounts) add(o *RcodeCounts) {
+	c.Total += o.Total
+	c.NoError += o.NoError
+	c.ServFail += o.ServFail
+	c.NXDomain += o.NXDomain
+}
+
+// Ratio returns n per Total, 0 without responses.
+func (c RcodeCounts) Ratio(n uint64) float64 {
+	if c.Total == 0 {
+		return 0
+	}
+	return float64(n) / float64(c.Total)
+}
+
+// RcodeRatioCounter counts rcodes by key over sliding window made of fixed buckets.
+// Each bucket tracks at most maxKeys keys, new keys over the limit are counted as RcodeRatioOther.
+type RcodeRatioCounter struct {
+	*windowCounter[RcodeCounts]
+}
+
+func NewRcodeRatioCounter(buckets int, maxKeys int) *RcodeRatioCounter {
+	return &RcodeRatioCounter{
+		windowCounter: newWindowCounter(buckets, maxKeys, RcodeRatioOther,
+			func() *RcodeCounts { return &RcodeCounts{} }, (*RcodeCounts).add),
+	}
+}
+
+func (c *RcodeRatioCounter) Inc(key string, rcode string) {
+	c.update(key, func(counts *RcodeCounts) {
+		counts.Total++
+		switch rcode {
+		case "NOERROR":
+			counts.NoError++
+		case "SERVFAIL":
+			counts.ServFail++
+		case "NXDOMAIN":
+			counts.NXDomain++
+		}
+	})
+}
+
+// Counts returns counts of keys over the whole window.
+func (c *RcodeRatioCounter) Counts() map[string]RcodeCounts {
+	total := c.total()
+	res := make(map[string]RcodeCounts, len(total))
+	for k, v := range total {
+		res[k] = *v
+	}
+	return res
+}
+
+// DnstapRcodeRatioOutput counts rcodes of responses over sliding Window seconds,
+// and emits their ratios globally or per identity every Interval seconds.
+type DnstapRcodeRatioOutput struct {
+	config     *OutputRcodeRatioConfig
+	logger     log.FieldLogger
+	flatOption DnstapFlatOption
+	counter    *RcodeRatioCounter
+	emitter    Emitter
+	ticker     windowTicker
+	now        func() time.Time
+}
+
+func NewDnstapRcodeRatioOutput(config *OutputRcodeRatioConfig, params *DnstapOutputParams) *DnstapOutput {
+	params.Handler = &DnstapRcodeRatioOutput{
+		config:     config,
+		logger:     params.GetLogger(),
+		flatOption: &config.Flat,
+		counter:    NewRcodeRatioCounter(config.GetWindow()/config.GetInterval(), config.GetMaxIdentities()),
+		emitter:    NewEmitter(&config.Emit),
+		now:        params.GetNow(),
+	}
+	return NewDnstapOutput(params)
+}
+
+func (o *DnstapRcodeRatioOutput) open() error {
+	if err := o.emitter.open(); err != nil {
+		return err
+	}
+	o.ticker.start(time.Duration(o.config.GetInterval())*time.Second, o.emit, o.counter.Rotate)
+	return nil
+}
+
+func (o *DnstapRcodeRatioOutput) emit() {
+	for _, m := range RcodeRatioRecords(o.counter.Counts(), o.config.PerIdentity, o.config.GetWindow(), o.now()) {
+		if err := o.emitter.emit(m); err != nil {
+			o.logger.Warnf("rcode ratio emit error: %v", err)
+		}
+	}
+}
+
+// RcodeRatioRecords returns emitted records of counts, sorted by identity when perIdentity.
+// The global record is emitted without responses too.
+func RcodeRatioRecords(counts map[string]RcodeCounts, perIdentity bool, window int, now time.Time) []map[string]interface{} {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	if !perIdentity && len(keys) == 0 {
+		keys = []string{""}
+	}
+	res := make([]map[string]interface{}, 0, len(keys))
+	for _, k := range keys {
+		c := counts[k]
+		m := map[string]interface{}{
+			"timestamp":      now.Format(time.RFC3339Nano),
+			"window":         window,
+			"total":          c.Total,
+			"noerror_ratio":  c.Ratio(c.NoError),
+			"servfail_ratio": c.Ratio(c.ServFail),
+			"nxdomain_ratio": c.Ratio(c.NXDomain),
+		}
+		if perIdentity {
+			m["identity"] = k
+		}
+		res = append(res, m)
+	}
+	return res
+}
+
+func (o *DnstapRcodeRatioOutput) write(m *Message) error {
+	records, err := flatFrame(m, o.flatOption)
+	if err != nil {
+		return err
+	}
+	for _, data := range records {
+		if !isResponse(data.MessageType) {
+			continue
+		}
+		key := ""
+		if o.config.PerIdentity {
+			key = data.Identity
+		}
+		o.counter.Inc(key, data.Rcode)
+	}
+	return nil
+}
+
+func (o *DnstapRcodeRatioOutput) close() {
+	o.ticker.stop()
+	o.emitter.close()
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+func TestRcodeRatioCounter(t *testing.T) {
+	c := dtap.NewRcodeRatioCounter(2, 2)
+	c.Inc("ns1", "NOERROR")
+	c.Inc("ns1", "NOERROR")
+	c.Inc("ns1", "NXDOMAIN")
+	c.Inc("ns1", "SERVFAIL")
+	c.Inc("ns2", "REFUSED")
+	// over MaxIdentities
+	c.Inc("ns3", "NOERROR")
+	assert.Equal(t, map[string]dtap.RcodeCounts{
+		"ns1":                {Total: 4, NoError: 2, ServFail: 1, NXDomain: 1},
+		"ns2":                {Total: 1},
+		dtap.RcodeRatioOther: {Total: 1, NoError: 1},
+	}, c.Counts())
+
+	c.Rotate()
+	c.Inc("ns1", "NOERROR")
+	assert.Equal(t, dtap.RcodeCounts{Total: 5, NoError: 3, ServFail: 1, NXDomain: 1}, c.Counts()["ns1"])
+
+	// first bucket is expired
+	c.Rotate()
+	assert.Equal(t, map[string]dtap.RcodeCounts{
+		"ns1": {Total: 1, NoError: 1},
+	}, c.Counts())
+}
+
+func TestRcodeRatioRecords(t *testing.T) {
+	now := time.Unix(1546300800, 0).UTC()
+	counts := map[string]dtap.RcodeCounts{
+		"ns1": {Total: 4, NoError: 2, ServFail: 1, NXDomain: 1},
+		"ns2": {Total: 1},
+	}
+	records := dtap.RcodeRatioRecords(counts, true, 60, now)
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, map[string]interface{}{
+			"timestamp":      "2019-01-01T00:00:00Z",
+			"window":         60,
+			"identity":       "ns1",
+			"total":          uint64(4),
+			"noerror_ratio":  0.5,
+			"servfail_ratio": 0.25,
+			"nxdomain_ratio": 0.25,
+		}, records[0])
+		assert.Equal(t, "ns2", records[1]["identity"])
+		assert.Equal(t, 0.0, records[1]["noerror_ratio"])
+	}
+
+	// global record without responses
+	records = dtap.RcodeRatioRecords(map[string]dtap.RcodeCounts{}, false, 60, now)
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, uint64(0), records[0]["total"])
+		assert.Equal(t, 0.0, records[0]["noerror_ratio"])
+		assert.NotContains(t, records[0], "identity")
+	}
+}
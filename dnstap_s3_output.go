@@ -0,0 +1,336 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	strftime "github.com/jehiah/go-strftime"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "github.com/sirupsen/logrus"
+)
+
+// S3RetryBackoff is the max wait between retries of S3 requests by the SDK,
+// and the first wait before an upload failed after them is tried again, doubled up to a minute.
+var S3RetryBackoff = time.Second
+
+var s3UploadErrors = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "dtap_s3_upload_errors_total",
+	Help: "The total number of parts and objects failed to upload to S3 until shutdown.",
+})
+
+// DnstapS3Output writes flat records as NDJSON objects to an S3 compatible object store by the AWS SDK.
+// Records are buffered per object and uploaded by multipart upload in parts of PartSize bytes,
+// the object is completed at ObjectSize bytes, ObjectMaxAge seconds or shutdown.
+// Uploads run in order on an own goroutine, and failed ones are tried again until shutdown.
+type DnstapS3Output struct {
+	config     *OutputS3Config
+	logger     log.FieldLogger
+	flatOption DnstapFlatOption
+	client     *s3.Client
+	now        func() time.Time
+	mux        sync.Mutex
+	objects    map[string]*s3Object
+	jobs       chan *s3Job
+	closing    chan struct{}
+	uploaded   chan struct{}
+	cancel     context.CancelFunc
+	done       chan struct{}
+}
+
+// s3Object is an object in progress.
+// buf, size and nextPart are owned by write, uploadID and parts by the upload goroutine.
+type s3Object struct {
+	key      string
+	created  time.Time
+	size     int
+	buf      bytes.Buffer
+	nextPart int32
+	uploadID string
+	parts    []types.CompletedPart
+}
+
+// s3Job uploads a part of obj, or completes obj when complete.
+type s3Job struct {
+	obj      *s3Object
+	part     int32
+	data     []byte
+	complete bool
+}
+
+func NewDnstapS3Output(config *OutputS3Config, params *DnstapOutputParams) (*DnstapOutput, error) {
+	client, err := newS3Client(config)
+	if err != nil {
+		return nil, err
+	}
+	params.Handler = &DnstapS3Output{
+		config:     config,
+		logger:     params.GetLogger(),
+		flatOption: &config.Flat,
+		client:     client,
+		now:        params.GetNow(),
+	}
+	return NewDnstapOutput(params), nil
+}
+
+func newS3Client(config *OutputS3Config) (*s3.Client, error) {
+	opts := []func(*awsconfig.LoadOptions) error{awsconfig.WithRegion(config.GetRegion())}
+	if config.AccessKeyID != "" {
+		opts = append(opts, awsconfig.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(config.AccessKeyID, config.SecretAccessKey, config.SessionToken)))
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't load aws config")
+	}
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if config.Endpoint != "" {
+			o.BaseEndpoint = aws.String(config.Endpoint)
+			o.UsePathStyle = !config.VirtualHost
+		}
+		o.HTTPClient = &http.Client{Timeout: time.Duration(config.GetTimeout()) * time.Second}
+		o.Retryer = retry.AddWithMaxBackoffDelay(retry.AddWithMaxAttempts(retry.NewStandard(), config.GetMaxRetry()+1), S3RetryBackoff)
+		// checksums of aws-chunked bodies are not supported by all S3 compatible stores.
+		o.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+		o.ResponseChecksumValidation = aws.ResponseChecksumValidationWhenRequired
+	}), nil
+}
+
+func (o *DnstapS3Output) open() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	o.cancel = cancel
+	o.objects = map[string]*s3Object{}
+	o.jobs = make(chan *s3Job, 4)
+	o.closing = make(chan struct{})
+	o.uploaded = make(chan struct{})
+	o.done = make(chan struct{})
+	go o.upload()
+	go o.expire(ctx)
+	return nil
+}
+
+// expire completes objects older than ObjectMaxAge.
+func (o *DnstapS3Output) expire(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer close(o.done)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			maxAge := time.Duration(o.config.GetObjectMaxAge()) * time.Second
+			var jobs []*s3Job
+			o.mux.Lock()
+			for group, obj := range o.objects {
+				if o.now().Sub(obj.created) >= maxAge {
+					jobs = append(jobs, o.completeJobs(group)...)
+				}
+			}
+			o.mux.Unlock()
+			o.send(jobs)
+		}
+	}
+}
+
+func (o *DnstapS3Output) write(m *Message) error {
+	records, err := flatFrame(m, o.flatOption)
+	if err != nil {
+		return err
+	}
+	var jobs []*s3Job
+	o.mux.Lock()
+	for _, data := range records {
+		buf, err := MarshalFlatJSON(data, o.flatOption)
+		if err != nil {
+			o.mux.Unlock()
+			o.send(jobs)
+			return err
+		}
+		group := ""
+		if strings.Contains(o.config.GetPrefix(), "{identity}") {
+			group = data.Identity
+		}
+		obj, ok := o.objects[group]
+		if !ok {
+			obj = &s3Object{key: o.objectKey(data.Identity), created: o.now()}
+			o.objects[group] = obj
+		}
+		obj.buf.Write(buf)
+		obj.buf.WriteByte('\n')
+		obj.size += len(buf) + 1
+		if obj.size >= o.config.GetObjectSize() {
+			jobs = append(jobs, o.completeJobs(group)...)
+		} else if obj.buf.Len() >= o.config.GetPartSize() {
+			jobs = append(jobs, o.partJob(obj))
+		}
+	}
+	o.mux.Unlock()
+	// it waits for the upload goroutine when it is behind, out of the lock.
+	o.send(jobs)
+	return nil
+}
+
+// partJob cuts the buffer of obj as the next part.
+func (o *DnstapS3Output) partJob(obj *s3Object) *s3Job {
+	obj.nextPart++
+	data := append([]byte(nil), obj.buf.Bytes()...)
+	obj.buf.Reset()
+	return &s3Job{obj: obj, part: obj.nextPart, data: data}
+}
+
+// completeJobs removes the object of group, and returns jobs uploading the rest of it and completing it.
+// The rest of an object without parts is uploaded by a single request on complete.
+func (o *DnstapS3Output) completeJobs(group string) []*s3Job {
+	obj := o.objects[group]
+	delete(o.objects, group)
+	if obj.nextPart == 0 {
+		return []*s3Job{{obj: obj, data: obj.buf.Bytes(), complete: true}}
+	}
+	var jobs []*s3Job
+	if obj.buf.Len() > 0 {
+		jobs = append(jobs, o.partJob(obj))
+	}
+	return append(jobs, &s3Job{obj: obj, complete: true})
+}
+
+func (o *DnstapS3Output) send(jobs []*s3Job) {
+	for _, job := range jobs {
+		o.jobs <- job
+	}
+}
+
+// upload runs jobs in order. A failed job is tried again with backoff, and is given up after shutdown started,
+// so a failed complete keeps the uploaded parts instead of aborting the multipart upload.
+func (o *DnstapS3Output) upload() {
+	defer close(o.uploaded)
+	for job := range o.jobs {
+		backoff := S3RetryBackoff
+		for {
+			err := o.run(job)
+			if err == nil {
+				break
+			}
+			select {
+			case <-o.closing:
+				s3UploadErrors.Inc()
+				o.logger.Warnf("s3 upload of %s is lost: %v", job.obj.key, err)
+			case <-time.After(backoff):
+				o.logger.Debugf("s3 upload error, retry after %s: %v", backoff, err)
+				if backoff *= 2; backoff > time.Minute {
+					backoff = time.Minute
+				}
+				continue
+			}
+			break
+		}
+	}
+}
+
+func (o *DnstapS3Output) run(job *s3Job) error {
+	ctx := context.Background()
+	obj := job.obj
+	bucket := aws.String(o.config.Bucket)
+	key := aws.String(obj.key)
+	switch {
+	case job.complete && obj.nextPart == 0:
+		_, err := o.client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:      bucket,
+			Key:         key,
+			Body:        bytes.NewReader(job.data),
+			ContentType: aws.String("application/x-ndjson"),
+		})
+		return errors.Wrapf(err, "can't put s3 object %s", obj.key)
+	case job.complete:
+		if len(obj.parts) == 0 {
+			return nil
+		}
+		_, err := o.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:          bucket,
+			Key:             key,
+			UploadId:        aws.String(obj.uploadID),
+			MultipartUpload: &types.CompletedMultipartUpload{Parts: obj.parts},
+		})
+		return errors.Wrapf(err, "can't complete s3 multipart upload %s", obj.key)
+	}
+	if obj.uploadID == "" {
+		res, err := o.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+			Bucket:      bucket,
+			Key:         key,
+			ContentType: aws.String("application/x-ndjson"),
+		})
+		if err != nil {
+			return errors.Wrapf(err, "can't create s3 multipart upload %s", obj.key)
+		}
+		obj.uploadID = aws.ToString(res.UploadId)
+	}
+	res, err := o.client.UploadPart(ctx, &s3.UploadPartInput{
+		Bucket:     bucket,
+		Key:        key,
+		UploadId:   aws.String(obj.uploadID),
+		PartNumber: aws.Int32(job.part),
+		Body:       bytes.NewReader(job.data),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "can't upload s3 part %d of %s", job.part, obj.key)
+	}
+	obj.parts = append(obj.parts, types.CompletedPart{PartNumber: aws.Int32(job.part), ETag: res.ETag})
+	return nil
+}
+
+// objectKey returns the key of a new object of identity, Prefix with strftime format and {identity}
+// followed by the creation time in unix nanoseconds.
+func (o *DnstapS3Output) objectKey(identity string) string {
+	now := o.now().UTC()
+	if identity == "" {
+		identity = "unknown"
+	}
+	prefix := strftime.Format(o.config.GetPrefix(), now)
+	prefix = strings.Replace(prefix, "{identity}", strings.Replace(identity, "/", "_", -1), -1)
+	return prefix + strconv.FormatInt(now.UnixNano(), 10) + ".ndjson"
+}
+
+// close completes objects in progress, and waits for their uploads.
+// Uploads failing after shutdown started are given up after the retries of the SDK.
+func (o *DnstapS3Output) close() {
+	close(o.closing)
+	o.cancel()
+	<-o.done
+	var jobs []*s3Job
+	o.mux.Lock()
+	for group := range o.objects {
+		jobs = append(jobs, o.completeJobs(group)...)
+	}
+	o.mux.Unlock()
+	o.send(jobs)
+	close(o.jobs)
+	<-o.uploaded
+}
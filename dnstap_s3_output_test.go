@@ -0,0 +1,240 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+// testS3Server is a fake S3 of single and multipart uploads, failing the first Fail requests
+// and the first FailComplete complete requests by 500.
+type testS3Server struct {
+	mux          sync.Mutex
+	Fail         int
+	FailComplete int
+	objects      map[string]string
+	parts        map[string]map[string]string
+	uploads      int
+	aborts       int
+}
+
+func (s *testS3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if s.Fail > 0 {
+		s.Fail--
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	q := r.URL.Query()
+	switch {
+	case r.Method == http.MethodPost && q["uploads"] != nil:
+		s.uploads++
+		id := fmt.Sprintf("upload%d", s.uploads)
+		s.parts[id] = map[string]string{}
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+	case r.Method == http.MethodPut && q.Get("uploadId") != "":
+		s.parts[q.Get("uploadId")][q.Get("partNumber")] = string(body)
+		w.Header().Set("ETag", `"etag`+q.Get("partNumber")+`"`)
+	case r.Method == http.MethodDelete:
+		s.aborts++
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPost && q.Get("uploadId") != "" && s.FailComplete > 0:
+		s.FailComplete--
+		w.WriteHeader(http.StatusInternalServerError)
+	case r.Method == http.MethodPost && q.Get("uploadId") != "":
+		complete := struct {
+			Parts []struct {
+				PartNumber string
+				ETag       string
+			} `xml:"Part"`
+		}{}
+		xml.Unmarshal(body, &complete)
+		parts := s.parts[q.Get("uploadId")]
+		var buf strings.Builder
+		for _, p := range complete.Parts {
+			if p.ETag != `"etag`+p.PartNumber+`"` {
+				fmt.Fprint(w, "<Error><Code>InvalidPart</Code></Error>")
+				return
+			}
+			buf.WriteString(parts[p.PartNumber])
+		}
+		s.objects[r.URL.Path] = buf.String()
+		fmt.Fprint(w, "<CompleteMultipartUploadResult></CompleteMultipartUploadResult>")
+	case r.Method == http.MethodPut:
+		s.objects[r.URL.Path] = string(body)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func (s *testS3Server) Objects() map[string]string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	res := map[string]string{}
+	for k, v := range s.objects {
+		res[k] = v
+	}
+	return res
+}
+
+func runTestS3Output(t *testing.T, config *dtap.OutputS3Config, qnames ...string) {
+	o, err := dtap.NewDnstapS3Output(config, newTestOutputParams())
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		o.Run(ctx)
+		close(done)
+	}()
+	for _, qname := range qnames {
+		dt := newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery(qname, dns.TypeA))
+		dt.Identity = []byte("ns1")
+		o.SetMessage(newTestMessage(t, dt))
+	}
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-done
+}
+
+func testS3Qnames(t *testing.T, object string) []string {
+	var res []string
+	for _, line := range strings.Split(strings.TrimSpace(object), "\n") {
+		m := map[string]interface{}{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &m))
+		res = append(res, m["qname"].(string))
+	}
+	return res
+}
+
+func TestDnstapS3OutputMultipart(t *testing.T) {
+	s3 := &testS3Server{objects: map[string]string{}, parts: map[string]map[string]string{}}
+	srv := httptest.NewServer(s3)
+	defer srv.Close()
+
+	config := &dtap.OutputS3Config{
+		Endpoint:        srv.URL,
+		Bucket:          "dnstap",
+		Prefix:          "%Y/{identity}/",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+		// every record is uploaded as a part.
+		PartSize: 1,
+	}
+	runTestS3Output(t, config, "a.example.com.", "b.example.com.", "c.example.com.")
+
+	objects := s3.Objects()
+	if assert.Len(t, objects, 1) {
+		for key, object := range objects {
+			assert.True(t, strings.HasPrefix(key, fmt.Sprintf("/dnstap/%d/ns1/", time.Now().UTC().Year())), key)
+			assert.True(t, strings.HasSuffix(key, ".ndjson"), key)
+			assert.Equal(t, []string{"a.example.com.", "b.example.com.", "c.example.com."}, testS3Qnames(t, object))
+		}
+	}
+	assert.Len(t, s3.parts["upload1"], 3)
+}
+
+func TestDnstapS3OutputObjectSize(t *testing.T) {
+	dtap.S3RetryBackoff = time.Millisecond
+	s3 := &testS3Server{objects: map[string]string{}, parts: map[string]map[string]string{}, Fail: 1}
+	srv := httptest.NewServer(s3)
+	defer srv.Close()
+
+	config := &dtap.OutputS3Config{
+		Endpoint:        srv.URL,
+		Bucket:          "dnstap",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+		// each object has 2 records.
+		ObjectSize: 1000,
+	}
+	runTestS3Output(t, config, "a.example.com.", "b.example.com.", "c.example.com.")
+
+	var keys []string
+	objects := s3.Objects()
+	for key := range objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if assert.Len(t, keys, 2) {
+		assert.Equal(t, []string{"a.example.com.", "b.example.com."}, testS3Qnames(t, objects[keys[0]]))
+		assert.Equal(t, []string{"c.example.com."}, testS3Qnames(t, objects[keys[1]]))
+	}
+	assert.Equal(t, 0, s3.uploads)
+}
+
+func TestDnstapS3OutputCompleteRetry(t *testing.T) {
+	dtap.S3RetryBackoff = time.Millisecond
+	// the first complete fails after retries of the SDK, and is tried again.
+	s3 := &testS3Server{objects: map[string]string{}, parts: map[string]map[string]string{}, FailComplete: 3}
+	srv := httptest.NewServer(s3)
+	defer srv.Close()
+
+	config := &dtap.OutputS3Config{
+		Endpoint:        srv.URL,
+		Bucket:          "dnstap",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+		PartSize:        1,
+		ObjectSize:      1000,
+		MaxRetry:        1,
+	}
+	runTestS3Output(t, config, "a.example.com.", "b.example.com.", "c.example.com.")
+
+	var keys []string
+	objects := s3.Objects()
+	for key := range objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if assert.Len(t, keys, 2) {
+		assert.Equal(t, []string{"a.example.com.", "b.example.com."}, testS3Qnames(t, objects[keys[0]]))
+		assert.Equal(t, []string{"c.example.com."}, testS3Qnames(t, objects[keys[1]]))
+	}
+	assert.Equal(t, 0, s3.aborts)
+}
+
+func TestOutputS3ConfigValidate(t *testing.T) {
+	config := &dtap.OutputS3Config{Bucket: "dnstap"}
+	assert.Nil(t, config.Validate())
+	assert.NotNil(t, (&dtap.OutputS3Config{AccessKeyID: "AKID", SecretAccessKey: "secret"}).Validate())
+	assert.NotNil(t, (&dtap.OutputS3Config{Bucket: "dnstap", AccessKeyID: "AKID"}).Validate())
+	config.PartSize = 1024
+	assert.NotNil(t, config.Validate())
+}
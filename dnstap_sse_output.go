@@ -0,0 +1,202 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "github.com/sirupsen/logrus"
+)
+
+var sseDroppedClients = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "dtap_sse_dropped_clients_total",
+	Help: "The total number of SSE clients disconnected by full ClientBuffer.",
+})
+
+type sseClient struct {
+	qname  string
+	typ    string
+	events chan []byte
+	// dropped is closed when the client is disconnected as slow.
+	dropped chan struct{}
+}
+
+func (c *sseClient) match(data *DnstapFlatT) bool {
+	if c.qname != "" && !strings.Contains(strings.ToLower(data.Qname), c.qname) {
+		return false
+	}
+	return c.typ == "" || strings.EqualFold(c.typ, data.Type)
+}
+
+// DnstapSSEOutput streams flat records as Server-Sent Events on Listen, one JSON data event per record.
+// Clients buffer at most ClientBuffer records, a client too slow to read them is disconnected.
+type DnstapSSEOutput struct {
+	*DnstapOutput
+	config     *OutputSSEConfig
+	logger     log.FieldLogger
+	flatOption DnstapFlatOption
+	mux        sync.Mutex
+	clients    map[*sseClient]struct{}
+	srv        *http.Server
+}
+
+func NewDnstapSSEOutput(config *OutputSSEConfig, params *DnstapOutputParams) *DnstapSSEOutput {
+	o := &DnstapSSEOutput{
+		config:     config,
+		logger:     params.GetLogger(),
+		flatOption: &config.Flat,
+		clients:    map[*sseClient]struct{}{},
+	}
+	params.Handler = o
+	o.DnstapOutput = NewDnstapOutput(params)
+	return o
+}
+
+func (o *DnstapSSEOutput) open() error {
+	l, err := net.Listen("tcp", o.config.GetListen())
+	if err != nil {
+		return errors.Wrapf(err, "can't listen %s", o.config.GetListen())
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/events", o)
+	o.srv = &http.Server{Handler: mux}
+	go func(srv *http.Server) {
+		if err := srv.Serve(l); err != nil && err != http.ErrServerClosed {
+			o.logger.Warnf("sse http server error: %s", err)
+		}
+	}(o.srv)
+	return nil
+}
+
+// Clients returns the number of connected clients.
+func (o *DnstapSSEOutput) Clients() int {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+	return len(o.clients)
+}
+
+func (o *DnstapSSEOutput) write(m *Message) error {
+	// flatFrame runs without clients too, flush messages and stateful steps
+	// like sequence and correlation must see every frame.
+	records, err := flatFrame(m, o.flatOption)
+	if err != nil {
+		return err
+	}
+	o.mux.Lock()
+	defer o.mux.Unlock()
+	if len(o.clients) == 0 {
+		return nil
+	}
+	for _, data := range records {
+		var buf []byte
+		for c := range o.clients {
+			if !c.match(data) {
+				continue
+			}
+			if buf == nil {
+				if buf, err = MarshalFlatJSON(data, o.flatOption); err != nil {
+					return err
+				}
+			}
+			select {
+			case c.events <- buf:
+			default:
+				delete(o.clients, c)
+				close(c.dropped)
+				sseDroppedClients.Inc()
+			}
+		}
+	}
+	return nil
+}
+
+// ServeHTTP serves GET /events with qname (substring, case-insensitive) and type parameters.
+func (o *DnstapSSEOutput) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	params := r.URL.Query()
+	c := &sseClient{
+		qname:   strings.ToLower(params.Get("qname")),
+		typ:     params.Get("type"),
+		events:  make(chan []byte, o.config.GetClientBuffer()),
+		dropped: make(chan struct{}),
+	}
+	o.mux.Lock()
+	if len(o.clients) >= o.config.GetMaxClients() {
+		o.mux.Unlock()
+		http.Error(w, "too many clients", http.StatusServiceUnavailable)
+		return
+	}
+	o.clients[c] = struct{}{}
+	o.mux.Unlock()
+	defer func() {
+		o.mux.Lock()
+		delete(o.clients, c)
+		o.mux.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-c.dropped:
+			return
+		case buf := <-c.events:
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", buf); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func (o *DnstapSSEOutput) close() {
+	// streaming handlers never become idle, disconnect them before shutdown.
+	o.mux.Lock()
+	for c := range o.clients {
+		delete(o.clients, c)
+		close(c.dropped)
+	}
+	o.mux.Unlock()
+	if o.srv == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	o.srv.Shutdown(ctx)
+	o.srv = nil
+}
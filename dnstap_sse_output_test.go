@@ -0,0 +1,207 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+func runTestSSEOutput(t *testing.T, config *dtap.OutputSSEConfig) (*dtap.DnstapSSEOutput, func()) {
+	assert.Nil(t, config.Validate())
+	o := dtap.NewDnstapSSEOutput(config, newTestOutputParams())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		o.Run(ctx)
+		close(done)
+	}()
+	return o, func() {
+		cancel()
+		<-done
+	}
+}
+
+func TestDnstapSSEOutput(t *testing.T) {
+	o, stop := runTestSSEOutput(t, &dtap.OutputSSEConfig{Listen: "127.0.0.1:0"})
+	defer stop()
+	srv := httptest.NewServer(o)
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/events?qname=EXAMPLE.com&type=CLIENT_QUERY")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer res.Body.Close()
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+	assert.Equal(t, 1, o.Clients())
+
+	for _, dt := range []*dnstap.Dnstap{
+		newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("www.example.com.", dns.TypeA)),
+		newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("www.example.org.", dns.TypeA)),
+		newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, newTestResponse(newTestQuery("www.example.com.", dns.TypeA))),
+		newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("mail.example.com.", dns.TypeMX)),
+	} {
+		o.SetMessage(newTestMessage(t, dt))
+	}
+
+	events := make(chan string)
+	go func() {
+		r := bufio.NewReader(res.Body)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				close(events)
+				return
+			}
+			if strings.HasPrefix(line, "data: ") {
+				events <- strings.TrimSpace(strings.TrimPrefix(line, "data: "))
+			}
+		}
+	}()
+	for _, qname := range []string{"www.example.com.", "mail.example.com."} {
+		select {
+		case ev := <-events:
+			m := map[string]interface{}{}
+			assert.NoError(t, json.Unmarshal([]byte(ev), &m))
+			assert.Equal(t, qname, m["qname"])
+			assert.Equal(t, "CLIENT_QUERY", m["type"])
+		case <-time.After(3 * time.Second):
+			t.Fatalf("no event of %s", qname)
+		}
+	}
+}
+
+func waitSSEClients(t *testing.T, o *dtap.DnstapSSEOutput, n int) {
+	for i := 0; i < 300 && o.Clients() != n; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, n, o.Clients())
+}
+
+// blockingWriter is a stream response writer of a client never reading.
+type blockingWriter struct {
+	header  http.Header
+	release chan struct{}
+}
+
+func (w *blockingWriter) Header() http.Header { return w.header }
+
+func (w *blockingWriter) Write(b []byte) (int, error) {
+	<-w.release
+	return len(b), nil
+}
+
+func (w *blockingWriter) WriteHeader(int) {}
+
+func (w *blockingWriter) Flush() {}
+
+func TestDnstapSSEOutputSlowClient(t *testing.T) {
+	o, stop := runTestSSEOutput(t, &dtap.OutputSSEConfig{Listen: "127.0.0.1:0", ClientBuffer: 1, MaxClients: 1})
+	defer stop()
+	w := &blockingWriter{header: http.Header{}, release: make(chan struct{})}
+	done := make(chan struct{})
+	go func() {
+		o.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/events", nil))
+		close(done)
+	}()
+	waitSSEClients(t, o, 1)
+
+	// over MaxClients
+	rec := httptest.NewRecorder()
+	o.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/events", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	for i := 0; i < 3; i++ {
+		o.SetMessage(newTestMessage(t, newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("www.example.com.", dns.TypeA))))
+	}
+	waitSSEClients(t, o, 0)
+	close(w.release)
+	<-done
+}
+
+func TestDnstapSSEOutputSequenceWithoutClients(t *testing.T) {
+	config := &dtap.OutputSSEConfig{Listen: "127.0.0.1:0", Flat: dtap.FlatConfig{IncludeSequence: true}}
+	assert.Nil(t, config.Validate())
+	params := newTestOutputParams()
+	params.Name = "test_sse_sequence"
+	o := dtap.NewDnstapSSEOutput(config, params)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		o.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// frames without clients still take sequence numbers.
+	posted := outputMetric(t, "dtap_output_post_seconds", params.Name).GetHistogram().GetSampleCount()
+	for i := 0; i < 2; i++ {
+		o.SetMessage(newTestMessage(t, newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("www.example.com.", dns.TypeA))))
+	}
+	for i := 0; i < 300 && outputMetric(t, "dtap_output_post_seconds", params.Name).GetHistogram().GetSampleCount() < posted+2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	srv := httptest.NewServer(o)
+	defer srv.Close()
+	res, err := http.Get(srv.URL + "/events")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer res.Body.Close()
+	waitSSEClients(t, o, 1)
+	o.SetMessage(newTestMessage(t, newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("www.example.com.", dns.TypeA))))
+
+	events := make(chan string)
+	go func() {
+		r := bufio.NewReader(res.Body)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				close(events)
+				return
+			}
+			if strings.HasPrefix(line, "data: ") {
+				events <- strings.TrimSpace(strings.TrimPrefix(line, "data: "))
+			}
+		}
+	}()
+	select {
+	case ev := <-events:
+		m := map[string]interface{}{}
+		assert.NoError(t, json.Unmarshal([]byte(ev), &m))
+		assert.Equal(t, 3.0, m["seq"])
+	case <-time.After(3 * time.Second):
+		t.Fatal("no event")
+	}
+}
@@ -0,0 +1,208 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	log "github.com/sirupsen/logrus"
+)
+
+// MaxStatsDPacketSize is max bytes of a UDP packet, lines are split into packets within it.
+var MaxStatsDPacketSize = 1432
+
+var statsdSeriesOverflow = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "dtap_statsd_series_overflow_total",
+	Help: "The total number of records counted as other by MaxSeries.",
+})
+
+// DnstapStatsDOutput counts flat records by tags, and sends the counters
+// to a StatsD or DogStatsD server every flush interval.
+type DnstapStatsDOutput struct {
+	config     *OutputStatsDConfig
+	logger     log.FieldLogger
+	flatOption DnstapFlatOption
+	tags       []string
+	// constant are formatted constant tags, sorted by key.
+	constant []string
+	conn     net.Conn
+	mux      sync.Mutex
+	counts   map[string]int64
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func NewDnstapStatsDOutput(config *OutputStatsDConfig, params *DnstapOutputParams) *DnstapOutput {
+	o := &DnstapStatsDOutput{
+		config:     config,
+		logger:     params.GetLogger(),
+		flatOption: &config.Flat,
+		tags:       config.GetTags(),
+		counts:     map[string]int64{},
+	}
+	keys := make([]string, 0, len(config.ConstantTags))
+	for k := range config.ConstantTags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		o.constant = append(o.constant, o.formatTag(k, config.ConstantTags[k]))
+	}
+	params.Handler = o
+	return NewDnstapOutput(params)
+}
+
+// statsdValue replaces separators of the statsd line protocol.
+func statsdValue(s string, format string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '|', ',', ':', '#', '@', '\n', ' ':
+			return '_'
+		case '.':
+			if format == "statsd" {
+				return '_'
+			}
+		}
+		return r
+	}, s)
+}
+
+func (o *DnstapStatsDOutput) formatTag(key, value string) string {
+	if o.config.GetFormat() == "statsd" {
+		return statsdValue(value, "statsd")
+	}
+	return statsdValue(key, "dogstatsd") + ":" + statsdValue(value, "dogstatsd")
+}
+
+func (o *DnstapStatsDOutput) open() error {
+	conn, err := net.Dial("udp", o.config.GetAddress())
+	if err != nil {
+		return errors.Wrapf(err, "can't connect statsd server %s", o.config.GetAddress())
+	}
+	o.conn = conn
+	o.stop = make(chan struct{})
+	o.done = make(chan struct{})
+	go o.run(o.stop, o.done)
+	return nil
+}
+
+func (o *DnstapStatsDOutput) run(stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(time.Duration(o.config.GetFlushInterval()) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := o.flush(); err != nil {
+				o.logger.Warnf("statsd send error: %s", err)
+			}
+		}
+	}
+}
+
+func (o *DnstapStatsDOutput) write(m *Message) error {
+	records, err := flatFrame(m, o.flatOption)
+	if err != nil {
+		return err
+	}
+	o.mux.Lock()
+	defer o.mux.Unlock()
+	for _, data := range records {
+		fields := data.ToMapString()
+		values := make([]string, 0, len(o.tags)+len(o.constant))
+		for _, tag := range o.tags {
+			v := "none"
+			if f, ok := fields[tag]; ok && f != nil && f != "" {
+				v = fmt.Sprint(f)
+			}
+			values = append(values, o.formatTag(tag, v))
+		}
+		key := strings.Join(append(values, o.constant...), "\x00")
+		if _, ok := o.counts[key]; !ok && len(o.counts) >= o.config.GetMaxSeries() {
+			statsdSeriesOverflow.Inc()
+			for i, tag := range o.tags {
+				values[i] = o.formatTag(tag, "other")
+			}
+			key = strings.Join(append(values, o.constant...), "\x00")
+		}
+		o.counts[key]++
+	}
+	return nil
+}
+
+// flush sends and resets the counters.
+func (o *DnstapStatsDOutput) flush() error {
+	o.mux.Lock()
+	counts := o.counts
+	o.counts = map[string]int64{}
+	o.mux.Unlock()
+
+	name := o.config.GetPrefix() + ".query"
+	var packet bytes.Buffer
+	for key, count := range counts {
+		var line string
+		tags := strings.Split(key, "\x00")
+		if key == "" {
+			line = fmt.Sprintf("%s:%d|c", name, count)
+		} else if o.config.GetFormat() == "statsd" {
+			line = fmt.Sprintf("%s.%s:%d|c", name, strings.Join(tags, "."), count)
+		} else {
+			line = fmt.Sprintf("%s:%d|c|#%s", name, count, strings.Join(tags, ","))
+		}
+		if packet.Len() > 0 && packet.Len()+1+len(line) > MaxStatsDPacketSize {
+			if _, err := o.conn.Write(packet.Bytes()); err != nil {
+				return err
+			}
+			packet.Reset()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	if packet.Len() > 0 {
+		if _, err := o.conn.Write(packet.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// close stops the flush loop and sends the left counters, once per open.
+func (o *DnstapStatsDOutput) close() {
+	if o.stop == nil {
+		return
+	}
+	close(o.stop)
+	<-o.done
+	o.stop = nil
+	if err := o.flush(); err != nil {
+		o.logger.Warnf("statsd send error: %s", err)
+	}
+	o.conn.Close()
+}
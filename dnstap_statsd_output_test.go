@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+func receiveStatsD(t *testing.T, config *dtap.OutputStatsDConfig, qtypes ...uint16) []string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer conn.Close()
+	config.Address = conn.LocalAddr().String()
+	assert.Nil(t, config.Validate())
+
+	o := dtap.NewDnstapStatsDOutput(config, newTestOutputParams())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		o.Run(ctx)
+		close(done)
+	}()
+	for _, qtype := range qtypes {
+		dt := newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("www.example.com.", qtype))
+		dt.Identity = []byte("ns1")
+		o.SetMessage(newTestMessage(t, dt))
+	}
+	time.Sleep(100 * time.Millisecond)
+	// counters are sent on close
+	cancel()
+	<-done
+
+	buf := make([]byte, 65536)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	assert.NoError(t, err)
+	lines := strings.Split(string(buf[:n]), "\n")
+	sort.Strings(lines)
+	return lines
+}
+
+func TestDnstapStatsDOutput(t *testing.T) {
+	config := &dtap.OutputStatsDConfig{
+		ConstantTags:  map[string]string{"env": "prod"},
+		FlushInterval: 60,
+	}
+	lines := receiveStatsD(t, config, dns.TypeA, dns.TypeA, dns.TypeAAAA)
+	assert.Equal(t, []string{
+		"dns.query:1|c|#qtype:AAAA,rcode:NOERROR,identity:ns1,env:prod",
+		"dns.query:2|c|#qtype:A,rcode:NOERROR,identity:ns1,env:prod",
+	}, lines)
+
+	config = &dtap.OutputStatsDConfig{
+		Format:        "statsd",
+		Prefix:        "dtap",
+		Tags:          []string{"qtype"},
+		MaxSeries:     1,
+		FlushInterval: 60,
+	}
+	lines = receiveStatsD(t, config, dns.TypeA, dns.TypeAAAA, dns.TypeMX)
+	assert.Equal(t, []string{"dtap.query.A:1|c", "dtap.query.other:2|c"}, lines)
+
+	assert.NotNil(t, (&dtap.OutputStatsDConfig{Format: "graphite"}).Validate())
+}
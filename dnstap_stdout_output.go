@@ -19,58 +19,83 @@ package dtap
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
+	"os"
 
-	dnstap "github.com/dnstap/golang-dnstap"
 	framestream "github.com/farsightsec/golang-framestream"
-	"github.com/golang/protobuf/proto"
-	"github.com/prometheus/common/log"
+	log "github.com/sirupsen/logrus"
 )
 
 type DnstapStdoutOutput struct {
 	config          *OutputStdoutConfig
+	logger          log.FieldLogger
 	enc             *framestream.Encoder
 	flatOption      DnstapFlatOption
+	serializer      Serializer
 	flushCancelFunc context.CancelFunc
 }
 
 func NewDnstapStdoutOutput(config *OutputStdoutConfig, params *DnstapOutputParams) *DnstapOutput {
 	params.Handler = &DnstapStdoutOutput{
 		config:     config,
+		logger:     params.GetLogger(),
 		flatOption: &config.Flat,
 	}
 	return NewDnstapOutput(params)
 }
 
 func (o *DnstapStdoutOutput) open() error {
-	return nil
+	if o.config.GetFormat() == DnstapJSONFormat {
+		return nil
+	}
+	var err error
+	o.serializer, err = NewSerializer(o.config.GetFormat())
+	return err
 }
 
-func (o *DnstapStdoutOutput) write(frame []byte) error {
-	dt := dnstap.Dnstap{}
-	if err := proto.Unmarshal(frame, &dt); err != nil {
-		return err
-	}
-	data, err := FlatDnstap(&dt, o.flatOption)
-	if err != nil {
-		return err
-	}
-	switch o.config.GetType() {
-	case "json":
-		buf, err := json.Marshal(data)
+func (o *DnstapStdoutOutput) write(m *Message) error {
+	if o.config.GetType() == "json" && o.config.GetFormat() == DnstapJSONFormat {
+		if m.flush {
+			return nil
+		}
+		buf, err := MarshalDnstapJSON(m.Frame)
 		if err != nil {
 			return err
 		}
 		fmt.Println(string(buf))
-	case "gotpl":
-		buf := &bytes.Buffer{}
-		if err := o.config.template.Execute(buf, data); err != nil {
-			return err
+		return nil
+	}
+	records, err := flatFrame(m, o.flatOption)
+	if err != nil {
+		return err
+	}
+	for _, data := range records {
+		switch o.config.GetType() {
+		case "json":
+			if o.config.GetFormat() != "json" {
+				buf, err := o.serializer.Serialize(flatMap(data, o.flatOption))
+				if err != nil {
+					return err
+				}
+				if _, err := os.Stdout.Write(buf); err != nil {
+					return err
+				}
+				continue
+			}
+			buf, err := MarshalFlatJSON(data, o.flatOption)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(buf))
+		case "gotpl":
+			buf := &bytes.Buffer{}
+			if err := o.config.template.Execute(buf, data); err != nil {
+				return err
+			}
+			fmt.Println(buf.String())
+		default:
+			o.logger.Fatalf("unsupported Type %s", o.config.GetType())
 		}
-		fmt.Println(buf.String())
-	default:
-		log.Fatalf("unsupported Type %s", o.config.GetType())
 	}
 	return nil
 }
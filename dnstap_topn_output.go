@@ -0,0 +1,229 @@
+/*
+ * Copyright (c) 2019 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"container/heap"
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type TopNEntry struct {
+	Qname string `json:"qname"`
+	Count uint64 `json:"count"`
+}
+
+// TopNCounter counts keys over sliding window made of fixed buckets.
+// Each bucket tracks at most maxKeys keys by the space-saving algorithm, a new key over the limit
+// replaces the least counted key and takes over its count, so frequent keys arriving late are
+// still admitted while a flood of unique keys only churns the least counted ones.
+// Counts of replacing keys are overestimated by at most the count of the replaced key.
+type TopNCounter struct {
+	mux     sync.Mutex
+	buckets []*topNBucket
+	current int
+	maxKeys int
+}
+
+// topNBucket is a min-heap of counts with the index of keys.
+type topNBucket struct {
+	items []*topNItem
+	keys  map[string]*topNItem
+}
+
+type topNItem struct {
+	key   string
+	count uint64
+	index int
+}
+
+func newTopNBucket() *topNBucket {
+	return &topNBucket{keys: map[string]*topNItem{}}
+}
+
+func (b *topNBucket) Len() int           { return len(b.items) }
+func (b *topNBucket) Less(i, j int) bool { return b.items[i].count < b.items[j].count }
+func (b *topNBucket) Swap(i, j int) {
+	b.items[i], b.items[j] = b.items[j], b.items[i]
+	b.items[i].index = i
+	b.items[j].index = j
+}
+func (b *topNBucket) Push(x interface{}) {
+	item := x.(*topNItem)
+	item.index = len(b.items)
+	b.items = append(b.items, item)
+}
+func (b *topNBucket) Pop() interface{} {
+	item := b.items[len(b.items)-1]
+	b.items = b.items[:len(b.items)-1]
+	return item
+}
+
+func NewTopNCounter(buckets int, maxKeys int) *TopNCounter {
+	if buckets < 1 {
+		buckets = 1
+	}
+	c := &TopNCounter{
+		buckets: make([]*topNBucket, buckets),
+		maxKeys: maxKeys,
+	}
+	for i := range c.buckets {
+		c.buckets[i] = newTopNBucket()
+	}
+	return c
+}
+
+func (c *TopNCounter) Inc(key string) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	b := c.buckets[c.current]
+	if item, ok := b.keys[key]; ok {
+		item.count++
+		heap.Fix(b, item.index)
+		return
+	}
+	if c.maxKeys <= 0 || b.Len() < c.maxKeys {
+		item := &topNItem{key: key, count: 1}
+		heap.Push(b, item)
+		b.keys[key] = item
+		return
+	}
+	// replace the least counted key.
+	item := b.items[0]
+	delete(b.keys, item.key)
+	item.key = key
+	item.count++
+	b.keys[key] = item
+	heap.Fix(b, 0)
+}
+
+// Rotate moves to the next bucket, dropping the oldest counts.
+func (c *TopNCounter) Rotate() {
+	c.mux.Lock()
+	c.current = (c.current + 1) % len(c.buckets)
+	c.buckets[c.current] = newTopNBucket()
+	c.mux.Unlock()
+}
+
+// Top returns the n most counted keys over the whole window.
+func (c *TopNCounter) Top(n int) []TopNEntry {
+	total := map[string]uint64{}
+	c.mux.Lock()
+	for _, b := range c.buckets {
+		for _, item := range b.items {
+			total[item.key] += item.count
+		}
+	}
+	c.mux.Unlock()
+	entries := make([]TopNEntry, 0, len(total))
+	for k, v := range total {
+		entries = append(entries, TopNEntry{Qname: k, Count: v})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Count == entries[j].Count {
+			return entries[i].Qname < entries[j].Qname
+		}
+		return entries[i].Count > entries[j].Count
+	})
+	if len(entries) > n {
+		entries = entries[:n]
+	}
+	return entries
+}
+
+type DnstapTopNOutput struct {
+	config     *OutputTopNConfig
+	logger     log.FieldLogger
+	flatOption DnstapFlatOption
+	counter    *TopNCounter
+	emitter    Emitter
+	cancel     context.CancelFunc
+	done       chan struct{}
+	now        func() time.Time
+}
+
+func NewDnstapTopNOutput(config *OutputTopNConfig, params *DnstapOutputParams) *DnstapOutput {
+	params.Handler = &DnstapTopNOutput{
+		config:     config,
+		logger:     params.GetLogger(),
+		flatOption: &config.Flat,
+		counter:    NewTopNCounter(config.GetWindow()/config.GetInterval(), config.GetMaxKeys()),
+		emitter:    NewEmitter(&config.Emit),
+		now:        params.GetNow(),
+	}
+	return NewDnstapOutput(params)
+}
+
+func (o *DnstapTopNOutput) open() error {
+	if err := o.emitter.open(); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	o.cancel = cancel
+	o.done = make(chan struct{})
+	go o.flush(ctx)
+	return nil
+}
+
+func (o *DnstapTopNOutput) flush(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(o.config.GetInterval()) * time.Second)
+	defer close(o.done)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			o.emit()
+			o.counter.Rotate()
+		}
+	}
+}
+
+func (o *DnstapTopNOutput) emit() {
+	m := map[string]interface{}{
+		"timestamp": o.now().Format(time.RFC3339Nano),
+		"window":    o.config.GetWindow(),
+		"top":       o.counter.Top(o.config.GetN()),
+	}
+	if err := o.emitter.emit(m); err != nil {
+		o.logger.Warnf("topn emit error: %v", err)
+	}
+}
+
+func (o *DnstapTopNOutput) write(m *Message) error {
+	records, err := flatFrame(m, o.flatOption)
+	if err != nil {
+		return err
+	}
+	for _, data := range records {
+		if data.Qname != "" {
+			o.counter.Inc(data.Qname)
+		}
+	}
+	return nil
+}
+
+func (o *DnstapTopNOutput) close() {
+	o.cancel()
+	<-o.done
+	o.emitter.close()
+}
@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) 2019 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+func TestTopNCounter(t *testing.T) {
+	c := dtap.NewTopNCounter(2, 3)
+	for i := 0; i < 3; i++ {
+		c.Inc("a.example.")
+	}
+	c.Inc("b.example.")
+	c.Inc("b.example.")
+	c.Inc("c.example.")
+	// over MaxKeys, the least counted key is replaced.
+	c.Inc("d.example.")
+	assert.Equal(t, []dtap.TopNEntry{
+		{Qname: "a.example.", Count: 3},
+		{Qname: "b.example.", Count: 2},
+		{Qname: "d.example.", Count: 2},
+	}, c.Top(4))
+
+	c.Rotate()
+	c.Inc("b.example.")
+	c.Inc("b.example.")
+	c.Inc("b.example.")
+	assert.Equal(t, []dtap.TopNEntry{
+		{Qname: "b.example.", Count: 5},
+		{Qname: "a.example.", Count: 3},
+	}, c.Top(2))
+
+	// first bucket is expired
+	c.Rotate()
+	assert.Equal(t, []dtap.TopNEntry{
+		{Qname: "b.example.", Count: 3},
+	}, c.Top(2))
+}
+
+func TestTopNCounterFlood(t *testing.T) {
+	c := dtap.NewTopNCounter(1, 100)
+	// unique names fill the bucket before the top talker arrives.
+	for i := 0; i < 10000; i++ {
+		c.Inc(fmt.Sprintf("%d.flood.example.", i))
+		if i >= 5000 && i%10 == 0 {
+			c.Inc("www.example.com.")
+		}
+	}
+	top := c.Top(1)
+	if assert.Len(t, top, 1) {
+		assert.Equal(t, "www.example.com.", top[0].Qname)
+		assert.GreaterOrEqual(t, top[0].Count, uint64(500))
+	}
+}
@@ -23,6 +23,9 @@ import (
 )
 
 var FlushTimeout = 1 * time.Second
+var ReconnectInterval = 1 * time.Second
+var HandshakeTimeout = 5 * time.Second
+var ProbeTimeout = 3 * time.Second
 var OutputBufferSize uint = 10000
 
 var nodename string
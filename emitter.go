@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2019 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/fluent/fluent-logger-golang/fluent"
+	"github.com/pkg/errors"
+)
+
+// Emitter writes aggregated records made by outputs to fluent or stdout.
+type Emitter interface {
+	open() error
+	emit(map[string]interface{}) error
+	close()
+}
+
+func NewEmitter(config *EmitConfig) Emitter {
+	if config.GetHost() == "" {
+		return &stdoutEmitter{}
+	}
+	return &fluentEmitter{config: config}
+}
+
+type stdoutEmitter struct{}
+
+func (e *stdoutEmitter) open() error {
+	return nil
+}
+
+func (e *stdoutEmitter) emit(m map[string]interface{}) error {
+	buf, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(buf))
+	return nil
+}
+
+func (e *stdoutEmitter) close() {}
+
+type fluentEmitter struct {
+	config *EmitConfig
+	client *fluent.Fluent
+}
+
+func (e *fluentEmitter) open() error {
+	var err error
+	e.client, err = fluent.New(fluent.Config{
+		FluentHost: e.config.GetHost(),
+		FluentPort: e.config.GetPort(),
+	})
+	if err != nil {
+		return errors.Wrapf(err, "can't create fluent logger")
+	}
+	return nil
+}
+
+func (e *fluentEmitter) emit(m map[string]interface{}) error {
+	if err := e.client.Post(e.config.GetTag(), m); err != nil {
+		return errors.Wrapf(err, "failed to post fluent message, tag: %s", e.config.GetTag())
+	}
+	return nil
+}
+
+func (e *fluentEmitter) close() {
+	e.client.Close()
+}
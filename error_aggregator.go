@@ -0,0 +1,182 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+var DefaultErrorLogInterval = 10 * time.Second
+
+// ErrorCategory is the kind of output errors, logged at the level of ErrorLogLevels of DnstapOutputParams.
+type ErrorCategory string
+
+const (
+	// ErrorCategoryParse is errors decoding frames into records.
+	ErrorCategoryParse ErrorCategory = "parse"
+	// ErrorCategoryPost is errors writing to the destination, and errors without a category.
+	ErrorCategoryPost ErrorCategory = "post"
+	// ErrorCategoryConnect is errors opening the destination.
+	ErrorCategoryConnect ErrorCategory = "connect"
+)
+
+// DefaultErrorLogLevels are the default log levels of output errors by category, debug, info, warn, error or none.
+var DefaultErrorLogLevels = map[ErrorCategory]string{
+	ErrorCategoryParse:   "warn",
+	ErrorCategoryPost:    "warn",
+	ErrorCategoryConnect: "debug",
+}
+
+type categoryError struct {
+	category ErrorCategory
+	err      error
+}
+
+func (e *categoryError) Error() string {
+	return e.err.Error()
+}
+
+func (e *categoryError) Cause() error {
+	return e.err
+}
+
+// WithCategory marks err as category, nil stays nil.
+func WithCategory(err error, category ErrorCategory) error {
+	if err == nil {
+		return nil
+	}
+	return &categoryError{category: category, err: err}
+}
+
+// Category returns the outermost category of err, ErrorCategoryPost when it has none.
+func Category(err error) ErrorCategory {
+	for err != nil {
+		if e, ok := err.(*categoryError); ok {
+			return e.category
+		}
+		cause, ok := err.(interface{ Cause() error })
+		if !ok {
+			break
+		}
+		err = cause.Cause()
+	}
+	return ErrorCategoryPost
+}
+
+// ValidErrorLogLevel returns whether level is a level of DefaultErrorLogLevels.
+func ValidErrorLogLevel(level string) bool {
+	switch level {
+	case "debug", "info", "warn", "error", "none":
+		return true
+	}
+	return false
+}
+
+// errorLogf returns the log function of level, none discards logs.
+func errorLogf(logger log.FieldLogger, level string) func(format string, args ...interface{}) {
+	switch level {
+	case "debug":
+		return logger.Debugf
+	case "info":
+		return logger.Infof
+	case "error":
+		return logger.Errorf
+	case "none":
+		return func(string, ...interface{}) {}
+	}
+	return logger.Warnf
+}
+
+var errorKeyNumbers = regexp.MustCompile(`[0-9]+`)
+
+type aggregatedError struct {
+	suppressed int
+	sample     error
+}
+
+// ErrorAggregator throttles error logs. The first error of a kind is logged
+// in each interval, and the rest are logged as a summary after the interval.
+// Errors are grouped by the cause message with numbers normalized.
+type ErrorAggregator struct {
+	mux      sync.Mutex
+	interval time.Duration
+	logf     func(format string, args ...interface{})
+	errors   map[string]*aggregatedError
+	start    time.Time
+	now      func() time.Time
+}
+
+func NewErrorAggregator(interval time.Duration, logf func(format string, args ...interface{})) *ErrorAggregator {
+	return &ErrorAggregator{
+		interval: interval,
+		logf:     logf,
+		errors:   map[string]*aggregatedError{},
+		now:      time.Now,
+	}
+}
+
+// SetNow replaces the clock of interval, for tests.
+func (a *ErrorAggregator) SetNow(now func() time.Time) {
+	a.mux.Lock()
+	a.now = now
+	a.mux.Unlock()
+}
+
+func (a *ErrorAggregator) Add(err error) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	now := a.now()
+	if now.Sub(a.start) >= a.interval {
+		a.flush()
+		a.start = now
+	}
+	key := errorKeyNumbers.ReplaceAllString(errors.Cause(err).Error(), "N")
+	if e, ok := a.errors[key]; ok {
+		e.suppressed++
+		e.sample = err
+		return
+	}
+	a.errors[key] = &aggregatedError{sample: err}
+	a.logf("%v", err)
+}
+
+// Flush logs summaries of suppressed errors.
+func (a *ErrorAggregator) Flush() {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	a.flush()
+}
+
+func (a *ErrorAggregator) flush() {
+	keys := make([]string, 0, len(a.errors))
+	for k := range a.errors {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if e := a.errors[k]; e.suppressed > 0 {
+			a.logf("%d errors suppressed in last %s, sample: %v", e.suppressed, a.interval, e.sample)
+		}
+	}
+	a.errors = map[string]*aggregatedError{}
+}
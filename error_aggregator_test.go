@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+func TestErrorAggregator(t *testing.T) {
+	var logs []string
+	now := time.Unix(1546300800, 0)
+	a := dtap.NewErrorAggregator(10*time.Second, func(format string, args ...interface{}) {
+		logs = append(logs, fmt.Sprintf(format, args...))
+	})
+	a.SetNow(func() time.Time { return now })
+
+	for i := 0; i < 5; i++ {
+		a.Add(errors.Wrapf(errors.Errorf("dns: overflow unpacking uint16 at %d", i), "frame %d", i))
+	}
+	a.Add(errors.New("connection refused"))
+	assert.Equal(t, []string{
+		"frame 0: dns: overflow unpacking uint16 at 0",
+		"connection refused",
+	}, logs)
+
+	// summary after interval
+	logs = nil
+	now = now.Add(10 * time.Second)
+	a.Add(errors.New("connection refused"))
+	assert.Equal(t, []string{
+		"4 errors suppressed in last 10s, sample: frame 4: dns: overflow unpacking uint16 at 4",
+		"connection refused",
+	}, logs)
+
+	logs = nil
+	a.Flush()
+	assert.Empty(t, logs)
+	a.Add(errors.New("connection refused"))
+	a.Add(errors.New("connection refused"))
+	a.Flush()
+	assert.Equal(t, []string{
+		"connection refused",
+		"1 errors suppressed in last 10s, sample: connection refused",
+	}, logs)
+}
+
+func TestErrorCategory(t *testing.T) {
+	err := dtap.WithCategory(errors.New("unexpected EOF"), dtap.ErrorCategoryParse)
+	assert.Equal(t, dtap.ErrorCategoryParse, dtap.Category(err))
+	assert.Equal(t, dtap.ErrorCategoryParse, dtap.Category(errors.Wrap(err, "frame")))
+	assert.Equal(t, "unexpected EOF", errors.Cause(err).Error())
+	assert.Equal(t, dtap.ErrorCategoryPost, dtap.Category(errors.New("connection reset")))
+	assert.Nil(t, dtap.WithCategory(nil, dtap.ErrorCategoryConnect))
+}
+
+func TestDnstapOutputErrorLogLevels(t *testing.T) {
+	config := &dtap.Config{InputMsgBuffer: 128, LogLevelParse: "info", LogLevelConnect: "error"}
+	assert.Empty(t, config.Validate())
+	levels := config.GetErrorLogLevels()
+	assert.Equal(t, "warn", levels[dtap.ErrorCategoryPost])
+	assert.NotEmpty(t, (&dtap.Config{InputMsgBuffer: 128, LogLevelPost: "trace"}).Validate())
+
+	dir, err := ioutil.TempDir("", "dtap")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	logger, hook := test.NewNullLogger()
+	logger.SetLevel(log.DebugLevel)
+	levelOf := func(kind string) (log.Level, bool) {
+		for _, e := range hook.AllEntries() {
+			if strings.Contains(e.Message, kind) {
+				return e.Level, true
+			}
+		}
+		return 0, false
+	}
+	run := func(path string, m *dtap.Message, kind string) {
+		params := newTestOutputParams().WithLogger(logger)
+		params.ErrorLogLevels = levels
+		o := dtap.NewDnstapCSVOutput(&dtap.OutputCSVConfig{Path: path, Columns: []string{"qname"}}, params)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			o.Run(ctx)
+			close(done)
+		}()
+		o.SetMessage(m)
+		for i := 0; i < 100; i++ {
+			if _, ok := levelOf(kind); ok {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		cancel()
+		<-done
+	}
+
+	run(filepath.Join(dir, "none", "out.csv"), dtap.NewMessage([]byte{0xff}), "open error")
+	level, ok := levelOf("open error")
+	assert.True(t, ok)
+	assert.Equal(t, log.ErrorLevel, level)
+
+	hook.Reset()
+	run(filepath.Join(dir, "out.csv"), dtap.NewMessage([]byte{0xff}), "parse error")
+	level, ok = levelOf("parse error")
+	assert.True(t, ok)
+	assert.Equal(t, log.InfoLevel, level)
+}
@@ -0,0 +1,25 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+// FlatFrame is flatFrame for tests of the records made by outputs.
+var FlatFrame = flatFrame
+
+// NewFlushMessage returns the message asking flat outputs to emit held records on shutdown.
+func NewFlushMessage() *Message {
+	return &Message{flush: true}
+}
@@ -0,0 +1,192 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/vm"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// MaxExprLength is max length of an expression source.
+	MaxExprLength = 1024
+	// MaxExprNodes is max number of nodes of an expression.
+	MaxExprNodes uint = 256
+)
+
+// exprBuiltins are the builtin functions of expressions, pure functions of strings and numbers.
+var exprBuiltins = []string{
+	"len", "lower", "upper", "trim", "trimPrefix", "trimSuffix", "hasPrefix", "hasSuffix",
+	"split", "abs", "ceil", "floor", "round", "int", "float", "string",
+}
+
+var transformFiltered = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "dtap_flat_transform_filtered_total",
+	Help: "Total number of flat records dropped by transform filter.",
+})
+
+// Expr is a compiled expression of expr-lang evaluated against the flat field map.
+// Evaluation never fails, unknown fields are nil and runtime errors result in nil,
+// or false for Match.
+type Expr struct {
+	src     string
+	program *vm.Program
+}
+
+// CompileExpr compiles src.
+func CompileExpr(src string) (*Expr, error) {
+	if len(src) > MaxExprLength {
+		return nil, errors.Errorf("expression is longer than %d", MaxExprLength)
+	}
+	options := []expr.Option{
+		expr.Env(map[string]interface{}{}),
+		expr.AllowUndefinedVariables(),
+		expr.MaxNodes(MaxExprNodes),
+		expr.DisableAllBuiltins(),
+	}
+	for _, name := range exprBuiltins {
+		options = append(options, expr.EnableBuiltin(name))
+	}
+	program, err := expr.Compile(src, options...)
+	if err == nil {
+		// calls of unknown functions are allowed by undefined variables, reject them.
+		v := &exprCallChecker{}
+		node := program.Node()
+		ast.Walk(&node, v)
+		err = v.err
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid expression `%s`", src)
+	}
+	return &Expr{src: src, program: program}, nil
+}
+
+// exprCallChecker finds calls of functions other than the enabled builtins.
+type exprCallChecker struct {
+	err error
+}
+
+func (v *exprCallChecker) Visit(node *ast.Node) {
+	if c, ok := (*node).(*ast.CallNode); ok && v.err == nil {
+		v.err = errors.Errorf("unknown function `%s`", c.Callee)
+	}
+}
+
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Eval returns bool, float64, string or nil, infinities and NaN are nil.
+func (e *Expr) Eval(fields map[string]interface{}) interface{} {
+	v, err := expr.Run(e.program, fields)
+	if err != nil {
+		return nil
+	}
+	v = exprValue(v)
+	if f, ok := v.(float64); ok && (math.IsInf(f, 0) || math.IsNaN(f)) {
+		return nil
+	}
+	return v
+}
+
+// Match returns true only when the result is true.
+func (e *Expr) Match(fields map[string]interface{}) bool {
+	b, ok := e.Eval(fields).(bool)
+	return ok && b
+}
+
+// Transform filters flat records and sets derived fields.
+type Transform struct {
+	filter *Expr
+	names  []string
+	set    map[string]*Expr
+}
+
+// NewTransform compiles filter and set expressions, empty filter keeps all records.
+func NewTransform(filter string, set map[string]string) (*Transform, error) {
+	t := &Transform{set: map[string]*Expr{}}
+	if filter != "" {
+		e, err := CompileExpr(filter)
+		if err != nil {
+			return nil, errors.Wrap(err, "Filter")
+		}
+		t.filter = e
+	}
+	for name, src := range set {
+		e, err := CompileExpr(src)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Set %s", name)
+		}
+		t.names = append(t.names, name)
+		t.set[name] = e
+	}
+	sort.Strings(t.names)
+	return t, nil
+}
+
+// Apply drops records not matching the filter, and sets derived fields of others.
+// Expressions see the fields of ToMapString, not derived fields.
+func (t *Transform) Apply(records []*DnstapFlatT) []*DnstapFlatT {
+	return t.apply(records, recordFilter{})
+}
+
+func (t *Transform) apply(records []*DnstapFlatT, f recordFilter) []*DnstapFlatT {
+	res := records[:0]
+	for _, data := range records {
+		fields := data.ToMapString()
+		if !f.keep(data, DropReasonFilter, transformFiltered, func() bool { return t.filter == nil || t.filter.Match(fields) }) {
+			continue
+		}
+		if len(t.names) > 0 {
+			data.Fields = map[string]interface{}{}
+			for _, name := range t.names {
+				data.Fields[name] = t.set[name].Eval(fields)
+			}
+		}
+		res = append(res, data)
+	}
+	return res
+}
+
+// exprValue normalizes numbers of the field map to float64.
+func exprValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case int:
+		return float64(x)
+	case int32:
+		return float64(x)
+	case int64:
+		return float64(x)
+	case uint16:
+		return float64(x)
+	case uint32:
+		return float64(x)
+	case float32:
+		return float64(x)
+	case float64, string, bool, nil:
+		return x
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+	"github.com/mimuret/dtap"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpr(t *testing.T) {
+	fields := map[string]interface{}{
+		"rcode":        "NXDOMAIN",
+		"latency_ms":   float64(120),
+		"message_size": int64(1500),
+		"tc":           false,
+	}
+	testcases := []struct {
+		src      string
+		expected interface{}
+	}{
+		{`rcode != 'NOERROR'`, true},
+		{`rcode == "NOERROR"`, false},
+		{`latency_ms > 100`, true},
+		{`latency_ms > 100 && !tc`, true},
+		{`tc || message_size <= 512`, false},
+		{`(message_size - 12) / 4`, float64(372)},
+		{`message_size / 0`, nil},
+		{`-latency_ms`, float64(-120)},
+		{`rcode + ":" + rcode`, "NXDOMAIN:NXDOMAIN"},
+		{`unknown == null`, true},
+		{`unknown == nil`, true},
+		{`unknown > 1`, nil},
+		{`rcode > 1`, nil},
+		{`lower(rcode) == "nxdomain"`, true},
+		{`rcode startsWith "NX"`, true},
+	}
+	for _, tc := range testcases {
+		e, err := dtap.CompileExpr(tc.src)
+		if assert.NoError(t, err, tc.src) {
+			assert.Equal(t, tc.expected, e.Eval(fields), tc.src)
+		}
+	}
+
+	for _, src := range []string{``, `rcode ==`, `(rcode == 'a'`, `rcode = 'a'`, `'a`, `a b`, `repeat(rcode, 1000000)`, strings.Repeat("1 + ", 300) + "1"} {
+		_, err := dtap.CompileExpr(src)
+		assert.Error(t, err, src)
+	}
+
+	e, err := dtap.CompileExpr(`unknown > 1`)
+	assert.NoError(t, err)
+	assert.False(t, e.Match(fields))
+}
+
+func TestFlatConfigTransform(t *testing.T) {
+	opt := &dtap.FlatConfig{
+		Filter: `rcode != 'NOERROR'`,
+		Set:    map[string]string{"big": "message_size > 10", "size_x2": "message_size * 2"},
+	}
+	assert.Nil(t, opt.Validate())
+	assert.NotNil(t, (&dtap.FlatConfig{Filter: `rcode ==`}).Validate())
+
+	q := newTestQuery("www.example.com.", dns.TypeA)
+	noerror := newTestResponse(q)
+	nxdomain := newTestResponse(q)
+	nxdomain.Rcode = dns.RcodeNameError
+
+	tr := opt.GetTransform()
+	records := []*dtap.DnstapFlatT{}
+	for _, m := range []*dns.Msg{noerror, nxdomain} {
+		data, err := dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, m), opt)
+		assert.NoError(t, err)
+		records = append(records, data)
+	}
+	records = tr.Apply(records)
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, "NXDOMAIN", records[0].Rcode)
+		assert.Equal(t, true, records[0].ToMapString()["big"])
+		buf, err := dtap.MarshalFlatJSON(records[0], opt)
+		assert.NoError(t, err)
+		m := map[string]interface{}{}
+		assert.NoError(t, json.Unmarshal(buf, &m))
+		assert.Equal(t, true, m["big"])
+		assert.Equal(t, float64(2*records[0].MessageSize), m["size_x2"])
+		assert.Equal(t, "www.example.com.", m["qname"])
+	}
+}
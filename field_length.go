@@ -0,0 +1,141 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var flatFieldTruncated = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "dtap_flat_field_truncated_total",
+	Help: "The total number of field values truncated by MaxFieldLength.",
+})
+
+// truncateString cuts s to at most max bytes on a rune boundary.
+func truncateString(s string, max int) (string, bool) {
+	if len(s) <= max {
+		return s, false
+	}
+	n := max
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n], true
+}
+
+// flatJSONFields are fields encoded as JSON strings by ToMapString, string values inside them are cut.
+var flatJSONFields = map[string]bool{
+	"extra_parsed":      true,
+	"svcb":              true,
+	"txt_records":       true,
+	"cname_chain":       true,
+	"edns_options":      true,
+	"transfer_records":  true,
+	"records":           true,
+	"enrichment_errors": true,
+	"policy":            true,
+}
+
+// TruncateFlatFields sets MaxFieldLength of d, so string values of its output map and JSON
+// longer than max bytes are cut, including values inside records, txt_records, svcb,
+// edns_options, policy and derived fields. Names of truncated fields are set to TruncatedFields.
+func TruncateFlatFields(d *DnstapFlatT, max int) {
+	if max <= 0 {
+		return
+	}
+	d.MaxFieldLength = 0
+	names := truncateFlatMap(d.ToMapString(), max)
+	d.MaxFieldLength = max
+	if len(names) > 0 {
+		d.TruncatedFields = append(d.TruncatedFields, names...)
+		flatFieldTruncated.Add(float64(len(names)))
+	}
+}
+
+// truncateFlatMap cuts string values of the flat map m, and returns sorted names of cut fields.
+func truncateFlatMap(m map[string]interface{}, max int) []string {
+	var names []string
+	for k, v := range m {
+		if k == "truncated_fields" {
+			continue
+		}
+		if s, ok := v.(string); ok && flatJSONFields[k] {
+			var inner interface{}
+			dec := json.NewDecoder(strings.NewReader(s))
+			dec.UseNumber()
+			if err := dec.Decode(&inner); err != nil {
+				continue
+			}
+			if inner, cut := truncateFlatValue(inner, max); cut {
+				if bs, err := json.Marshal(inner); err == nil {
+					m[k] = string(bs)
+					names = append(names, k)
+				}
+			}
+			continue
+		}
+		if v, cut := truncateFlatValue(v, max); cut {
+			m[k] = v
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// truncateFlatValue cuts strings of v and of its nested lists and objects,
+// and reports whether any string is cut.
+func truncateFlatValue(v interface{}, max int) (interface{}, bool) {
+	switch v := v.(type) {
+	case string:
+		return truncateString(v, max)
+	case []string:
+		res, cut := make([]string, len(v)), false
+		for i, s := range v {
+			var ok bool
+			if res[i], ok = truncateString(s, max); ok {
+				cut = true
+			}
+		}
+		return res, cut
+	case []interface{}:
+		res, cut := make([]interface{}, len(v)), false
+		for i, e := range v {
+			var ok bool
+			if res[i], ok = truncateFlatValue(e, max); ok {
+				cut = true
+			}
+		}
+		return res, cut
+	case map[string]interface{}:
+		res, cut := make(map[string]interface{}, len(v)), false
+		for k, e := range v {
+			var ok bool
+			if res[k], ok = truncateFlatValue(e, max); ok {
+				cut = true
+			}
+		}
+		return res, cut
+	}
+	return v, false
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+func TestTruncateFlatFields(t *testing.T) {
+	d := &dtap.DnstapFlatT{
+		Qname:                 "www.example.com.",
+		SecondLevelDomainName: "example.com",
+		TxtRecords:            []string{"short", "a long text record"},
+		Records:               []dtap.RRRecord{{Name: "example.com.", Type: "TXT", Rdata: "\"a long text record\""}},
+		Svcb:                  []dtap.SvcbRecord{{Type: "HTTPS", Target: "a.long.target.example.", Params: map[string]string{"alpn": "h2,h3,a-long-alpn"}}},
+		EdnsOptions:           []dtap.EdnsOption{{Code: 65001, Name: "a long option name"}},
+		Policy:                &dtap.Policy{Rule: "a long policy rule"},
+		Fields:                map[string]interface{}{"name": "é long derived value", "n": 42.0},
+	}
+	dtap.TruncateFlatFields(d, 12)
+	assert.Equal(t, []string{"edns_options", "name", "policy", "qname", "records", "svcb", "txt_records"}, d.TruncatedFields)
+	// the record itself is kept, its output is cut.
+	assert.Equal(t, "www.example.com.", d.Qname)
+
+	m := d.ToMapString()
+	assert.Equal(t, "www.example.", m["qname"])
+	assert.Equal(t, "example.com", m["sld"])
+	assert.Equal(t, `["short","a long text "]`, m["txt_records"])
+	assert.Contains(t, m["records"], `"rdata":"\"a long text"`)
+	assert.Contains(t, m["svcb"], `"target":"a.long.targe"`)
+	assert.Contains(t, m["svcb"], `"alpn":"h2,h3,a-long"`)
+	assert.Contains(t, m["edns_options"], `"name":"a long optio"`)
+	assert.Contains(t, m["policy"], `"rule":"a long polic"`)
+	assert.Equal(t, "é long deri", m["name"])
+	assert.Equal(t, 42.0, m["n"])
+
+	buf, err := dtap.MarshalFlatJSON(d, &dtap.FlatConfig{})
+	assert.NoError(t, err)
+	assert.Contains(t, string(buf), `"qname":"www.example."`)
+	assert.Contains(t, string(buf), `"rule":"a long polic"`)
+	assert.Contains(t, string(buf), `"truncated_fields":["edns_options","name","policy","qname","records","svcb","txt_records"]`)
+
+	// multibyte runes are not split.
+	d = &dtap.DnstapFlatT{Qname: "ああ"}
+	dtap.TruncateFlatFields(d, 4)
+	assert.Equal(t, "あ", d.ToMapString()["qname"])
+
+	d = &dtap.DnstapFlatT{Qname: "www.example.com."}
+	dtap.TruncateFlatFields(d, 0)
+	assert.Equal(t, "www.example.com.", d.ToMapString()["qname"])
+	assert.Nil(t, d.TruncatedFields)
+}
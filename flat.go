@@ -17,53 +17,216 @@
 package dtap
 
 import (
+	"bytes"
 	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"math"
 	"net"
+	"os"
+	"reflect"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/golang/protobuf/proto"
 	"github.com/miekg/dns"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/net/idna"
 )
 
+var flatZoneTransferDropped = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "dtap_flat_zone_transfer_dropped_total",
+	Help: "The total number of AXFR/IXFR records dropped by DropZoneTransfers.",
+})
+
+var flatRcodeDropped = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "dtap_flat_rcode_dropped_total",
+	Help: "The total number of records dropped by Rcodes.",
+})
+
+// DefaultCollectorID is collector of flat records of IncludeCollector without CollectorID, the hostname.
+var DefaultCollectorID, _ = os.Hostname()
+
 type DnstapFlatT struct {
-	Timestamp             string `json:"timestamp" msg:"timestamp"`
-	QueryTime             string `json:"query_time,omitempty" msg:"query_time"`
-	QueryAddress          net.IP `json:"query_address,omitempty" msg:"query_address"`
-	QueryAddressHash      string `json:"query_address_hash,omitempty" msg:"query_address_hash"`
-	QueryPort             uint32 `json:"query_port,omitempty" msg:"query_port"`
-	ResponseTime          string `json:"response_time,omitempty" msg:"response_time"`
-	ResponseAddress       net.IP `json:"response_address,omitempty" msg:"response_address"`
-	ResponseAddressHash   string `json:"response_address_hash,omitempty" msg:"response_address_hash"`
-	ResponsePort          uint32 `json:"response_port,omitempty" msg:"response_port"`
-	ResponseZone          string `json:"response_zone,omitempty" msg:"response_zone"`
-	EcsNet                *Net   `json:"ecs_net,omitempty" msg:"ecs_net"`
-	Identity              string `json:"identity,omitempty" msg:"identity"`
-	Type                  string `json:"type" msg:"type"`
-	SocketFamily          string `json:"socket_family" msg:"socket_family"`
-	SocketProtocol        string `json:"socket_protocol" msg:"socket_protocol"`
-	Version               string `json:"version" msg:"version"`
-	Extra                 string `json:"extra" msg:"extra"`
-	TopLevelDomainName    string `json:"tld" msg:"tld"`
-	SecondLevelDomainName string `json:"sld" msg:"sld"`
-	ThirdLevelDomainName  string `json:"thirdld" msg:"thirdld"`
-	FourthLevelDomainName string `json:"fourthld" msg:"fourthld"`
-	Qname                 string `json:"qname" msg:"qname"`
-	Qclass                string `json:"qclass" msg:"qclass"`
-	Qtype                 string `json:"qtype" msg:"qtype"`
-	MessageSize           int    `json:"message_size" msg:"message_size"`
-	Txid                  uint16 `json:"txid" msg:"txid"`
-	Rcode                 string `json:"rcode" msg:"rcode"`
-	AA                    bool   `json:"aa" msg:"aa"`
-	TC                    bool   `json:"tc" msg:"tc"`
-	RD                    bool   `json:"rd" msg:"rd"`
-	RA                    bool   `json:"ra" msg:"ra"`
-	AD                    bool   `json:"ad" msg:"ad"`
-	CD                    bool   `json:"cd" msg:"cd"`
+	Timestamp           string `json:"timestamp" msg:"timestamp"`
+	QueryTime           string `json:"query_time,omitempty" msg:"query_time"`
+	ReceivedAt          string `json:"received_at,omitempty" msg:"received_at"`
+	QueryAddress        net.IP `json:"query_address,omitempty" msg:"query_address"`
+	QueryAddressHash    string `json:"query_address_hash,omitempty" msg:"query_address_hash"`
+	QueryPort           uint32 `json:"query_port,omitempty" msg:"query_port"`
+	ResponseTime        string `json:"response_time,omitempty" msg:"response_time"`
+	ResponseAddress     net.IP `json:"response_address,omitempty" msg:"response_address"`
+	ResponseAddressHash string `json:"response_address_hash,omitempty" msg:"response_address_hash"`
+	ResponsePort        uint32 `json:"response_port,omitempty" msg:"response_port"`
+	// Src and Dst fields are the sender and the receiver of the message set by CanonicalEndpoints.
+	SrcAddress            net.IP       `json:"src_address,omitempty" msg:"src_address"`
+	SrcPort               uint32       `json:"src_port,omitempty" msg:"src_port"`
+	DstAddress            net.IP       `json:"dst_address,omitempty" msg:"dst_address"`
+	DstPort               uint32       `json:"dst_port,omitempty" msg:"dst_port"`
+	ResponseZone          string       `json:"response_zone,omitempty" msg:"response_zone"`
+	AuthorityName         string       `json:"authority_name,omitempty" msg:"authority_name"`
+	AuthoritativeForZone  *bool        `json:"is_authoritative_for_zone,omitempty" msg:"is_authoritative_for_zone"`
+	EcsNet                *Net         `json:"ecs_net,omitempty" msg:"ecs_net"`
+	Identity              string       `json:"identity,omitempty" msg:"identity"`
+	Type                  string       `json:"type" msg:"type"`
+	IsResponse            *bool        `json:"is_response,omitempty" msg:"is_response"`
+	MessageTypeShort      string       `json:"message_type_short,omitempty" msg:"message_type_short"`
+	SocketFamily          string       `json:"socket_family" msg:"socket_family"`
+	SocketProtocol        string       `json:"socket_protocol" msg:"socket_protocol"`
+	SocketFamilyCode      *int         `json:"socket_family_code,omitempty" msg:"socket_family_code"`
+	SocketProtocolCode    *int         `json:"socket_protocol_code,omitempty" msg:"socket_protocol_code"`
+	Version               string       `json:"version" msg:"version"`
+	Extra                 string       `json:"extra" msg:"extra"`
+	TopLevelDomainName    string       `json:"tld" msg:"tld"`
+	TLDClass              string       `json:"tld_class,omitempty" msg:"tld_class"`
+	QnameReversed         string       `json:"qname_reversed,omitempty" msg:"qname_reversed"`
+	QnameUnicode          string       `json:"qname_unicode,omitempty" msg:"qname_unicode"`
+	SecondLevelDomainName string       `json:"sld" msg:"sld"`
+	ThirdLevelDomainName  string       `json:"thirdld" msg:"thirdld"`
+	FourthLevelDomainName string       `json:"fourthld" msg:"fourthld"`
+	Subdomain             string       `json:"subdomain" msg:"subdomain"`
+	LabelCount            int          `json:"label_count" msg:"label_count"`
+	Qname                 string       `json:"qname" msg:"qname"`
+	Qclass                string       `json:"qclass" msg:"qclass"`
+	Qtype                 string       `json:"qtype" msg:"qtype"`
+	MessageSize           int          `json:"message_size" msg:"message_size"`
+	Qdcount               int          `json:"qdcount" msg:"qdcount"`
+	Ancount               int          `json:"ancount" msg:"ancount"`
+	Nscount               int          `json:"nscount" msg:"nscount"`
+	Arcount               int          `json:"arcount" msg:"arcount"`
+	Txid                  uint16       `json:"txid" msg:"txid"`
+	Rcode                 string       `json:"rcode" msg:"rcode"`
+	AA                    bool         `json:"aa" msg:"aa"`
+	TC                    bool         `json:"tc" msg:"tc"`
+	RD                    bool         `json:"rd" msg:"rd"`
+	RA                    bool         `json:"ra" msg:"ra"`
+	AD                    bool         `json:"ad" msg:"ad"`
+	CD                    bool         `json:"cd" msg:"cd"`
+	DNSID                 *uint16      `json:"dns_id,omitempty" msg:"dns_id"`
+	FlagsHex              string       `json:"flags_hex,omitempty" msg:"flags_hex"`
+	HijackSuspected       bool         `json:"hijack_suspected,omitempty" msg:"hijack_suspected"`
+	EdnsUDPSize           *uint16      `json:"edns_udp_size,omitempty" msg:"edns_udp_size"`
+	EdnsBufsizeSmall      bool         `json:"edns_bufsize_small,omitempty" msg:"edns_bufsize_small"`
+	TimestampEstimated    bool         `json:"timestamp_estimated,omitempty" msg:"timestamp_estimated"`
+	TimestampClamped      bool         `json:"timestamp_clamped,omitempty" msg:"timestamp_clamped"`
+	DocID                 string       `json:"doc_id,omitempty" msg:"doc_id"`
+	LatencyMs             *float64     `json:"latency_ms,omitempty" msg:"latency_ms"`
+	Svcb                  []SvcbRecord `json:"svcb,omitempty" msg:"svcb"`
+	RecordTrimmed         bool         `json:"record_trimmed,omitempty" msg:"record_trimmed"`
+	TxtRecords            []string     `json:"txt_records,omitempty" msg:"txt_records"`
+	Nsid                  string       `json:"nsid,omitempty" msg:"nsid"`
+	CnameChain            []string     `json:"cname_chain,omitempty" msg:"cname_chain"`
+	FinalName             string       `json:"final_name,omitempty" msg:"final_name"`
+	ZoneTransfer          bool         `json:"zone_transfer,omitempty" msg:"zone_transfer"`
+	WouldDrop             bool         `json:"would_drop,omitempty" msg:"would_drop"`
+	WouldDropReason       string       `json:"would_drop_reason,omitempty" msg:"would_drop_reason"`
+	QueryPtr              string       `json:"query_ptr,omitempty" msg:"query_ptr"`
+	Paired                bool         `json:"paired,omitempty" msg:"paired"`
+	QueryMessageSize      *int         `json:"query_message_size,omitempty" msg:"query_message_size"`
+	Unmatched             bool         `json:"unmatched,omitempty" msg:"unmatched"`
+	Occurrences           int          `json:"occurrences,omitempty" msg:"occurrences"`
+	ClientAddress         net.IP       `json:"client_address,omitempty" msg:"client_address"`
+	EdnsOptions           []EdnsOption `json:"edns_options,omitempty" msg:"edns_options"`
+	ClientCookie          string       `json:"client_cookie,omitempty" msg:"client_cookie"`
+	ServerCookie          string       `json:"server_cookie,omitempty" msg:"server_cookie"`
+	EdnsPaddingSize       *int         `json:"edns_padding_size,omitempty" msg:"edns_padding_size"`
+	EdnsKeepalive         *int         `json:"edns_keepalive,omitempty" msg:"edns_keepalive"`
+	EdnsVersion           *int         `json:"edns_version,omitempty" msg:"edns_version"`
+	ExtendedRcode         string       `json:"extended_rcode,omitempty" msg:"extended_rcode"`
+	EdnsExpire            *int64       `json:"edns_expire,omitempty" msg:"edns_expire"`
+	AnswerIPCount         *int         `json:"answer_ip_count,omitempty" msg:"answer_ip_count"`
+	LargeResponse         bool         `json:"large_response,omitempty" msg:"large_response"`
+	CorrelationID         string       `json:"correlation_id,omitempty" msg:"correlation_id"`
+	PtrTarget             net.IP       `json:"ptr_target,omitempty" msg:"ptr_target"`
+	Records               []RRRecord   `json:"records,omitempty" msg:"records"`
+	QnameBinary           bool         `json:"qname_binary,omitempty" msg:"qname_binary"`
+	QnameRaw              string       `json:"qname_raw,omitempty" msg:"qname_raw"`
+	ParsePartial          bool         `json:"parse_partial,omitempty" msg:"parse_partial"`
+	CaptureTruncated      bool         `json:"capture_truncated,omitempty" msg:"capture_truncated"`
+	EnrichmentErrors      []string     `json:"enrichment_errors,omitempty" msg:"enrichment_errors"`
+	SubdomainEntropy      *float64     `json:"subdomain_entropy,omitempty" msg:"subdomain_entropy"`
+	RandomSubdomain       bool         `json:"random_subdomain_suspected,omitempty" msg:"random_subdomain_suspected"`
+	Policy                *Policy      `json:"policy,omitempty" msg:"policy"`
+	Blocklisted           bool         `json:"blocklisted,omitempty" msg:"blocklisted"`
+	BlocklistMatch        string       `json:"blocklist_match,omitempty" msg:"blocklist_match"`
+	// Transfer fields are set on summary records of AssembleZoneTransfers.
+	TransferMessages   int                    `json:"transfer_messages,omitempty" msg:"transfer_messages"`
+	TransferRecords    map[string]interface{} `json:"transfer_records,omitempty" msg:"transfer_records"`
+	TransferSerial     *uint32                `json:"transfer_serial,omitempty" msg:"transfer_serial"`
+	TransferFromSerial *uint32                `json:"transfer_from_serial,omitempty" msg:"transfer_from_serial"`
+	TransferBytes      int                    `json:"transfer_bytes,omitempty" msg:"transfer_bytes"`
+	TransferIncomplete bool                   `json:"transfer_incomplete,omitempty" msg:"transfer_incomplete"`
+	// TruncatedFields are names of fields cut by MaxFieldLength.
+	TruncatedFields []string `json:"truncated_fields,omitempty" msg:"truncated_fields"`
+	// Seq and SeqEpoch are set by IncludeSequence.
+	Seq      uint64 `json:"seq,omitempty" msg:"seq"`
+	SeqEpoch int64  `json:"seq_epoch,omitempty" msg:"seq_epoch"`
+	// Source is the label of the input received the frame.
+	Source string `json:"source,omitempty" msg:"source"`
+	// Collector is CollectorID of the flat config set by IncludeCollector.
+	Collector string `json:"collector,omitempty" msg:"collector"`
+	// TransportClient fields are the peer of the input connection set by IncludeTransportAddress.
+	TransportClientAddress net.IP `json:"transport_client_address,omitempty" msg:"transport_client_address"`
+	TransportClientPort    uint32 `json:"transport_client_port,omitempty" msg:"transport_client_port"`
+	// TimestampEpoch is float64 seconds or int64 nanoseconds by EpochUnit.
+	TimestampEpoch interface{} `json:"timestamp_epoch,omitempty" msg:"timestamp_epoch"`
+	// ExtraParsed are fields of extra parsed by ExtraParser.
+	ExtraParsed map[string]interface{} `json:"extra_parsed,omitempty" msg:"extra_parsed"`
+	// Fields are derived fields set by transform, emitted as top level fields.
+	Fields map[string]interface{} `json:"-" msg:"-"`
+	// MaxFieldLength cuts string values of the output map and JSON to it, set by TruncateFlatFields.
+	MaxFieldLength int `json:"-" msg:"-"`
+	// MessageType is the dnstap type of the message, not renamed by TypeNames.
+	MessageType dnstap.Message_Type `json:"-" msg:"-"`
+	// dnsMsg is the fully parsed response of a zone transfer, reused by the transfer assembler.
+	dnsMsg *dns.Msg
+}
+
+// RRRecord is a resource record of answer, authority or additional section.
+type RRRecord struct {
+	Section string `json:"section" msg:"section"`
+	Name    string `json:"name" msg:"name"`
+	Type    string `json:"type" msg:"type"`
+	TTL     uint32 `json:"ttl" msg:"ttl"`
+	Rdata   string `json:"rdata" msg:"rdata"`
+}
+
+// EdnsOption is code and known name of an option in the OPT record.
+type EdnsOption struct {
+	Code uint16 `json:"code" msg:"code"`
+	Name string `json:"name,omitempty" msg:"name"`
 }
 
+var ednsOptionNames = map[uint16]string{
+	dns.EDNS0LLQ:          "LLQ",
+	dns.EDNS0UL:           "UL",
+	dns.EDNS0NSID:         "NSID",
+	dns.EDNS0DAU:          "DAU",
+	dns.EDNS0DHU:          "DHU",
+	dns.EDNS0N3U:          "N3U",
+	dns.EDNS0SUBNET:       "ECS",
+	dns.EDNS0EXPIRE:       "EXPIRE",
+	dns.EDNS0COOKIE:       "COOKIE",
+	dns.EDNS0TCPKEEPALIVE: "KEEPALIVE",
+	dns.EDNS0PADDING:      "PADDING",
+	13:                    "CHAIN",
+	14:                    "KEY-TAG",
+	15:                    "EDE",
+}
+
+// EdnsSmallBufsize is the threshold of small EDNS UDP payload size,
+// smaller size may force TCP fallback.
+const EdnsSmallBufsize = 1232
+
 var (
 	DefaultIPv4Mask = net.CIDRMask(22, 22)
 	DefaultIPv6Mask = net.CIDRMask(40, 40)
@@ -75,9 +238,303 @@ type DnstapFlatOption interface {
 	GetEnableEcs() bool
 	GetEnableHashIP() bool
 	GetIPHashSalt() []byte
+	GetAddressHasher() AddressHasher
+	GetCanonicalEndpoints() bool
+	GetIncludeMessageTypeShort() bool
+	GetFilterDryRun() bool
+	GetIncludeWireDebug() bool
+	GetIncludeSocketCodes() bool
+	GetTypeName(string) string
+	GetIncludeReceivedAt() bool
+	GetIncludeCollector() bool
+	GetCollectorID() string
+	GetIncludeTransportAddress() bool
+	GetIncludeEpoch() bool
+	GetExtraParser() string
+	GetParseMode() string
+	GetPartialParse() bool
+	GetRecoverTruncatedCapture() bool
+	GetEpochUnit() string
+	GetNumbersAsStrings() bool
+	GetKeyCase() string
+	GetHijackRules() []*HijackRule
+	GetExplodeQuestions() bool
+	GetLegacyLabels() bool
+	GetClassifyTLD() bool
+	GetIncludeReversedQname() bool
+	GetDecodeIDN() bool
+	GetIdempotencyKey() bool
+	GetEnableSVCB() bool
+	GetAlwaysIncludeTXT() bool
+	GetParseBoth() bool
+	GetSplitCombined() bool
+	GetEnableNSID() bool
+	GetEnableKeepalive() bool
+	GetEnableExtendedRcode() bool
+	GetDropZoneTransfers() bool
+	GetTagZoneTransfers() bool
+	GetRcodes() []string
+	GetRcodeFilterQueries() bool
+	GetReverseDNS() *ReverseDNS
+	GetAnonymizer() *IPAnonymizer
+	GetCorrelator() *Correlator
+	GetQtypeSampler() *QtypeSampler
+	GetQnameLimiter() *QnameLimiter
+	GetCollapser() *Collapser
+	GetTransferAssembler() *TransferAssembler
+	GetMaxFieldLength() int
+	GetSequence() *Sequence
+	GetUseECSForClient() bool
+	GetEnableEDNSOptions() bool
+	GetIncludeDNSCookie() bool
+	GetAnswerStats() bool
+	GetIncludeCorrelationID() bool
+	GetDecodePTR() bool
+	GetIncludeAllSections() bool
+	GetMaxAnswers() int
+	GetTransform() *Transform
+	GetSubdomainEntropy() bool
+	GetRandomSubdomainThreshold() float64
+	GetBlocklist() *Blocklist
+	GetLargeResponseBytes() int
+	Now() time.Time
 }
 
 func FlatDnstap(dt *dnstap.Dnstap, opt DnstapFlatOption) (*DnstapFlatT, error) {
+	data, _, err := flatDnstap(dt, opt)
+	return data, err
+}
+
+// FlatDnstapRecords makes flat records from dnstap message.
+// When ExplodeQuestions is enabled, it makes a record per question.
+func FlatDnstapRecords(dt *dnstap.Dnstap, opt DnstapFlatOption) ([]*DnstapFlatT, error) {
+	if opt.GetSplitCombined() {
+		if query, response := splitCombined(dt, opt); query != nil {
+			records, err := flatDnstapRecords(query, opt)
+			if err != nil {
+				return nil, err
+			}
+			responses, err := flatDnstapRecords(response, opt)
+			if err != nil {
+				return nil, err
+			}
+			return append(records, responses...), nil
+		}
+	}
+	return flatDnstapRecords(dt, opt)
+}
+
+// splitCombined returns a query type message and a response type message of dt,
+// when dt is a response type message has both payloads. Otherwise it returns nil.
+func splitCombined(dt *dnstap.Dnstap, opt DnstapFlatOption) (*dnstap.Dnstap, *dnstap.Dnstap) {
+	msg := dt.GetMessage()
+	if !isCombined(msg) {
+		return nil, nil
+	}
+	// each QUERY type is just before its RESPONSE type.
+	queryType := msg.GetType() - 1
+	queryMsg := proto.Clone(msg).(*dnstap.Message)
+	queryMsg.Type = &queryType
+	queryMsg.ResponseMessage = nil
+	queryMsg.ResponseTimeSec, queryMsg.ResponseTimeNsec = nil, nil
+	responseMsg := proto.Clone(msg).(*dnstap.Message)
+	if !opt.GetParseBoth() {
+		// response type message is parsed from query payload when it has one.
+		responseMsg.QueryMessage = nil
+	}
+	query, response := proto.Clone(dt).(*dnstap.Dnstap), proto.Clone(dt).(*dnstap.Dnstap)
+	query.Message, response.Message = queryMsg, responseMsg
+	return query, response
+}
+
+// isCombined returns true when msg is a response type message has both payloads.
+func isCombined(msg *dnstap.Message) bool {
+	return isResponse(msg.GetType()) && msg.GetQueryMessage() != nil && msg.GetResponseMessage() != nil
+}
+
+func flatDnstapRecords(dt *dnstap.Dnstap, opt DnstapFlatOption) ([]*DnstapFlatT, error) {
+	data, dnsMsg, err := flatDnstap(dt, opt)
+	if err != nil {
+		return nil, err
+	}
+	if isResponse(data.MessageType) && (data.Qtype == "AXFR" || data.Qtype == "IXFR") &&
+		opt.GetParseMode() != "header_only" && !data.ParsePartial {
+		data.dnsMsg = dnsMsg
+	}
+	if !opt.GetExplodeQuestions() || len(dnsMsg.Question) < 2 {
+		return []*DnstapFlatT{data}, nil
+	}
+	records := make([]*DnstapFlatT, 0, len(dnsMsg.Question))
+	for _, q := range dnsMsg.Question {
+		r := *data
+		setQuestion(&r, q, opt)
+		setHijackSuspected(&r, dnsMsg, opt)
+		setAuthoritativeForZone(&r, dt.GetMessage().GetType())
+		if opt.GetIdempotencyKey() {
+			r.DocID = docID(&r)
+		}
+		records = append(records, &r)
+	}
+	return records, nil
+}
+
+func flatFrame(m *Message, opt DnstapFlatOption) ([]*DnstapFlatT, error) {
+	records, err := flatFrameRecords(m, opt)
+	if err != nil {
+		return nil, err
+	}
+	for _, data := range records {
+		setSequence(data, opt)
+	}
+	return records, nil
+}
+
+// flatFrameRecords returns the records of m without seq, for outputs which filter
+// records after flatFrame and number only the emitted ones.
+func flatFrameRecords(m *Message, opt DnstapFlatOption) ([]*DnstapFlatT, error) {
+	if m.flush {
+		return flushFlat(opt), nil
+	}
+	dt := dnstap.Dnstap{}
+	if err := proto.Unmarshal(m.Frame, &dt); err != nil {
+		return nil, WithCategory(err, ErrorCategoryParse)
+	}
+	records, err := FlatDnstapRecords(&dt, opt)
+	if err != nil {
+		return nil, WithCategory(err, ErrorCategoryParse)
+	}
+	if m.Source != "" {
+		for _, data := range records {
+			data.Source = m.Source
+		}
+	}
+	if opt.GetIncludeCollector() {
+		for _, data := range records {
+			data.Collector = opt.GetCollectorID()
+		}
+	}
+	if opt.GetIncludeTransportAddress() && m.TransportAddr != nil {
+		addr := maskIP(m.TransportAddr.IP, opt)
+		for _, data := range records {
+			data.TransportClientAddress = addr
+			data.TransportClientPort = uint32(m.TransportAddr.Port)
+		}
+	}
+	if opt.GetIncludeReceivedAt() && !m.ReceivedAt.IsZero() {
+		receivedAt := m.ReceivedAt.Format(time.RFC3339Nano)
+		for _, data := range records {
+			data.ReceivedAt = receivedAt
+		}
+	}
+	// split records carry both halves already, so they are not correlated.
+	if c := opt.GetCorrelator(); c != nil && len(records) > 0 && !(opt.GetSplitCombined() && isCombined(dt.GetMessage())) {
+		msg := dt.GetMessage()
+		key := fmt.Sprintf("%s\x00%d\x00%x\x00%d", dt.GetIdentity(), records[0].Txid, msg.GetQueryAddress(), msg.GetQueryPort())
+		records = c.Correlate(key, records, isResponse(msg.GetType()))
+	}
+	if a := opt.GetTransferAssembler(); a != nil {
+		records = a.Assemble(&dt, records)
+	}
+	records = filterRecords(records, opt)
+	if c := opt.GetCollapser(); c != nil {
+		records = c.Collapse(records)
+	}
+	if l := opt.GetQnameLimiter(); l != nil {
+		records = newRecordFilter(opt).apply(records, DropReasonPerQname, perQnameDropped, l.AllowRecord)
+	}
+	if t := opt.GetTransform(); t != nil {
+		records = t.apply(records, newRecordFilter(opt))
+	}
+	for _, data := range records {
+		TruncateFlatFields(data, opt.GetMaxFieldLength())
+	}
+	return records, nil
+}
+
+// setSequence numbers the emitted record by IncludeSequence.
+func setSequence(data *DnstapFlatT, opt DnstapFlatOption) {
+	s := opt.GetSequence()
+	if s == nil {
+		return
+	}
+	data.Seq = s.Next()
+	data.SeqEpoch = s.Epoch()
+}
+
+// filterRecords applies the filters and the qtype sampler to records.
+func filterRecords(records []*DnstapFlatT, opt DnstapFlatOption) []*DnstapFlatT {
+	f := newRecordFilter(opt)
+	records = filterZoneTransfers(records, opt, f)
+	records = filterRcodes(records, opt, f)
+	if s := opt.GetQtypeSampler(); s != nil {
+		records = f.apply(records, DropReasonQtypeSample, qtypeSampledOut, s.Sample)
+	}
+	return records
+}
+
+// flushFlat returns records held by the transfer assembler and the collapser.
+func flushFlat(opt DnstapFlatOption) []*DnstapFlatT {
+	var records []*DnstapFlatT
+	if a := opt.GetTransferAssembler(); a != nil {
+		records = filterRecords(a.Flush(), opt)
+	}
+	if c := opt.GetCollapser(); c != nil {
+		records = append(records, c.Flush()...)
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	if l := opt.GetQnameLimiter(); l != nil {
+		records = newRecordFilter(opt).apply(records, DropReasonPerQname, perQnameDropped, l.AllowRecord)
+	}
+	if t := opt.GetTransform(); t != nil {
+		records = t.apply(records, newRecordFilter(opt))
+	}
+	for _, data := range records {
+		TruncateFlatFields(data, opt.GetMaxFieldLength())
+	}
+	return records
+}
+
+// filterZoneTransfers drops AXFR/IXFR records by DropZoneTransfers,
+// or marks them as zone_transfer by TagZoneTransfers.
+func filterZoneTransfers(records []*DnstapFlatT, opt DnstapFlatOption, f recordFilter) []*DnstapFlatT {
+	if opt.GetTagZoneTransfers() {
+		for _, data := range records {
+			if data.Qtype == "AXFR" || data.Qtype == "IXFR" {
+				data.ZoneTransfer = true
+			}
+		}
+		return records
+	}
+	if !opt.GetDropZoneTransfers() {
+		return records
+	}
+	return f.apply(records, DropReasonZoneTransfer, flatZoneTransferDropped, func(data *DnstapFlatT) bool {
+		return data.Qtype != "AXFR" && data.Qtype != "IXFR"
+	})
+}
+
+// filterRcodes drops responses of rcodes not in Rcodes, and queries by RcodeFilterQueries.
+func filterRcodes(records []*DnstapFlatT, opt DnstapFlatOption, f recordFilter) []*DnstapFlatT {
+	rcodes := opt.GetRcodes()
+	if len(rcodes) == 0 {
+		return records
+	}
+	return f.apply(records, DropReasonRcode, flatRcodeDropped, func(data *DnstapFlatT) bool {
+		if !isResponse(data.MessageType) {
+			return !opt.GetRcodeFilterQueries()
+		}
+		for _, rcode := range rcodes {
+			if strings.EqualFold(rcode, data.Rcode) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func flatDnstap(dt *dnstap.Dnstap, opt DnstapFlatOption) (*DnstapFlatT, *dns.Msg, error) {
 	var data = DnstapFlatT{}
 
 	var dnsMessage []byte
@@ -89,121 +546,1013 @@ func FlatDnstap(dt *dnstap.Dnstap, opt DnstapFlatOption) (*DnstapFlatT, error) {
 	}
 
 	data.QueryTime = time.Unix(int64(msg.GetQueryTimeSec()), int64(msg.GetQueryTimeNsec())).Format(time.RFC3339Nano)
-	data.ResponseTime = time.Unix(int64(msg.GetResponseTimeSec()), int64(msg.GetResponseTimeNsec())).Format(time.RFC3339Nano)
-	if len(msg.GetQueryAddress()) == 4 {
-		data.QueryAddress = net.IP(msg.GetQueryAddress()).Mask(opt.GetIPv4Mask())
+	if isResponse(msg.GetType()) && msg.GetResponseTimeSec() == 0 && msg.GetResponseTimeNsec() == 0 {
+		// some producers set only query time, use receive time instead of epoch.
+		data.ResponseTime = opt.Now().Format(time.RFC3339Nano)
+		data.TimestampEstimated = true
 	} else {
-		data.QueryAddress = net.IP(msg.GetQueryAddress()).Mask(opt.GetIPv6Mask())
+		responseTime := time.Unix(int64(msg.GetResponseTimeSec()), int64(msg.GetResponseTimeNsec()))
+		data.ResponseTime = responseTime.Format(time.RFC3339Nano)
+		if isResponse(msg.GetType()) && msg.GetQueryTimeSec() != 0 {
+			queryTime := time.Unix(int64(msg.GetQueryTimeSec()), int64(msg.GetQueryTimeNsec()))
+			latency := float64(responseTime.Sub(queryTime)) / float64(time.Millisecond)
+			data.LatencyMs = &latency
+		}
 	}
+	data.QueryAddress = maskAddress(msg.GetQueryAddress(), msg.SocketFamily, opt)
 	if opt.GetEnableHashIP() && opt.GetIPHashSalt() != nil {
-		bs := make([]byte, len(opt.GetIPHashSalt())+16)
-		bs = append(bs, opt.GetIPHashSalt()...)
-		bs = append(bs, net.IP(msg.GetQueryAddress()).To16()...)
-		data.QueryAddressHash = fmt.Sprintf("%x", sha256.Sum256(bs))
+		data.QueryAddressHash = opt.GetAddressHasher()(opt.GetIPHashSalt(), net.IP(msg.GetQueryAddress()))
 	}
-	data.QueryPort = msg.GetQueryPort()
-	if len(msg.GetResponseAddress()) == 4 {
-		data.ResponseAddress = net.IP(msg.GetResponseAddress()).Mask(opt.GetIPv4Mask()).To4()
-	} else {
-		data.ResponseAddress = net.IP(msg.GetResponseAddress()).Mask(opt.GetIPv6Mask()).To16()
+	if r := opt.GetReverseDNS(); r != nil && len(msg.GetQueryAddress()) > 0 {
+		var err error
+		if data.QueryPtr, err = r.LookupResult(net.IP(msg.GetQueryAddress())); err != nil {
+			data.addEnrichmentError("reverse_dns", err)
+		}
 	}
+	data.QueryPort = msg.GetQueryPort()
+	data.ResponseAddress = maskAddress(msg.GetResponseAddress(), msg.SocketFamily, opt)
 	if opt.GetEnableHashIP() && opt.GetIPHashSalt() != nil {
-		bs := make([]byte, len(opt.GetIPHashSalt())+16)
-		bs = append(bs, opt.GetIPHashSalt()...)
-		bs = append(bs, net.IP(msg.GetResponseAddress()).To16()...)
-		data.ResponseAddressHash = fmt.Sprintf("%x", sha256.Sum256(bs))
+		data.ResponseAddressHash = opt.GetAddressHasher()(opt.GetIPHashSalt(), net.IP(msg.GetResponseAddress()))
 	}
 
 	data.ResponsePort = msg.GetResponsePort()
+	if opt.GetCanonicalEndpoints() {
+		// queries are sent by the initiator, responses by the responder.
+		data.SrcAddress, data.SrcPort = data.QueryAddress, data.QueryPort
+		data.DstAddress, data.DstPort = data.ResponseAddress, data.ResponsePort
+		if isResponse(msg.GetType()) {
+			data.SrcAddress, data.SrcPort, data.DstAddress, data.DstPort = data.DstAddress, data.DstPort, data.SrcAddress, data.SrcPort
+		}
+	}
 	data.ResponseZone = string(msg.GetQueryZone())
+	if zone := msg.GetQueryZone(); len(zone) > 0 {
+		name, _, err := dns.UnpackDomainName(zone, 0)
+		if err != nil {
+			data.addEnrichmentError("authority_name", err)
+		} else {
+			data.AuthorityName = sanitizeQname(name)
+		}
+	}
 	data.Identity = string(dt.GetIdentity())
 	if data.Identity == "" {
 		data.Identity = hostname
 	}
-	data.Type = msg.GetType().String()
+	data.MessageType = msg.GetType()
+	data.Type = opt.GetTypeName(msg.GetType().String())
+	if opt.GetIncludeMessageTypeShort() {
+		response := isResponse(msg.GetType())
+		data.IsResponse = &response
+		data.MessageTypeShort = MessageTypeShort(msg.GetType())
+	}
 	data.SocketFamily = msg.GetSocketFamily().String()
 	data.SocketProtocol = msg.GetSocketProtocol().String()
+	if opt.GetIncludeSocketCodes() {
+		family, protocol := int(msg.GetSocketFamily()), int(msg.GetSocketProtocol())
+		data.SocketFamilyCode, data.SocketProtocolCode = &family, &protocol
+	}
+	data.Policy = messagePolicy(msg, opt)
 	data.Version = string(dt.GetVersion())
 	data.Extra = string(dt.GetExtra())
+	if p := opt.GetExtraParser(); p != "none" && len(dt.GetExtra()) > 0 {
+		fields, err := parseExtra(dt.GetExtra(), p)
+		if err != nil {
+			data.Extra = base64.StdEncoding.EncodeToString(dt.GetExtra())
+			data.addEnrichmentError("extra", err)
+		}
+		data.ExtraParsed = fields
+	}
+	bothMessages := opt.GetParseBoth() && isResponse(msg.GetType()) &&
+		msg.GetQueryMessage() != nil && msg.GetResponseMessage() != nil
+	if bothMessages {
+		dnsMessage = msg.GetResponseMessage()
+	}
 	dnsMsg := dns.Msg{}
-	if err := dnsMsg.Unpack(dnsMessage); err != nil {
-		return nil, errors.Wrapf(err, "can't parse dns message() failed: %s\n", err)
+	var counts []int
+	switch opt.GetParseMode() {
+	case "header_only":
+		var err error
+		if counts, err = unpackHeaderOnly(dnsMessage, &dnsMsg); err != nil {
+			return nil, nil, errors.Wrapf(err, "can't parse dns message() failed: %s\n", err)
+		}
+	case "lenient":
+		if err := dnsMsg.Unpack(dnsMessage); err != nil {
+			if len(dnsMessage) < dnsHeaderSize {
+				return nil, nil, errors.Wrapf(err, "can't parse dns message() failed: %s\n", err)
+			}
+			if c, ok := recoverTruncated(dnsMessage, &dnsMsg, &data, err, opt); ok {
+				counts = c
+				break
+			}
+			data.addEnrichmentError("dns", err)
+			if opt.GetPartialParse() {
+				data.ParsePartial = true
+				// the question is lost when it fails, use the one of the header only parse.
+				partial := dns.Msg{}
+				if len(dnsMsg.Question) == 0 {
+					if _, err := unpackHeaderOnly(dnsMessage, &partial); err == nil {
+						dnsMsg.Question = partial.Question
+					}
+				}
+			}
+		}
+	default:
+		if err := dnsMsg.Unpack(dnsMessage); err != nil {
+			if c, ok := recoverTruncated(dnsMessage, &dnsMsg, &data, err, opt); ok {
+				counts = c
+				break
+			}
+			if !opt.GetPartialParse() {
+				return nil, nil, errors.Wrapf(err, "can't parse dns message() failed: %s\n", err)
+			}
+			dnsMsg = dns.Msg{}
+			var herr error
+			if counts, herr = unpackHeaderOnly(dnsMessage, &dnsMsg); herr != nil {
+				return nil, nil, errors.Wrapf(err, "can't parse dns message() failed: %s\n", err)
+			}
+			data.ParsePartial = true
+			data.addEnrichmentError("dns", err)
+		}
+	}
+	if bothMessages {
+		// question of response may be stripped, use query's one.
+		queryMsg := dns.Msg{}
+		if err := queryMsg.Unpack(msg.GetQueryMessage()); err != nil {
+			data.addEnrichmentError("parse_both", err)
+		} else if len(queryMsg.Question) > 0 {
+			dnsMsg.Question = queryMsg.Question
+		}
 	}
 
 	if len(dnsMsg.Question) > 0 {
-		data.Qname = dnsMsg.Question[0].Name
-		data.Qclass = dns.ClassToString[dnsMsg.Question[0].Qclass]
-		data.Qtype = dns.TypeToString[dnsMsg.Question[0].Qtype]
-		labels := strings.Split(dnsMsg.Question[0].Name, ".")
-
-		data.TopLevelDomainName = getName(labels, 2)
-		data.SecondLevelDomainName = getName(labels, 3)
-		data.ThirdLevelDomainName = getName(labels, 4)
-		data.FourthLevelDomainName = getName(labels, 5)
+		setQuestion(&data, dnsMsg.Question[0], opt)
 
 		data.MessageSize = len(dnsMessage)
 		data.Txid = dnsMsg.MsgHdr.Id
 	}
-	if opt.GetEnableEcs() {
-		if len(dnsMsg.Extra) > 0 {
-			for _, rr := range dnsMsg.Extra {
-				if optrr, ok := rr.(*dns.OPT); ok {
-					for _, edns0opt := range optrr.Option {
-						if ecs, ok := edns0opt.(*dns.EDNS0_SUBNET); ok {
-							ip := ecs.Address
-							// ipv4
-							if ecs.Family == 1 {
-								ip = ip.Mask(opt.GetIPv4Mask())
-							} else {
-								ip = ip.Mask(opt.GetIPv6Mask())
-							}
-							data.EcsNet = &Net{
-								IP:           ip,
-								PrefixLength: int(ecs.SourceNetmask),
-							}
-						}
-					}
-				}
-			}
+	data.Qdcount = len(dnsMsg.Question)
+	data.Ancount = len(dnsMsg.Answer)
+	data.Nscount = len(dnsMsg.Ns)
+	data.Arcount = len(dnsMsg.Extra)
+	if counts != nil {
+		data.Ancount, data.Nscount, data.Arcount = counts[0], counts[1], counts[2]
+	}
+	ecs := ecsOption(&dnsMsg)
+	if opt.GetEnableEcs() && ecs != nil {
+		ip := ecs.Address
+		if a := opt.GetAnonymizer(); a != nil {
+			ip = a.Anonymize(ip)
+			ip = ip.Mask(net.CIDRMask(int(ecs.SourceNetmask), len(ip)*8))
+		} else if ecs.Family == 1 {
+			// ipv4
+			ip = ip.Mask(opt.GetIPv4Mask())
+		} else {
+			ip = ip.Mask(opt.GetIPv6Mask())
 		}
+		data.EcsNet = &Net{
+			IP:           ip,
+			PrefixLength: int(ecs.SourceNetmask),
+		}
+	}
+	if opt.GetUseECSForClient() {
+		data.ClientAddress = clientAddress(ecs, data.QueryAddress, opt)
+	}
+	if optrr := dnsMsg.IsEdns0(); optrr != nil {
+		size := optrr.UDPSize()
+		data.EdnsUDPSize = &size
+		data.EdnsBufsizeSmall = size < EdnsSmallBufsize
+		if opt.GetEnableNSID() {
+			data.Nsid = nsid(optrr)
+		}
+		if opt.GetEnableKeepalive() {
+			data.EdnsKeepalive, data.EdnsExpire = ednsKeepalive(optrr)
+		}
+		if opt.GetEnableExtendedRcode() {
+			version := int(optrr.Version())
+			data.EdnsVersion = &version
+			data.ExtendedRcode = extendedRcode(optrr, dnsMsg.Rcode)
+		}
+		if opt.GetEnableEDNSOptions() {
+			data.EdnsOptions = ednsOptions(optrr)
+		}
+		if opt.GetIncludeDNSCookie() {
+			data.ClientCookie, data.ServerCookie = dnsCookie(optrr)
+		}
+		data.EdnsPaddingSize = ednsPaddingSize(optrr)
 	}
 	data.Rcode = dns.RcodeToString[dnsMsg.Rcode]
 	data.AA = dnsMsg.Authoritative
+	setAuthoritativeForZone(&data, msg.GetType())
 	data.TC = dnsMsg.Truncated
 	data.RD = dnsMsg.RecursionDesired
 	data.RA = dnsMsg.RecursionAvailable
 	data.AD = dnsMsg.AuthenticatedData
 	data.CD = dnsMsg.CheckingDisabled
+	if opt.GetIncludeWireDebug() {
+		id := dnsMsg.Id
+		data.DNSID = &id
+		data.FlagsHex = fmt.Sprintf("%04x", flagsWord(&dnsMsg.MsgHdr))
+	}
+
+	if opt.GetEnableSVCB() && isResponse(msg.GetType()) {
+		var err error
+		if data.Svcb, err = svcbRecords(&dnsMsg); err != nil {
+			data.addEnrichmentError("svcb", err)
+		}
+	}
+	if opt.GetAlwaysIncludeTXT() && isResponse(msg.GetType()) {
+		data.TxtRecords = txtRecords(&dnsMsg)
+	}
+
+	if opt.GetIncludeAllSections() {
+		data.Records = allRecords(&dnsMsg, opt.GetMaxAnswers())
+	}
+
+	if isResponse(msg.GetType()) {
+		data.CnameChain = cnameChain(&dnsMsg)
+		if len(data.CnameChain) > 0 {
+			data.FinalName = data.CnameChain[len(data.CnameChain)-1]
+		}
+	}
+
+	if isResponse(msg.GetType()) && opt.GetAnswerStats() {
+		count := len(answerIPs(&dnsMsg))
+		data.AnswerIPCount = &count
+		data.LargeResponse = data.MessageSize > opt.GetLargeResponseBytes()
+	}
+
+	setHijackSuspected(&data, &dnsMsg, opt)
 
 	switch msg.GetType() {
 	case dnstap.Message_AUTH_QUERY, dnstap.Message_RESOLVER_QUERY,
 		dnstap.Message_CLIENT_QUERY, dnstap.Message_FORWARDER_QUERY,
-		dnstap.Message_STUB_QUERY, dnstap.Message_TOOL_QUERY:
+		dnstap.Message_STUB_QUERY, dnstap.Message_TOOL_QUERY,
+		dnstap.Message_UPDATE_QUERY:
 		data.Timestamp = data.QueryTime
 	case dnstap.Message_AUTH_RESPONSE, dnstap.Message_RESOLVER_RESPONSE,
 		dnstap.Message_CLIENT_RESPONSE, dnstap.Message_FORWARDER_RESPONSE,
-		dnstap.Message_STUB_RESPONSE, dnstap.Message_TOOL_RESPONSE:
+		dnstap.Message_STUB_RESPONSE, dnstap.Message_TOOL_RESPONSE,
+		dnstap.Message_UPDATE_RESPONSE:
 		data.Timestamp = data.ResponseTime
 	}
+	if opt.GetIncludeEpoch() {
+		data.TimestampEpoch = timestampEpoch(data.Timestamp, opt.GetEpochUnit())
+	}
+	if opt.GetIdempotencyKey() {
+		data.DocID = docID(&data)
+	}
+	if opt.GetIncludeCorrelationID() {
+		data.CorrelationID = correlationID(&data, msg)
+	}
+
+	return &data, &dnsMsg, nil
+}
+
+// correlationID returns the same id for a query and its response.
+// Query address and port are the initiator in both directions, and used unmasked.
+func correlationID(data *DnstapFlatT, msg *dnstap.Message) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%d\x00%x\x00%d", data.Identity, data.Txid, net.IP(msg.GetQueryAddress()).To16(), msg.GetQueryPort())
+	return fmt.Sprintf("%x", h.Sum(nil)[:16])
+}
+
+// docID returns a deterministic id of the record for deduplication on retry.
+// Estimated timestamps change on every flatting, so query time is used instead.
+func docID(data *DnstapFlatT) string {
+	ts := data.Timestamp
+	if data.TimestampEstimated {
+		ts = data.QueryTime
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%d\x00%s\x00%s\x00%s\x00%d",
+		data.Identity, data.Type, data.Txid, ts, data.Qname, data.QueryAddress, data.QueryPort)
+	return fmt.Sprintf("%x", h.Sum(nil)[:16])
+}
+
+// parseExtra parses extra as a JSON object, or whitespace, comma or semicolon separated key=value pairs for kv.
+func parseExtra(extra []byte, parser string) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	if parser == "json" {
+		if err := json.Unmarshal(extra, &fields); err != nil {
+			return nil, errors.New("extra is not a JSON object")
+		}
+		return fields, nil
+	}
+	for _, pair := range strings.FieldsFunc(string(extra), func(r rune) bool {
+		return r == ',' || r == ';' || unicode.IsSpace(r)
+	}) {
+		n := strings.IndexByte(pair, '=')
+		if n < 1 || !utf8.ValidString(pair) {
+			return nil, errors.New("extra is not key=value pairs")
+		}
+		fields[pair[:n]] = pair[n+1:]
+	}
+	return fields, nil
+}
+
+const dnsHeaderSize = 12
+
+// unpackHeaderOnly unpacks the header and questions of msg into m without resource records,
+// and returns answer, authority and additional counts of the header.
+func unpackHeaderOnly(msg []byte, m *dns.Msg) ([]int, error) {
+	counts, _, err := unpackHeaderQuestions(msg, m)
+	return counts, err
+}
+
+// unpackHeaderQuestions parses the header and questions into m, and returns section counts of the header
+// and the offset of the answer section.
+func unpackHeaderQuestions(msg []byte, m *dns.Msg) ([]int, int, error) {
+	if len(msg) < dnsHeaderSize {
+		return nil, 0, errors.New("dns message is shorter than header")
+	}
+	bits := binary.BigEndian.Uint16(msg[2:])
+	m.Id = binary.BigEndian.Uint16(msg)
+	m.Response = bits&(1<<15) != 0
+	m.Opcode = int(bits>>11) & 0xF
+	m.Authoritative = bits&(1<<10) != 0
+	m.Truncated = bits&(1<<9) != 0
+	m.RecursionDesired = bits&(1<<8) != 0
+	m.RecursionAvailable = bits&(1<<7) != 0
+	m.Zero = bits&(1<<6) != 0
+	m.AuthenticatedData = bits&(1<<5) != 0
+	m.CheckingDisabled = bits&(1<<4) != 0
+	m.Rcode = int(bits & 0xF)
+	off := dnsHeaderSize
+	for i := 0; i < int(binary.BigEndian.Uint16(msg[4:])); i++ {
+		name, next, err := dns.UnpackDomainName(msg, off)
+		if err != nil {
+			return nil, 0, err
+		}
+		if next+4 > len(msg) {
+			return nil, 0, errors.New("dns question is truncated")
+		}
+		m.Question = append(m.Question, dns.Question{
+			Name:   name,
+			Qtype:  binary.BigEndian.Uint16(msg[next:]),
+			Qclass: binary.BigEndian.Uint16(msg[next+2:]),
+		})
+		off = next + 4
+	}
+	return []int{
+		int(binary.BigEndian.Uint16(msg[6:])),
+		int(binary.BigEndian.Uint16(msg[8:])),
+		int(binary.BigEndian.Uint16(msg[10:])),
+	}, off, nil
+}
+
+// unpackTruncated parses resource records one by one up to the end of a capture cut at a fixed length.
+// It returns truncated when a record runs past the end of msg, the records before it are kept.
+func unpackTruncated(msg []byte, m *dns.Msg) ([]int, bool, error) {
+	counts, off, err := unpackHeaderQuestions(msg, m)
+	if err != nil {
+		return nil, false, err
+	}
+	for i, section := range []*[]dns.RR{&m.Answer, &m.Ns, &m.Extra} {
+		for n := 0; n < counts[i]; n++ {
+			if rrTruncated(msg, off) {
+				return counts, true, nil
+			}
+			rr, next, err := dns.UnpackRR(msg, off)
+			if err != nil {
+				return nil, false, err
+			}
+			*section = append(*section, rr)
+			off = next
+		}
+	}
+	return counts, false, nil
+}
+
+// rrTruncated returns whether the resource record at off runs past the end of msg.
+func rrTruncated(msg []byte, off int) bool {
+	if off >= len(msg) {
+		return true
+	}
+	_, next, err := dns.UnpackDomainName(msg, off)
+	if err != nil {
+		return err == dns.ErrBuf
+	}
+	if next+10 > len(msg) {
+		return true
+	}
+	return next+10+int(binary.BigEndian.Uint16(msg[next+8:])) > len(msg)
+}
+
+// recoverTruncated replaces m with records of msg before the truncation point for RecoverTruncatedCapture,
+// and returns the section counts of the header. It returns false when msg is not truncated but malformed.
+func recoverTruncated(msg []byte, m *dns.Msg, data *DnstapFlatT, err error, opt DnstapFlatOption) ([]int, bool) {
+	if !opt.GetRecoverTruncatedCapture() {
+		return nil, false
+	}
+	partial := dns.Msg{}
+	counts, truncated, perr := unpackTruncated(msg, &partial)
+	if perr != nil || !truncated {
+		return nil, false
+	}
+	*m = partial
+	data.CaptureTruncated = true
+	data.addEnrichmentError("dns", err)
+	return counts, true
+}
+
+// setAuthoritativeForZone sets AuthoritativeForZone of authoritative responses with AuthorityName,
+// true when the qname is within the zone.
+func setAuthoritativeForZone(data *DnstapFlatT, t dnstap.Message_Type) {
+	data.AuthoritativeForZone = nil
+	if !isResponse(t) || !data.AA || data.AuthorityName == "" || data.Qname == "" {
+		return
+	}
+	ok := dns.IsSubDomain(data.AuthorityName, data.Qname)
+	data.AuthoritativeForZone = &ok
+}
+
+// addEnrichmentError records a failed enrichment step, the rest of the record is still emitted.
+func (d *DnstapFlatT) addEnrichmentError(step string, err error) {
+	d.EnrichmentErrors = append(d.EnrichmentErrors, fmt.Sprintf("%s: %s", step, err))
+}
+
+func setQuestion(data *DnstapFlatT, q dns.Question, opt DnstapFlatOption) {
+	// reset fields of the question, exploded records are copies of the first one.
+	data.QnameBinary, data.QnameRaw = false, ""
+	data.SubdomainEntropy, data.RandomSubdomain = nil, false
+	data.Blocklisted, data.BlocklistMatch = false, ""
+	data.QnameUnicode, data.QnameReversed, data.TLDClass = "", "", ""
+	data.Subdomain = ""
+	data.PtrTarget = nil
+	data.HijackSuspected = false
+
+	data.Qname = q.Name
+	if qnameBinary(q.Name) {
+		data.Qname = sanitizeQname(q.Name)
+		data.QnameBinary = true
+		if opt.GetIncludeWireDebug() {
+			buf := make([]byte, 256)
+			if n, err := dns.PackDomainName(q.Name, buf, 0, nil, false); err == nil {
+				data.QnameRaw = base64.StdEncoding.EncodeToString(buf[:n])
+			} else {
+				data.addEnrichmentError("qname_raw", err)
+			}
+		}
+		q.Name = data.Qname
+	}
+	data.Qclass = dns.ClassToString[q.Qclass]
+	data.Qtype = dns.TypeToString[q.Qtype]
+	if opt.GetSubdomainEntropy() {
+		if labels := dns.SplitDomainName(q.Name); len(labels) > 2 {
+			entropy := shannonEntropy(labels[0])
+			data.SubdomainEntropy = &entropy
+			data.RandomSubdomain = entropy > opt.GetRandomSubdomainThreshold()
+		}
+	}
+	if b := opt.GetBlocklist(); b != nil {
+		if match, ok := b.Match(q.Name); ok {
+			data.Blocklisted, data.BlocklistMatch = true, match
+			blocklistMatched.Inc()
+		}
+	}
+	if opt.GetDecodeIDN() {
+		data.QnameUnicode = qnameUnicode(data.Qname)
+	}
+	if opt.GetDecodePTR() {
+		if ip := arpaAddress(data.Qname); ip != nil {
+			data.PtrTarget = maskIP(ip, opt)
+		}
+	}
+	data.LabelCount = dns.CountLabel(q.Name)
+	if data.LabelCount == 0 {
+		// root has no labels, e.g. priming queries.
+		data.TopLevelDomainName, data.SecondLevelDomainName = "", ""
+		data.ThirdLevelDomainName, data.FourthLevelDomainName = "", ""
+		return
+	}
+	labels := dns.SplitDomainName(q.Name)
+	if opt.GetClassifyTLD() {
+		data.TLDClass = TLDClass(publicSuffixTLD(q.Name))
+	}
+	if opt.GetIncludeReversedQname() {
+		data.QnameReversed = reverseLabels(labels)
+	}
+	if opt.GetLegacyLabels() {
+		data.TopLevelDomainName = legacyLabels(q.Name, labels, 1)
+		data.SecondLevelDomainName = legacyLabels(q.Name, labels, 2)
+		data.ThirdLevelDomainName = legacyLabels(q.Name, labels, 3)
+		data.FourthLevelDomainName = legacyLabels(q.Name, labels, 4)
+		return
+	}
+	data.TopLevelDomainName = lastLabels(labels, 1)
+	data.SecondLevelDomainName = lastLabels(labels, 2)
+	data.ThirdLevelDomainName = lastLabels(labels, 3)
+	data.FourthLevelDomainName = lastLabels(labels, 4)
+	if len(labels) > 2 {
+		data.Subdomain = strings.Join(labels[:len(labels)-2], ".")
+	}
+}
 
-	return &data, nil
+// setHijackSuspected sets HijackSuspected of the response by HijackRules for the qname of data.
+func setHijackSuspected(data *DnstapFlatT, dnsMsg *dns.Msg, opt DnstapFlatOption) {
+	if isResponse(data.MessageType) && len(opt.GetHijackRules()) > 0 {
+		data.HijackSuspected = hijackSuspected(opt.GetHijackRules(), data.Qname, answerIPs(dnsMsg))
+	}
 }
 
-func getName(labels []string, i int) string {
-	var res string
-	labelsLen := len(labels)
-	if labelsLen-i >= 0 {
-		res = strings.Join(labels[labelsLen-i:labelsLen-1], ".")
+// qnameUnicode returns the Unicode form of punycode labels of qname, empty when it can't be decoded.
+func qnameUnicode(qname string) string {
+	if !strings.Contains(strings.ToLower(qname), "xn--") {
+		return qname
+	}
+	name, err := idna.Lookup.ToUnicode(qname)
+	if err != nil {
+		return ""
+	}
+	return name
+}
+
+// reverseLabels joins labels in reverse order, e.g. com.example.www for www.example.com.
+func reverseLabels(labels []string) string {
+	reversed := make([]string, len(labels))
+	for i, label := range labels {
+		reversed[len(labels)-1-i] = label
+	}
+	return strings.Join(reversed, ".")
+}
+
+// shannonEntropy returns bits per byte of s.
+func shannonEntropy(s string) float64 {
+	var counts [256]int
+	for i := 0; i < len(s); i++ {
+		counts[s[i]]++
+	}
+	var res float64
+	for _, c := range counts {
+		if c > 0 {
+			p := float64(c) / float64(len(s))
+			res -= p * math.Log2(p)
+		}
+	}
+	return res
+}
+
+// qnameBinary reports whether name has non-printable bytes,
+// as \DDD escapes of the presentation format, control characters or invalid UTF-8.
+func qnameBinary(name string) bool {
+	if !utf8.ValidString(name) {
+		return true
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c < ' ' || c == 0x7f {
+			return true
+		}
+		if c != '\\' || i+1 >= len(name) {
+			continue
+		}
+		if n, ok := escapedByte(name[i+1:]); ok {
+			if n < ' ' || n > '~' {
+				return true
+			}
+			i += 3
+			continue
+		}
+		i++
+	}
+	return false
+}
+
+// escapedByte returns value of \DDD escape digits at head of s.
+func escapedByte(s string) (int, bool) {
+	if len(s) < 3 {
+		return 0, false
+	}
+	n := 0
+	for _, c := range []byte(s[:3]) {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		n = n*10 + int(c-'0')
+	}
+	return n, n <= 255
+}
+
+// sanitizeQname escapes control characters and invalid UTF-8 bytes of name as \DDD.
+func sanitizeQname(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); {
+		r, size := utf8.DecodeRuneInString(name[i:])
+		if (r == utf8.RuneError && size <= 1) || r < ' ' || r == 0x7f {
+			fmt.Fprintf(&b, "\\%03d", name[i])
+			i++
+			continue
+		}
+		b.WriteString(name[i : i+size])
+		i += size
+	}
+	return b.String()
+}
+
+var messageTypeShort = map[dnstap.Message_Type]string{
+	dnstap.Message_AUTH_QUERY:         "aq",
+	dnstap.Message_AUTH_RESPONSE:      "ar",
+	dnstap.Message_RESOLVER_QUERY:     "rq",
+	dnstap.Message_RESOLVER_RESPONSE:  "rr",
+	dnstap.Message_CLIENT_QUERY:       "cq",
+	dnstap.Message_CLIENT_RESPONSE:    "cr",
+	dnstap.Message_FORWARDER_QUERY:    "fq",
+	dnstap.Message_FORWARDER_RESPONSE: "fr",
+	dnstap.Message_STUB_QUERY:         "sq",
+	dnstap.Message_STUB_RESPONSE:      "sr",
+	dnstap.Message_TOOL_QUERY:         "tq",
+	dnstap.Message_TOOL_RESPONSE:      "tr",
+	dnstap.Message_UPDATE_QUERY:       "uq",
+	dnstap.Message_UPDATE_RESPONSE:    "ur",
+}
+
+// MessageTypeShort returns the two letter code of t, the initial of the role and q or r, empty for unknown types.
+func MessageTypeShort(t dnstap.Message_Type) string {
+	return messageTypeShort[t]
+}
+
+func isResponse(t dnstap.Message_Type) bool {
+	switch t {
+	case dnstap.Message_AUTH_RESPONSE, dnstap.Message_RESOLVER_RESPONSE,
+		dnstap.Message_CLIENT_RESPONSE, dnstap.Message_FORWARDER_RESPONSE,
+		dnstap.Message_STUB_RESPONSE, dnstap.Message_TOOL_RESPONSE,
+		dnstap.Message_UPDATE_RESPONSE:
+		return true
+	}
+	return false
+}
+
+// maskAddress returns masked address by socket family,
+// address length is used only when the family is unset.
+// For INET, a 16 byte address is IPv4-mapped or IPv4 in the first 4 bytes.
+func maskAddress(addr []byte, family *dnstap.SocketFamily, opt DnstapFlatOption) net.IP {
+	if len(addr) == 0 {
+		return nil
+	}
+	ip := net.IP(addr)
+	inet := len(addr) == 4
+	if family != nil {
+		inet = *family == dnstap.SocketFamily_INET
+	}
+	if !inet {
+		if ip = ip.To16(); ip == nil {
+			return nil
+		}
+		if a := opt.GetAnonymizer(); a != nil {
+			return a.Anonymize(ip)
+		}
+		return ip.Mask(opt.GetIPv6Mask())
+	}
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	} else if len(addr) >= 4 {
+		ip = net.IP(addr[:4])
 	} else {
-		res = strings.Join(labels, ".")
+		return nil
+	}
+	if a := opt.GetAnonymizer(); a != nil {
+		return a.Anonymize(ip)
+	}
+	return ip.Mask(opt.GetIPv4Mask())
+}
+
+// timestampEpoch returns RFC3339 ts as float64 seconds, or int64 nanoseconds for unit ns.
+func timestampEpoch(ts, unit string) interface{} {
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return nil
+	}
+	if unit == "ns" {
+		return t.UnixNano()
+	}
+	return float64(t.UnixNano()) / float64(time.Second)
+}
+
+func maskIP(ip net.IP, opt DnstapFlatOption) net.IP {
+	if a := opt.GetAnonymizer(); a != nil {
+		return a.Anonymize(ip)
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return v4.Mask(opt.GetIPv4Mask())
+	}
+	return ip.Mask(opt.GetIPv6Mask())
+}
+
+// arpaAddress returns address of a full in-addr.arpa or ip6.arpa name, otherwise nil.
+func arpaAddress(qname string) net.IP {
+	name := strings.ToLower(dns.Fqdn(qname))
+	switch {
+	case strings.HasSuffix(name, ".in-addr.arpa."):
+		labels := strings.Split(strings.TrimSuffix(name, ".in-addr.arpa."), ".")
+		if len(labels) != 4 {
+			return nil
+		}
+		ip := make(net.IP, 4)
+		for i, label := range labels {
+			n, err := strconv.ParseUint(label, 10, 8)
+			if err != nil {
+				return nil
+			}
+			ip[3-i] = byte(n)
+		}
+		return ip
+	case strings.HasSuffix(name, ".ip6.arpa."):
+		labels := strings.Split(strings.TrimSuffix(name, ".ip6.arpa."), ".")
+		if len(labels) != 32 {
+			return nil
+		}
+		ip := make(net.IP, 16)
+		for i, label := range labels {
+			n, err := strconv.ParseUint(label, 16, 4)
+			if err != nil || len(label) != 1 {
+				return nil
+			}
+			pos := 31 - i
+			ip[pos/2] |= byte(n) << (4 * uint(1-pos%2))
+		}
+		return ip
+	}
+	return nil
+}
+
+// ecsOption returns EDNS Client Subnet option of the message.
+func ecsOption(dnsMsg *dns.Msg) *dns.EDNS0_SUBNET {
+	for _, rr := range dnsMsg.Extra {
+		if optrr, ok := rr.(*dns.OPT); ok {
+			for _, edns0opt := range optrr.Option {
+				if ecs, ok := edns0opt.(*dns.EDNS0_SUBNET); ok {
+					return ecs
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// clientAddress returns ECS subnet address as the client, falling back to the query address.
+// The subnet is masked by IPv4Mask/IPv6Mask and the ECS source prefix, whichever is shorter,
+// or pseudonymized and masked by the source prefix with PrefixPreservingAnonymization.
+// ECS with source prefix 0 means the client opted out, so the query address is used.
+func clientAddress(ecs *dns.EDNS0_SUBNET, queryAddress net.IP, opt DnstapFlatOption) net.IP {
+	if ecs == nil || ecs.SourceNetmask == 0 || ecs.Address == nil {
+		return queryAddress
+	}
+	ip, bits := ecs.Address.To16(), 128
+	if ecs.Family == 1 {
+		ip, bits = ecs.Address.To4(), 32
+	}
+	if ip == nil {
+		return queryAddress
+	}
+	prefix := int(ecs.SourceNetmask)
+	if prefix > bits {
+		prefix = bits
+	}
+	return maskIP(ip, opt).Mask(net.CIDRMask(prefix, bits))
+}
+
+// ednsOptions returns options of the OPT record in order.
+// It is empty slice, not nil, for OPT record without options.
+func ednsOptions(optrr *dns.OPT) []EdnsOption {
+	res := []EdnsOption{}
+	for _, o := range optrr.Option {
+		code := o.Option()
+		res = append(res, EdnsOption{Code: code, Name: ednsOptionNames[code]})
+	}
+	return res
+}
+
+// dnsCookie returns hex client and server cookies (RFC 7873) of the OPT record.
+// Client cookie is the first 8 bytes, server cookie is the rest.
+func dnsCookie(optrr *dns.OPT) (string, string) {
+	for _, o := range optrr.Option {
+		c, ok := o.(*dns.EDNS0_COOKIE)
+		if !ok {
+			continue
+		}
+		cookie := strings.ToLower(c.Cookie)
+		if len(cookie) <= 16 {
+			return cookie, ""
+		}
+		return cookie[:16], cookie[16:]
+	}
+	return "", ""
+}
+
+// ednsPaddingSize returns length of the padding option (RFC 7830), nil when it is not present.
+func ednsPaddingSize(optrr *dns.OPT) *int {
+	for _, o := range optrr.Option {
+		if p, ok := o.(*dns.EDNS0_PADDING); ok {
+			size := len(p.Padding)
+			return &size
+		}
+	}
+	return nil
+}
+
+// ednsKeepalive returns the edns-tcp-keepalive timeout (RFC 7828) in milliseconds
+// and the expire (RFC 7314) in seconds, 0 when the option has no value, nil when it is not present.
+func ednsKeepalive(optrr *dns.OPT) (*int, *int64) {
+	var keepalive *int
+	var expire *int64
+	for _, o := range optrr.Option {
+		switch v := o.(type) {
+		case *dns.EDNS0_TCP_KEEPALIVE:
+			timeout := int(v.Timeout) * 100
+			keepalive = &timeout
+		case *dns.EDNS0_EXPIRE:
+			e := int64(v.Expire)
+			expire = &e
+		}
+	}
+	return keepalive, expire
+}
+
+// extendedRcode returns the name of the 12 bits rcode, the upper 8 bits of OPT and the 4 bits of header.
+// miekg/dns doesn't merge them on unpack, and names 16 BADSIG of TSIG, it is BADVERS with OPT.
+func extendedRcode(optrr *dns.OPT, rcode int) string {
+	rcode = optrr.ExtendedRcode() | rcode&0xf
+	if rcode == dns.RcodeBadVers {
+		return "BADVERS"
+	}
+	if name, ok := dns.RcodeToString[rcode]; ok {
+		return name
+	}
+	return strconv.Itoa(rcode)
+}
+
+// nsid returns NSID option as string when it is printable, otherwise as hex.
+func nsid(optrr *dns.OPT) string {
+	for _, o := range optrr.Option {
+		n, ok := o.(*dns.EDNS0_NSID)
+		if !ok || n.Nsid == "" {
+			continue
+		}
+		bs, err := hex.DecodeString(n.Nsid)
+		if err != nil {
+			return n.Nsid
+		}
+		for _, b := range bs {
+			if b < 0x20 || b > 0x7e {
+				return n.Nsid
+			}
+		}
+		return string(bs)
+	}
+	return ""
+}
+
+// allRecords returns records of answer, authority and additional sections in order,
+// up to max records when max > 0. The OPT pseudo-record is excluded.
+func allRecords(dnsMsg *dns.Msg, max int) []RRRecord {
+	var res []RRRecord
+	sections := []struct {
+		name string
+		rrs  []dns.RR
+	}{
+		{"answer", dnsMsg.Answer},
+		{"authority", dnsMsg.Ns},
+		{"additional", dnsMsg.Extra},
+	}
+	for _, section := range sections {
+		for _, rr := range section.rrs {
+			if max > 0 && len(res) >= max {
+				return res
+			}
+			h := rr.Header()
+			if h.Rrtype == dns.TypeOPT {
+				continue
+			}
+			res = append(res, RRRecord{
+				Section: section.name,
+				Name:    h.Name,
+				Type:    dns.TypeToString[h.Rrtype],
+				TTL:     h.Ttl,
+				Rdata:   strings.TrimPrefix(rr.String(), h.String()),
+			})
+		}
+	}
+	return res
+}
+
+// cnameChain returns CNAME targets of the answer section in order.
+func cnameChain(dnsMsg *dns.Msg) []string {
+	var res []string
+	for _, rr := range dnsMsg.Answer {
+		if cname, ok := rr.(*dns.CNAME); ok {
+			res = append(res, cname.Target)
+		}
+	}
+	return res
+}
+
+// txtRecords returns full TXT data of the answer section.
+// Multiple strings of a TXT record are concatenated as SPF and DKIM do.
+func txtRecords(dnsMsg *dns.Msg) []string {
+	var res []string
+	for _, rr := range dnsMsg.Answer {
+		if txt, ok := rr.(*dns.TXT); ok {
+			res = append(res, strings.Join(txt.Txt, ""))
+		}
 	}
 	return res
 }
 
+// answerIPs returns addresses of A and AAAA records in answer section.
+func answerIPs(m *dns.Msg) []net.IP {
+	var ips []net.IP
+	for _, rr := range m.Answer {
+		switch v := rr.(type) {
+		case *dns.A:
+			ips = append(ips, v.A)
+		case *dns.AAAA:
+			ips = append(ips, v.AAAA)
+		}
+	}
+	return ips
+}
+
+// hijackSuspected reports whether any answered address is out of
+// the expected CIDRs of the first rule matching qname.
+func hijackSuspected(rules []*HijackRule, qname string, ips []net.IP) bool {
+	for _, rule := range rules {
+		if !rule.Match(qname) {
+			continue
+		}
+		for _, ip := range ips {
+			if !rule.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// flagsWord rebuilds the 16-bit header flags word from the parsed bits.
+func flagsWord(h *dns.MsgHdr) uint16 {
+	var w uint16
+	if h.Response {
+		w |= 1 << 15
+	}
+	w |= uint16(h.Opcode&0xf) << 11
+	if h.Authoritative {
+		w |= 1 << 10
+	}
+	if h.Truncated {
+		w |= 1 << 9
+	}
+	if h.RecursionDesired {
+		w |= 1 << 8
+	}
+	if h.RecursionAvailable {
+		w |= 1 << 7
+	}
+	if h.Zero {
+		w |= 1 << 6
+	}
+	if h.AuthenticatedData {
+		w |= 1 << 5
+	}
+	if h.CheckingDisabled {
+		w |= 1 << 4
+	}
+	w |= uint16(h.Rcode & 0xf)
+	return w
+}
+
+// lastLabels returns the rightmost n labels without root,
+// or empty string when name has less than n labels.
+func lastLabels(labels []string, n int) string {
+	if len(labels) < n {
+		return ""
+	}
+	return strings.Join(labels[len(labels)-n:], ".")
+}
+
+// legacyLabels returns the rightmost n labels of name like lastLabels,
+// or name itself when it has less than n labels.
+func legacyLabels(name string, labels []string, n int) string {
+	if n < 1 || len(labels) < n {
+		return name
+	}
+	return strings.Join(labels[len(labels)-n:], ".")
+}
+
 func (d *DnstapFlatT) ToMapString() map[string]interface{} {
 	res := map[string]interface{}{}
 	res["timestamp"] = d.Timestamp
 	res["query_time"] = d.QueryTime
+	if d.ReceivedAt != "" {
+		res["received_at"] = d.ReceivedAt
+	}
+	if d.TimestampEpoch != nil {
+		res["timestamp_epoch"] = d.TimestampEpoch
+	}
+	if len(d.ExtraParsed) > 0 {
+		if bs, err := json.Marshal(d.ExtraParsed); err == nil {
+			res["extra_parsed"] = string(bs)
+		}
+	}
 	if d.QueryAddress != nil {
 		res["query_address"] = d.QueryAddress.String()
 	}
@@ -216,28 +1565,65 @@ func (d *DnstapFlatT) ToMapString() map[string]interface{} {
 	res["response_address_hash"] = d.ResponseAddressHash
 
 	res["response_port"] = int64(d.ResponsePort)
+	if d.SrcAddress != nil {
+		res["src_address"] = d.SrcAddress.String()
+		res["src_port"] = int64(d.SrcPort)
+	}
+	if d.DstAddress != nil {
+		res["dst_address"] = d.DstAddress.String()
+		res["dst_port"] = int64(d.DstPort)
+	}
 	res["response_zone"] = d.ResponseZone
-	if d.ResponseAddress != nil {
-		res["ResponseAddressHash"] = d.EcsNet
+	if d.AuthorityName != "" {
+		res["authority_name"] = d.AuthorityName
+	}
+	if d.AuthoritativeForZone != nil {
+		res["is_authoritative_for_zone"] = *d.AuthoritativeForZone
+	}
+	if d.EcsNet != nil {
+		res["ecs_net"] = d.EcsNet.String()
 	}
 
 	res["identity"] = d.Identity
 	res["type"] = d.Type
+	if d.IsResponse != nil {
+		res["is_response"] = *d.IsResponse
+		res["message_type_short"] = d.MessageTypeShort
+	}
 	res["socket_family"] = d.SocketFamily
 	res["socket_protocol"] = d.SocketProtocol
+	if d.SocketFamilyCode != nil {
+		res["socket_family_code"] = int32(*d.SocketFamilyCode)
+		res["socket_protocol_code"] = int32(*d.SocketProtocolCode)
+	}
 
 	res["version"] = d.Version
 	res["extra"] = d.Extra
 	res["tld"] = d.TopLevelDomainName
+	if d.TLDClass != "" {
+		res["tld_class"] = d.TLDClass
+	}
+	if d.QnameReversed != "" {
+		res["qname_reversed"] = d.QnameReversed
+	}
+	if d.QnameUnicode != "" {
+		res["qname_unicode"] = d.QnameUnicode
+	}
 	res["sld"] = d.SecondLevelDomainName
 	res["thirdld"] = d.ThirdLevelDomainName
 	res["fourthld"] = d.FourthLevelDomainName
+	res["subdomain"] = d.Subdomain
+	res["label_count"] = int64(d.LabelCount)
 
 	res["qname"] = d.Qname
 	res["qclass"] = d.Qclass
 	res["qtype"] = d.Qtype
 
 	res["message_size"] = int64(d.MessageSize)
+	res["qdcount"] = int64(d.Qdcount)
+	res["ancount"] = int64(d.Ancount)
+	res["nscount"] = int64(d.Nscount)
+	res["arcount"] = int64(d.Arcount)
 	res["txid"] = int32(d.Txid)
 	res["rcode"] = d.Rcode
 
@@ -247,6 +1633,373 @@ func (d *DnstapFlatT) ToMapString() map[string]interface{} {
 	res["ra"] = d.RA
 	res["ad"] = d.AD
 	res["cd"] = d.CD
+	if d.DNSID != nil {
+		res["dns_id"] = int32(*d.DNSID)
+		res["flags_hex"] = d.FlagsHex
+	}
+	if d.EdnsUDPSize != nil {
+		res["edns_udp_size"] = int32(*d.EdnsUDPSize)
+		res["edns_bufsize_small"] = d.EdnsBufsizeSmall
+	}
+	if d.TimestampEstimated {
+		res["timestamp_estimated"] = d.TimestampEstimated
+	}
+	if d.TimestampClamped {
+		res["timestamp_clamped"] = d.TimestampClamped
+	}
+	if d.HijackSuspected {
+		res["hijack_suspected"] = d.HijackSuspected
+	}
+	if d.DocID != "" {
+		res["doc_id"] = d.DocID
+	}
+	if d.LatencyMs != nil {
+		res["latency_ms"] = *d.LatencyMs
+	}
+	if len(d.Svcb) > 0 {
+		if bs, err := json.Marshal(d.Svcb); err == nil {
+			res["svcb"] = string(bs)
+		}
+	}
+	if d.RecordTrimmed {
+		res["record_trimmed"] = d.RecordTrimmed
+	}
+	if d.Nsid != "" {
+		res["nsid"] = d.Nsid
+	}
+	if len(d.TxtRecords) > 0 {
+		if bs, err := json.Marshal(d.TxtRecords); err == nil {
+			res["txt_records"] = string(bs)
+		}
+	}
+	if len(d.CnameChain) > 0 {
+		if bs, err := json.Marshal(d.CnameChain); err == nil {
+			res["cname_chain"] = string(bs)
+		}
+		res["final_name"] = d.FinalName
+	}
+	if d.QueryPtr != "" {
+		res["query_ptr"] = d.QueryPtr
+	}
+	if d.EdnsOptions != nil {
+		if bs, err := json.Marshal(d.EdnsOptions); err == nil {
+			res["edns_options"] = string(bs)
+		}
+	}
+	if d.PtrTarget != nil {
+		res["ptr_target"] = d.PtrTarget.String()
+	}
+	if d.CorrelationID != "" {
+		res["correlation_id"] = d.CorrelationID
+	}
+	if d.AnswerIPCount != nil {
+		res["answer_ip_count"] = int64(*d.AnswerIPCount)
+		res["large_response"] = d.LargeResponse
+	}
+	if d.ClientCookie != "" {
+		res["client_cookie"] = d.ClientCookie
+	}
+	if d.ServerCookie != "" {
+		res["server_cookie"] = d.ServerCookie
+	}
+	if d.TransferMessages > 0 {
+		res["transfer_messages"] = int64(d.TransferMessages)
+		if bs, err := json.Marshal(d.TransferRecords); err == nil {
+			res["transfer_records"] = string(bs)
+		}
+		if d.TransferSerial != nil {
+			res["transfer_serial"] = int64(*d.TransferSerial)
+		}
+		if d.TransferFromSerial != nil {
+			res["transfer_from_serial"] = int64(*d.TransferFromSerial)
+		}
+		res["transfer_bytes"] = int64(d.TransferBytes)
+		res["transfer_incomplete"] = d.TransferIncomplete
+	}
+	if d.EdnsPaddingSize != nil {
+		res["edns_padding_size"] = int64(*d.EdnsPaddingSize)
+	}
+	if d.EdnsKeepalive != nil {
+		res["edns_keepalive"] = int64(*d.EdnsKeepalive)
+	}
+	if d.EdnsExpire != nil {
+		res["edns_expire"] = *d.EdnsExpire
+	}
+	if d.EdnsVersion != nil {
+		res["edns_version"] = int32(*d.EdnsVersion)
+	}
+	if d.ExtendedRcode != "" {
+		res["extended_rcode"] = d.ExtendedRcode
+	}
+	if d.ClientAddress != nil {
+		res["client_address"] = d.ClientAddress.String()
+	}
+	if d.Paired {
+		res["paired"] = d.Paired
+		res["query_message_size"] = int64(*d.QueryMessageSize)
+	}
+	if d.Unmatched {
+		res["unmatched"] = d.Unmatched
+	}
+	if d.Source != "" {
+		res["source"] = d.Source
+	}
+	if d.Collector != "" {
+		res["collector"] = d.Collector
+	}
+	if d.TransportClientAddress != nil {
+		res["transport_client_address"] = d.TransportClientAddress.String()
+		res["transport_client_port"] = int64(d.TransportClientPort)
+	}
+	if d.Seq > 0 {
+		res["seq"] = int64(d.Seq)
+		res["seq_epoch"] = d.SeqEpoch
+	}
+	if d.Occurrences > 0 {
+		res["occurrences"] = int64(d.Occurrences)
+	}
+	if d.ZoneTransfer {
+		res["zone_transfer"] = d.ZoneTransfer
+	}
+	if d.WouldDrop {
+		res["would_drop"] = d.WouldDrop
+		res["would_drop_reason"] = d.WouldDropReason
+	}
+	if len(d.Records) > 0 {
+		if bs, err := json.Marshal(d.Records); err == nil {
+			res["records"] = string(bs)
+		}
+	}
+	if d.QnameBinary {
+		res["qname_binary"] = d.QnameBinary
+	}
+	if d.ParsePartial {
+		res["parse_partial"] = d.ParsePartial
+	}
+	if d.CaptureTruncated {
+		res["capture_truncated"] = d.CaptureTruncated
+	}
+	if d.SubdomainEntropy != nil {
+		res["subdomain_entropy"] = *d.SubdomainEntropy
+		res["random_subdomain_suspected"] = d.RandomSubdomain
+	}
+	if d.Blocklisted {
+		res["blocklisted"] = d.Blocklisted
+		res["blocklist_match"] = d.BlocklistMatch
+	}
+	if len(d.EnrichmentErrors) > 0 {
+		if bs, err := json.Marshal(d.EnrichmentErrors); err == nil {
+			res["enrichment_errors"] = string(bs)
+		}
+	}
+	if len(d.TruncatedFields) > 0 {
+		if bs, err := json.Marshal(d.TruncatedFields); err == nil {
+			res["truncated_fields"] = string(bs)
+		}
+	}
+	if d.QnameRaw != "" {
+		res["qname_raw"] = d.QnameRaw
+	}
+	if d.Policy != nil {
+		if bs, err := json.Marshal(d.Policy); err == nil {
+			res["policy"] = string(bs)
+		}
+	}
+	for k, v := range d.Fields {
+		res[k] = v
+	}
+	if d.MaxFieldLength > 0 {
+		truncateFlatMap(res, d.MaxFieldLength)
+	}
+
+	return res
+}
+
+// trimFields are optional fields dropped by TrimFlatRecord, in order.
+var trimFields = []func(d *DnstapFlatT){
+	func(d *DnstapFlatT) { d.Records = nil },
+	func(d *DnstapFlatT) { d.Svcb = nil },
+	func(d *DnstapFlatT) { d.Extra, d.ExtraParsed = "", nil },
+	func(d *DnstapFlatT) { d.ResponseZone, d.AuthorityName = "", "" },
+	func(d *DnstapFlatT) { d.QueryAddressHash, d.ResponseAddressHash = "", "" },
+}
+
+// TrimFlatRecord drops optional fields until the JSON size of d is within maxBytes,
+// and sets RecordTrimmed when any field is dropped.
+// It returns false when d is still larger than maxBytes.
+func TrimFlatRecord(d *DnstapFlatT, opt DnstapFlatOption, maxBytes int) (bool, error) {
+	for n := 0; ; n++ {
+		buf, err := MarshalFlatJSON(d, opt)
+		if err != nil {
+			return false, err
+		}
+		if len(buf) <= maxBytes {
+			return true, nil
+		}
+		if n >= len(trimFields) {
+			return false, nil
+		}
+		trimFields[n](d)
+		d.RecordTrimmed = true
+	}
+}
+
+// MarshalFlatJSON marshals flat data as JSON.
+// When NumbersAsStrings is enabled, all numeric values are emitted as strings.
+func MarshalFlatJSON(d *DnstapFlatT, opt DnstapFlatOption) ([]byte, error) {
+	buf, err := json.Marshal(d)
+	if err != nil || (!opt.GetNumbersAsStrings() && len(d.Fields) == 0 && d.MaxFieldLength == 0 && opt.GetKeyCase() == "snake") {
+		return buf, err
+	}
+	m, err := decodeFlatJSON(buf, d, opt.GetNumbersAsStrings())
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(caseKeys(m, opt.GetKeyCase()))
+}
+
+// flatMap returns ToMapString of d for serializers.
+// When NumbersAsStrings is enabled, all numeric values are strings.
+func flatMap(d *DnstapFlatT, opt DnstapFlatOption) map[string]interface{} {
+	m := d.ToMapString()
+	if opt.GetNumbersAsStrings() {
+		for k, v := range m {
+			m[k] = flatNumber(v, true)
+		}
+	}
+	return caseKeys(m, opt.GetKeyCase())
+}
 
+// flatMessage returns flat data for msgpack based encoders.
+func flatMessage(d *DnstapFlatT, opt DnstapFlatOption) (interface{}, error) {
+	if !opt.GetNumbersAsStrings() && len(d.Fields) == 0 && d.MaxFieldLength == 0 && opt.GetKeyCase() == "snake" {
+		return msgFields(d), nil
+	}
+	buf, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	m, err := decodeFlatJSON(buf, d, opt.GetNumbersAsStrings())
+	if err != nil {
+		return nil, err
+	}
+	return caseKeys(m, opt.GetKeyCase()), nil
+}
+
+// flatMsgFields are the indexes and msg tag names of DnstapFlatT fields, without fields tagged "-".
+var flatMsgFields = func() map[string]int {
+	res := map[string]int{}
+	t := reflect.TypeOf(DnstapFlatT{})
+	for i := 0; i < t.NumField(); i++ {
+		if name := t.Field(i).Tag.Get("msg"); name != "" && name != "-" {
+			res[name] = i
+		}
+	}
 	return res
+}()
+
+// msgFields returns the fields of d by msg tag names, like fluent-logger does for structs
+// but skipping the fields tagged "-".
+func msgFields(d *DnstapFlatT) map[string]interface{} {
+	v := reflect.ValueOf(d).Elem()
+	res := make(map[string]interface{}, len(flatMsgFields))
+	for name, i := range flatMsgFields {
+		res[name] = v.Field(i).Interface()
+	}
+	return res
+}
+
+// caseKeys converts keys of m and its nested objects to keyCase, snake is as is.
+func caseKeys(m map[string]interface{}, keyCase string) map[string]interface{} {
+	if keyCase != "camel" {
+		return m
+	}
+	res := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		res[camelCase(k)] = caseValue(v)
+	}
+	return res
+}
+
+func caseValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return caseKeys(v, "camel")
+	case []interface{}:
+		for i := range v {
+			v[i] = caseValue(v[i])
+		}
+	}
+	return v
+}
+
+// camelCase converts a snake_case key to camelCase, e.g. query_address to queryAddress.
+// Leading underscores, underscores before digits and keys like @timestamp are kept.
+func camelCase(key string) string {
+	var b strings.Builder
+	upper := false
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		switch {
+		case c == '_' && b.Len() > 0 && i+1 < len(key) && (key[i+1] < '0' || key[i+1] > '9'):
+			upper = true
+		case upper && c >= 'a' && c <= 'z':
+			b.WriteByte(c - 'a' + 'A')
+			upper = false
+		default:
+			b.WriteByte(c)
+			upper = false
+		}
+	}
+	return b.String()
+}
+
+// decodeFlatJSON decodes JSON of d into a map with derived fields of d.
+// Numbers are strings when numbersAsStrings, otherwise int64 or float64.
+func decodeFlatJSON(buf []byte, d *DnstapFlatT, numbersAsStrings bool) (map[string]interface{}, error) {
+	m := map[string]interface{}{}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+	for k, v := range d.Fields {
+		m[k] = v
+	}
+	if d.MaxFieldLength > 0 {
+		truncateFlatMap(m, d.MaxFieldLength)
+	}
+	for k, v := range m {
+		m[k] = flatNumber(v, numbersAsStrings)
+	}
+	return m, nil
+}
+
+// flatNumber returns v with numbers decoded as int64 or float64, or as strings by numbersAsStrings,
+// numbers in nested maps and arrays alike.
+func flatNumber(v interface{}, numbersAsStrings bool) interface{} {
+	switch n := v.(type) {
+	case json.Number:
+		if numbersAsStrings {
+			return n.String()
+		}
+		if i, err := n.Int64(); err == nil {
+			return i
+		}
+		f, _ := n.Float64()
+		return f
+	case int32, int64, float64:
+		if numbersAsStrings {
+			return fmt.Sprint(n)
+		}
+	case map[string]interface{}:
+		for k, e := range n {
+			n[k] = flatNumber(e, numbersAsStrings)
+		}
+	case []interface{}:
+		for i, e := range n {
+			n[i] = flatNumber(e, numbersAsStrings)
+		}
+	}
+	return v
 }
@@ -0,0 +1,1540 @@
+/*
+ * Copyright (c) 2019 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/golang/protobuf/proto"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+func newTestDnstap(t *testing.T, mt dnstap.Message_Type, m *dns.Msg) *dnstap.Dnstap {
+	bs, err := m.Pack()
+	assert.NoError(t, err)
+	msg := &dnstap.Message{
+		Type:           &mt,
+		SocketFamily:   dnstap.SocketFamily_INET.Enum(),
+		SocketProtocol: dnstap.SocketProtocol_UDP.Enum(),
+		QueryAddress:   net.ParseIP("192.0.2.1").To4(),
+		QueryPort:      proto.Uint32(53000),
+		QueryTimeSec:   proto.Uint64(1546300800),
+		QueryTimeNsec:  proto.Uint32(0),
+	}
+	switch mt {
+	case dnstap.Message_CLIENT_RESPONSE, dnstap.Message_AUTH_RESPONSE,
+		dnstap.Message_RESOLVER_RESPONSE, dnstap.Message_FORWARDER_RESPONSE,
+		dnstap.Message_STUB_RESPONSE, dnstap.Message_TOOL_RESPONSE,
+		dnstap.Message_UPDATE_RESPONSE:
+		msg.ResponseMessage = bs
+		msg.ResponseTimeSec = proto.Uint64(1546300801)
+		msg.ResponseTimeNsec = proto.Uint32(0)
+	default:
+		msg.QueryMessage = bs
+	}
+	return &dnstap.Dnstap{
+		Type:    dnstap.Dnstap_MESSAGE.Enum(),
+		Message: msg,
+	}
+}
+
+func newTestQuery(qname string, qtype uint16) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(qname, qtype)
+	m.Id = 0x1234
+	return m
+}
+
+func TestFlatDnstapWireDebug(t *testing.T) {
+	dt := newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("www.example.com.", dns.TypeA))
+
+	data, err := dtap.FlatDnstap(dt, &dtap.FlatConfig{})
+	assert.NoError(t, err)
+	assert.Nil(t, data.DNSID)
+	assert.Equal(t, "", data.FlagsHex)
+
+	data, err = dtap.FlatDnstap(dt, &dtap.FlatConfig{IncludeWireDebug: true})
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(0x1234), *data.DNSID)
+	// RD only
+	assert.Equal(t, "0100", data.FlagsHex)
+}
+
+func TestMarshalFlatJSONNumbersAsStrings(t *testing.T) {
+	dt := newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("www.example.com.", dns.TypeA))
+	opt := &dtap.FlatConfig{}
+	data, err := dtap.FlatDnstap(dt, opt)
+	assert.NoError(t, err)
+
+	bs, err := dtap.MarshalFlatJSON(data, opt)
+	assert.NoError(t, err)
+	assert.Contains(t, string(bs), `"query_port":53000`)
+
+	opt.NumbersAsStrings = true
+	bs, err = dtap.MarshalFlatJSON(data, opt)
+	assert.NoError(t, err)
+	assert.Contains(t, string(bs), `"query_port":"53000"`)
+	assert.Contains(t, string(bs), `"txid":"4660"`)
+	assert.Contains(t, string(bs), `"rd":true`)
+}
+
+func TestMarshalFlatJSONNumbersAsStringsNested(t *testing.T) {
+	q := newTestQuery("www.example.com.", dns.TypeA)
+	dt := newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, newTestResponse(q, "www.example.com. 300 IN A 192.0.2.1"))
+	opt := &dtap.FlatConfig{IncludeAllSections: true, NumbersAsStrings: true}
+	data, err := dtap.FlatDnstap(dt, opt)
+	assert.NoError(t, err)
+	data.Fields = map[string]interface{}{"custom": map[string]interface{}{"weight": 2.5}}
+
+	bs, err := dtap.MarshalFlatJSON(data, opt)
+	assert.NoError(t, err)
+	assert.Contains(t, string(bs), `"ttl":"300"`)
+	assert.Contains(t, string(bs), `"custom":{"weight":"2.5"}`)
+
+	// nested numbers are numbers again without NumbersAsStrings.
+	opt.NumbersAsStrings = false
+	bs, err = dtap.MarshalFlatJSON(data, opt)
+	assert.NoError(t, err)
+	assert.Contains(t, string(bs), `"ttl":300`)
+}
+
+func newTestResponse(q *dns.Msg, rrs ...string) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetReply(q)
+	for _, s := range rrs {
+		rr, _ := dns.NewRR(s)
+		m.Answer = append(m.Answer, rr)
+	}
+	return m
+}
+
+func TestFlatDnstapHijackSuspected(t *testing.T) {
+	opt := &dtap.FlatConfig{
+		HijackRules: []*dtap.HijackRule{
+			{Qname: "*.example.com", CIDRs: []string{"192.0.2.0/24", "2001:db8::/32"}},
+		},
+	}
+	q := newTestQuery("www.example.com.", dns.TypeA)
+	testcases := []struct {
+		rr       string
+		expected bool
+	}{
+		{"www.example.com. 300 IN A 192.0.2.10", false},
+		{"www.example.com. 300 IN AAAA 2001:db8::10", false},
+		{"www.example.com. 300 IN A 198.51.100.1", true},
+	}
+	for _, tc := range testcases {
+		dt := newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, newTestResponse(q, tc.rr))
+		data, err := dtap.FlatDnstap(dt, opt)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expected, data.HijackSuspected, tc.rr)
+	}
+
+	// not matched qname
+	other := newTestQuery("www.example.net.", dns.TypeA)
+	dt := newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, newTestResponse(other, "www.example.net. 300 IN A 198.51.100.1"))
+	data, err := dtap.FlatDnstap(dt, opt)
+	assert.NoError(t, err)
+	assert.False(t, data.HijackSuspected)
+}
+
+func TestFlatDnstapEdnsUDPSize(t *testing.T) {
+	q := newTestQuery("www.example.com.", dns.TypeA)
+	data, err := dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_CLIENT_QUERY, q), &dtap.FlatConfig{})
+	assert.NoError(t, err)
+	assert.Nil(t, data.EdnsUDPSize)
+	assert.False(t, data.EdnsBufsizeSmall)
+
+	q.SetEdns0(512, false)
+	data, err = dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_CLIENT_QUERY, q), &dtap.FlatConfig{})
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(512), *data.EdnsUDPSize)
+	assert.True(t, data.EdnsBufsizeSmall)
+
+	q = newTestQuery("www.example.com.", dns.TypeA)
+	q.SetEdns0(1232, false)
+	data, err = dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_CLIENT_QUERY, q), &dtap.FlatConfig{})
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(1232), *data.EdnsUDPSize)
+	assert.False(t, data.EdnsBufsizeSmall)
+}
+
+func TestFlatDnstapResponseTimeFallback(t *testing.T) {
+	q := newTestQuery("www.example.com.", dns.TypeA)
+	dt := newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, newTestResponse(q))
+	data, err := dtap.FlatDnstap(dt, &dtap.FlatConfig{})
+	assert.NoError(t, err)
+	assert.False(t, data.TimestampEstimated)
+	assert.Equal(t, time.Unix(1546300801, 0).Format(time.RFC3339Nano), data.Timestamp)
+
+	dt.Message.ResponseTimeSec = nil
+	dt.Message.ResponseTimeNsec = nil
+	now := time.Unix(1546300802, 500)
+	opt := &dtap.FlatConfig{}
+	opt.SetNow(func() time.Time { return now })
+	data, err = dtap.FlatDnstap(dt, opt)
+	assert.NoError(t, err)
+	assert.True(t, data.TimestampEstimated)
+	assert.Equal(t, now.Format(time.RFC3339Nano), data.Timestamp)
+}
+
+func TestFlatDnstapRecordsExplodeQuestions(t *testing.T) {
+	q := newTestQuery("www.example.com.", dns.TypeA)
+	q.Question = append(q.Question, dns.Question{Name: "mail.example.net.", Qtype: dns.TypeMX, Qclass: dns.ClassINET})
+	dt := newTestDnstap(t, dnstap.Message_CLIENT_QUERY, q)
+
+	records, err := dtap.FlatDnstapRecords(dt, &dtap.FlatConfig{})
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+	assert.Equal(t, "www.example.com.", records[0].Qname)
+
+	records, err = dtap.FlatDnstapRecords(dt, &dtap.FlatConfig{ExplodeQuestions: true})
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+	assert.Equal(t, "www.example.com.", records[0].Qname)
+	assert.Equal(t, "A", records[0].Qtype)
+	assert.Equal(t, "example.com", records[0].SecondLevelDomainName)
+	assert.Equal(t, "mail.example.net.", records[1].Qname)
+	assert.Equal(t, "MX", records[1].Qtype)
+	assert.Equal(t, "example.net", records[1].SecondLevelDomainName)
+	assert.Equal(t, records[0].Txid, records[1].Txid)
+	assert.Equal(t, records[0].QueryAddress, records[1].QueryAddress)
+}
+
+func TestFlatDnstapRecordsExplodeQuestionsReset(t *testing.T) {
+	q := newTestQuery("1.2.0.192.in-addr.arpa.", dns.TypePTR)
+	q.Question = append(q.Question, dns.Question{Name: ".", Qtype: dns.TypeNS, Qclass: dns.ClassINET})
+	dt := newTestDnstap(t, dnstap.Message_CLIENT_QUERY, q)
+
+	opt := &dtap.FlatConfig{ExplodeQuestions: true, DecodePTR: true, SubdomainEntropy: true, ClassifyTLD: true, IncludeReversedQname: true}
+	assert.Nil(t, opt.Validate())
+	records, err := dtap.FlatDnstapRecords(dt, opt)
+	assert.NoError(t, err)
+	if assert.Len(t, records, 2) {
+		assert.NotNil(t, records[0].PtrTarget)
+		assert.NotNil(t, records[0].SubdomainEntropy)
+		assert.Equal(t, "1.2.0.192", records[0].Subdomain)
+		assert.Equal(t, "special", records[0].TLDClass)
+		assert.Equal(t, "arpa.in-addr.192.0.2.1", records[0].QnameReversed)
+
+		// fields of the first question are not carried into the second.
+		assert.Nil(t, records[1].PtrTarget)
+		assert.Nil(t, records[1].SubdomainEntropy)
+		assert.Equal(t, "", records[1].Subdomain)
+		assert.Equal(t, "", records[1].TLDClass)
+		assert.Equal(t, "", records[1].QnameReversed)
+	}
+}
+
+func TestFlatDnstapLabels(t *testing.T) {
+	testcases := []struct {
+		qname     string
+		tld       string
+		sld       string
+		thirdld   string
+		subdomain string
+	}{
+		{"www.example.com.", "com", "example.com", "www.example.com", "www"},
+		{"a.b.example.com.", "com", "example.com", "b.example.com", "a.b"},
+		{"example.com.", "com", "example.com", "", ""},
+		{"com.", "com", "", "", ""},
+		{".", "", "", "", ""},
+	}
+	for _, tc := range testcases {
+		dt := newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery(tc.qname, dns.TypeA))
+		data, err := dtap.FlatDnstap(dt, &dtap.FlatConfig{})
+		assert.NoError(t, err)
+		assert.Equal(t, tc.tld, data.TopLevelDomainName, tc.qname)
+		assert.Equal(t, tc.sld, data.SecondLevelDomainName, tc.qname)
+		assert.Equal(t, tc.thirdld, data.ThirdLevelDomainName, tc.qname)
+		assert.Equal(t, tc.subdomain, data.Subdomain, tc.qname)
+	}
+
+	dt := newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("example.com.", dns.TypeA))
+	data, err := dtap.FlatDnstap(dt, &dtap.FlatConfig{LegacyLabels: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "com", data.TopLevelDomainName)
+	assert.Equal(t, "example.com", data.SecondLevelDomainName)
+	assert.Equal(t, "example.com.", data.FourthLevelDomainName)
+	assert.Equal(t, "", data.Subdomain)
+}
+
+func TestFlatDnstapLabelLevels(t *testing.T) {
+	testcases := []struct {
+		qname  string
+		legacy bool
+		labels [4]string
+	}{
+		{"com.", false, [4]string{"com", "", "", ""}},
+		{"example.com.", false, [4]string{"com", "example.com", "", ""}},
+		{"www.example.com.", false, [4]string{"com", "example.com", "www.example.com", ""}},
+		{"a.www.example.com.", false, [4]string{"com", "example.com", "www.example.com", "a.www.example.com"}},
+		{"b.a.www.example.com.", false, [4]string{"com", "example.com", "www.example.com", "a.www.example.com"}},
+		{"com.", true, [4]string{"com", "com.", "com.", "com."}},
+		{"example.com.", true, [4]string{"com", "example.com", "example.com.", "example.com."}},
+		{"www.example.com.", true, [4]string{"com", "example.com", "www.example.com", "www.example.com."}},
+		{"a.www.example.com.", true, [4]string{"com", "example.com", "www.example.com", "a.www.example.com"}},
+		{"b.a.www.example.com.", true, [4]string{"com", "example.com", "www.example.com", "a.www.example.com"}},
+	}
+	for _, tc := range testcases {
+		dt := newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery(tc.qname, dns.TypeA))
+		data, err := dtap.FlatDnstap(dt, &dtap.FlatConfig{LegacyLabels: tc.legacy})
+		assert.NoError(t, err)
+		got := [4]string{data.TopLevelDomainName, data.SecondLevelDomainName, data.ThirdLevelDomainName, data.FourthLevelDomainName}
+		assert.Equal(t, tc.labels, got, "%s legacy: %v", tc.qname, tc.legacy)
+	}
+}
+
+func TestFlatDnstapIdempotencyKey(t *testing.T) {
+	q := newTestQuery("www.example.com.", dns.TypeA)
+	dt := newTestDnstap(t, dnstap.Message_CLIENT_QUERY, q)
+
+	data, err := dtap.FlatDnstap(dt, &dtap.FlatConfig{})
+	assert.NoError(t, err)
+	assert.Equal(t, "", data.DocID)
+	assert.NotContains(t, data.ToMapString(), "doc_id")
+
+	opt := &dtap.FlatConfig{IdempotencyKey: true}
+	data, err = dtap.FlatDnstap(dt, opt)
+	assert.NoError(t, err)
+	assert.Len(t, data.DocID, 32)
+	assert.Equal(t, data.DocID, data.ToMapString()["doc_id"])
+
+	again, err := dtap.FlatDnstap(dt, opt)
+	assert.NoError(t, err)
+	assert.Equal(t, data.DocID, again.DocID)
+
+	// response of same query is another record
+	res, err := dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, newTestResponse(q)), opt)
+	assert.NoError(t, err)
+	assert.NotEqual(t, data.DocID, res.DocID)
+
+	// estimated response time doesn't change id
+	dt = newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, newTestResponse(q))
+	dt.Message.ResponseTimeSec = nil
+	dt.Message.ResponseTimeNsec = nil
+	res, err = dtap.FlatDnstap(dt, opt)
+	assert.NoError(t, err)
+	opt.SetNow(func() time.Time { return time.Now().Add(time.Hour) })
+	again, err = dtap.FlatDnstap(dt, opt)
+	assert.NoError(t, err)
+	assert.Equal(t, res.DocID, again.DocID)
+
+	q.Question = append(q.Question, dns.Question{Name: "www.example.net.", Qtype: dns.TypeA, Qclass: dns.ClassINET})
+	opt.ExplodeQuestions = true
+	records, err := dtap.FlatDnstapRecords(newTestDnstap(t, dnstap.Message_CLIENT_QUERY, q), opt)
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+	assert.NotEqual(t, records[0].DocID, records[1].DocID)
+}
+
+func TestFlatDnstapLatency(t *testing.T) {
+	q := newTestQuery("www.example.com.", dns.TypeA)
+	data, err := dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_CLIENT_QUERY, q), &dtap.FlatConfig{})
+	assert.NoError(t, err)
+	assert.Nil(t, data.LatencyMs)
+
+	dt := newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, newTestResponse(q))
+	dt.Message.QueryTimeNsec = proto.Uint32(750000000)
+	data, err = dtap.FlatDnstap(dt, &dtap.FlatConfig{})
+	assert.NoError(t, err)
+	assert.Equal(t, 250.0, *data.LatencyMs)
+
+	dt.Message.ResponseTimeSec = nil
+	dt.Message.ResponseTimeNsec = nil
+	data, err = dtap.FlatDnstap(dt, &dtap.FlatConfig{})
+	assert.NoError(t, err)
+	assert.Nil(t, data.LatencyMs)
+}
+
+func TestTrimFlatRecord(t *testing.T) {
+	opt := &dtap.FlatConfig{}
+	newData := func() *dtap.DnstapFlatT {
+		dt := newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("www.example.com.", dns.TypeA))
+		dt.Extra = bytes.Repeat([]byte("x"), 1000)
+		data, err := dtap.FlatDnstap(dt, opt)
+		assert.NoError(t, err)
+		return data
+	}
+	data := newData()
+	ok, err := dtap.TrimFlatRecord(data, opt, 4096)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.False(t, data.RecordTrimmed)
+	assert.Len(t, data.Extra, 1000)
+
+	ok, err = dtap.TrimFlatRecord(data, opt, 800)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, data.RecordTrimmed)
+	assert.Equal(t, "", data.Extra)
+	assert.Equal(t, "www.example.com.", data.Qname)
+	bs, err := dtap.MarshalFlatJSON(data, opt)
+	assert.NoError(t, err)
+	assert.True(t, len(bs) <= 800)
+	assert.Contains(t, string(bs), `"record_trimmed":true`)
+
+	data = newData()
+	ok, err = dtap.TrimFlatRecord(data, opt, 10)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.True(t, data.RecordTrimmed)
+}
+
+func TestFlatDnstapTXTRecords(t *testing.T) {
+	q := newTestQuery("example.com.", dns.TypeTXT)
+	res := newTestResponse(q,
+		`example.com. 300 IN TXT "v=spf1 include:_spf.example.net -all"`,
+		`example.com. 300 IN TXT "v=DKIM1; k=rsa; " "p=MIGfMA0GCSqGSIb3"`,
+		"example.com. 300 IN A 192.0.2.1",
+	)
+	dt := newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, res)
+
+	data, err := dtap.FlatDnstap(dt, &dtap.FlatConfig{})
+	assert.NoError(t, err)
+	assert.Nil(t, data.TxtRecords)
+
+	data, err = dtap.FlatDnstap(dt, &dtap.FlatConfig{AlwaysIncludeTXT: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"v=spf1 include:_spf.example.net -all",
+		"v=DKIM1; k=rsa; p=MIGfMA0GCSqGSIb3",
+	}, data.TxtRecords)
+	assert.Equal(t, `["v=spf1 include:_spf.example.net -all","v=DKIM1; k=rsa; p=MIGfMA0GCSqGSIb3"]`, data.ToMapString()["txt_records"])
+}
+
+func TestFlatDnstapParseBoth(t *testing.T) {
+	q := newTestQuery("www.example.com.", dns.TypeA)
+	res := newTestResponse(q, "www.example.com. 300 IN A 192.0.2.1")
+	res.Rcode = dns.RcodeNameError
+	// question section stripped
+	res.Question = nil
+	dt := newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, res)
+	bs, err := q.Pack()
+	assert.NoError(t, err)
+	dt.Message.QueryMessage = bs
+
+	data, err := dtap.FlatDnstap(dt, &dtap.FlatConfig{})
+	assert.NoError(t, err)
+	assert.Equal(t, "NOERROR", data.Rcode)
+
+	data, err = dtap.FlatDnstap(dt, &dtap.FlatConfig{ParseBoth: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "NXDOMAIN", data.Rcode)
+	assert.Equal(t, len(dt.Message.ResponseMessage), data.MessageSize)
+	assert.Equal(t, "www.example.com.", data.Qname)
+	assert.Equal(t, "A", data.Qtype)
+}
+
+func TestFlatDnstapRecordsSplitCombined(t *testing.T) {
+	q := newTestQuery("www.example.com.", dns.TypeA)
+	res := newTestResponse(q, "www.example.com. 300 IN A 192.0.2.1")
+	res.Rcode = dns.RcodeNameError
+	dt := newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, res)
+	bs, err := q.Pack()
+	assert.NoError(t, err)
+	dt.Message.QueryMessage = bs
+
+	records, err := dtap.FlatDnstapRecords(dt, &dtap.FlatConfig{SplitCombined: true})
+	assert.NoError(t, err)
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, "CLIENT_QUERY", records[0].Type)
+		assert.Equal(t, records[0].QueryTime, records[0].Timestamp)
+		assert.Equal(t, len(bs), records[0].MessageSize)
+		assert.Equal(t, "NOERROR", records[0].Rcode)
+		assert.Nil(t, records[0].LatencyMs)
+
+		assert.Equal(t, "CLIENT_RESPONSE", records[1].Type)
+		assert.Equal(t, records[1].ResponseTime, records[1].Timestamp)
+		assert.NotEqual(t, records[0].Timestamp, records[1].Timestamp)
+		assert.Equal(t, len(dt.Message.ResponseMessage), records[1].MessageSize)
+		assert.Equal(t, "NXDOMAIN", records[1].Rcode)
+		if assert.NotNil(t, records[1].LatencyMs) {
+			assert.Equal(t, 1000.0, *records[1].LatencyMs)
+		}
+	}
+	// the message is not changed
+	assert.Equal(t, dnstap.Message_CLIENT_RESPONSE, dt.Message.GetType())
+	assert.NotNil(t, dt.Message.QueryMessage)
+
+	// without both payloads
+	dt = newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, res)
+	records, err = dtap.FlatDnstapRecords(dt, &dtap.FlatConfig{SplitCombined: true})
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+}
+
+func TestFlatDnstapNSID(t *testing.T) {
+	q := newTestQuery("www.example.com.", dns.TypeA)
+	testcases := []struct {
+		nsid     string
+		expected string
+	}{
+		{hex.EncodeToString([]byte("ns1.tokyo")), "ns1.tokyo"},
+		{"00ff10", "00ff10"},
+		{"", ""},
+	}
+	for _, tc := range testcases {
+		res := newTestResponse(q)
+		res.SetEdns0(1232, false)
+		if tc.nsid != "" {
+			optrr := res.IsEdns0()
+			optrr.Option = append(optrr.Option, &dns.EDNS0_NSID{Code: dns.EDNS0NSID, Nsid: tc.nsid})
+		}
+		dt := newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, res)
+
+		data, err := dtap.FlatDnstap(dt, &dtap.FlatConfig{})
+		assert.NoError(t, err)
+		assert.Equal(t, "", data.Nsid)
+
+		data, err = dtap.FlatDnstap(dt, &dtap.FlatConfig{EnableNSID: true})
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expected, data.Nsid, tc.nsid)
+	}
+}
+
+func TestFlatDnstapCanonicalEndpoints(t *testing.T) {
+	q := newTestQuery("www.example.com.", dns.TypeA)
+	// addresses are masked as query_address and response_address.
+	testcases := []struct {
+		dt               *dnstap.Dnstap
+		src, dst         string
+		srcPort, dstPort uint32
+	}{
+		{newTestDnstap(t, dnstap.Message_CLIENT_QUERY, q), "192.0.2.0", "198.51.100.0", 53000, 53},
+		{newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, newTestResponse(q)), "198.51.100.0", "192.0.2.0", 53, 53000},
+	}
+	for _, tc := range testcases {
+		tc.dt.Message.ResponseAddress = net.ParseIP("198.51.100.53").To4()
+		tc.dt.Message.ResponsePort = proto.Uint32(53)
+		data, err := dtap.FlatDnstap(tc.dt, &dtap.FlatConfig{CanonicalEndpoints: true})
+		assert.NoError(t, err)
+		assert.Equal(t, tc.src, data.SrcAddress.String())
+		assert.Equal(t, tc.srcPort, data.SrcPort)
+		assert.Equal(t, tc.dst, data.DstAddress.String())
+		assert.Equal(t, tc.dstPort, data.DstPort)
+		m := data.ToMapString()
+		assert.Equal(t, tc.src, m["src_address"])
+		assert.Equal(t, int64(tc.dstPort), m["dst_port"])
+		// direction fields are kept
+		assert.Equal(t, "192.0.2.0", m["query_address"])
+	}
+
+	data, err := dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_CLIENT_QUERY, q), &dtap.FlatConfig{})
+	assert.NoError(t, err)
+	assert.NotContains(t, data.ToMapString(), "src_address")
+}
+
+func TestFlatDnstapMessageTypeShort(t *testing.T) {
+	codes := map[string]bool{}
+	for v, name := range dnstap.Message_Type_name {
+		code := dtap.MessageTypeShort(dnstap.Message_Type(v))
+		assert.Len(t, code, 2, name)
+		assert.Equal(t, strings.ToLower(name[:1]), code[:1], name)
+		codes[code] = true
+	}
+	assert.Len(t, codes, 14)
+
+	q := newTestQuery("www.example.com.", dns.TypeA)
+	opt := &dtap.FlatConfig{IncludeMessageTypeShort: true}
+	data, err := dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_FORWARDER_QUERY, q), opt)
+	assert.NoError(t, err)
+	m := data.ToMapString()
+	assert.Equal(t, false, m["is_response"])
+	assert.Equal(t, "fq", m["message_type_short"])
+	data, err = dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_AUTH_RESPONSE, newTestResponse(q)), opt)
+	assert.NoError(t, err)
+	m = data.ToMapString()
+	assert.Equal(t, true, m["is_response"])
+	assert.Equal(t, "ar", m["message_type_short"])
+
+	data, err = dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_CLIENT_QUERY, q), &dtap.FlatConfig{})
+	assert.NoError(t, err)
+	assert.NotContains(t, data.ToMapString(), "is_response")
+}
+
+func TestFlatDnstapExtendedRcode(t *testing.T) {
+	q := newTestQuery("www.example.com.", dns.TypeA)
+	testcases := []struct {
+		rcode    int
+		version  uint8
+		expected string
+	}{
+		{dns.RcodeNameError, 0, "NXDOMAIN"},
+		{dns.RcodeBadVers, 1, "BADVERS"},
+		{dns.RcodeBadCookie, 0, "BADCOOKIE"},
+		{0xfff, 0, "4095"},
+	}
+	for _, tc := range testcases {
+		res := newTestResponse(q)
+		res.Rcode = tc.rcode
+		res.SetEdns0(1232, false)
+		res.IsEdns0().SetVersion(tc.version)
+		dt := newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, res)
+
+		data, err := dtap.FlatDnstap(dt, &dtap.FlatConfig{})
+		assert.NoError(t, err)
+		assert.Nil(t, data.EdnsVersion)
+		assert.Equal(t, "", data.ExtendedRcode)
+
+		data, err = dtap.FlatDnstap(dt, &dtap.FlatConfig{EnableExtendedRcode: true})
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expected, data.ExtendedRcode)
+		assert.Equal(t, tc.expected, data.ToMapString()["extended_rcode"])
+		if assert.NotNil(t, data.EdnsVersion) {
+			assert.Equal(t, int(tc.version), *data.EdnsVersion)
+		}
+	}
+
+	// without OPT
+	res := newTestResponse(q)
+	res.Rcode = dns.RcodeServerFailure
+	data, err := dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, res), &dtap.FlatConfig{EnableExtendedRcode: true})
+	assert.NoError(t, err)
+	assert.Nil(t, data.EdnsVersion)
+	assert.NotContains(t, data.ToMapString(), "extended_rcode")
+}
+
+func TestFlatDnstapCnameChain(t *testing.T) {
+	q := newTestQuery("www.example.com.", dns.TypeA)
+	res := newTestResponse(q,
+		"www.example.com. 300 IN CNAME a.example.net.",
+		"a.example.net. 300 IN CNAME b.cdn.example.org.",
+		"b.cdn.example.org. 300 IN A 192.0.2.1")
+	data, err := dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, res), &dtap.FlatConfig{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a.example.net.", "b.cdn.example.org."}, data.CnameChain)
+	assert.Equal(t, "b.cdn.example.org.", data.FinalName)
+	assert.Equal(t, `["a.example.net.","b.cdn.example.org."]`, data.ToMapString()["cname_chain"])
+	assert.Equal(t, "b.cdn.example.org.", data.ToMapString()["final_name"])
+
+	data, err = dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, newTestResponse(q, "www.example.com. 300 IN A 192.0.2.1")), &dtap.FlatConfig{})
+	assert.NoError(t, err)
+	assert.Nil(t, data.CnameChain)
+	assert.Empty(t, data.FinalName)
+	_, ok := data.ToMapString()["cname_chain"]
+	assert.False(t, ok)
+}
+
+func TestFlatDnstapUseECSForClient(t *testing.T) {
+	newECSQuery := func(addr string, prefix uint8) *dns.Msg {
+		q := newTestQuery("www.example.com.", dns.TypeA)
+		q.SetEdns0(1232, false)
+		ecs := &dns.EDNS0_SUBNET{
+			Code:          dns.EDNS0SUBNET,
+			Family:        1,
+			SourceNetmask: prefix,
+			Address:       net.ParseIP(addr).To4(),
+		}
+		q.IsEdns0().Option = append(q.IsEdns0().Option, ecs)
+		return q
+	}
+	testcases := []struct {
+		q        *dns.Msg
+		expected string
+	}{
+		// ECS prefix is shorter than IPv4Mask
+		{newECSQuery("198.51.100.77", 20), "198.51.96.0"},
+		// IPv4Mask is shorter than ECS prefix
+		{newECSQuery("198.51.100.77", 32), "198.51.100.0"},
+		// client opted out
+		{newECSQuery("0.0.0.0", 0), "192.0.2.0"},
+		{newTestQuery("www.example.com.", dns.TypeA), "192.0.2.0"},
+	}
+	for _, tc := range testcases {
+		dt := newTestDnstap(t, dnstap.Message_CLIENT_QUERY, tc.q)
+		data, err := dtap.FlatDnstap(dt, &dtap.FlatConfig{})
+		assert.NoError(t, err)
+		assert.Nil(t, data.ClientAddress)
+
+		data, err = dtap.FlatDnstap(dt, &dtap.FlatConfig{UseECSForClient: true})
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expected, data.ClientAddress.String())
+		assert.Equal(t, tc.expected, data.ToMapString()["client_address"])
+	}
+}
+
+func TestFlatDnstapEDNSOptions(t *testing.T) {
+	q := newTestQuery("www.example.com.", dns.TypeA)
+	data, err := dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_CLIENT_QUERY, q), &dtap.FlatConfig{EnableEDNSOptions: true})
+	assert.NoError(t, err)
+	assert.Nil(t, data.EdnsOptions)
+	_, ok := data.ToMapString()["edns_options"]
+	assert.False(t, ok)
+
+	q.SetEdns0(1232, false)
+	data, err = dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_CLIENT_QUERY, q), &dtap.FlatConfig{EnableEDNSOptions: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []dtap.EdnsOption{}, data.EdnsOptions)
+	assert.Equal(t, "[]", data.ToMapString()["edns_options"])
+
+	optrr := q.IsEdns0()
+	optrr.Option = append(optrr.Option,
+		&dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: "0102030405060708"},
+		&dns.EDNS0_LOCAL{Code: 65001, Data: []byte{1}},
+		&dns.EDNS0_TCP_KEEPALIVE{Code: dns.EDNS0TCPKEEPALIVE},
+	)
+	dt := newTestDnstap(t, dnstap.Message_CLIENT_QUERY, q)
+	data, err = dtap.FlatDnstap(dt, &dtap.FlatConfig{})
+	assert.NoError(t, err)
+	assert.Nil(t, data.EdnsOptions)
+
+	data, err = dtap.FlatDnstap(dt, &dtap.FlatConfig{EnableEDNSOptions: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []dtap.EdnsOption{
+		{Code: 10, Name: "COOKIE"},
+		{Code: 65001},
+		{Code: 11, Name: "KEEPALIVE"},
+	}, data.EdnsOptions)
+	assert.Equal(t, `[{"code":10,"name":"COOKIE"},{"code":65001},{"code":11,"name":"KEEPALIVE"}]`, data.ToMapString()["edns_options"])
+}
+
+func TestFlatDnstapSocketFamilyAddress(t *testing.T) {
+	v4 := net.ParseIP("192.0.2.1").To4()
+	mapped := net.ParseIP("192.0.2.1").To16()
+	padded := append(append([]byte{}, v4...), make([]byte, 12)...)
+	v6 := net.ParseIP("2001:db8:1:2::1")
+	testcases := []struct {
+		family   *dnstap.SocketFamily
+		addr     []byte
+		expected string
+	}{
+		{nil, v4, "192.0.2.0"},
+		{nil, mapped, "::"},
+		{nil, v6, "2001:db8:1::"},
+		{dnstap.SocketFamily_INET.Enum(), v4, "192.0.2.0"},
+		{dnstap.SocketFamily_INET.Enum(), mapped, "192.0.2.0"},
+		{dnstap.SocketFamily_INET.Enum(), padded, "192.0.2.0"},
+		{dnstap.SocketFamily_INET6.Enum(), v6, "2001:db8:1::"},
+		{dnstap.SocketFamily_INET6.Enum(), v4, "::"},
+	}
+	for _, tc := range testcases {
+		dt := newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("www.example.com.", dns.TypeA))
+		dt.Message.SocketFamily = tc.family
+		dt.Message.QueryAddress = tc.addr
+		dt.Message.ResponseAddress = tc.addr
+		data, err := dtap.FlatDnstap(dt, &dtap.FlatConfig{})
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expected, data.QueryAddress.String(), "%v %x", tc.family, tc.addr)
+		assert.Equal(t, tc.expected, data.ResponseAddress.String(), "%v %x", tc.family, tc.addr)
+	}
+}
+
+func TestFlatDnstapDNSCookie(t *testing.T) {
+	testcases := []struct {
+		cookie string
+		client string
+		server string
+	}{
+		{"0102030405060708", "0102030405060708", ""},
+		{"0102030405060708A1A2A3A4A5A6A7A8", "0102030405060708", "a1a2a3a4a5a6a7a8"},
+		{"", "", ""},
+	}
+	for _, tc := range testcases {
+		q := newTestQuery("www.example.com.", dns.TypeA)
+		q.SetEdns0(1232, false)
+		if tc.cookie != "" {
+			q.IsEdns0().Option = append(q.IsEdns0().Option, &dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: tc.cookie})
+		}
+		dt := newTestDnstap(t, dnstap.Message_CLIENT_QUERY, q)
+		data, err := dtap.FlatDnstap(dt, &dtap.FlatConfig{})
+		assert.NoError(t, err)
+		assert.Empty(t, data.ClientCookie)
+
+		data, err = dtap.FlatDnstap(dt, &dtap.FlatConfig{IncludeDNSCookie: true})
+		assert.NoError(t, err)
+		assert.Equal(t, tc.client, data.ClientCookie)
+		assert.Equal(t, tc.server, data.ServerCookie)
+		_, ok := data.ToMapString()["server_cookie"]
+		assert.Equal(t, tc.server != "", ok)
+	}
+}
+
+func TestFlatDnstapEDNSPadding(t *testing.T) {
+	q := newTestQuery("www.example.com.", dns.TypeA)
+	q.SetEdns0(1232, false)
+	dt := newTestDnstap(t, dnstap.Message_CLIENT_QUERY, q)
+	data, err := dtap.FlatDnstap(dt, &dtap.FlatConfig{})
+	assert.NoError(t, err)
+	assert.Nil(t, data.EdnsPaddingSize)
+	_, ok := data.ToMapString()["edns_padding_size"]
+	assert.False(t, ok)
+
+	for _, size := range []int{0, 128} {
+		q := newTestQuery("www.example.com.", dns.TypeA)
+		q.SetEdns0(1232, false)
+		q.IsEdns0().Option = append(q.IsEdns0().Option, &dns.EDNS0_PADDING{Padding: make([]byte, size)})
+		dt := newTestDnstap(t, dnstap.Message_CLIENT_QUERY, q)
+		data, err := dtap.FlatDnstap(dt, &dtap.FlatConfig{})
+		assert.NoError(t, err)
+		if assert.NotNil(t, data.EdnsPaddingSize) {
+			assert.Equal(t, size, *data.EdnsPaddingSize)
+		}
+		assert.Equal(t, int64(size), data.ToMapString()["edns_padding_size"])
+	}
+}
+
+func TestFlatDnstapKeepalive(t *testing.T) {
+	testcases := []struct {
+		options   []dns.EDNS0
+		keepalive interface{}
+		expire    interface{}
+	}{
+		{nil, nil, nil},
+		{[]dns.EDNS0{&dns.EDNS0_LOCAL{Code: dns.EDNS0TCPKEEPALIVE}, &dns.EDNS0_LOCAL{Code: dns.EDNS0EXPIRE}}, int64(0), int64(0)},
+		{[]dns.EDNS0{&dns.EDNS0_LOCAL{Code: dns.EDNS0TCPKEEPALIVE, Data: []byte{0x01, 0x2c}}}, int64(30000), nil},
+		{[]dns.EDNS0{&dns.EDNS0_LOCAL{Code: dns.EDNS0EXPIRE, Data: []byte{0x00, 0x09, 0x3a, 0x80}}}, nil, int64(604800)},
+	}
+	for n, tc := range testcases {
+		res := newTestResponse(newTestQuery("example.com.", dns.TypeSOA))
+		res.SetEdns0(1232, false)
+		res.IsEdns0().Option = tc.options
+		dt := newTestDnstap(t, dnstap.Message_AUTH_RESPONSE, res)
+
+		data, err := dtap.FlatDnstap(dt, &dtap.FlatConfig{})
+		assert.NoError(t, err)
+		assert.Nil(t, data.EdnsKeepalive, n)
+		assert.Nil(t, data.EdnsExpire, n)
+
+		data, err = dtap.FlatDnstap(dt, &dtap.FlatConfig{EnableKeepalive: true})
+		assert.NoError(t, err)
+		m := data.ToMapString()
+		assert.Equal(t, tc.keepalive, m["edns_keepalive"], n)
+		assert.Equal(t, tc.expire, m["edns_expire"], n)
+	}
+}
+
+func TestFlatDnstapSocketCodes(t *testing.T) {
+	dt := newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("www.example.com.", dns.TypeA))
+	data, err := dtap.FlatDnstap(dt, &dtap.FlatConfig{})
+	assert.NoError(t, err)
+	_, ok := data.ToMapString()["socket_family_code"]
+	assert.False(t, ok)
+
+	dt.Message.SocketFamily = dnstap.SocketFamily_INET6.Enum()
+	dt.Message.SocketProtocol = dnstap.SocketProtocol_TCP.Enum()
+	data, err = dtap.FlatDnstap(dt, &dtap.FlatConfig{IncludeSocketCodes: true})
+	assert.NoError(t, err)
+	m := data.ToMapString()
+	assert.Equal(t, "INET6", m["socket_family"])
+	assert.Equal(t, int32(2), m["socket_family_code"])
+	assert.Equal(t, "TCP", m["socket_protocol"])
+	assert.Equal(t, int32(2), m["socket_protocol_code"])
+}
+
+func TestFlatDnstapTypeNames(t *testing.T) {
+	config := &dtap.FlatConfig{TypeNames: map[string]string{"client_query": "cq", "CLIENT_RESPONSE": "cr"}}
+	assert.Nil(t, config.Validate())
+	q := newTestQuery("www.example.com.", dns.TypeA)
+	data, err := dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_CLIENT_QUERY, q), config)
+	assert.NoError(t, err)
+	assert.Equal(t, "cq", data.ToMapString()["type"])
+
+	// unmapped types use the default name.
+	data, err = dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_RESOLVER_QUERY, q), config)
+	assert.NoError(t, err)
+	assert.Equal(t, "RESOLVER_QUERY", data.Type)
+
+	// renamed responses are still responses for filters.
+	data, err = dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, newTestResponse(q)), config)
+	assert.NoError(t, err)
+	assert.Equal(t, "cr", data.Type)
+	assert.True(t, (&dtap.OutputFluentConfig{MinAnswers: 1, Flat: *config}).SkipAnswers(data))
+	data.LatencyMs = nil
+	assert.True(t, (&dtap.OutputFluentConfig{MinLatencyMs: 1, Flat: *config}).SkipLatency(data))
+
+	config = &dtap.FlatConfig{TypeNames: map[string]string{"CLIENT_QUERIES": "cq", "CLIENT_RESPONSE": ""}}
+	assert.NotNil(t, config.Validate())
+}
+
+func TestFlatDnstapAnswerStats(t *testing.T) {
+	q := newTestQuery("www.example.com.", dns.TypeANY)
+	res := newTestResponse(q,
+		"www.example.com. 300 IN A 192.0.2.1",
+		"www.example.com. 300 IN A 192.0.2.2",
+		"www.example.com. 300 IN AAAA 2001:db8::1",
+		"www.example.com. 300 IN TXT \"v=spf1 -all\"")
+	dt := newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, res)
+
+	data, err := dtap.FlatDnstap(dt, &dtap.FlatConfig{})
+	assert.NoError(t, err)
+	assert.Nil(t, data.AnswerIPCount)
+
+	data, err = dtap.FlatDnstap(dt, &dtap.FlatConfig{AnswerStats: true})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, *data.AnswerIPCount)
+	assert.False(t, data.LargeResponse)
+	assert.Equal(t, int64(3), data.ToMapString()["answer_ip_count"])
+
+	data, err = dtap.FlatDnstap(dt, &dtap.FlatConfig{AnswerStats: true, LargeResponseBytes: 100})
+	assert.NoError(t, err)
+	assert.True(t, data.LargeResponse)
+
+	data, err = dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_CLIENT_QUERY, q), &dtap.FlatConfig{AnswerStats: true, LargeResponseBytes: 1})
+	assert.NoError(t, err)
+	assert.Nil(t, data.AnswerIPCount)
+	assert.False(t, data.LargeResponse)
+}
+
+func TestFlatDnstapCorrelationID(t *testing.T) {
+	q := newTestQuery("www.example.com.", dns.TypeA)
+	opt := &dtap.FlatConfig{IncludeCorrelationID: true}
+	query, err := dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_CLIENT_QUERY, q), opt)
+	assert.NoError(t, err)
+	response, err := dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, newTestResponse(q)), opt)
+	assert.NoError(t, err)
+	assert.Len(t, query.CorrelationID, 32)
+	assert.Equal(t, query.CorrelationID, response.CorrelationID)
+	assert.Equal(t, query.CorrelationID, query.ToMapString()["correlation_id"])
+
+	// other client address in the same masked network
+	dt := newTestDnstap(t, dnstap.Message_CLIENT_QUERY, q)
+	dt.Message.QueryAddress = net.ParseIP("192.0.2.2").To4()
+	other, err := dtap.FlatDnstap(dt, opt)
+	assert.NoError(t, err)
+	assert.NotEqual(t, query.CorrelationID, other.CorrelationID)
+
+	data, err := dtap.FlatDnstap(dt, &dtap.FlatConfig{})
+	assert.NoError(t, err)
+	assert.Empty(t, data.CorrelationID)
+}
+
+func TestFlatDnstapDecodePTR(t *testing.T) {
+	testcases := []struct {
+		qname    string
+		expected string
+	}{
+		{"1.2.0.192.in-addr.arpa.", "192.0.2.0"},
+		{"1.2.0.192.IN-ADDR.ARPA.", "192.0.2.0"},
+		{"b.a.9.8.7.6.5.0.4.0.0.0.3.0.0.0.2.0.0.0.1.0.0.0.0.0.0.0.1.2.3.4.ip6.arpa.", "4321:0:1::"},
+		// partial names
+		{"2.0.192.in-addr.arpa.", ""},
+		{"0.0.0.0.1.2.3.4.ip6.arpa.", ""},
+		{"300.2.0.192.in-addr.arpa.", ""},
+		{"www.example.com.", ""},
+	}
+	for _, tc := range testcases {
+		dt := newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery(tc.qname, dns.TypePTR))
+		data, err := dtap.FlatDnstap(dt, &dtap.FlatConfig{})
+		assert.NoError(t, err)
+		assert.Nil(t, data.PtrTarget)
+
+		data, err = dtap.FlatDnstap(dt, &dtap.FlatConfig{DecodePTR: true})
+		assert.NoError(t, err)
+		if tc.expected == "" {
+			assert.Nil(t, data.PtrTarget, tc.qname)
+			continue
+		}
+		assert.Equal(t, tc.expected, data.PtrTarget.String(), tc.qname)
+		assert.Equal(t, tc.expected, data.ToMapString()["ptr_target"])
+	}
+}
+
+func TestFlatDnstapIncludeAllSections(t *testing.T) {
+	q := newTestQuery("www.example.com.", dns.TypeA)
+	m := newTestResponse(q, "www.example.com. 300 IN A 192.0.2.10", "www.example.com. 300 IN A 192.0.2.11")
+	ns, _ := dns.NewRR("example.com. 3600 IN NS ns.example.com.")
+	glue, _ := dns.NewRR("ns.example.com. 3600 IN A 192.0.2.53")
+	m.Ns = append(m.Ns, ns)
+	m.Extra = append(m.Extra, glue)
+	m.SetEdns0(1232, false)
+	dt := newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, m)
+
+	data, err := dtap.FlatDnstap(dt, &dtap.FlatConfig{})
+	assert.NoError(t, err)
+	assert.Nil(t, data.Records)
+
+	data, err = dtap.FlatDnstap(dt, &dtap.FlatConfig{IncludeAllSections: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []dtap.RRRecord{
+		{Section: "answer", Name: "www.example.com.", Type: "A", TTL: 300, Rdata: "192.0.2.10"},
+		{Section: "answer", Name: "www.example.com.", Type: "A", TTL: 300, Rdata: "192.0.2.11"},
+		{Section: "authority", Name: "example.com.", Type: "NS", TTL: 3600, Rdata: "ns.example.com."},
+		{Section: "additional", Name: "ns.example.com.", Type: "A", TTL: 3600, Rdata: "192.0.2.53"},
+	}, data.Records)
+	assert.Contains(t, data.ToMapString()["records"], `"section":"authority"`)
+
+	data, err = dtap.FlatDnstap(dt, &dtap.FlatConfig{IncludeAllSections: true, MaxAnswers: 3})
+	assert.NoError(t, err)
+	if assert.Len(t, data.Records, 3) {
+		assert.Equal(t, "authority", data.Records[2].Section)
+	}
+}
+
+func TestFlatDnstapQnameBinary(t *testing.T) {
+	testcases := []struct {
+		qname    string
+		expected string
+		binary   bool
+	}{
+		{"www.example.com.", "www.example.com.", false},
+		{`a\.b.example.com.`, `a\.b.example.com.`, false},
+		{`a\000b.example.com.`, `a\000b.example.com.`, true},
+		{"a\x01b.example.com.", `a\001b.example.com.`, true},
+		{`\255.example.com.`, `\255.example.com.`, true},
+	}
+	for _, tc := range testcases {
+		dt := newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery(tc.qname, dns.TypeA))
+		data, err := dtap.FlatDnstap(dt, &dtap.FlatConfig{})
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expected, data.Qname, tc.qname)
+		assert.Equal(t, tc.binary, data.QnameBinary, tc.qname)
+		assert.Empty(t, data.QnameRaw)
+		assert.Equal(t, "example.com", data.SecondLevelDomainName)
+
+		data, err = dtap.FlatDnstap(dt, &dtap.FlatConfig{IncludeWireDebug: true})
+		assert.NoError(t, err)
+		if tc.binary {
+			raw, err := base64.StdEncoding.DecodeString(data.QnameRaw)
+			assert.NoError(t, err)
+			name, _, err := dns.UnpackDomainName(raw, 0)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, name)
+			assert.Equal(t, true, data.ToMapString()["qname_binary"])
+		} else {
+			assert.Empty(t, data.QnameRaw)
+		}
+	}
+}
+
+func TestFlatDnstapSectionCounts(t *testing.T) {
+	q := newTestQuery("www.example.com.", dns.TypeA)
+	m := newTestResponse(q, "www.example.com. 300 IN A 192.0.2.10", "www.example.com. 300 IN A 192.0.2.11")
+	ns, _ := dns.NewRR("example.com. 3600 IN NS ns.example.com.")
+	m.Ns = append(m.Ns, ns)
+	m.SetEdns0(1232, false)
+
+	data, err := dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, m), &dtap.FlatConfig{})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 2, 1, 1}, []int{data.Qdcount, data.Ancount, data.Nscount, data.Arcount})
+	assert.Equal(t, int64(2), data.ToMapString()["ancount"])
+
+	data, err = dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_CLIENT_QUERY, new(dns.Msg)), &dtap.FlatConfig{})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{0, 0, 0, 0}, []int{data.Qdcount, data.Ancount, data.Nscount, data.Arcount})
+}
+
+func TestFlatDnstapSubdomainEntropy(t *testing.T) {
+	testcases := []struct {
+		qname    string
+		entropy  float64
+		suspect  bool
+		hasValue bool
+	}{
+		{"www.example.com.", 0, false, true},
+		{"abcd.example.com.", 2, false, true},
+		{"x7k2qp9z4mwr.example.com.", math.Log2(12), true, true},
+		{"example.com.", 0, false, false},
+	}
+	for _, tc := range testcases {
+		dt := newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery(tc.qname, dns.TypeA))
+		data, err := dtap.FlatDnstap(dt, &dtap.FlatConfig{})
+		assert.NoError(t, err)
+		assert.Nil(t, data.SubdomainEntropy)
+
+		data, err = dtap.FlatDnstap(dt, &dtap.FlatConfig{SubdomainEntropy: true})
+		assert.NoError(t, err)
+		if !tc.hasValue {
+			assert.Nil(t, data.SubdomainEntropy, tc.qname)
+			continue
+		}
+		if assert.NotNil(t, data.SubdomainEntropy, tc.qname) {
+			assert.InDelta(t, tc.entropy, *data.SubdomainEntropy, 0.0001, tc.qname)
+		}
+		assert.Equal(t, tc.suspect, data.RandomSubdomain, tc.qname)
+	}
+
+	dt := newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("abcd.example.com.", dns.TypeA))
+	data, err := dtap.FlatDnstap(dt, &dtap.FlatConfig{SubdomainEntropy: true, RandomSubdomainThreshold: 1.5})
+	assert.NoError(t, err)
+	assert.True(t, data.RandomSubdomain)
+	assert.Equal(t, true, data.ToMapString()["random_subdomain_suspected"])
+}
+
+func TestFlatDnstapIncludeEpoch(t *testing.T) {
+	dt := newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("www.example.com.", dns.TypeA))
+	dt.Message.QueryTimeNsec = proto.Uint32(500000000)
+	data, err := dtap.FlatDnstap(dt, &dtap.FlatConfig{})
+	assert.NoError(t, err)
+	assert.Nil(t, data.TimestampEpoch)
+
+	data, err = dtap.FlatDnstap(dt, &dtap.FlatConfig{IncludeEpoch: true})
+	assert.NoError(t, err)
+	assert.Equal(t, 1546300800.5, data.TimestampEpoch)
+	assert.Equal(t, 1546300800.5, data.ToMapString()["timestamp_epoch"])
+
+	data, err = dtap.FlatDnstap(dt, &dtap.FlatConfig{IncludeEpoch: true, EpochUnit: "ns"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1546300800500000000), data.TimestampEpoch)
+
+	assert.NotNil(t, (&dtap.FlatConfig{EpochUnit: "ms"}).Validate())
+}
+
+func TestFlatDnstapExtraParser(t *testing.T) {
+	testcases := []struct {
+		extra    string
+		parser   string
+		expected map[string]interface{}
+		failed   bool
+	}{
+		{`{"site":"tokyo","rack":3}`, "json", map[string]interface{}{"site": "tokyo", "rack": float64(3)}, false},
+		{"site=tokyo, rack=3;role=edge", "kv", map[string]interface{}{"site": "tokyo", "rack": "3", "role": "edge"}, false},
+		{"site=tokyo rack", "kv", nil, true},
+		{"\xff\x00", "json", nil, true},
+		{"site=tokyo", "none", nil, false},
+	}
+	for _, tc := range testcases {
+		dt := newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("www.example.com.", dns.TypeA))
+		dt.Extra = []byte(tc.extra)
+		data, err := dtap.FlatDnstap(dt, &dtap.FlatConfig{ExtraParser: tc.parser})
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expected, data.ExtraParsed, tc.extra)
+		if tc.failed {
+			assert.Equal(t, base64.StdEncoding.EncodeToString(dt.Extra), data.Extra)
+			assert.Len(t, data.EnrichmentErrors, 1)
+			continue
+		}
+		assert.Equal(t, tc.extra, data.Extra)
+		assert.Empty(t, data.EnrichmentErrors)
+	}
+	assert.NotNil(t, (&dtap.FlatConfig{ExtraParser: "yaml"}).Validate())
+}
+
+func TestFlatDnstapAuthorityName(t *testing.T) {
+	zone := make([]byte, 256)
+	n, err := dns.PackDomainName("Example.COM.", zone, 0, nil, false)
+	assert.NoError(t, err)
+	testcases := []struct {
+		qname    string
+		aa       bool
+		expected *bool
+	}{
+		{"www.example.com.", true, proto.Bool(true)},
+		{"www.example.net.", true, proto.Bool(false)},
+		{"www.example.com.", false, nil},
+	}
+	for _, tc := range testcases {
+		res := newTestResponse(newTestQuery(tc.qname, dns.TypeA))
+		res.Authoritative = tc.aa
+		dt := newTestDnstap(t, dnstap.Message_AUTH_RESPONSE, res)
+		dt.Message.QueryZone = zone[:n]
+
+		data, err := dtap.FlatDnstap(dt, &dtap.FlatConfig{})
+		assert.NoError(t, err)
+		assert.Equal(t, "Example.COM.", data.AuthorityName)
+		assert.Equal(t, string(zone[:n]), data.ResponseZone)
+		assert.Equal(t, tc.expected, data.AuthoritativeForZone, tc.qname)
+	}
+
+	data, err := dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_AUTH_QUERY, newTestQuery("www.example.com.", dns.TypeA)), &dtap.FlatConfig{})
+	assert.NoError(t, err)
+	assert.Equal(t, "", data.AuthorityName)
+	assert.Nil(t, data.AuthoritativeForZone)
+}
+
+func TestFlatDnstapParseMode(t *testing.T) {
+	q := newTestQuery("www.example.com.", dns.TypeA)
+	res := newTestResponse(q, "www.example.com. 300 IN A 192.0.2.10", "www.example.com. 300 IN A 192.0.2.11")
+	res.Authoritative = true
+	res.Rcode = dns.RcodeNameError
+	dt := newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, res)
+
+	strict, err := dtap.FlatDnstap(dt, &dtap.FlatConfig{})
+	assert.NoError(t, err)
+	header, err := dtap.FlatDnstap(dt, &dtap.FlatConfig{ParseMode: "header_only"})
+	assert.NoError(t, err)
+	assert.Equal(t, strict.Qname, header.Qname)
+	assert.Equal(t, strict.Qtype, header.Qtype)
+	assert.Equal(t, "NXDOMAIN", header.Rcode)
+	assert.Equal(t, strict.Txid, header.Txid)
+	assert.True(t, header.AA)
+	assert.True(t, header.RD)
+	assert.Equal(t, 2, header.Ancount)
+	assert.Equal(t, strict.MessageSize, header.MessageSize)
+
+	// break the last answer
+	dt.Message.ResponseMessage = dt.Message.ResponseMessage[:len(dt.Message.ResponseMessage)-2]
+	_, err = dtap.FlatDnstap(dt, &dtap.FlatConfig{})
+	assert.Error(t, err)
+	lenient, err := dtap.FlatDnstap(dt, &dtap.FlatConfig{ParseMode: "lenient"})
+	assert.NoError(t, err)
+	assert.Equal(t, "www.example.com.", lenient.Qname)
+	assert.Len(t, lenient.EnrichmentErrors, 1)
+
+	assert.Error(t, (&dtap.FlatConfig{ParseMode: "fast"}).Validate())
+}
+
+func TestFlatDnstapPartialParse(t *testing.T) {
+	res := newTestResponse(newTestQuery("www.example.com.", dns.TypeA), "www.example.com. 300 IN A 192.0.2.10")
+	res.RecursionAvailable = true
+	dt := newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, res)
+	// make the answer name at 33 a compression pointer to itself.
+	wire := dt.Message.ResponseMessage
+	wire[33], wire[34] = 0xc0, 33
+
+	_, err := dtap.FlatDnstap(dt, &dtap.FlatConfig{})
+	assert.Error(t, err)
+	for _, mode := range []string{"strict", "lenient"} {
+		data, err := dtap.FlatDnstap(dt, &dtap.FlatConfig{ParseMode: mode, PartialParse: true})
+		assert.NoError(t, err, mode)
+		assert.Equal(t, "www.example.com.", data.Qname, mode)
+		assert.Equal(t, "A", data.Qtype, mode)
+		assert.Equal(t, "NOERROR", data.Rcode, mode)
+		assert.True(t, data.RA, mode)
+		assert.Len(t, data.EnrichmentErrors, 1, mode)
+		assert.Equal(t, true, data.ToMapString()["parse_partial"], mode)
+	}
+
+	data, err := dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, res), &dtap.FlatConfig{PartialParse: true})
+	assert.NoError(t, err)
+	assert.False(t, data.ParsePartial)
+
+	dt.Message.ResponseMessage = wire[:8]
+	_, err = dtap.FlatDnstap(dt, &dtap.FlatConfig{PartialParse: true})
+	assert.Error(t, err)
+}
+
+func TestFlatDnstapRecoverTruncatedCapture(t *testing.T) {
+	res := newTestResponse(newTestQuery("www.example.com.", dns.TypeA),
+		"www.example.com. 300 IN A 192.0.2.10",
+		"www.example.com. 300 IN A 192.0.2.11")
+	res.SetEdns0(4096, true)
+	dt := newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, res)
+	// cut in the rdata of the second answer, the OPT record is lost.
+	wire := dt.Message.ResponseMessage
+	dt.Message.ResponseMessage = wire[:len(wire)-11-2]
+
+	_, err := dtap.FlatDnstap(dt, &dtap.FlatConfig{})
+	assert.Error(t, err)
+	for _, mode := range []string{"strict", "lenient"} {
+		data, err := dtap.FlatDnstap(dt, &dtap.FlatConfig{ParseMode: mode, RecoverTruncatedCapture: true, AnswerStats: true})
+		assert.NoError(t, err, mode)
+		assert.True(t, data.CaptureTruncated, mode)
+		assert.Equal(t, "www.example.com.", data.Qname, mode)
+		assert.Equal(t, 2, data.Ancount, mode)
+		assert.Equal(t, 1, data.Arcount, mode)
+		assert.Equal(t, 1, *data.AnswerIPCount, mode)
+		assert.Len(t, data.EnrichmentErrors, 1, mode)
+		assert.Equal(t, true, data.ToMapString()["capture_truncated"], mode)
+	}
+
+	// a malformed message isn't recovered.
+	dt = newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, res)
+	dt.Message.ResponseMessage[33], dt.Message.ResponseMessage[34] = 0xc0, 33
+	_, err = dtap.FlatDnstap(dt, &dtap.FlatConfig{RecoverTruncatedCapture: true})
+	assert.Error(t, err)
+}
+
+func benchmarkFlatDnstapParseMode(b *testing.B, mode string) {
+	q := newTestQuery("www.example.com.", dns.TypeA)
+	var rrs []string
+	for i := 0; i < 8; i++ {
+		rrs = append(rrs, fmt.Sprintf("www.example.com. 300 IN A 192.0.2.%d", i))
+	}
+	res := newTestResponse(q, rrs...)
+	res.SetEdns0(4096, true)
+	bs, _ := res.Pack()
+	mt := dnstap.Message_CLIENT_RESPONSE
+	dt := &dnstap.Dnstap{
+		Type: dnstap.Dnstap_MESSAGE.Enum(),
+		Message: &dnstap.Message{
+			Type:            &mt,
+			SocketFamily:    dnstap.SocketFamily_INET.Enum(),
+			QueryAddress:    net.ParseIP("192.0.2.1").To4(),
+			ResponseMessage: bs,
+		},
+	}
+	opt := &dtap.FlatConfig{ParseMode: mode}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := dtap.FlatDnstap(dt, opt); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFlatDnstapStrict(b *testing.B) {
+	benchmarkFlatDnstapParseMode(b, "strict")
+}
+
+func BenchmarkFlatDnstapHeaderOnly(b *testing.B) {
+	benchmarkFlatDnstapParseMode(b, "header_only")
+}
+
+func TestFlatDnstapRootQuery(t *testing.T) {
+	for _, legacy := range []bool{false, true} {
+		for _, qtype := range []uint16{dns.TypeNS, dns.TypeSOA} {
+			q := newTestQuery(".", qtype)
+			for _, dt := range []*dnstap.Dnstap{
+				newTestDnstap(t, dnstap.Message_RESOLVER_QUERY, q),
+				newTestDnstap(t, dnstap.Message_RESOLVER_RESPONSE, newTestResponse(q, ". 518400 IN NS a.root-servers.net.")),
+			} {
+				data, err := dtap.FlatDnstap(dt, &dtap.FlatConfig{LegacyLabels: legacy})
+				assert.NoError(t, err)
+				assert.Equal(t, ".", data.Qname)
+				assert.Equal(t, 0, data.LabelCount)
+				assert.Equal(t, "", data.TopLevelDomainName)
+				assert.Equal(t, "", data.SecondLevelDomainName)
+				assert.Equal(t, "", data.ThirdLevelDomainName)
+				assert.Equal(t, "", data.FourthLevelDomainName)
+				assert.Equal(t, "", data.Subdomain)
+			}
+		}
+	}
+
+	data, err := dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("www.example.com.", dns.TypeA)), &dtap.FlatConfig{})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, data.LabelCount)
+}
+
+func TestFlatDnstapReversedQname(t *testing.T) {
+	opt := &dtap.FlatConfig{IncludeReversedQname: true}
+	data, err := dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("www.example.com.", dns.TypeA)), opt)
+	assert.NoError(t, err)
+	assert.Equal(t, "com.example.www", data.QnameReversed)
+	assert.Equal(t, "com.example.www", data.ToMapString()["qname_reversed"])
+
+	data, err = dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery(".", dns.TypeNS)), opt)
+	assert.NoError(t, err)
+	assert.Equal(t, "", data.QnameReversed)
+
+	data, err = dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("www.example.com.", dns.TypeA)), &dtap.FlatConfig{})
+	assert.NoError(t, err)
+	assert.NotContains(t, data.ToMapString(), "qname_reversed")
+}
+
+func TestFlatDnstapDecodeIDN(t *testing.T) {
+	opt := &dtap.FlatConfig{DecodeIDN: true}
+	for qname, unicode := range map[string]string{
+		"www.xn--wgv71a119e.jp.": "www.日本語.jp.",
+		"www.example.com.":       "www.example.com.",
+		"xn--zz.jp.":             "",
+	} {
+		data, err := dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery(qname, dns.TypeA)), opt)
+		assert.NoError(t, err)
+		assert.Equal(t, unicode, data.QnameUnicode, qname)
+		assert.Equal(t, qname, data.Qname)
+	}
+
+	data, err := dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("www.xn--wgv71a119e.jp.", dns.TypeA)), &dtap.FlatConfig{})
+	assert.NoError(t, err)
+	assert.NotContains(t, data.ToMapString(), "qname_unicode")
+}
+
+func TestMarshalFlatJSONKeyCase(t *testing.T) {
+	opt := &dtap.FlatConfig{KeyCase: "camel", IncludeEpoch: true}
+	assert.Nil(t, opt.Validate())
+	data, err := dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("www.example.com.", dns.TypeA)), opt)
+	assert.NoError(t, err)
+	data.Fields = map[string]interface{}{"site_name": "tokyo"}
+	buf, err := dtap.MarshalFlatJSON(data, opt)
+	assert.NoError(t, err)
+	m := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(buf, &m))
+	assert.Equal(t, "192.0.2.0", m["queryAddress"])
+	assert.Equal(t, float64(1546300800), m["timestampEpoch"])
+	assert.Equal(t, "tokyo", m["siteName"])
+	assert.Equal(t, "www.example.com.", m["qname"])
+	assert.NotContains(t, m, "query_address")
+
+	assert.NotNil(t, (&dtap.FlatConfig{KeyCase: "kebab"}).Validate())
+}
+
+// testPolicyMessage is dnstap.Message with only policy = 15, and testPolicy is dnstap.Policy of the upstream dnstap.proto.
+type testPolicyMessage struct {
+	Policy *testPolicy `protobuf:"bytes,15,opt,name=policy"`
+}
+
+type testPolicy struct {
+	Type   *string `protobuf:"bytes,1,opt,name=type"`
+	Rule   []byte  `protobuf:"bytes,2,opt,name=rule"`
+	Action *int32  `protobuf:"varint,3,opt,name=action"`
+	Match  *int32  `protobuf:"varint,4,opt,name=match"`
+	Value  []byte  `protobuf:"bytes,5,opt,name=value"`
+}
+
+func (m *testPolicyMessage) Reset()         { *m = testPolicyMessage{} }
+func (m *testPolicyMessage) String() string { return proto.CompactTextString(m) }
+func (*testPolicyMessage) ProtoMessage()    {}
+func (p *testPolicy) Reset()                { *p = testPolicy{} }
+func (p *testPolicy) String() string        { return proto.CompactTextString(p) }
+func (*testPolicy) ProtoMessage()           {}
+
+func TestFlatDnstapPolicy(t *testing.T) {
+	rule := make([]byte, 256)
+	n, err := dns.PackDomainName("bad.example.rpz.example.", rule, 0, nil, false)
+	assert.NoError(t, err)
+	policy, err := proto.Marshal(&testPolicyMessage{Policy: &testPolicy{
+		Type:   proto.String("RPZ"),
+		Rule:   rule[:n],
+		Action: proto.Int32(1), // NXDOMAIN
+		Match:  proto.Int32(2), // CLIENT_IP
+		Value:  net.ParseIP("192.0.2.1").To4(),
+	}})
+	assert.NoError(t, err)
+
+	dt := newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, newTestQuery("bad.example.", dns.TypeA))
+	// policy field 15 is newer than golang-dnstap, decode it as an unknown field.
+	dt.Message.ProtoReflect().SetUnknown(policy)
+	bs, err := proto.Marshal(dt)
+	assert.NoError(t, err)
+	dt = &dnstap.Dnstap{}
+	assert.NoError(t, proto.Unmarshal(bs, dt))
+
+	data, err := dtap.FlatDnstap(dt, &dtap.FlatConfig{})
+	assert.NoError(t, err)
+	assert.Equal(t, &dtap.Policy{
+		Type:   "RPZ",
+		Rule:   "bad.example.rpz.example.",
+		Match:  "CLIENT_IP",
+		Action: "NXDOMAIN",
+		Value:  "192.0.2.0",
+	}, data.Policy)
+	assert.JSONEq(t, `{"type":"RPZ","rule":"bad.example.rpz.example.","match":"CLIENT_IP","action":"NXDOMAIN","value":"192.0.2.0"}`, data.ToMapString()["policy"].(string))
+
+	data, err = dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, newTestQuery("www.example.com.", dns.TypeA)), &dtap.FlatConfig{})
+	assert.NoError(t, err)
+	assert.Nil(t, data.Policy)
+	assert.NotContains(t, data.ToMapString(), "policy")
+}
+
+// flatFrameRows returns the columns of records of messages made by FlatFrame, like the CSV output.
+func flatFrameRows(t *testing.T, opt *dtap.FlatConfig, columns []string, messages ...*dtap.Message) [][]string {
+	var rows [][]string
+	for _, m := range messages {
+		records, err := dtap.FlatFrame(m, opt)
+		assert.NoError(t, err)
+		for _, data := range records {
+			values := data.ToMapString()
+			row := make([]string, len(columns))
+			for n, c := range columns {
+				if v, ok := values[c]; ok && v != nil {
+					row[n] = fmt.Sprint(v)
+				}
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+func TestFlatFrame(t *testing.T) {
+	q := newTestQuery("example.com.", dns.TypeA)
+	query := newTestMessage(t, newTestDnstap(t, dnstap.Message_CLIENT_QUERY, q))
+	response := newTestMessage(t, newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, newTestResponse(q)))
+	nxdomainResponse := newTestResponse(q)
+	nxdomainResponse.Rcode = dns.RcodeNameError
+	nxdomain := newTestMessage(t, newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, nxdomainResponse))
+	axfr := newTestMessage(t, newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("example.com.", dns.TypeAXFR)))
+	ixfr := newTestMessage(t, newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("example.com.", dns.TypeIXFR)))
+	axfrResponse := newTestMessage(t, newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, newTestResponse(newTestQuery("example.com.", dns.TypeAXFR))))
+	dropQuery := newTestMessage(t, newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("drop.example.com.", dns.TypeA)))
+	sourced := newTestMessage(t, newTestDnstap(t, dnstap.Message_CLIENT_QUERY, q))
+	sourced.Source = "unbound1"
+	transported := newTestMessage(t, newTestDnstap(t, dnstap.Message_CLIENT_QUERY, q))
+	transported.TransportAddr = &net.TCPAddr{IP: net.ParseIP("192.0.2.10"), Port: 53000}
+	sequence := &dtap.FlatConfig{IncludeSequence: true}
+	sequence.SetNow(func() time.Time { return time.Unix(1546300800, 0) })
+
+	testcases := []struct {
+		name     string
+		flat     *dtap.FlatConfig
+		columns  []string
+		messages []*dtap.Message
+		expected [][]string
+	}{
+		{
+			"drop zone transfers", &dtap.FlatConfig{DropZoneTransfers: true},
+			[]string{"qtype", "zone_transfer"}, []*dtap.Message{axfr, ixfr, query},
+			[][]string{{"A", ""}},
+		},
+		{
+			"tag zone transfers", &dtap.FlatConfig{DropZoneTransfers: true, TagZoneTransfers: true},
+			[]string{"qtype", "zone_transfer"}, []*dtap.Message{axfr, ixfr, query},
+			[][]string{{"AXFR", "true"}, {"IXFR", "true"}, {"A", ""}},
+		},
+		{
+			"rcodes", &dtap.FlatConfig{Rcodes: []string{"nxdomain", "SERVFAIL"}},
+			[]string{"type", "rcode"}, []*dtap.Message{response, query, nxdomain},
+			[][]string{{"CLIENT_QUERY", "NOERROR"}, {"CLIENT_RESPONSE", "NXDOMAIN"}},
+		},
+		{
+			"rcodes filter queries", &dtap.FlatConfig{Rcodes: []string{"NXDOMAIN"}, RcodeFilterQueries: true},
+			[]string{"type", "rcode"}, []*dtap.Message{response, query, nxdomain},
+			[][]string{{"CLIENT_RESPONSE", "NXDOMAIN"}},
+		},
+		{
+			"rcodes of renamed types", &dtap.FlatConfig{Rcodes: []string{"NXDOMAIN"}, TypeNames: map[string]string{"CLIENT_QUERY": "cq", "CLIENT_RESPONSE": "cr"}},
+			[]string{"type", "rcode"}, []*dtap.Message{response, query, nxdomain},
+			[][]string{{"cq", "NOERROR"}, {"cr", "NXDOMAIN"}},
+		},
+		{
+			"filter dry run", &dtap.FlatConfig{
+				Rcodes:            []string{"NXDOMAIN"},
+				DropZoneTransfers: true,
+				Filter:            "qname != 'drop.example.com.'",
+				FilterDryRun:      true,
+			},
+			[]string{"qname", "rcode", "would_drop", "would_drop_reason"}, []*dtap.Message{nxdomain, response, axfrResponse, dropQuery},
+			[][]string{
+				{"example.com.", "NXDOMAIN", "", ""},
+				{"example.com.", "NOERROR", "true", "rcode"},
+				// the first failed filter is the reason, rcode is not evaluated.
+				{"example.com.", "NOERROR", "true", "zone_transfer"},
+				{"drop.example.com.", "NOERROR", "true", "filter"},
+			},
+		},
+		{
+			"source", &dtap.FlatConfig{},
+			[]string{"qname", "source"}, []*dtap.Message{sourced},
+			[][]string{{"example.com.", "unbound1"}},
+		},
+		{
+			"collector", &dtap.FlatConfig{IncludeCollector: true, CollectorID: "collector1"},
+			[]string{"qname", "collector"}, []*dtap.Message{query},
+			[][]string{{"example.com.", "collector1"}},
+		},
+		{
+			"transport address", &dtap.FlatConfig{IPv4Mask: 24, IncludeTransportAddress: true},
+			[]string{"transport_client_address", "transport_client_port"}, []*dtap.Message{transported},
+			[][]string{{"192.0.2.0", "53000"}},
+		},
+		{
+			"sequence", sequence,
+			[]string{"qname", "seq", "seq_epoch"}, []*dtap.Message{query, dropQuery},
+			[][]string{{"example.com.", "1", "1546300800000000000"}, {"drop.example.com.", "2", "1546300800000000000"}},
+		},
+	}
+	for _, tc := range testcases {
+		assert.Nil(t, tc.flat.Validate(), tc.name)
+		assert.Equal(t, tc.expected, flatFrameRows(t, tc.flat, tc.columns, tc.messages...), tc.name)
+	}
+	assert.NotNil(t, (&dtap.FlatConfig{Rcodes: []string{"NOTANRCODE"}}).Validate())
+}
@@ -0,0 +1,186 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/base64"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tinylib/msgp/msgp"
+)
+
+// forwardEntry is a msgpack encoded [time, record] entry of the forward protocol.
+type forwardEntry struct {
+	tag   string
+	entry []byte
+}
+
+func newForwardEntry(tag string, t time.Time, record map[string]interface{}) (*forwardEntry, error) {
+	b := msgp.AppendArrayHeader(nil, 2)
+	b = msgp.AppendInt64(b, t.Unix())
+	b, err := msgp.AppendMapStrIntf(b, record)
+	if err != nil {
+		return nil, err
+	}
+	return &forwardEntry{tag: tag, entry: b}, nil
+}
+
+// forwardClient posts entries in CompressedPackedForward mode of the forward protocol.
+type forwardClient struct {
+	address    string
+	timeout    time.Duration
+	requestAck bool
+	mux        sync.Mutex
+	conn       net.Conn
+	// aborted fails writes instead of connecting again, set by abort.
+	aborted int32
+	// inflight is the connection which write uses, closed by abort.
+	inflight atomic.Value
+}
+
+func newForwardClient(address string, timeout time.Duration, requestAck bool) *forwardClient {
+	return &forwardClient{address: address, timeout: timeout, requestAck: requestAck}
+}
+
+// send posts entries, one message per tag in order of the first entry of the tag.
+func (c *forwardClient) send(entries []interface{}) error {
+	var tags []string
+	byTag := map[string]*bytes.Buffer{}
+	counts := map[string]int{}
+	for _, v := range entries {
+		e := v.(*forwardEntry)
+		buf, ok := byTag[e.tag]
+		if !ok {
+			buf = &bytes.Buffer{}
+			byTag[e.tag] = buf
+			tags = append(tags, e.tag)
+		}
+		buf.Write(e.entry)
+		counts[e.tag]++
+	}
+	for _, tag := range tags {
+		if err := c.post(tag, byTag[tag].Bytes(), counts[tag]); err != nil {
+			return errors.Wrapf(err, "failed to post fluent message, tag: %s", tag)
+		}
+		fluentPostRecords.Add(float64(counts[tag]))
+	}
+	return nil
+}
+
+func (c *forwardClient) post(tag string, entries []byte, count int) error {
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	if _, err := w.Write(entries); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	option := map[string]interface{}{"compressed": "gzip", "size": int64(count)}
+	var chunk string
+	if c.requestAck {
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return err
+		}
+		chunk = base64.StdEncoding.EncodeToString(id)
+		option["chunk"] = chunk
+	}
+	msg := msgp.AppendArrayHeader(nil, 3)
+	msg = msgp.AppendString(msg, tag)
+	msg = msgp.AppendBytes(msg, gz.Bytes())
+	msg, err := msgp.AppendMapStrIntf(msg, option)
+	if err != nil {
+		return err
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	// retry once on a new connection, the server may have closed the idle one.
+	for n := 0; ; n++ {
+		err = c.write(msg, chunk)
+		if err == nil {
+			return nil
+		}
+		c.closeConn()
+		if n > 0 {
+			return err
+		}
+	}
+}
+
+func (c *forwardClient) write(msg []byte, chunk string) error {
+	if atomic.LoadInt32(&c.aborted) == 1 {
+		return errors.New("fluent forward client is aborted")
+	}
+	if c.conn == nil {
+		conn, err := net.DialTimeout("tcp", c.address, c.timeout)
+		if err != nil {
+			return errors.Wrapf(err, "can't connect fluent host, address: %s", c.address)
+		}
+		c.conn = conn
+		c.inflight.Store(conn)
+		// abort may have missed the new connection.
+		if atomic.LoadInt32(&c.aborted) == 1 {
+			return errors.New("fluent forward client is aborted")
+		}
+	}
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	if _, err := c.conn.Write(msg); err != nil {
+		return err
+	}
+	if !c.requestAck {
+		return nil
+	}
+	resp := map[string]interface{}{}
+	if err := msgp.NewReader(c.conn).ReadMapStrIntf(resp); err != nil {
+		return errors.Wrap(err, "can't read ack")
+	}
+	if ack, _ := resp["ack"].(string); ack != chunk {
+		return errors.Errorf("ack mismatch, expected: %s, got: %v", chunk, resp["ack"])
+	}
+	return nil
+}
+
+func (c *forwardClient) closeConn() {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
+
+// abort cancels the post in flight by closing its connection, and makes the later posts fail.
+// Unlike close, it doesn't wait for the post holding the lock.
+func (c *forwardClient) abort() {
+	atomic.StoreInt32(&c.aborted, 1)
+	if conn, ok := c.inflight.Load().(net.Conn); ok {
+		conn.Close()
+	}
+}
+
+func (c *forwardClient) close() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.closeConn()
+}
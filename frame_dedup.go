@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// DefaultDedupExactSize is the default max number of frame hashes held by FrameDeduper.
+var DefaultDedupExactSize = 100000
+
+var dedupExactDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "dtap_output_dedup_exact_dropped_total",
+	Help: "The total number of byte-identical frames dropped by DedupExactWindow.",
+}, []string{"output"})
+
+type frameHash struct {
+	sum  uint64
+	seen time.Time
+}
+
+// FrameDeduper detects byte-identical frames within a window by FNV-1a hash of the frame.
+// At most size hashes are held, the oldest one is forgotten first.
+type FrameDeduper struct {
+	window time.Duration
+	size   int
+	now    func() time.Time
+	mux    sync.Mutex
+	seen   map[uint64]struct{}
+	order  []frameHash
+}
+
+// NewFrameDeduper makes a deduper, size <= 0 is DefaultDedupExactSize.
+func NewFrameDeduper(window time.Duration, size int, now func() time.Time) *FrameDeduper {
+	if size <= 0 {
+		size = DefaultDedupExactSize
+	}
+	return &FrameDeduper{
+		window: window,
+		size:   size,
+		now:    now,
+		seen:   map[uint64]struct{}{},
+	}
+}
+
+// Duplicate records frame, and reports whether the same frame was recorded within the window.
+func (d *FrameDeduper) Duplicate(frame []byte) bool {
+	h := fnv.New64a()
+	h.Write(frame)
+	sum := h.Sum64()
+	now := d.now()
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	for len(d.order) > 0 && now.Sub(d.order[0].seen) >= d.window {
+		d.forgetOldest()
+	}
+	if _, ok := d.seen[sum]; ok {
+		return true
+	}
+	for len(d.order) >= d.size {
+		d.forgetOldest()
+	}
+	d.seen[sum] = struct{}{}
+	d.order = append(d.order, frameHash{sum: sum, seen: now})
+	return false
+}
+
+func (d *FrameDeduper) forgetOldest() {
+	delete(d.seen, d.order[0].sum)
+	d.order = d.order[1:]
+}
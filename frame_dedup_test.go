@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+func TestFrameDeduper(t *testing.T) {
+	now := time.Unix(1546300800, 0)
+	d := dtap.NewFrameDeduper(time.Second, 2, func() time.Time { return now })
+	assert.False(t, d.Duplicate([]byte{1}))
+	assert.True(t, d.Duplicate([]byte{1}))
+	assert.False(t, d.Duplicate([]byte{2}))
+
+	now = now.Add(time.Second)
+	assert.False(t, d.Duplicate([]byte{1}))
+
+	// size bound forgets the oldest hash.
+	assert.False(t, d.Duplicate([]byte{3}))
+	assert.False(t, d.Duplicate([]byte{4}))
+	assert.False(t, d.Duplicate([]byte{1}))
+	assert.True(t, d.Duplicate([]byte{4}))
+}
+
+func TestDnstapOutputDedupExact(t *testing.T) {
+	params := newTestOutputParams()
+	params.Name = "test_dedup_exact"
+	params.DedupExactWindow = time.Second
+	o := dtap.NewDnstapOutput(params)
+	for i := 0; i < 3; i++ {
+		o.SetMessage(dtap.NewMessage([]byte{1, 2, 3}))
+		o.SetMessage(dtap.NewMessage([]byte{4, 5, 6}))
+	}
+	assert.Equal(t, 2.0, outputMetric(t, "dtap_output_buffer_depth", params.Name).GetGauge().GetValue())
+}
+
+func TestOutputMuxDedupExact(t *testing.T) {
+	params := newTestOutputParams()
+	params.Name = "test_mux_dedup_exact"
+	params.DedupExactWindow = time.Second
+	o := dtap.NewDnstapOutput(params)
+	mux := dtap.NewOutputMux()
+	mux.Add(o, 1)
+	// inputs write frames through the mux like cmd/dtap, not directly to the buffer.
+	in := prometheus.NewCounter(prometheus.CounterOpts{Name: "in"})
+	direct := mux.Direct()
+	irbuf := dtap.NewRbuf(16, in, prometheus.NewCounter(prometheus.CounterOpts{Name: "lost"}))
+	if direct != nil {
+		irbuf = dtap.NewRbufTo(direct, in)
+	}
+	for i := 0; i < 3; i++ {
+		irbuf.Write(dtap.NewMessage([]byte{1, 2, 3}))
+	}
+	if direct == nil {
+		irbuf.Close()
+		for m := range irbuf.Read() {
+			mux.SetMessage(m)
+		}
+	}
+	assert.Equal(t, 1.0, outputMetric(t, "dtap_output_buffer_depth", params.Name).GetGauge().GetValue())
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// PerIdentityMaxKeys is the max number of identities with a token bucket,
+// the least recently seen identity is evicted over it.
+var PerIdentityMaxKeys = 10000
+
+// PerIdentityMaxLabels is the max number of identity label values of dropped frames,
+// drops of other identities are counted as IdentityRateOther.
+var PerIdentityMaxLabels = 100
+
+// IdentityRateOther is the identity label of drops over PerIdentityMaxLabels and of evicted identities.
+const IdentityRateOther = "other"
+
+var identityRateDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "dtap_input_identity_rate_dropped_total",
+	Help: "The total number of input frames dropped by PerIdentityMaxQPS.",
+}, []string{"identity"})
+
+type identityBucket struct {
+	tokens float64
+	last   time.Time
+	// dropped is the count of drops under the identity label, 0 is unlabeled.
+	dropped uint64
+}
+
+// IdentityLimiter is a token bucket of frames per second for each dnstap identity,
+// so one producer can't take the pipeline of the others.
+// Buckets idle until full are expired, because a full bucket is the same as a new one.
+type IdentityLimiter struct {
+	qps     float64
+	burst   float64
+	now     func() time.Time
+	mux     sync.Mutex
+	buckets *Cache
+	labels  int
+	expired time.Time
+}
+
+// NewIdentityLimiter returns a limiter of qps frames per second with burst frames.
+func NewIdentityLimiter(qps float64, burst int, now func() time.Time) *IdentityLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	idle := time.Duration(float64(burst) / qps * float64(time.Second))
+	buckets := NewCache("identity_limiter", PerIdentityMaxKeys, idle)
+	buckets.SetNow(now)
+	l := &IdentityLimiter{
+		qps:     qps,
+		burst:   float64(burst),
+		now:     now,
+		buckets: buckets,
+	}
+	buckets.OnEvict = l.evict
+	return l
+}
+
+// evict folds drops of the evicted identity into IdentityRateOther,
+// so the label values are bounded by live identities.
+func (l *IdentityLimiter) evict(identity string, value interface{}) {
+	b := value.(*identityBucket)
+	if b.dropped == 0 {
+		return
+	}
+	identityRateDropped.DeleteLabelValues(identity)
+	identityRateDropped.WithLabelValues(IdentityRateOther).Add(float64(b.dropped))
+	l.labels--
+}
+
+// Allow takes a token of identity, and returns false when it has none.
+func (l *IdentityLimiter) Allow(identity string) bool {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	now := l.now()
+	b := &identityBucket{tokens: l.burst, last: now}
+	if v, ok := l.buckets.Get(identity); ok {
+		b = v.(*identityBucket)
+		b.tokens += now.Sub(b.last).Seconds() * l.qps
+		if b.tokens > l.burst {
+			b.tokens = l.burst
+		}
+		b.last = now
+	}
+	// set also refreshes the idle expiry.
+	l.buckets.Set(identity, b)
+	if b.tokens < 1 {
+		l.dropped(identity, b)
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// dropped counts a dropped frame under identity while PerIdentityMaxLabels allows it.
+// Over the limit, idle buckets are expired at most once a second to free their labels.
+func (l *IdentityLimiter) dropped(identity string, b *identityBucket) {
+	if b.dropped == 0 {
+		if now := l.now(); l.labels >= PerIdentityMaxLabels && now.Sub(l.expired) >= time.Second {
+			l.expired = now
+			l.buckets.Expire()
+		}
+		if l.labels >= PerIdentityMaxLabels {
+			identityRateDropped.WithLabelValues(IdentityRateOther).Inc()
+			return
+		}
+		l.labels++
+	}
+	b.dropped++
+	identityRateDropped.WithLabelValues(identity).Inc()
+}
+
+// frameIdentity returns the identity field of a dnstap frame without decoding the message,
+// empty when it has none or the frame is malformed.
+func frameIdentity(frame []byte) string {
+	identity := ""
+	walkProto(frame, func(num uint64, wire uint64, v uint64, b []byte) bool {
+		if num == 1 && wire == proto.WireBytes {
+			identity = string(b)
+			return false
+		}
+		return true
+	})
+	return identity
+}
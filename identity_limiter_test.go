@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"testing"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+func TestIdentityLimiter(t *testing.T) {
+	now := time.Unix(1546300800, 0)
+	l := dtap.NewIdentityLimiter(1, 2, func() time.Time { return now })
+	assert.True(t, l.Allow("ns1"))
+	assert.True(t, l.Allow("ns1"))
+	assert.False(t, l.Allow("ns1"))
+	assert.True(t, l.Allow("ns2"))
+	now = now.Add(time.Second)
+	assert.True(t, l.Allow("ns1"))
+	assert.False(t, l.Allow("ns1"))
+	// idle buckets are refilled up to burst.
+	now = now.Add(time.Hour)
+	assert.True(t, l.Allow("ns1"))
+	assert.True(t, l.Allow("ns1"))
+	assert.False(t, l.Allow("ns1"))
+}
+
+func identityRateDropped(t *testing.T) map[string]float64 {
+	res := map[string]float64{}
+	mfs, err := prometheus.DefaultGatherer.Gather()
+	assert.NoError(t, err)
+	for _, mf := range mfs {
+		if mf.GetName() != "dtap_input_identity_rate_dropped_total" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			res[m.GetLabel()[0].GetValue()] = m.GetCounter().GetValue()
+		}
+	}
+	return res
+}
+
+func TestIdentityLimiterLabels(t *testing.T) {
+	defer func(n int) { dtap.PerIdentityMaxLabels = n }(dtap.PerIdentityMaxLabels)
+	dtap.PerIdentityMaxLabels = 1
+	now := time.Unix(1546300800, 0)
+	l := dtap.NewIdentityLimiter(1, 1, func() time.Time { return now })
+	other := identityRateDropped(t)[dtap.IdentityRateOther]
+	for _, identity := range []string{"label-ns1", "label-ns1", "label-ns2", "label-ns2"} {
+		l.Allow(identity)
+	}
+	dropped := identityRateDropped(t)
+	assert.Equal(t, 1.0, dropped["label-ns1"])
+	// over PerIdentityMaxLabels
+	assert.NotContains(t, dropped, "label-ns2")
+	assert.Equal(t, other+1, dropped[dtap.IdentityRateOther])
+
+	// idle buckets are removed, and their drops are folded into other.
+	now = now.Add(time.Hour)
+	l.Allow("label-ns3")
+	l.Allow("label-ns3")
+	dropped = identityRateDropped(t)
+	assert.NotContains(t, dropped, "label-ns1")
+	assert.Equal(t, 1.0, dropped["label-ns3"])
+	assert.Equal(t, other+2, dropped[dtap.IdentityRateOther])
+}
+
+func TestRBufIdentityLimiter(t *testing.T) {
+	now := time.Unix(1546300800, 0)
+	rbuf := newTestRbuf(16)
+	rbuf.SetIdentityLimiter(dtap.NewIdentityLimiter(1, 1, func() time.Time { return now }))
+	for _, identity := range []string{"ns1", "ns1", "ns2", "", ""} {
+		dt := newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("www.example.com.", dns.TypeA))
+		dt.Identity = []byte(identity)
+		rbuf.Write(dtap.NewMessage(newTestFrame(t, dt)))
+	}
+	// the second ns1 frame is dropped, frames without identity are not limited.
+	assert.Equal(t, 4, rbuf.Len())
+}
@@ -18,6 +18,8 @@ package dtap
 
 import (
 	"context"
+	"net"
+	"time"
 
 	dnstap "github.com/dnstap/golang-dnstap"
 	framestream "github.com/farsightsec/golang-framestream"
@@ -29,16 +31,27 @@ type FluetOutput interface {
 }
 type Output interface {
 	Run(context.Context)
-	SetMessage([]byte)
+	SetMessage(*Message)
+	Probe() error
 }
 type Input interface {
 	Run(context.Context, *RBuf) error
 }
 type OutputHandler interface {
 	open() error
-	write([]byte) error
+	write(*Message) error
 	close()
 }
+
+// contextHandler is an OutputHandler whose write waits are canceled by ctx.
+type contextHandler interface {
+	writeContext(context.Context, *Message) error
+}
+type Prober interface {
+	Probe() error
+}
 type SocketOutput interface {
-	newConnect() (*framestream.Encoder, error)
+	dial() (net.Conn, error)
+	newConnect() (*framestream.Encoder, net.Conn, error)
+	reconnectInterval() time.Duration
 }
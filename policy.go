@@ -0,0 +1,142 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"net"
+	"strconv"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/golang/protobuf/proto"
+	"github.com/miekg/dns"
+)
+
+// dnstap Message.policy and its fields of dnstap.proto, newer than golang-dnstap,
+// so they are read from the unknown fields of the message.
+const (
+	messagePolicyField = 15
+	policyTypeField    = 1
+	policyRuleField    = 2
+	policyActionField  = 3
+	policyMatchField   = 4
+	policyValueField   = 5
+)
+
+var policyMatchNames = map[uint64]string{
+	1: "QNAME",
+	2: "CLIENT_IP",
+	3: "RESPONSE_IP",
+	4: "NS_NAME",
+	5: "NS_IP",
+}
+
+// policyActionNames are RPZ names of policy actions.
+var policyActionNames = map[uint64]string{
+	1: "NXDOMAIN",
+	2: "NODATA",
+	3: "PASSTHRU",
+	4: "DROP",
+	5: "TCP-ONLY",
+	6: "LOCAL-DATA",
+}
+
+// Policy is the policy applied to the message, e.g. an RPZ rewrite.
+type Policy struct {
+	Type   string `json:"type,omitempty" msg:"type"`
+	Rule   string `json:"rule,omitempty" msg:"rule"`
+	Match  string `json:"match,omitempty" msg:"match"`
+	Action string `json:"action,omitempty" msg:"action"`
+	Value  string `json:"value,omitempty" msg:"value"`
+}
+
+func policyName(names map[uint64]string, v uint64) string {
+	if name, ok := names[v]; ok {
+		return name
+	}
+	return strconv.FormatUint(v, 10)
+}
+
+// messagePolicy returns the policy of msg, nil when it has none.
+func messagePolicy(msg *dnstap.Message, opt DnstapFlatOption) *Policy {
+	if msg == nil {
+		return nil
+	}
+	var policy []byte
+	walkProto(msg.ProtoReflect().GetUnknown(), func(num uint64, wire uint64, v uint64, b []byte) bool {
+		if num == messagePolicyField && wire == proto.WireBytes {
+			policy = b
+			return false
+		}
+		return true
+	})
+	if policy == nil {
+		return nil
+	}
+	p := &Policy{}
+	var match uint64
+	var value []byte
+	walkProto(policy, func(num uint64, wire uint64, v uint64, b []byte) bool {
+		switch num {
+		case policyTypeField:
+			p.Type = string(b)
+		case policyRuleField:
+			p.Rule = policyDomainName(b)
+		case policyMatchField:
+			match = v
+			p.Match = policyName(policyMatchNames, v)
+		case policyActionField:
+			p.Action = policyName(policyActionNames, v)
+		case policyValueField:
+			value = b
+		}
+		return true
+	})
+	if value != nil {
+		p.Value = policyValue(match, value, opt)
+	}
+	if *p == (Policy{}) {
+		return nil
+	}
+	return p
+}
+
+// policyDomainName returns the wire format domain name b as a string, or b as is when it isn't.
+func policyDomainName(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	if name, n, err := dns.UnpackDomainName(b, 0); err == nil && n == len(b) {
+		return name
+	}
+	return string(b)
+}
+
+// policyValue returns value by match type, an address of IP matches and a domain name of name matches.
+// Client addresses are masked like query_address.
+func policyValue(match uint64, value []byte, opt DnstapFlatOption) string {
+	switch match {
+	case 2, 3, 5:
+		if len(value) == net.IPv4len || len(value) == net.IPv6len {
+			ip := net.IP(value)
+			if match == 2 {
+				ip = maskIP(ip, opt)
+			}
+			return ip.String()
+		}
+	}
+	return policyDomainName(value)
+}
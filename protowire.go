@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"github.com/golang/protobuf/proto"
+)
+
+// walkProto calls fn with the number, wire type and value of each field of a protobuf message,
+// v is the value of varint, fixed64 and fixed32 fields and b is the data of bytes fields.
+// It stops when fn returns false, and returns false when msg is malformed.
+func walkProto(msg []byte, fn func(num uint64, wire uint64, v uint64, b []byte) bool) bool {
+	for len(msg) > 0 {
+		key, n := proto.DecodeVarint(msg)
+		if n == 0 {
+			return false
+		}
+		msg = msg[n:]
+		var v uint64
+		var b []byte
+		switch key & 7 {
+		case proto.WireVarint:
+			if v, n = proto.DecodeVarint(msg); n == 0 {
+				return false
+			}
+		case proto.WireFixed64:
+			if len(msg) < 8 {
+				return false
+			}
+			for i := 7; i >= 0; i-- {
+				v = v<<8 | uint64(msg[i])
+			}
+			n = 8
+		case proto.WireBytes:
+			l, m := proto.DecodeVarint(msg)
+			if m == 0 || l > uint64(len(msg)-m) {
+				return false
+			}
+			b = msg[m : m+int(l)]
+			n = m + int(l)
+		case proto.WireFixed32:
+			if len(msg) < 4 {
+				return false
+			}
+			for i := 3; i >= 0; i-- {
+				v = v<<8 | uint64(msg[i])
+			}
+			n = 4
+		default:
+			return false
+		}
+		msg = msg[n:]
+		if !fn(key>>3, key&7, v, b) {
+			return true
+		}
+	}
+	return true
+}
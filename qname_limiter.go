@@ -0,0 +1,93 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	DefaultPerQnameWindow = time.Minute
+	// PerQnameMaxKeys is the max number of qnames counted in a window,
+	// records of other qnames share the limit of one overflow key.
+	PerQnameMaxKeys = 100000
+)
+
+// perQnameOverflowKey is the key of qnames over PerQnameMaxKeys, it never collides with a qname.
+const perQnameOverflowKey = "\x00overflow"
+
+var perQnameDropped = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "dtap_flat_per_qname_dropped_total",
+	Help: "Total number of flat records dropped by PerQnameLimit.",
+})
+
+// QnameLimiter emits at most limit records per qname in a window.
+// Counters of all qnames are reset when the window passes.
+type QnameLimiter struct {
+	limit  int
+	window time.Duration
+	now    func() time.Time
+	mux    sync.Mutex
+	start  time.Time
+	counts map[string]int
+}
+
+func NewQnameLimiter(limit int, window time.Duration, now func() time.Time) *QnameLimiter {
+	return &QnameLimiter{
+		limit:  limit,
+		window: window,
+		now:    now,
+		start:  now(),
+		counts: map[string]int{},
+	}
+}
+
+// Allow counts a record of qname, and returns false when it exceeds the limit.
+func (l *QnameLimiter) Allow(qname string) bool {
+	key := strings.ToLower(strings.TrimSuffix(qname, "."))
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if now := l.now(); now.Sub(l.start) >= l.window {
+		l.start = now
+		l.counts = map[string]int{}
+	}
+	n, ok := l.counts[key]
+	if !ok && len(l.counts) >= PerQnameMaxKeys {
+		key = perQnameOverflowKey
+		n = l.counts[key]
+	}
+	if n >= l.limit {
+		return false
+	}
+	l.counts[key] = n + 1
+	return true
+}
+
+// AllowRecord counts data by the qname, and returns false when it exceeds the limit.
+func (l *QnameLimiter) AllowRecord(data *DnstapFlatT) bool {
+	return l.Allow(data.Qname)
+}
+
+// Apply drops records over the limit.
+func (l *QnameLimiter) Apply(records []*DnstapFlatT) []*DnstapFlatT {
+	return recordFilter{}.apply(records, DropReasonPerQname, perQnameDropped, l.AllowRecord)
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+func TestQnameLimiter(t *testing.T) {
+	now := time.Unix(1546300800, 0)
+	l := dtap.NewQnameLimiter(3, time.Minute, func() time.Time { return now })
+
+	var records []*dtap.DnstapFlatT
+	for i := 0; i < 100; i++ {
+		records = append(records, &dtap.DnstapFlatT{Qname: "dominant.example."})
+		if i%10 == 0 {
+			records = append(records, &dtap.DnstapFlatT{Qname: "other.example"})
+		}
+	}
+	records = append(records, &dtap.DnstapFlatT{Qname: "DOMINANT.example"})
+	res := l.Apply(records)
+	counts := map[string]int{}
+	for _, data := range res {
+		counts[data.Qname]++
+	}
+	assert.Equal(t, map[string]int{"dominant.example.": 3, "other.example": 3}, counts)
+
+	assert.False(t, l.Allow("dominant.example"))
+	now = now.Add(time.Minute)
+	assert.True(t, l.Allow("dominant.example"))
+}
+
+func TestQnameLimiterOverflow(t *testing.T) {
+	defer func(n int) { dtap.PerQnameMaxKeys = n }(dtap.PerQnameMaxKeys)
+	dtap.PerQnameMaxKeys = 2
+	now := time.Unix(1546300800, 0)
+	l := dtap.NewQnameLimiter(2, time.Minute, func() time.Time { return now })
+	assert.True(t, l.Allow("a.example."))
+	assert.True(t, l.Allow("b.example."))
+	// new qnames over PerQnameMaxKeys share one limit.
+	assert.True(t, l.Allow("c.example."))
+	assert.True(t, l.Allow("d.example."))
+	assert.False(t, l.Allow("e.example."))
+	assert.True(t, l.Allow("a.example."))
+}
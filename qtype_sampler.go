@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// QtypeSampleDefaultKey is the key of QtypeSampleRates for unlisted qtypes.
+const QtypeSampleDefaultKey = "*"
+
+var qtypeSampledOut = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "dtap_flat_qtype_sampled_out_total",
+	Help: "Total number of flat records dropped by QtypeSampleRates.",
+})
+
+// QtypeSampler keeps records by the sample rate of the qtype.
+type QtypeSampler struct {
+	rates map[string]float64
+	def   float64
+	mux   sync.Mutex
+	rand  *rand.Rand
+}
+
+// NewQtypeSampler makes a sampler of rates by qtype name,
+// the rate of QtypeSampleDefaultKey is used for unlisted qtypes, default 1.
+func NewQtypeSampler(rates map[string]float64) *QtypeSampler {
+	s := &QtypeSampler{
+		rates: map[string]float64{},
+		def:   1,
+		rand:  rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	for qtype, rate := range rates {
+		if qtype == QtypeSampleDefaultKey {
+			s.def = rate
+			continue
+		}
+		s.rates[strings.ToUpper(qtype)] = rate
+	}
+	return s
+}
+
+// Rate returns the sample rate of qtype.
+func (s *QtypeSampler) Rate(qtype string) float64 {
+	if rate, ok := s.rates[strings.ToUpper(qtype)]; ok {
+		return rate
+	}
+	return s.def
+}
+
+// Sample returns true when data is sampled by the rate of the qtype.
+func (s *QtypeSampler) Sample(data *DnstapFlatT) bool {
+	rate := s.Rate(data.Qtype)
+	return rate >= 1 || rate > 0 && s.sample() < rate
+}
+
+// Apply drops records not sampled by the rate of the qtype.
+func (s *QtypeSampler) Apply(records []*DnstapFlatT) []*DnstapFlatT {
+	return recordFilter{}.apply(records, DropReasonQtypeSample, qtypeSampledOut, s.Sample)
+}
+
+func (s *QtypeSampler) sample() float64 {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.rand.Float64()
+}
@@ -0,0 +1,54 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+func TestQtypeSampler(t *testing.T) {
+	s := dtap.NewQtypeSampler(map[string]float64{"a": 0, "AAAA": 0.5, "*": 1})
+	assert.Equal(t, 0.0, s.Rate("A"))
+	assert.Equal(t, 0.5, s.Rate("aaaa"))
+	assert.Equal(t, 1.0, s.Rate("ANY"))
+
+	var records []*dtap.DnstapFlatT
+	for i := 0; i < 1000; i++ {
+		records = append(records, &dtap.DnstapFlatT{Qtype: "A"}, &dtap.DnstapFlatT{Qtype: "AAAA"}, &dtap.DnstapFlatT{Qtype: "ANY"})
+	}
+	counts := map[string]int{}
+	for _, data := range s.Apply(records) {
+		counts[data.Qtype]++
+	}
+	assert.Equal(t, 0, counts["A"])
+	assert.InDelta(t, 500, counts["AAAA"], 150)
+	assert.Equal(t, 1000, counts["ANY"])
+}
+
+func TestQtypeSamplerDefault(t *testing.T) {
+	s := dtap.NewQtypeSampler(map[string]float64{"ANY": 1, "*": 0})
+	res := s.Apply([]*dtap.DnstapFlatT{{Qtype: "A"}, {Qtype: "ANY"}, {Qtype: "TXT"}})
+	assert.Len(t, res, 1)
+	assert.Equal(t, "ANY", res[0].Qtype)
+
+	c := &dtap.FlatConfig{QtypeSampleRates: map[string]float64{"A": 2, "NOTYPE": 0.5}}
+	assert.Error(t, c.Validate())
+}
@@ -1,21 +1,47 @@
 package dtap
 
 import (
+	"net"
 	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// Message is a dnstap frame in the pipeline.
+type Message struct {
+	Frame []byte
+	// ReceivedAt is the time the input decoded the frame.
+	ReceivedAt time.Time
+	// Source is the label of the input.
+	Source string
+	// TransportAddr is the peer of the TCP connection the input received the frame on, nil when unknown.
+	TransportAddr *net.TCPAddr
+	// flush asks flat outputs to emit held records on shutdown, it has no frame.
+	flush bool
+}
+
+// NewMessage returns Message of frame received now.
+func NewMessage(frame []byte) *Message {
+	return &Message{Frame: frame, ReceivedAt: time.Now()}
+}
+
 type RBuf struct {
-	channel     chan []byte
+	channel     chan *Message
 	mux         sync.Mutex
 	inCounter   prometheus.Counter
 	lostCounter prometheus.Counter
+	// dst is the buffer written directly by NewRbufTo.
+	dst *RBuf
+	// limiter drops frames over the rate of their identity.
+	limiter *IdentityLimiter
+	// depth is set to the number of buffered frames on Write.
+	depth prometheus.Gauge
 }
 
 func NewRbuf(size uint, inCounter prometheus.Counter, lostCounter prometheus.Counter) *RBuf {
 	rbuf := &RBuf{
-		channel:     make(chan []byte, size),
+		channel:     make(chan *Message, size),
 		mux:         sync.Mutex{},
 		inCounter:   inCounter,
 		lostCounter: lostCounter,
@@ -23,24 +49,106 @@ func NewRbuf(size uint, inCounter prometheus.Counter, lostCounter prometheus.Cou
 	return rbuf
 }
 
-func (r *RBuf) Read() <-chan []byte {
+// NewRbufTo returns RBuf writing frames to dst without own channel.
+// Frames are counted by inCounter, and lost ones by dst.
+func NewRbufTo(dst *RBuf, inCounter prometheus.Counter) *RBuf {
+	return &RBuf{
+		inCounter: inCounter,
+		dst:       dst,
+	}
+}
+
+func (r *RBuf) Read() <-chan *Message {
+	if r.dst != nil {
+		return r.dst.Read()
+	}
 	return r.channel
 }
 
-func (r *RBuf) Write(b []byte) {
+// SetIdentityLimiter drops frames over the rate of their identity on Write.
+// Frames without identity are not limited.
+func (r *RBuf) SetIdentityLimiter(l *IdentityLimiter) {
+	r.limiter = l
+}
+
+// SetDepthGauge sets the number of buffered frames to g on Write,
+// so frames written directly by inputs through NewRbufTo are counted too.
+func (r *RBuf) SetDepthGauge(g prometheus.Gauge) {
+	r.depth = g
+}
+
+func (r *RBuf) setDepth() {
+	if r.depth != nil {
+		r.depth.Set(float64(len(r.channel)))
+	}
+}
+
+func (r *RBuf) Write(m *Message) {
+	if r.limiter != nil {
+		if identity := frameIdentity(m.Frame); identity != "" && !r.limiter.Allow(identity) {
+			return
+		}
+	}
+	if r.dst != nil {
+		r.inCounter.Inc()
+		r.dst.Write(m)
+		return
+	}
 	r.mux.Lock()
 	select {
-	case r.channel <- b:
+	case r.channel <- m:
 		r.inCounter.Inc()
 	default:
 		r.lostCounter.Inc()
 		r.inCounter.Inc()
-		<-r.channel
-		r.channel <- b
+		// drop the oldest frame, reader may have drained it meanwhile.
+		select {
+		case <-r.channel:
+		default:
+		}
+		r.channel <- m
 	}
 	r.mux.Unlock()
+	r.setDepth()
 }
 
+// WriteWait writes m waiting for room of the buffer instead of dropping the oldest frame.
+// It returns false when done is closed before m is accepted, frames dropped by the identity limiter are accepted.
+func (r *RBuf) WriteWait(done <-chan struct{}, m *Message) bool {
+	if r.limiter != nil {
+		if identity := frameIdentity(m.Frame); identity != "" && !r.limiter.Allow(identity) {
+			return true
+		}
+	}
+	if r.dst != nil {
+		if !r.dst.WriteWait(done, m) {
+			return false
+		}
+		r.inCounter.Inc()
+		return true
+	}
+	select {
+	case r.channel <- m:
+		r.inCounter.Inc()
+		r.setDepth()
+		return true
+	case <-done:
+		return false
+	}
+}
+
+// Len returns the number of buffered frames.
+func (r *RBuf) Len() int {
+	if r.dst != nil {
+		return r.dst.Len()
+	}
+	return len(r.channel)
+}
+
+// Close closes the channel, RBuf made by NewRbufTo leaves dst open.
 func (r *RBuf) Close() {
+	if r.dst != nil {
+		return
+	}
 	close(r.channel)
 }
@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Reasons of filters dropping records, would_drop_reason of FilterDryRun.
+const (
+	DropReasonZoneTransfer = "zone_transfer"
+	DropReasonRcode        = "rcode"
+	DropReasonQtypeSample  = "qtype_sample"
+	DropReasonPerQname     = "per_qname_limit"
+	DropReasonFilter       = "filter"
+	DropReasonSocketFamily = "socket_family"
+	DropReasonLatency      = "min_latency"
+	DropReasonAnswers      = "min_answers"
+	DropReasonFutureSkew   = "future_skew"
+)
+
+var flatWouldDrop = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "dtap_flat_would_drop_total",
+	Help: "Total number of flat records kept by FilterDryRun which filters would drop.",
+}, []string{"reason"})
+
+// recordFilter carries out the decisions of filters.
+// Records failing a filter are dropped and counted by the filter counter,
+// or kept with would_drop and the reason by dryRun.
+type recordFilter struct {
+	dryRun bool
+}
+
+func newRecordFilter(opt DnstapFlatOption) recordFilter {
+	return recordFilter{dryRun: opt.GetFilterDryRun()}
+}
+
+// keep returns true when data is emitted, pass is the decision of the filter.
+// Records marked would_drop already are kept without the decision,
+// as they never reach later filters without dryRun.
+func (f recordFilter) keep(data *DnstapFlatT, reason string, dropped prometheus.Counter, pass func() bool) bool {
+	if data.WouldDrop || pass() {
+		return true
+	}
+	if !f.dryRun {
+		dropped.Inc()
+		return false
+	}
+	data.WouldDrop, data.WouldDropReason = true, reason
+	flatWouldDrop.WithLabelValues(reason).Inc()
+	return true
+}
+
+// apply returns records kept by pass.
+func (f recordFilter) apply(records []*DnstapFlatT, reason string, dropped prometheus.Counter, pass func(*DnstapFlatT) bool) []*DnstapFlatT {
+	res := records[:0]
+	for _, data := range records {
+		if f.keep(data, reason, dropped, func() bool { return pass(data) }) {
+			res = append(res, data)
+		}
+	}
+	return res
+}
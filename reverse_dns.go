@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	DefaultReverseDNSCacheSize = 10000
+	DefaultReverseDNSTTL       = time.Hour
+	// ReverseDNSTimeout is the timeout of a PTR lookup.
+	ReverseDNSTimeout = 2 * time.Second
+	// ReverseDNSWorkers is the number of background lookup workers.
+	ReverseDNSWorkers = 4
+	// ReverseDNSQueueSize bounds pending lookups, new ones are dropped when full.
+	ReverseDNSQueueSize = 1024
+)
+
+var reverseDNSLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "dtap_reverse_dns_lookups_total",
+	Help: "The total number of PTR lookups by result.",
+}, []string{"result"})
+
+// ReverseDNS is a best-effort PTR cache of client addresses.
+// Lookup never blocks, it returns the cached name and resolves misses in background.
+// Failed lookups are cached too to avoid hammering resolvers.
+type ReverseDNS struct {
+	cache   *Cache
+	queue   chan string
+	mux     sync.Mutex
+	pending map[string]struct{}
+	once    sync.Once
+	lookup  func(ctx context.Context, addr string) ([]string, error)
+}
+
+func NewReverseDNS(size int, ttl time.Duration) *ReverseDNS {
+	return &ReverseDNS{
+		cache:   NewCache("reverse_dns", size, ttl),
+		queue:   make(chan string, ReverseDNSQueueSize),
+		pending: map[string]struct{}{},
+		lookup:  net.DefaultResolver.LookupAddr,
+	}
+}
+
+// SetLookup replaces the PTR resolver, for tests.
+func (r *ReverseDNS) SetLookup(lookup func(ctx context.Context, addr string) ([]string, error)) {
+	r.lookup = lookup
+}
+
+// Lookup returns the cached PTR name of ip, or empty until it is resolved.
+func (r *ReverseDNS) Lookup(ip net.IP) string {
+	name, _ := r.LookupResult(ip)
+	return name
+}
+
+// LookupResult is Lookup returning the cached failure,
+// or an error when the lookup is dropped by the full queue.
+// It returns empty without error while the lookup is pending.
+func (r *ReverseDNS) LookupResult(ip net.IP) (string, error) {
+	addr := ip.String()
+	if v, ok := r.cache.Get(addr); ok {
+		if err, ok := v.(error); ok {
+			return "", err
+		}
+		return v.(string), nil
+	}
+	r.once.Do(r.start)
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if _, ok := r.pending[addr]; ok {
+		return "", nil
+	}
+	select {
+	case r.queue <- addr:
+		r.pending[addr] = struct{}{}
+	default:
+		reverseDNSLookups.WithLabelValues("dropped").Inc()
+		return "", errors.New("lookup queue is full")
+	}
+	return "", nil
+}
+
+// start runs lookup workers, they live as long as the process.
+func (r *ReverseDNS) start() {
+	for i := 0; i < ReverseDNSWorkers; i++ {
+		go r.worker()
+	}
+}
+
+func (r *ReverseDNS) worker() {
+	for addr := range r.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), ReverseDNSTimeout)
+		names, err := r.lookup(ctx, addr)
+		cancel()
+		var v interface{}
+		switch {
+		case err != nil:
+			reverseDNSLookups.WithLabelValues("failed").Inc()
+			v = errors.Wrap(err, "lookup failed")
+		case len(names) == 0:
+			reverseDNSLookups.WithLabelValues("failed").Inc()
+			v = errors.New("no PTR record")
+		default:
+			reverseDNSLookups.WithLabelValues("success").Inc()
+			v = strings.ToLower(names[0])
+		}
+		r.cache.Set(addr, v)
+		r.mux.Lock()
+		delete(r.pending, addr)
+		r.mux.Unlock()
+	}
+}
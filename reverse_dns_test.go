@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+func TestReverseDNS(t *testing.T) {
+	var lookups int32
+	r := dtap.NewReverseDNS(16, time.Minute)
+	r.SetLookup(func(ctx context.Context, addr string) ([]string, error) {
+		atomic.AddInt32(&lookups, 1)
+		if addr == "192.0.2.1" {
+			return []string{"Host1.Example.JP."}, nil
+		}
+		return nil, errors.New("no such host")
+	})
+
+	// miss returns empty without blocking
+	assert.Equal(t, "", r.Lookup(net.ParseIP("192.0.2.1")))
+	var name string
+	for i := 0; i < 100 && name == ""; i++ {
+		time.Sleep(10 * time.Millisecond)
+		name = r.Lookup(net.ParseIP("192.0.2.1"))
+	}
+	assert.Equal(t, "host1.example.jp.", name)
+
+	assert.Equal(t, "", r.Lookup(net.ParseIP("192.0.2.2")))
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, "", r.Lookup(net.ParseIP("192.0.2.2")))
+	time.Sleep(50 * time.Millisecond)
+
+	// cached, including the failure
+	assert.Equal(t, int32(2), atomic.LoadInt32(&lookups))
+}
+
+func TestFlatDnstapEnrichmentErrors(t *testing.T) {
+	opt := &dtap.FlatConfig{ReverseDNS: true}
+	opt.GetReverseDNS().SetLookup(func(ctx context.Context, addr string) ([]string, error) {
+		return nil, errors.New("no such host")
+	})
+	dt := newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("www.example.com.", dns.TypeA))
+
+	// pending lookup is not an error
+	data, err := dtap.FlatDnstap(dt, opt)
+	assert.NoError(t, err)
+	assert.Nil(t, data.EnrichmentErrors)
+	for i := 0; i < 100 && data.EnrichmentErrors == nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+		data, err = dtap.FlatDnstap(dt, opt)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []string{"reverse_dns: lookup failed: no such host"}, data.EnrichmentErrors)
+	assert.Equal(t, "www.example.com.", data.Qname)
+	assert.Equal(t, `["reverse_dns: lookup failed: no such host"]`, data.ToMapString()["enrichment_errors"])
+}
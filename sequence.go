@@ -0,0 +1,42 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Sequence numbers records of an output from 1.
+// Epoch is the start time in unix nano, consumers detect restarts by its change.
+type Sequence struct {
+	epoch int64
+	n     uint64
+}
+
+func NewSequence(now time.Time) *Sequence {
+	return &Sequence{epoch: now.UnixNano()}
+}
+
+func (s *Sequence) Epoch() int64 {
+	return s.epoch
+}
+
+// Next returns the next sequence number.
+func (s *Sequence) Next() uint64 {
+	return atomic.AddUint64(&s.n, 1)
+}
@@ -0,0 +1,196 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"sort"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	"github.com/tinylib/msgp/msgp"
+)
+
+// Serializer encodes a flat record map to the output wire format.
+type Serializer interface {
+	Serialize(map[string]interface{}) ([]byte, error)
+	ContentType() string
+}
+
+// SerializeFormats are supported values of the output Format.
+var SerializeFormats = []string{"json", "msgpack", "cbor", "avro"}
+
+// DnstapJSONFormat is the output Format emitting raw dnstap as protobuf JSON
+// instead of flat records.
+const DnstapJSONFormat = "dnstap_json"
+
+var dnstapJSONMarshaler = &jsonpb.Marshaler{OrigName: true}
+
+// MarshalDnstapJSON returns protobuf JSON of dnstap frame,
+// with proto field names and message bytes as base64.
+func MarshalDnstapJSON(frame []byte) ([]byte, error) {
+	dt := &dnstap.Dnstap{}
+	if err := proto.Unmarshal(frame, dt); err != nil {
+		return nil, err
+	}
+	s, err := dnstapJSONMarshaler.MarshalToString(dt)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't marshal dnstap json")
+	}
+	return []byte(s), nil
+}
+
+// NewSerializer returns a serializer of format, empty is json.
+func NewSerializer(format string) (Serializer, error) {
+	switch format {
+	case "", "json":
+		return &jsonSerializer{}, nil
+	case "msgpack":
+		return &msgpackSerializer{}, nil
+	case "cbor":
+		return &cborSerializer{}, nil
+	case "avro":
+		return NewAvroSerializer()
+	}
+	return nil, errors.Errorf("unsupported format %s", format)
+}
+
+type jsonSerializer struct{}
+
+func (s *jsonSerializer) Serialize(m map[string]interface{}) ([]byte, error) {
+	return json.Marshal(m)
+}
+
+func (s *jsonSerializer) ContentType() string {
+	return "application/json"
+}
+
+type msgpackSerializer struct{}
+
+func (s *msgpackSerializer) Serialize(m map[string]interface{}) ([]byte, error) {
+	return msgp.AppendMapStrIntf(nil, m)
+}
+
+func (s *msgpackSerializer) ContentType() string {
+	return "application/msgpack"
+}
+
+// cborSerializer encodes RFC 8949 CBOR with sorted map keys.
+// It supports the value types of flat record maps.
+type cborSerializer struct{}
+
+func (s *cborSerializer) Serialize(m map[string]interface{}) ([]byte, error) {
+	return appendCBOR(nil, m)
+}
+
+func (s *cborSerializer) ContentType() string {
+	return "application/cbor"
+}
+
+const (
+	cborUint   = 0 << 5
+	cborNegInt = 1 << 5
+	cborText   = 3 << 5
+	cborArray  = 4 << 5
+	cborMap    = 5 << 5
+	cborSimple = 7 << 5
+)
+
+func appendCBORHead(b []byte, major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return append(b, major|byte(n))
+	case n <= math.MaxUint8:
+		return append(b, major|24, byte(n))
+	case n <= math.MaxUint16:
+		b = append(b, major|25)
+		return append(b, byte(n>>8), byte(n))
+	case n <= math.MaxUint32:
+		b = append(b, major|26, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(b[len(b)-4:], uint32(n))
+		return b
+	}
+	b = append(b, major|27, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint64(b[len(b)-8:], n)
+	return b
+}
+
+func appendCBORInt(b []byte, i int64) []byte {
+	if i < 0 {
+		return appendCBORHead(b, cborNegInt, uint64(-1-i))
+	}
+	return appendCBORHead(b, cborUint, uint64(i))
+}
+
+func appendCBOR(b []byte, v interface{}) ([]byte, error) {
+	var err error
+	switch v := v.(type) {
+	case nil:
+		return append(b, cborSimple|22), nil
+	case bool:
+		if v {
+			return append(b, cborSimple|21), nil
+		}
+		return append(b, cborSimple|20), nil
+	case string:
+		b = appendCBORHead(b, cborText, uint64(len(v)))
+		return append(b, v...), nil
+	case int:
+		return appendCBORInt(b, int64(v)), nil
+	case int32:
+		return appendCBORInt(b, int64(v)), nil
+	case int64:
+		return appendCBORInt(b, v), nil
+	case uint16:
+		return appendCBORHead(b, cborUint, uint64(v)), nil
+	case uint32:
+		return appendCBORHead(b, cborUint, uint64(v)), nil
+	case uint64:
+		return appendCBORHead(b, cborUint, v), nil
+	case float64:
+		b = append(b, cborSimple|27, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(b[len(b)-8:], math.Float64bits(v))
+		return b, nil
+	case []interface{}:
+		b = appendCBORHead(b, cborArray, uint64(len(v)))
+		for _, e := range v {
+			if b, err = appendCBOR(b, e); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b = appendCBORHead(b, cborMap, uint64(len(v)))
+		for _, k := range keys {
+			b, _ = appendCBOR(b, k)
+			if b, err = appendCBOR(b, v[k]); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+	return nil, errors.Errorf("cbor: unsupported type %T", v)
+}
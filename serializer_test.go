@@ -0,0 +1,159 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/linkedin/goavro"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/tinylib/msgp/msgp"
+
+	"github.com/mimuret/dtap"
+)
+
+func newTestFlatMap(t *testing.T) map[string]interface{} {
+	q := newTestQuery("www.example.com.", dns.TypeA)
+	data, err := dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_CLIENT_QUERY, q), &dtap.FlatConfig{})
+	assert.NoError(t, err)
+	return data.ToMapString()
+}
+
+func TestJSONSerializer(t *testing.T) {
+	s, err := dtap.NewSerializer("json")
+	assert.NoError(t, err)
+	assert.Equal(t, "application/json", s.ContentType())
+	buf, err := s.Serialize(newTestFlatMap(t))
+	assert.NoError(t, err)
+	m := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(buf, &m))
+	assert.Equal(t, "www.example.com.", m["qname"])
+	assert.Equal(t, float64(53000), m["query_port"])
+	assert.Equal(t, true, m["rd"])
+}
+
+func TestMsgpackSerializer(t *testing.T) {
+	s, err := dtap.NewSerializer("msgpack")
+	assert.NoError(t, err)
+	assert.Equal(t, "application/msgpack", s.ContentType())
+	buf, err := s.Serialize(newTestFlatMap(t))
+	assert.NoError(t, err)
+	m, rest, err := msgp.ReadMapStrIntfBytes(buf, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, rest)
+	assert.Equal(t, "www.example.com.", m["qname"])
+	assert.Equal(t, int64(53000), m["query_port"])
+	assert.Equal(t, true, m["rd"])
+}
+
+func TestCBORSerializer(t *testing.T) {
+	s, err := dtap.NewSerializer("cbor")
+	assert.NoError(t, err)
+	assert.Equal(t, "application/cbor", s.ContentType())
+	buf, err := s.Serialize(map[string]interface{}{
+		"a": int64(1),
+		"b": []interface{}{true, nil},
+		"c": "x",
+		"d": int32(-2),
+		"e": 1.5,
+		"f": int64(53000),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "a6"+
+		"6161"+"01"+
+		"6162"+"82f5f6"+
+		"6163"+"6178"+
+		"6164"+"21"+
+		"6165"+"fb3ff8000000000000"+
+		"6166"+"19cf08", hex.EncodeToString(buf))
+
+	_, err = s.Serialize(map[string]interface{}{"a": struct{}{}})
+	assert.Error(t, err)
+
+	buf, err = s.Serialize(newTestFlatMap(t))
+	assert.NoError(t, err)
+	assert.Contains(t, string(buf), "www.example.com.")
+}
+
+func TestNewSerializer(t *testing.T) {
+	_, err := dtap.NewSerializer("xml")
+	assert.Error(t, err)
+}
+
+func TestMarshalDnstapJSON(t *testing.T) {
+	q := newTestQuery("www.example.com.", dns.TypeA)
+	dt := newTestDnstap(t, dnstap.Message_CLIENT_QUERY, q)
+	buf, err := dtap.MarshalDnstapJSON(newTestFrame(t, dt))
+	assert.NoError(t, err)
+	m := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(buf, &m))
+	assert.Equal(t, "MESSAGE", m["type"])
+	msg := m["message"].(map[string]interface{})
+	assert.Equal(t, "CLIENT_QUERY", msg["type"])
+	assert.Equal(t, "wAACAQ==", msg["query_address"])
+	assert.Equal(t, float64(53000), msg["query_port"])
+	assert.Equal(t, "1546300800", msg["query_time_sec"])
+	bs, err := q.Pack()
+	assert.NoError(t, err)
+	assert.Equal(t, base64.StdEncoding.EncodeToString(bs), msg["query_message"])
+
+	_, err = dtap.MarshalDnstapJSON([]byte{0xff})
+	assert.Error(t, err)
+}
+
+func TestAvroSerializer(t *testing.T) {
+	s, err := dtap.NewSerializer("avro")
+	assert.NoError(t, err)
+	assert.Equal(t, "application/avro", s.ContentType())
+	codec, err := goavro.NewCodec(dtap.FlatAvroSchema())
+	assert.NoError(t, err)
+
+	m := newTestFlatMap(t)
+	m["not_in_schema"] = "x"
+	buf, err := s.Serialize(m)
+	assert.NoError(t, err)
+	native, rest, err := codec.NativeFromBinary(buf)
+	assert.NoError(t, err)
+	assert.Empty(t, rest)
+	record := native.(map[string]interface{})
+	assert.Equal(t, "www.example.com.", record["qname"])
+	assert.Equal(t, int32(53000), record["query_port"])
+	assert.Equal(t, true, record["rd"])
+	assert.NotContains(t, record, "not_in_schema")
+
+	// NumbersAsStrings values are parsed back.
+	m["query_port"] = "53001"
+	buf, err = s.Serialize(m)
+	assert.NoError(t, err)
+	native, _, err = codec.NativeFromBinary(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(53001), native.(map[string]interface{})["query_port"])
+
+	// Confluent wire format is magic byte 0 and 4 byte schema id.
+	avro, err := dtap.NewAvroSerializer()
+	assert.NoError(t, err)
+	avro.SetSchemaID(7)
+	framed, err := avro.Serialize(m)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0, 0, 0, 0, 7}, framed[:5])
+	assert.Equal(t, buf, framed[5:])
+}
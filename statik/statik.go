@@ -8,6 +8,6 @@ import (
 )
 
 func init() {
-	data := "PK\x03\x04\x14\x00\x08\x00\x08\x00\x85\x0d0O\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00	\x00	\x00flat.avscUT\x05\x00\x01\xeb\xe8~]\xb4\x94\xcdj\xeb0\x10\x85\xf7~\n\xa1u\x16w\x9d\xf5\xa5O\xd0])f*\x8dcQYrf&%?\xe4\xdd\x8bU\x1aJ\xab\xd8\xaeP7\xc6\x8c\xfc}>:\x08]\x1a\xa5\xb4\x9cF\xd4[\xa5	M$\xab7\xd3,\xc0\x90f\xff\x03\x0b\x8c\x0f\x1e\xe4\xf1c\xa1s\xe8-\xeb\xadzj\x94R\xea\x92\x9e_\x00q\x03\xb2\xc00\xa6\xcf\xd3\xd2\xa7\x9f\x85\\\xd8\xe94\xben\xf2\xf8\xfe\x80tj'\xc9]\xfe6\xb7\xd8\xc1\xc1\xcb\xb4\xa4\x9b\x15V\xb0\x96\x90\xf9\x97\xe2\xd5\xde\xb6\x07\xee\xab\xcb\xc7H\xf2S\xea\x82\xe4\x8c\xfff\x85\x84<\xc6\xc0XR\xef*o\xfd\x82\xbf\xabkw|\xf3\xffE\xcd\xe7\x18j\xd6\x8c\x86\xdb\x80\x99\x94\xc5Fg1\x88\x93SEe\x12\xdc\xd3\xcd\x92\x1c\xcd+J\xdb\xc1\xe0\xfc\xfdDk\x14#E\x89&\xfa2\xc9\x1b\x12\xbb\x18*v\x82G!\xa8\xe8\x13o\xcb\xb6\xc6\xa5\xa0\xf4\x8el)\xdc\xc5\x03I_J\xef\xd3K\x19j<\xcc\xdcF\xf3l\xf9A\x1e\x90\x19v\xd8\xb2;g\x0c\xd3\x952\xdf\xf5\xd1e\xaaZ\xc4\xc8D[\x18\x182\x87\xf3%F\x8f\x10\x16\xa2\x9aB\x902;\\\x07\x96F\x85\xd2?\x9aE\xb0Q\xea\xb9\xb9\xbe\x07\x00\x00\xff\xffPK\x07\x08\xa5+\xb8\xfc?\x01\x00\x00J	\x00\x00PK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\x85\x0d0O\xa5+\xb8\xfc?\x01\x00\x00J	\x00\x00	\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xa4\x81\x00\x00\x00\x00flat.avscUT\x05\x00\x01\xeb\xe8~]PK\x05\x06\x00\x00\x00\x00\x01\x00\x01\x00@\x00\x00\x00\x7f\x01\x00\x00\x00\x00"
+	data := "PK\x03\x04\x14\x00\x08\x00\x08\x00\x07\x1cN]\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00	\x00	\x00flat.avscUT\x05\x00\x01\xbf\xf7\xcej\xb4\x95\xc1N\xc30\x0c\x86\xef}\x8a\xa8\xe7\x1d8\xef\x8cx\x02n\x08U^\xe2\xae\x11i\xdc\xc5.Z\x87\xf6\xee\xa8E\x9a&h\xcbf\xc25\xdb\xf7\xc5\xf9\xed\xa4\x1f\x851\xa5\x0c\x1d\x96[S&\xb4\x94\\\xb9\x19\xd7\"\xb4\xd3\xdacd\x81\xee)\x80<\x7f\xfdP{\x0c\x8e\xcb\xady)\x8c1f\x14\x18s\x05\x88o\x91\x05\xdan\xfa\xbb1W~\x96\xe4\xe3\xbe\x9c\x88\xf3f\x1e?\xf4\x98\x86j\x94,\xf2\x97u\x875\xf4AF\xac,n\xb0\x82s	\x99\xef\x14\xdf\xec\xad\x1a\xe0&\xbb\xbc\xa3$?\xa5>\xca\\\x0e\x0f\xab\xd5&\xe4\x8e\"\xa3&\xde\x9b\xbc\xf9\x03\xfe\xae\xce\x9d\xf1\xc5\xff\x1f1\x9f(\xde;\xc5k^\xb4\\E\x94\x8c\xa7\xf7\x0e\xa3x\x192*\xa7\x8e,\xe9V\x8f\xc7d\xdfP\xaa\x1aZ\x1f\x86?)\xbaDB\x96\x82N\xf2\x8e\x89=\xc5EX\xd1\xb8\xa3$\xc8\xe8\x93\xe0\x94\x11kAi|rZ\xb8\xa6>I\xa3\xa5\xb9\xdf9j\xc1\xe7l\xc8a\x92/\xf9\xd6Q\x1b\x80Y\xc9\xea/G\x8b\xcc\xb0\xc7\x8a\xfdi\xe6I\x19\xbf\x06\xab\xb8\x1c\xbdS`\xc9\x92[~\xc1Vw\x84\x99\x81\xdf\x11\x05\x84\xf8K\xa9V	&\xa7\x05\xb5\xa5\x82vG\xab\x05\x1d\xd9\xca\xbb\xc5\xc9]\xb9	\x851\xaf\xc5\xf9s\x00PK\x07\x08\xcd\xf81PM\x01\x00\x00\xef	\x00\x00PK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\x07\x1cN]\xcd\xf81PM\x01\x00\x00\xef	\x00\x00	\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb4\x81\x00\x00\x00\x00flat.avscUT\x05\x00\x01\xbf\xf7\xcejPK\x05\x06\x00\x00\x00\x00\x01\x00\x01\x00@\x00\x00\x00\x8d\x01\x00\x00\x00\x00"
 	fs.Register(data)
 }
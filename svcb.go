@@ -0,0 +1,172 @@
+/*
+ * Copyright (c) 2019 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+// SVCB and HTTPS types (RFC 9460).
+const (
+	TypeSVCB  uint16 = dns.TypeSVCB
+	TypeHTTPS uint16 = dns.TypeHTTPS
+)
+
+var svcbKeyNames = map[uint16]string{
+	0: "mandatory",
+	1: "alpn",
+	2: "no-default-alpn",
+	3: "port",
+	4: "ipv4hint",
+	5: "ech",
+	6: "ipv6hint",
+}
+
+type SvcbRecord struct {
+	Type     string            `json:"type" msg:"type"`
+	Priority uint16            `json:"priority" msg:"priority"`
+	Target   string            `json:"target" msg:"target"`
+	Params   map[string]string `json:"params,omitempty" msg:"params"`
+}
+
+func svcbKeyName(key uint16) string {
+	if name, ok := svcbKeyNames[key]; ok {
+		return name
+	}
+	return "key" + strconv.Itoa(int(key))
+}
+
+// svcbRecords returns SVCB/HTTPS records in the answer section,
+// and the first parse error of skipped records.
+func svcbRecords(dnsMsg *dns.Msg) ([]SvcbRecord, error) {
+	var res []SvcbRecord
+	var firstErr error
+	for _, rr := range dnsMsg.Answer {
+		switch rr.(type) {
+		case *dns.SVCB, *dns.HTTPS:
+		default:
+			continue
+		}
+		// params are formatted from the wire format, as miekg/dns quotes and escapes them in its own way.
+		unknown := &dns.RFC3597{}
+		if err := unknown.ToRFC3597(rr); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		var t string
+		switch unknown.Hdr.Rrtype {
+		case TypeSVCB:
+			t = "SVCB"
+		case TypeHTTPS:
+			t = "HTTPS"
+		default:
+			continue
+		}
+		rdata, err := hex.DecodeString(unknown.Rdata)
+		if err == nil {
+			var r *SvcbRecord
+			if r, err = parseSvcb(rdata); err == nil {
+				r.Type = t
+				res = append(res, *r)
+				continue
+			}
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return res, firstErr
+}
+
+func parseSvcb(rdata []byte) (*SvcbRecord, error) {
+	if len(rdata) < 3 {
+		return nil, errors.New("short SVCB rdata")
+	}
+	r := &SvcbRecord{Priority: binary.BigEndian.Uint16(rdata)}
+	target, off, err := dns.UnpackDomainName(rdata, 2)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't parse SVCB target")
+	}
+	r.Target = target
+	for off < len(rdata) {
+		if len(rdata)-off < 4 {
+			return nil, errors.New("short SVCB param")
+		}
+		key := binary.BigEndian.Uint16(rdata[off:])
+		l := int(binary.BigEndian.Uint16(rdata[off+2:]))
+		off += 4
+		if len(rdata)-off < l {
+			return nil, errors.New("short SVCB param value")
+		}
+		if r.Params == nil {
+			r.Params = map[string]string{}
+		}
+		r.Params[svcbKeyName(key)] = svcbValue(key, rdata[off:off+l])
+		off += l
+	}
+	return r, nil
+}
+
+func svcbValue(key uint16, v []byte) string {
+	switch key {
+	case 0:
+		var keys []string
+		for i := 0; i+1 < len(v); i += 2 {
+			keys = append(keys, svcbKeyName(binary.BigEndian.Uint16(v[i:])))
+		}
+		return strings.Join(keys, ",")
+	case 1:
+		var alpn []string
+		for i := 0; i < len(v); {
+			l := int(v[i])
+			i++
+			if i+l > len(v) {
+				break
+			}
+			alpn = append(alpn, string(v[i:i+l]))
+			i += l
+		}
+		return strings.Join(alpn, ",")
+	case 3:
+		if len(v) == 2 {
+			return strconv.Itoa(int(binary.BigEndian.Uint16(v)))
+		}
+	case 4, 6:
+		size := net.IPv4len
+		if key == 6 {
+			size = net.IPv6len
+		}
+		var ips []string
+		for i := 0; i+size <= len(v); i += size {
+			ips = append(ips, net.IP(v[i:i+size]).String())
+		}
+		return strings.Join(ips, ",")
+	case 5:
+		return base64.StdEncoding.EncodeToString(v)
+	}
+	return hex.EncodeToString(v)
+}
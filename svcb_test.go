@@ -0,0 +1,60 @@
+/*
+ * Copyright (c) 2019 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"testing"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+func TestFlatDnstapSVCB(t *testing.T) {
+	q := newTestQuery("example.com.", dtap.TypeHTTPS)
+	// priority 1, target ".", alpn=h2,h3 port=443 ipv4hint=192.0.2.1
+	rr := `example.com. 300 IN TYPE65 \# 27 0001 00 0001 0006 026832026833 0003 0002 01bb 0004 0004 c0000201`
+	dt := newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, newTestResponse(q, rr, "example.com. 300 IN A 192.0.2.1"))
+
+	data, err := dtap.FlatDnstap(dt, &dtap.FlatConfig{})
+	assert.NoError(t, err)
+	assert.Nil(t, data.Svcb)
+
+	data, err = dtap.FlatDnstap(dt, &dtap.FlatConfig{EnableSVCB: true})
+	assert.NoError(t, err)
+	if assert.Len(t, data.Svcb, 1) {
+		assert.Equal(t, dtap.SvcbRecord{
+			Type:     "HTTPS",
+			Priority: 1,
+			Target:   ".",
+			Params: map[string]string{
+				"alpn":     "h2,h3",
+				"port":     "443",
+				"ipv4hint": "192.0.2.1",
+			},
+		}, data.Svcb[0])
+	}
+	assert.Contains(t, data.ToMapString()["svcb"], `"alpn":"h2,h3"`)
+
+	// alias mode
+	rr = `example.com. 300 IN SVCB 0 svc.example.net.`
+	dt = newTestDnstap(t, dnstap.Message_CLIENT_RESPONSE, newTestResponse(q, rr))
+	data, err = dtap.FlatDnstap(dt, &dtap.FlatConfig{EnableSVCB: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []dtap.SvcbRecord{{Type: "SVCB", Priority: 0, Target: "svc.example.net."}}, data.Svcb)
+}
@@ -0,0 +1,41 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+//go:generate go run tld_class_gen.go tlds-alpha-by-domain.txt
+
+// TLDClass returns gtld, cctld, new_gtld or special of tld, and unknown for names not delegated.
+// IDN TLDs are in the A-label form, e.g. xn--p1ai.
+func TLDClass(tld string) string {
+	if class, ok := tldClasses[strings.ToLower(strings.TrimSuffix(tld, "."))]; ok {
+		return class
+	}
+	return "unknown"
+}
+
+// publicSuffixTLD returns the TLD of the public suffix of qname by the public suffix list,
+// e.g. uk of co.uk for www.example.co.uk., names out of the list have their last label.
+func publicSuffixTLD(qname string) string {
+	suffix, _ := publicsuffix.PublicSuffix(strings.ToLower(strings.TrimSuffix(qname, ".")))
+	return suffix[strings.LastIndex(suffix, ".")+1:]
+}
@@ -0,0 +1,139 @@
+//go:build ignore
+// +build ignore
+
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// tld_class_gen.go generates tld_class_table.go from a TLD list
+// in the format of https://data.iana.org/TLD/tlds-alpha-by-domain.txt.
+// The bundled tlds-alpha-by-domain.txt is the TLDs of the ICANN section of the public suffix list
+// used by golang.org/x/net/publicsuffix, named by its first comment line.
+//
+//	go run tld_class_gen.go tlds-alpha-by-domain.txt
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// gTLDs are the generic TLDs delegated before the 2012 new gTLD program.
+var gTLDs = []string{
+	"aero", "asia", "biz", "cat", "com", "coop", "edu", "gov", "info", "int", "jobs",
+	"mil", "mobi", "museum", "name", "net", "org", "post", "pro", "tel", "travel", "xxx",
+}
+
+// specialTLDs are the infrastructure TLD and special-use names of RFC 6761, 6762 and 7686.
+var specialTLDs = []string{"arpa", "example", "invalid", "local", "localhost", "onion", "test"}
+
+// idnCcTLDs are the IDN ccTLDs of the fast track process.
+var idnCcTLDs = []string{
+	"xn--2scrj9c", "xn--3e0b707e", "xn--3hcrj9c", "xn--45br5cyl", "xn--45brj9c",
+	"xn--54b7fta0cc", "xn--80ao21a", "xn--90a3ac", "xn--90ae", "xn--90ais",
+	"xn--clchc0ea0b2g2a9gcd", "xn--d1alf", "xn--e1a4c", "xn--fiqs8s", "xn--fiqz9s",
+	"xn--fpcrj9c3d", "xn--fzc2c9e2c", "xn--gecrj9c", "xn--h2breg3eve", "xn--h2brj9c",
+	"xn--h2brj9c8c", "xn--j1amh", "xn--j6w193g", "xn--kprw13d", "xn--kpry57d",
+	"xn--l1acc", "xn--lgbbat1ad8j", "xn--mgb2ddes", "xn--mgb9awbf", "xn--mgba3a4f16a",
+	"xn--mgba3a4fra", "xn--mgbaam7a8h", "xn--mgbai9a5eva00b", "xn--mgbai9azgqp6j",
+	"xn--mgbayh7gpa", "xn--mgbbh1a", "xn--mgbbh1a71e", "xn--mgbc0a9azcg",
+	"xn--mgberp4a5d4a87g", "xn--mgberp4a5d4ar", "xn--mgbgu82a", "xn--mgbpl2fh",
+	"xn--mgbqly7c0a67fbc", "xn--mgbqly7cvafr", "xn--mgbtf8fl", "xn--mgbtx2b",
+	"xn--mgbx4cd0ab", "xn--mix082f", "xn--mix891f", "xn--nnx388a", "xn--node",
+	"xn--o3cw4h", "xn--ogbpf8fl", "xn--p1ai", "xn--pgbs0dh", "xn--qxam",
+	"xn--rvc1e0am3e", "xn--s9brj9c", "xn--wgbh1c", "xn--wgbl6a", "xn--xkc2al3hye2a",
+	"xn--xkc2dl3a5ee0h", "xn--y9a3aq", "xn--yfro4i67o", "xn--ygbi2ammx",
+}
+
+func main() {
+	if len(os.Args) != 2 {
+		log.Fatal("usage: go run tld_class_gen.go tlds-alpha-by-domain.txt")
+	}
+	f, err := os.Open(os.Args[1])
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	classes := map[string]string{}
+	for _, tld := range specialTLDs {
+		classes[tld] = "special"
+	}
+	cc := map[string]bool{}
+	for _, tld := range idnCcTLDs {
+		cc[tld] = true
+	}
+	g := map[string]bool{}
+	for _, tld := range gTLDs {
+		g[tld] = true
+	}
+	version := ""
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if strings.HasPrefix(line, "#") {
+			if version == "" {
+				version = strings.TrimSpace(strings.TrimPrefix(line, "#"))
+			}
+			continue
+		}
+		tld := strings.ToLower(line)
+		switch {
+		case tld == "":
+			continue
+		case classes[tld] != "":
+		case g[tld]:
+			classes[tld] = "gtld"
+		case len(tld) == 2 || cc[tld]:
+			classes[tld] = "cctld"
+		default:
+			classes[tld] = "new_gtld"
+		}
+	}
+	if err := s.Err(); err != nil {
+		log.Fatal(err)
+	}
+
+	tlds := make([]string, 0, len(classes))
+	for tld := range classes {
+		tlds = append(tlds, tld)
+	}
+	sort.Strings(tlds)
+	buf := &bytes.Buffer{}
+	fmt.Fprintln(buf, "// Code generated by go run tld_class_gen.go; DO NOT EDIT.")
+	fmt.Fprintln(buf)
+	fmt.Fprintf(buf, "// Source: %s\n\n", version)
+	fmt.Fprintln(buf, "package dtap")
+	fmt.Fprintln(buf)
+	fmt.Fprintln(buf, "var tldClasses = map[string]string{")
+	for _, tld := range tlds {
+		fmt.Fprintf(buf, "\t%q: %q,\n", tld, classes[tld])
+	}
+	fmt.Fprintln(buf, "}")
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile("tld_class_table.go", src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
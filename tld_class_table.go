@@ -0,0 +1,1554 @@
+// Code generated by go run tld_class_gen.go; DO NOT EDIT.
+
+// Source: Version 2019022100, TLDs of the ICANN section of the public suffix list revision 0e2a405f597a
+
+package dtap
+
+var tldClasses = map[string]string{
+	"aaa":                      "new_gtld",
+	"aarp":                     "new_gtld",
+	"abarth":                   "new_gtld",
+	"abb":                      "new_gtld",
+	"abbott":                   "new_gtld",
+	"abbvie":                   "new_gtld",
+	"abc":                      "new_gtld",
+	"able":                     "new_gtld",
+	"abogado":                  "new_gtld",
+	"abudhabi":                 "new_gtld",
+	"ac":                       "cctld",
+	"academy":                  "new_gtld",
+	"accenture":                "new_gtld",
+	"accountant":               "new_gtld",
+	"accountants":              "new_gtld",
+	"aco":                      "new_gtld",
+	"active":                   "new_gtld",
+	"actor":                    "new_gtld",
+	"ad":                       "cctld",
+	"adac":                     "new_gtld",
+	"ads":                      "new_gtld",
+	"adult":                    "new_gtld",
+	"ae":                       "cctld",
+	"aeg":                      "new_gtld",
+	"aero":                     "gtld",
+	"aetna":                    "new_gtld",
+	"af":                       "cctld",
+	"afamilycompany":           "new_gtld",
+	"afl":                      "new_gtld",
+	"africa":                   "new_gtld",
+	"ag":                       "cctld",
+	"agakhan":                  "new_gtld",
+	"agency":                   "new_gtld",
+	"ai":                       "cctld",
+	"aig":                      "new_gtld",
+	"aigo":                     "new_gtld",
+	"airbus":                   "new_gtld",
+	"airforce":                 "new_gtld",
+	"airtel":                   "new_gtld",
+	"akdn":                     "new_gtld",
+	"al":                       "cctld",
+	"alfaromeo":                "new_gtld",
+	"alibaba":                  "new_gtld",
+	"alipay":                   "new_gtld",
+	"allfinanz":                "new_gtld",
+	"allstate":                 "new_gtld",
+	"ally":                     "new_gtld",
+	"alsace":                   "new_gtld",
+	"alstom":                   "new_gtld",
+	"am":                       "cctld",
+	"americanexpress":          "new_gtld",
+	"americanfamily":           "new_gtld",
+	"amex":                     "new_gtld",
+	"amfam":                    "new_gtld",
+	"amica":                    "new_gtld",
+	"amsterdam":                "new_gtld",
+	"analytics":                "new_gtld",
+	"android":                  "new_gtld",
+	"anquan":                   "new_gtld",
+	"anz":                      "new_gtld",
+	"ao":                       "cctld",
+	"aol":                      "new_gtld",
+	"apartments":               "new_gtld",
+	"app":                      "new_gtld",
+	"apple":                    "new_gtld",
+	"aq":                       "cctld",
+	"aquarelle":                "new_gtld",
+	"ar":                       "cctld",
+	"arab":                     "new_gtld",
+	"aramco":                   "new_gtld",
+	"archi":                    "new_gtld",
+	"army":                     "new_gtld",
+	"arpa":                     "special",
+	"art":                      "new_gtld",
+	"arte":                     "new_gtld",
+	"as":                       "cctld",
+	"asda":                     "new_gtld",
+	"asia":                     "gtld",
+	"associates":               "new_gtld",
+	"at":                       "cctld",
+	"athleta":                  "new_gtld",
+	"attorney":                 "new_gtld",
+	"au":                       "cctld",
+	"auction":                  "new_gtld",
+	"audi":                     "new_gtld",
+	"audible":                  "new_gtld",
+	"audio":                    "new_gtld",
+	"auspost":                  "new_gtld",
+	"author":                   "new_gtld",
+	"auto":                     "new_gtld",
+	"autos":                    "new_gtld",
+	"avianca":                  "new_gtld",
+	"aw":                       "cctld",
+	"aws":                      "new_gtld",
+	"ax":                       "cctld",
+	"axa":                      "new_gtld",
+	"az":                       "cctld",
+	"azure":                    "new_gtld",
+	"ba":                       "cctld",
+	"baby":                     "new_gtld",
+	"baidu":                    "new_gtld",
+	"banamex":                  "new_gtld",
+	"bananarepublic":           "new_gtld",
+	"band":                     "new_gtld",
+	"bank":                     "new_gtld",
+	"bar":                      "new_gtld",
+	"barcelona":                "new_gtld",
+	"barclaycard":              "new_gtld",
+	"barclays":                 "new_gtld",
+	"barefoot":                 "new_gtld",
+	"bargains":                 "new_gtld",
+	"baseball":                 "new_gtld",
+	"basketball":               "new_gtld",
+	"bauhaus":                  "new_gtld",
+	"bayern":                   "new_gtld",
+	"bb":                       "cctld",
+	"bbc":                      "new_gtld",
+	"bbt":                      "new_gtld",
+	"bbva":                     "new_gtld",
+	"bcg":                      "new_gtld",
+	"bcn":                      "new_gtld",
+	"bd":                       "cctld",
+	"be":                       "cctld",
+	"beats":                    "new_gtld",
+	"beauty":                   "new_gtld",
+	"beer":                     "new_gtld",
+	"bentley":                  "new_gtld",
+	"berlin":                   "new_gtld",
+	"best":                     "new_gtld",
+	"bestbuy":                  "new_gtld",
+	"bet":                      "new_gtld",
+	"bf":                       "cctld",
+	"bg":                       "cctld",
+	"bh":                       "cctld",
+	"bharti":                   "new_gtld",
+	"bi":                       "cctld",
+	"bible":                    "new_gtld",
+	"bid":                      "new_gtld",
+	"bike":                     "new_gtld",
+	"bing":                     "new_gtld",
+	"bingo":                    "new_gtld",
+	"bio":                      "new_gtld",
+	"biz":                      "gtld",
+	"bj":                       "cctld",
+	"black":                    "new_gtld",
+	"blackfriday":              "new_gtld",
+	"blockbuster":              "new_gtld",
+	"blog":                     "new_gtld",
+	"bloomberg":                "new_gtld",
+	"blue":                     "new_gtld",
+	"bm":                       "cctld",
+	"bms":                      "new_gtld",
+	"bmw":                      "new_gtld",
+	"bn":                       "cctld",
+	"bnl":                      "new_gtld",
+	"bnpparibas":               "new_gtld",
+	"bo":                       "cctld",
+	"boats":                    "new_gtld",
+	"boehringer":               "new_gtld",
+	"bofa":                     "new_gtld",
+	"bom":                      "new_gtld",
+	"bond":                     "new_gtld",
+	"boo":                      "new_gtld",
+	"book":                     "new_gtld",
+	"booking":                  "new_gtld",
+	"bosch":                    "new_gtld",
+	"bostik":                   "new_gtld",
+	"boston":                   "new_gtld",
+	"bot":                      "new_gtld",
+	"boutique":                 "new_gtld",
+	"box":                      "new_gtld",
+	"br":                       "cctld",
+	"bradesco":                 "new_gtld",
+	"bridgestone":              "new_gtld",
+	"broadway":                 "new_gtld",
+	"broker":                   "new_gtld",
+	"brother":                  "new_gtld",
+	"brussels":                 "new_gtld",
+	"bs":                       "cctld",
+	"bt":                       "cctld",
+	"budapest":                 "new_gtld",
+	"bugatti":                  "new_gtld",
+	"build":                    "new_gtld",
+	"builders":                 "new_gtld",
+	"business":                 "new_gtld",
+	"buy":                      "new_gtld",
+	"buzz":                     "new_gtld",
+	"bv":                       "cctld",
+	"bw":                       "cctld",
+	"by":                       "cctld",
+	"bz":                       "cctld",
+	"bzh":                      "new_gtld",
+	"ca":                       "cctld",
+	"cab":                      "new_gtld",
+	"cafe":                     "new_gtld",
+	"cal":                      "new_gtld",
+	"call":                     "new_gtld",
+	"calvinklein":              "new_gtld",
+	"cam":                      "new_gtld",
+	"camera":                   "new_gtld",
+	"camp":                     "new_gtld",
+	"cancerresearch":           "new_gtld",
+	"canon":                    "new_gtld",
+	"capetown":                 "new_gtld",
+	"capital":                  "new_gtld",
+	"capitalone":               "new_gtld",
+	"car":                      "new_gtld",
+	"caravan":                  "new_gtld",
+	"cards":                    "new_gtld",
+	"care":                     "new_gtld",
+	"career":                   "new_gtld",
+	"careers":                  "new_gtld",
+	"cars":                     "new_gtld",
+	"cartier":                  "new_gtld",
+	"casa":                     "new_gtld",
+	"case":                     "new_gtld",
+	"caseih":                   "new_gtld",
+	"cash":                     "new_gtld",
+	"casino":                   "new_gtld",
+	"cat":                      "gtld",
+	"catering":                 "new_gtld",
+	"catholic":                 "new_gtld",
+	"cba":                      "new_gtld",
+	"cbn":                      "new_gtld",
+	"cbre":                     "new_gtld",
+	"cbs":                      "new_gtld",
+	"cc":                       "cctld",
+	"cd":                       "cctld",
+	"ceb":                      "new_gtld",
+	"center":                   "new_gtld",
+	"ceo":                      "new_gtld",
+	"cern":                     "new_gtld",
+	"cf":                       "cctld",
+	"cfa":                      "new_gtld",
+	"cfd":                      "new_gtld",
+	"cg":                       "cctld",
+	"ch":                       "cctld",
+	"chanel":                   "new_gtld",
+	"channel":                  "new_gtld",
+	"charity":                  "new_gtld",
+	"chase":                    "new_gtld",
+	"chat":                     "new_gtld",
+	"cheap":                    "new_gtld",
+	"chintai":                  "new_gtld",
+	"christmas":                "new_gtld",
+	"chrome":                   "new_gtld",
+	"chrysler":                 "new_gtld",
+	"church":                   "new_gtld",
+	"ci":                       "cctld",
+	"cipriani":                 "new_gtld",
+	"circle":                   "new_gtld",
+	"cisco":                    "new_gtld",
+	"citadel":                  "new_gtld",
+	"citi":                     "new_gtld",
+	"citic":                    "new_gtld",
+	"city":                     "new_gtld",
+	"cityeats":                 "new_gtld",
+	"ck":                       "cctld",
+	"cl":                       "cctld",
+	"claims":                   "new_gtld",
+	"cleaning":                 "new_gtld",
+	"click":                    "new_gtld",
+	"clinic":                   "new_gtld",
+	"clinique":                 "new_gtld",
+	"clothing":                 "new_gtld",
+	"cloud":                    "new_gtld",
+	"club":                     "new_gtld",
+	"clubmed":                  "new_gtld",
+	"cm":                       "cctld",
+	"cn":                       "cctld",
+	"co":                       "cctld",
+	"coach":                    "new_gtld",
+	"codes":                    "new_gtld",
+	"coffee":                   "new_gtld",
+	"college":                  "new_gtld",
+	"cologne":                  "new_gtld",
+	"com":                      "gtld",
+	"comcast":                  "new_gtld",
+	"commbank":                 "new_gtld",
+	"community":                "new_gtld",
+	"company":                  "new_gtld",
+	"compare":                  "new_gtld",
+	"computer":                 "new_gtld",
+	"comsec":                   "new_gtld",
+	"condos":                   "new_gtld",
+	"construction":             "new_gtld",
+	"consulting":               "new_gtld",
+	"contact":                  "new_gtld",
+	"contractors":              "new_gtld",
+	"cooking":                  "new_gtld",
+	"cookingchannel":           "new_gtld",
+	"cool":                     "new_gtld",
+	"coop":                     "gtld",
+	"corsica":                  "new_gtld",
+	"country":                  "new_gtld",
+	"coupon":                   "new_gtld",
+	"coupons":                  "new_gtld",
+	"courses":                  "new_gtld",
+	"cr":                       "cctld",
+	"credit":                   "new_gtld",
+	"creditcard":               "new_gtld",
+	"creditunion":              "new_gtld",
+	"cricket":                  "new_gtld",
+	"crown":                    "new_gtld",
+	"crs":                      "new_gtld",
+	"cruise":                   "new_gtld",
+	"cruises":                  "new_gtld",
+	"csc":                      "new_gtld",
+	"cu":                       "cctld",
+	"cuisinella":               "new_gtld",
+	"cv":                       "cctld",
+	"cw":                       "cctld",
+	"cx":                       "cctld",
+	"cy":                       "cctld",
+	"cymru":                    "new_gtld",
+	"cyou":                     "new_gtld",
+	"cz":                       "cctld",
+	"dabur":                    "new_gtld",
+	"dad":                      "new_gtld",
+	"dance":                    "new_gtld",
+	"data":                     "new_gtld",
+	"date":                     "new_gtld",
+	"dating":                   "new_gtld",
+	"datsun":                   "new_gtld",
+	"day":                      "new_gtld",
+	"dclk":                     "new_gtld",
+	"dds":                      "new_gtld",
+	"de":                       "cctld",
+	"deal":                     "new_gtld",
+	"dealer":                   "new_gtld",
+	"deals":                    "new_gtld",
+	"degree":                   "new_gtld",
+	"delivery":                 "new_gtld",
+	"dell":                     "new_gtld",
+	"deloitte":                 "new_gtld",
+	"delta":                    "new_gtld",
+	"democrat":                 "new_gtld",
+	"dental":                   "new_gtld",
+	"dentist":                  "new_gtld",
+	"desi":                     "new_gtld",
+	"design":                   "new_gtld",
+	"dev":                      "new_gtld",
+	"dhl":                      "new_gtld",
+	"diamonds":                 "new_gtld",
+	"diet":                     "new_gtld",
+	"digital":                  "new_gtld",
+	"direct":                   "new_gtld",
+	"directory":                "new_gtld",
+	"discount":                 "new_gtld",
+	"discover":                 "new_gtld",
+	"dish":                     "new_gtld",
+	"diy":                      "new_gtld",
+	"dj":                       "cctld",
+	"dk":                       "cctld",
+	"dm":                       "cctld",
+	"dnp":                      "new_gtld",
+	"do":                       "cctld",
+	"docs":                     "new_gtld",
+	"doctor":                   "new_gtld",
+	"dodge":                    "new_gtld",
+	"dog":                      "new_gtld",
+	"doha":                     "new_gtld",
+	"domains":                  "new_gtld",
+	"dot":                      "new_gtld",
+	"download":                 "new_gtld",
+	"drive":                    "new_gtld",
+	"dtv":                      "new_gtld",
+	"dubai":                    "new_gtld",
+	"duck":                     "new_gtld",
+	"dunlop":                   "new_gtld",
+	"duns":                     "new_gtld",
+	"dupont":                   "new_gtld",
+	"durban":                   "new_gtld",
+	"dvag":                     "new_gtld",
+	"dvr":                      "new_gtld",
+	"dz":                       "cctld",
+	"earth":                    "new_gtld",
+	"eat":                      "new_gtld",
+	"ec":                       "cctld",
+	"eco":                      "new_gtld",
+	"edeka":                    "new_gtld",
+	"edu":                      "gtld",
+	"education":                "new_gtld",
+	"ee":                       "cctld",
+	"eg":                       "cctld",
+	"email":                    "new_gtld",
+	"emerck":                   "new_gtld",
+	"energy":                   "new_gtld",
+	"engineer":                 "new_gtld",
+	"engineering":              "new_gtld",
+	"enterprises":              "new_gtld",
+	"epson":                    "new_gtld",
+	"equipment":                "new_gtld",
+	"er":                       "cctld",
+	"ericsson":                 "new_gtld",
+	"erni":                     "new_gtld",
+	"es":                       "cctld",
+	"esq":                      "new_gtld",
+	"estate":                   "new_gtld",
+	"esurance":                 "new_gtld",
+	"et":                       "cctld",
+	"etisalat":                 "new_gtld",
+	"eu":                       "cctld",
+	"eurovision":               "new_gtld",
+	"eus":                      "new_gtld",
+	"events":                   "new_gtld",
+	"everbank":                 "new_gtld",
+	"example":                  "special",
+	"exchange":                 "new_gtld",
+	"expert":                   "new_gtld",
+	"exposed":                  "new_gtld",
+	"express":                  "new_gtld",
+	"extraspace":               "new_gtld",
+	"fage":                     "new_gtld",
+	"fail":                     "new_gtld",
+	"fairwinds":                "new_gtld",
+	"faith":                    "new_gtld",
+	"family":                   "new_gtld",
+	"fan":                      "new_gtld",
+	"fans":                     "new_gtld",
+	"farm":                     "new_gtld",
+	"farmers":                  "new_gtld",
+	"fashion":                  "new_gtld",
+	"fast":                     "new_gtld",
+	"fedex":                    "new_gtld",
+	"feedback":                 "new_gtld",
+	"ferrari":                  "new_gtld",
+	"ferrero":                  "new_gtld",
+	"fi":                       "cctld",
+	"fiat":                     "new_gtld",
+	"fidelity":                 "new_gtld",
+	"fido":                     "new_gtld",
+	"film":                     "new_gtld",
+	"final":                    "new_gtld",
+	"finance":                  "new_gtld",
+	"financial":                "new_gtld",
+	"fire":                     "new_gtld",
+	"firestone":                "new_gtld",
+	"firmdale":                 "new_gtld",
+	"fish":                     "new_gtld",
+	"fishing":                  "new_gtld",
+	"fit":                      "new_gtld",
+	"fitness":                  "new_gtld",
+	"fj":                       "cctld",
+	"fk":                       "cctld",
+	"flickr":                   "new_gtld",
+	"flights":                  "new_gtld",
+	"flir":                     "new_gtld",
+	"florist":                  "new_gtld",
+	"flowers":                  "new_gtld",
+	"fly":                      "new_gtld",
+	"fm":                       "cctld",
+	"fo":                       "cctld",
+	"foo":                      "new_gtld",
+	"food":                     "new_gtld",
+	"foodnetwork":              "new_gtld",
+	"football":                 "new_gtld",
+	"ford":                     "new_gtld",
+	"forex":                    "new_gtld",
+	"forsale":                  "new_gtld",
+	"forum":                    "new_gtld",
+	"foundation":               "new_gtld",
+	"fox":                      "new_gtld",
+	"fr":                       "cctld",
+	"free":                     "new_gtld",
+	"fresenius":                "new_gtld",
+	"frl":                      "new_gtld",
+	"frogans":                  "new_gtld",
+	"frontdoor":                "new_gtld",
+	"frontier":                 "new_gtld",
+	"ftr":                      "new_gtld",
+	"fujitsu":                  "new_gtld",
+	"fujixerox":                "new_gtld",
+	"fun":                      "new_gtld",
+	"fund":                     "new_gtld",
+	"furniture":                "new_gtld",
+	"futbol":                   "new_gtld",
+	"fyi":                      "new_gtld",
+	"ga":                       "cctld",
+	"gal":                      "new_gtld",
+	"gallery":                  "new_gtld",
+	"gallo":                    "new_gtld",
+	"gallup":                   "new_gtld",
+	"game":                     "new_gtld",
+	"games":                    "new_gtld",
+	"gap":                      "new_gtld",
+	"garden":                   "new_gtld",
+	"gb":                       "cctld",
+	"gbiz":                     "new_gtld",
+	"gd":                       "cctld",
+	"gdn":                      "new_gtld",
+	"ge":                       "cctld",
+	"gea":                      "new_gtld",
+	"gent":                     "new_gtld",
+	"genting":                  "new_gtld",
+	"george":                   "new_gtld",
+	"gf":                       "cctld",
+	"gg":                       "cctld",
+	"ggee":                     "new_gtld",
+	"gh":                       "cctld",
+	"gi":                       "cctld",
+	"gift":                     "new_gtld",
+	"gifts":                    "new_gtld",
+	"gives":                    "new_gtld",
+	"giving":                   "new_gtld",
+	"gl":                       "cctld",
+	"glade":                    "new_gtld",
+	"glass":                    "new_gtld",
+	"gle":                      "new_gtld",
+	"global":                   "new_gtld",
+	"globo":                    "new_gtld",
+	"gm":                       "cctld",
+	"gmail":                    "new_gtld",
+	"gmbh":                     "new_gtld",
+	"gmo":                      "new_gtld",
+	"gmx":                      "new_gtld",
+	"gn":                       "cctld",
+	"godaddy":                  "new_gtld",
+	"gold":                     "new_gtld",
+	"goldpoint":                "new_gtld",
+	"golf":                     "new_gtld",
+	"goo":                      "new_gtld",
+	"goodyear":                 "new_gtld",
+	"goog":                     "new_gtld",
+	"google":                   "new_gtld",
+	"gop":                      "new_gtld",
+	"got":                      "new_gtld",
+	"gov":                      "gtld",
+	"gp":                       "cctld",
+	"gq":                       "cctld",
+	"gr":                       "cctld",
+	"grainger":                 "new_gtld",
+	"graphics":                 "new_gtld",
+	"gratis":                   "new_gtld",
+	"green":                    "new_gtld",
+	"gripe":                    "new_gtld",
+	"grocery":                  "new_gtld",
+	"group":                    "new_gtld",
+	"gs":                       "cctld",
+	"gt":                       "cctld",
+	"gu":                       "cctld",
+	"guardian":                 "new_gtld",
+	"gucci":                    "new_gtld",
+	"guge":                     "new_gtld",
+	"guide":                    "new_gtld",
+	"guitars":                  "new_gtld",
+	"guru":                     "new_gtld",
+	"gw":                       "cctld",
+	"gy":                       "cctld",
+	"hair":                     "new_gtld",
+	"hamburg":                  "new_gtld",
+	"hangout":                  "new_gtld",
+	"haus":                     "new_gtld",
+	"hbo":                      "new_gtld",
+	"hdfc":                     "new_gtld",
+	"hdfcbank":                 "new_gtld",
+	"health":                   "new_gtld",
+	"healthcare":               "new_gtld",
+	"help":                     "new_gtld",
+	"helsinki":                 "new_gtld",
+	"here":                     "new_gtld",
+	"hermes":                   "new_gtld",
+	"hgtv":                     "new_gtld",
+	"hiphop":                   "new_gtld",
+	"hisamitsu":                "new_gtld",
+	"hitachi":                  "new_gtld",
+	"hiv":                      "new_gtld",
+	"hk":                       "cctld",
+	"hkt":                      "new_gtld",
+	"hm":                       "cctld",
+	"hn":                       "cctld",
+	"hockey":                   "new_gtld",
+	"holdings":                 "new_gtld",
+	"holiday":                  "new_gtld",
+	"homedepot":                "new_gtld",
+	"homegoods":                "new_gtld",
+	"homes":                    "new_gtld",
+	"homesense":                "new_gtld",
+	"honda":                    "new_gtld",
+	"honeywell":                "new_gtld",
+	"horse":                    "new_gtld",
+	"hospital":                 "new_gtld",
+	"host":                     "new_gtld",
+	"hosting":                  "new_gtld",
+	"hot":                      "new_gtld",
+	"hoteles":                  "new_gtld",
+	"hotels":                   "new_gtld",
+	"hotmail":                  "new_gtld",
+	"house":                    "new_gtld",
+	"how":                      "new_gtld",
+	"hr":                       "cctld",
+	"hsbc":                     "new_gtld",
+	"ht":                       "cctld",
+	"hu":                       "cctld",
+	"hughes":                   "new_gtld",
+	"hyatt":                    "new_gtld",
+	"hyundai":                  "new_gtld",
+	"ibm":                      "new_gtld",
+	"icbc":                     "new_gtld",
+	"ice":                      "new_gtld",
+	"icu":                      "new_gtld",
+	"id":                       "cctld",
+	"ie":                       "cctld",
+	"ieee":                     "new_gtld",
+	"ifm":                      "new_gtld",
+	"ikano":                    "new_gtld",
+	"il":                       "cctld",
+	"im":                       "cctld",
+	"imamat":                   "new_gtld",
+	"imdb":                     "new_gtld",
+	"immo":                     "new_gtld",
+	"immobilien":               "new_gtld",
+	"in":                       "cctld",
+	"inc":                      "new_gtld",
+	"industries":               "new_gtld",
+	"infiniti":                 "new_gtld",
+	"info":                     "gtld",
+	"ing":                      "new_gtld",
+	"ink":                      "new_gtld",
+	"institute":                "new_gtld",
+	"insurance":                "new_gtld",
+	"insure":                   "new_gtld",
+	"int":                      "gtld",
+	"intel":                    "new_gtld",
+	"international":            "new_gtld",
+	"intuit":                   "new_gtld",
+	"invalid":                  "special",
+	"investments":              "new_gtld",
+	"io":                       "cctld",
+	"ipiranga":                 "new_gtld",
+	"iq":                       "cctld",
+	"ir":                       "cctld",
+	"irish":                    "new_gtld",
+	"is":                       "cctld",
+	"iselect":                  "new_gtld",
+	"ismaili":                  "new_gtld",
+	"ist":                      "new_gtld",
+	"istanbul":                 "new_gtld",
+	"it":                       "cctld",
+	"itau":                     "new_gtld",
+	"itv":                      "new_gtld",
+	"iveco":                    "new_gtld",
+	"jaguar":                   "new_gtld",
+	"java":                     "new_gtld",
+	"jcb":                      "new_gtld",
+	"jcp":                      "new_gtld",
+	"je":                       "cctld",
+	"jeep":                     "new_gtld",
+	"jetzt":                    "new_gtld",
+	"jewelry":                  "new_gtld",
+	"jio":                      "new_gtld",
+	"jll":                      "new_gtld",
+	"jm":                       "cctld",
+	"jmp":                      "new_gtld",
+	"jnj":                      "new_gtld",
+	"jo":                       "cctld",
+	"jobs":                     "gtld",
+	"joburg":                   "new_gtld",
+	"jot":                      "new_gtld",
+	"joy":                      "new_gtld",
+	"jp":                       "cctld",
+	"jpmorgan":                 "new_gtld",
+	"jprs":                     "new_gtld",
+	"juegos":                   "new_gtld",
+	"juniper":                  "new_gtld",
+	"kaufen":                   "new_gtld",
+	"kddi":                     "new_gtld",
+	"ke":                       "cctld",
+	"kerryhotels":              "new_gtld",
+	"kerrylogistics":           "new_gtld",
+	"kerryproperties":          "new_gtld",
+	"kfh":                      "new_gtld",
+	"kg":                       "cctld",
+	"kh":                       "cctld",
+	"ki":                       "cctld",
+	"kia":                      "new_gtld",
+	"kim":                      "new_gtld",
+	"kinder":                   "new_gtld",
+	"kindle":                   "new_gtld",
+	"kitchen":                  "new_gtld",
+	"kiwi":                     "new_gtld",
+	"km":                       "cctld",
+	"kn":                       "cctld",
+	"koeln":                    "new_gtld",
+	"komatsu":                  "new_gtld",
+	"kosher":                   "new_gtld",
+	"kp":                       "cctld",
+	"kpmg":                     "new_gtld",
+	"kpn":                      "new_gtld",
+	"kr":                       "cctld",
+	"krd":                      "new_gtld",
+	"kred":                     "new_gtld",
+	"kuokgroup":                "new_gtld",
+	"kw":                       "cctld",
+	"ky":                       "cctld",
+	"kyoto":                    "new_gtld",
+	"kz":                       "cctld",
+	"la":                       "cctld",
+	"lacaixa":                  "new_gtld",
+	"ladbrokes":                "new_gtld",
+	"lamborghini":              "new_gtld",
+	"lamer":                    "new_gtld",
+	"lancaster":                "new_gtld",
+	"lancia":                   "new_gtld",
+	"lancome":                  "new_gtld",
+	"land":                     "new_gtld",
+	"landrover":                "new_gtld",
+	"lanxess":                  "new_gtld",
+	"lasalle":                  "new_gtld",
+	"lat":                      "new_gtld",
+	"latino":                   "new_gtld",
+	"latrobe":                  "new_gtld",
+	"law":                      "new_gtld",
+	"lawyer":                   "new_gtld",
+	"lb":                       "cctld",
+	"lc":                       "cctld",
+	"lds":                      "new_gtld",
+	"lease":                    "new_gtld",
+	"leclerc":                  "new_gtld",
+	"lefrak":                   "new_gtld",
+	"legal":                    "new_gtld",
+	"lego":                     "new_gtld",
+	"lexus":                    "new_gtld",
+	"lgbt":                     "new_gtld",
+	"li":                       "cctld",
+	"liaison":                  "new_gtld",
+	"lidl":                     "new_gtld",
+	"life":                     "new_gtld",
+	"lifeinsurance":            "new_gtld",
+	"lifestyle":                "new_gtld",
+	"lighting":                 "new_gtld",
+	"like":                     "new_gtld",
+	"lilly":                    "new_gtld",
+	"limited":                  "new_gtld",
+	"limo":                     "new_gtld",
+	"lincoln":                  "new_gtld",
+	"linde":                    "new_gtld",
+	"link":                     "new_gtld",
+	"lipsy":                    "new_gtld",
+	"live":                     "new_gtld",
+	"living":                   "new_gtld",
+	"lixil":                    "new_gtld",
+	"lk":                       "cctld",
+	"llc":                      "new_gtld",
+	"loan":                     "new_gtld",
+	"loans":                    "new_gtld",
+	"local":                    "special",
+	"localhost":                "special",
+	"locker":                   "new_gtld",
+	"locus":                    "new_gtld",
+	"loft":                     "new_gtld",
+	"lol":                      "new_gtld",
+	"london":                   "new_gtld",
+	"lotte":                    "new_gtld",
+	"lotto":                    "new_gtld",
+	"love":                     "new_gtld",
+	"lpl":                      "new_gtld",
+	"lplfinancial":             "new_gtld",
+	"lr":                       "cctld",
+	"ls":                       "cctld",
+	"lt":                       "cctld",
+	"ltd":                      "new_gtld",
+	"ltda":                     "new_gtld",
+	"lu":                       "cctld",
+	"lundbeck":                 "new_gtld",
+	"lupin":                    "new_gtld",
+	"luxe":                     "new_gtld",
+	"luxury":                   "new_gtld",
+	"lv":                       "cctld",
+	"ly":                       "cctld",
+	"ma":                       "cctld",
+	"macys":                    "new_gtld",
+	"madrid":                   "new_gtld",
+	"maif":                     "new_gtld",
+	"maison":                   "new_gtld",
+	"makeup":                   "new_gtld",
+	"man":                      "new_gtld",
+	"management":               "new_gtld",
+	"mango":                    "new_gtld",
+	"map":                      "new_gtld",
+	"market":                   "new_gtld",
+	"marketing":                "new_gtld",
+	"markets":                  "new_gtld",
+	"marriott":                 "new_gtld",
+	"marshalls":                "new_gtld",
+	"maserati":                 "new_gtld",
+	"mattel":                   "new_gtld",
+	"mba":                      "new_gtld",
+	"mc":                       "cctld",
+	"mckinsey":                 "new_gtld",
+	"md":                       "cctld",
+	"me":                       "cctld",
+	"med":                      "new_gtld",
+	"media":                    "new_gtld",
+	"meet":                     "new_gtld",
+	"melbourne":                "new_gtld",
+	"meme":                     "new_gtld",
+	"memorial":                 "new_gtld",
+	"men":                      "new_gtld",
+	"menu":                     "new_gtld",
+	"merckmsd":                 "new_gtld",
+	"metlife":                  "new_gtld",
+	"mg":                       "cctld",
+	"mh":                       "cctld",
+	"miami":                    "new_gtld",
+	"microsoft":                "new_gtld",
+	"mil":                      "gtld",
+	"mini":                     "new_gtld",
+	"mint":                     "new_gtld",
+	"mit":                      "new_gtld",
+	"mitsubishi":               "new_gtld",
+	"mk":                       "cctld",
+	"ml":                       "cctld",
+	"mlb":                      "new_gtld",
+	"mls":                      "new_gtld",
+	"mm":                       "cctld",
+	"mma":                      "new_gtld",
+	"mn":                       "cctld",
+	"mo":                       "cctld",
+	"mobi":                     "gtld",
+	"mobile":                   "new_gtld",
+	"mobily":                   "new_gtld",
+	"moda":                     "new_gtld",
+	"moe":                      "new_gtld",
+	"moi":                      "new_gtld",
+	"mom":                      "new_gtld",
+	"monash":                   "new_gtld",
+	"money":                    "new_gtld",
+	"monster":                  "new_gtld",
+	"mopar":                    "new_gtld",
+	"mormon":                   "new_gtld",
+	"mortgage":                 "new_gtld",
+	"moscow":                   "new_gtld",
+	"moto":                     "new_gtld",
+	"motorcycles":              "new_gtld",
+	"mov":                      "new_gtld",
+	"movie":                    "new_gtld",
+	"movistar":                 "new_gtld",
+	"mp":                       "cctld",
+	"mq":                       "cctld",
+	"mr":                       "cctld",
+	"ms":                       "cctld",
+	"msd":                      "new_gtld",
+	"mt":                       "cctld",
+	"mtn":                      "new_gtld",
+	"mtr":                      "new_gtld",
+	"mu":                       "cctld",
+	"museum":                   "gtld",
+	"mutual":                   "new_gtld",
+	"mv":                       "cctld",
+	"mw":                       "cctld",
+	"mx":                       "cctld",
+	"my":                       "cctld",
+	"mz":                       "cctld",
+	"na":                       "cctld",
+	"nab":                      "new_gtld",
+	"nadex":                    "new_gtld",
+	"nagoya":                   "new_gtld",
+	"name":                     "gtld",
+	"nationwide":               "new_gtld",
+	"natura":                   "new_gtld",
+	"navy":                     "new_gtld",
+	"nba":                      "new_gtld",
+	"nc":                       "cctld",
+	"ne":                       "cctld",
+	"nec":                      "new_gtld",
+	"net":                      "gtld",
+	"netbank":                  "new_gtld",
+	"netflix":                  "new_gtld",
+	"network":                  "new_gtld",
+	"neustar":                  "new_gtld",
+	"new":                      "new_gtld",
+	"newholland":               "new_gtld",
+	"news":                     "new_gtld",
+	"next":                     "new_gtld",
+	"nextdirect":               "new_gtld",
+	"nexus":                    "new_gtld",
+	"nf":                       "cctld",
+	"nfl":                      "new_gtld",
+	"ng":                       "cctld",
+	"ngo":                      "new_gtld",
+	"nhk":                      "new_gtld",
+	"ni":                       "cctld",
+	"nico":                     "new_gtld",
+	"nike":                     "new_gtld",
+	"nikon":                    "new_gtld",
+	"ninja":                    "new_gtld",
+	"nissan":                   "new_gtld",
+	"nissay":                   "new_gtld",
+	"nl":                       "cctld",
+	"no":                       "cctld",
+	"nokia":                    "new_gtld",
+	"northwesternmutual":       "new_gtld",
+	"norton":                   "new_gtld",
+	"now":                      "new_gtld",
+	"nowruz":                   "new_gtld",
+	"nowtv":                    "new_gtld",
+	"np":                       "cctld",
+	"nr":                       "cctld",
+	"nra":                      "new_gtld",
+	"nrw":                      "new_gtld",
+	"ntt":                      "new_gtld",
+	"nu":                       "cctld",
+	"nyc":                      "new_gtld",
+	"nz":                       "cctld",
+	"obi":                      "new_gtld",
+	"observer":                 "new_gtld",
+	"off":                      "new_gtld",
+	"office":                   "new_gtld",
+	"okinawa":                  "new_gtld",
+	"olayan":                   "new_gtld",
+	"olayangroup":              "new_gtld",
+	"oldnavy":                  "new_gtld",
+	"ollo":                     "new_gtld",
+	"om":                       "cctld",
+	"omega":                    "new_gtld",
+	"one":                      "new_gtld",
+	"ong":                      "new_gtld",
+	"onion":                    "special",
+	"onl":                      "new_gtld",
+	"online":                   "new_gtld",
+	"onyourside":               "new_gtld",
+	"ooo":                      "new_gtld",
+	"open":                     "new_gtld",
+	"oracle":                   "new_gtld",
+	"orange":                   "new_gtld",
+	"org":                      "gtld",
+	"organic":                  "new_gtld",
+	"origins":                  "new_gtld",
+	"osaka":                    "new_gtld",
+	"otsuka":                   "new_gtld",
+	"ott":                      "new_gtld",
+	"ovh":                      "new_gtld",
+	"pa":                       "cctld",
+	"page":                     "new_gtld",
+	"panasonic":                "new_gtld",
+	"paris":                    "new_gtld",
+	"pars":                     "new_gtld",
+	"partners":                 "new_gtld",
+	"parts":                    "new_gtld",
+	"party":                    "new_gtld",
+	"passagens":                "new_gtld",
+	"pay":                      "new_gtld",
+	"pccw":                     "new_gtld",
+	"pe":                       "cctld",
+	"pet":                      "new_gtld",
+	"pf":                       "cctld",
+	"pfizer":                   "new_gtld",
+	"pg":                       "cctld",
+	"ph":                       "cctld",
+	"pharmacy":                 "new_gtld",
+	"phd":                      "new_gtld",
+	"philips":                  "new_gtld",
+	"phone":                    "new_gtld",
+	"photo":                    "new_gtld",
+	"photography":              "new_gtld",
+	"photos":                   "new_gtld",
+	"physio":                   "new_gtld",
+	"piaget":                   "new_gtld",
+	"pics":                     "new_gtld",
+	"pictet":                   "new_gtld",
+	"pictures":                 "new_gtld",
+	"pid":                      "new_gtld",
+	"pin":                      "new_gtld",
+	"ping":                     "new_gtld",
+	"pink":                     "new_gtld",
+	"pioneer":                  "new_gtld",
+	"pizza":                    "new_gtld",
+	"pk":                       "cctld",
+	"pl":                       "cctld",
+	"place":                    "new_gtld",
+	"play":                     "new_gtld",
+	"playstation":              "new_gtld",
+	"plumbing":                 "new_gtld",
+	"plus":                     "new_gtld",
+	"pm":                       "cctld",
+	"pn":                       "cctld",
+	"pnc":                      "new_gtld",
+	"pohl":                     "new_gtld",
+	"poker":                    "new_gtld",
+	"politie":                  "new_gtld",
+	"porn":                     "new_gtld",
+	"post":                     "gtld",
+	"pr":                       "cctld",
+	"pramerica":                "new_gtld",
+	"praxi":                    "new_gtld",
+	"press":                    "new_gtld",
+	"prime":                    "new_gtld",
+	"pro":                      "gtld",
+	"prod":                     "new_gtld",
+	"productions":              "new_gtld",
+	"prof":                     "new_gtld",
+	"progressive":              "new_gtld",
+	"promo":                    "new_gtld",
+	"properties":               "new_gtld",
+	"property":                 "new_gtld",
+	"protection":               "new_gtld",
+	"pru":                      "new_gtld",
+	"prudential":               "new_gtld",
+	"ps":                       "cctld",
+	"pt":                       "cctld",
+	"pub":                      "new_gtld",
+	"pw":                       "cctld",
+	"pwc":                      "new_gtld",
+	"py":                       "cctld",
+	"qa":                       "cctld",
+	"qpon":                     "new_gtld",
+	"quebec":                   "new_gtld",
+	"quest":                    "new_gtld",
+	"qvc":                      "new_gtld",
+	"racing":                   "new_gtld",
+	"radio":                    "new_gtld",
+	"raid":                     "new_gtld",
+	"re":                       "cctld",
+	"read":                     "new_gtld",
+	"realestate":               "new_gtld",
+	"realtor":                  "new_gtld",
+	"realty":                   "new_gtld",
+	"recipes":                  "new_gtld",
+	"red":                      "new_gtld",
+	"redstone":                 "new_gtld",
+	"redumbrella":              "new_gtld",
+	"rehab":                    "new_gtld",
+	"reise":                    "new_gtld",
+	"reisen":                   "new_gtld",
+	"reit":                     "new_gtld",
+	"reliance":                 "new_gtld",
+	"ren":                      "new_gtld",
+	"rent":                     "new_gtld",
+	"rentals":                  "new_gtld",
+	"repair":                   "new_gtld",
+	"report":                   "new_gtld",
+	"republican":               "new_gtld",
+	"rest":                     "new_gtld",
+	"restaurant":               "new_gtld",
+	"review":                   "new_gtld",
+	"reviews":                  "new_gtld",
+	"rexroth":                  "new_gtld",
+	"rich":                     "new_gtld",
+	"richardli":                "new_gtld",
+	"ricoh":                    "new_gtld",
+	"rightathome":              "new_gtld",
+	"ril":                      "new_gtld",
+	"rio":                      "new_gtld",
+	"rip":                      "new_gtld",
+	"rmit":                     "new_gtld",
+	"ro":                       "cctld",
+	"rocher":                   "new_gtld",
+	"rocks":                    "new_gtld",
+	"rodeo":                    "new_gtld",
+	"rogers":                   "new_gtld",
+	"room":                     "new_gtld",
+	"rs":                       "cctld",
+	"rsvp":                     "new_gtld",
+	"ru":                       "cctld",
+	"rugby":                    "new_gtld",
+	"ruhr":                     "new_gtld",
+	"run":                      "new_gtld",
+	"rw":                       "cctld",
+	"rwe":                      "new_gtld",
+	"ryukyu":                   "new_gtld",
+	"sa":                       "cctld",
+	"saarland":                 "new_gtld",
+	"safe":                     "new_gtld",
+	"safety":                   "new_gtld",
+	"sakura":                   "new_gtld",
+	"sale":                     "new_gtld",
+	"salon":                    "new_gtld",
+	"samsclub":                 "new_gtld",
+	"samsung":                  "new_gtld",
+	"sandvik":                  "new_gtld",
+	"sandvikcoromant":          "new_gtld",
+	"sanofi":                   "new_gtld",
+	"sap":                      "new_gtld",
+	"sarl":                     "new_gtld",
+	"sas":                      "new_gtld",
+	"save":                     "new_gtld",
+	"saxo":                     "new_gtld",
+	"sb":                       "cctld",
+	"sbi":                      "new_gtld",
+	"sbs":                      "new_gtld",
+	"sc":                       "cctld",
+	"sca":                      "new_gtld",
+	"scb":                      "new_gtld",
+	"schaeffler":               "new_gtld",
+	"schmidt":                  "new_gtld",
+	"scholarships":             "new_gtld",
+	"school":                   "new_gtld",
+	"schule":                   "new_gtld",
+	"schwarz":                  "new_gtld",
+	"science":                  "new_gtld",
+	"scjohnson":                "new_gtld",
+	"scor":                     "new_gtld",
+	"scot":                     "new_gtld",
+	"sd":                       "cctld",
+	"se":                       "cctld",
+	"search":                   "new_gtld",
+	"seat":                     "new_gtld",
+	"secure":                   "new_gtld",
+	"security":                 "new_gtld",
+	"seek":                     "new_gtld",
+	"select":                   "new_gtld",
+	"sener":                    "new_gtld",
+	"services":                 "new_gtld",
+	"ses":                      "new_gtld",
+	"seven":                    "new_gtld",
+	"sew":                      "new_gtld",
+	"sex":                      "new_gtld",
+	"sexy":                     "new_gtld",
+	"sfr":                      "new_gtld",
+	"sg":                       "cctld",
+	"sh":                       "cctld",
+	"shangrila":                "new_gtld",
+	"sharp":                    "new_gtld",
+	"shaw":                     "new_gtld",
+	"shell":                    "new_gtld",
+	"shia":                     "new_gtld",
+	"shiksha":                  "new_gtld",
+	"shoes":                    "new_gtld",
+	"shop":                     "new_gtld",
+	"shopping":                 "new_gtld",
+	"shouji":                   "new_gtld",
+	"show":                     "new_gtld",
+	"showtime":                 "new_gtld",
+	"shriram":                  "new_gtld",
+	"si":                       "cctld",
+	"silk":                     "new_gtld",
+	"sina":                     "new_gtld",
+	"singles":                  "new_gtld",
+	"site":                     "new_gtld",
+	"sj":                       "cctld",
+	"sk":                       "cctld",
+	"ski":                      "new_gtld",
+	"skin":                     "new_gtld",
+	"sky":                      "new_gtld",
+	"skype":                    "new_gtld",
+	"sl":                       "cctld",
+	"sling":                    "new_gtld",
+	"sm":                       "cctld",
+	"smart":                    "new_gtld",
+	"smile":                    "new_gtld",
+	"sn":                       "cctld",
+	"sncf":                     "new_gtld",
+	"so":                       "cctld",
+	"soccer":                   "new_gtld",
+	"social":                   "new_gtld",
+	"softbank":                 "new_gtld",
+	"software":                 "new_gtld",
+	"sohu":                     "new_gtld",
+	"solar":                    "new_gtld",
+	"solutions":                "new_gtld",
+	"song":                     "new_gtld",
+	"sony":                     "new_gtld",
+	"soy":                      "new_gtld",
+	"space":                    "new_gtld",
+	"sport":                    "new_gtld",
+	"spot":                     "new_gtld",
+	"spreadbetting":            "new_gtld",
+	"sr":                       "cctld",
+	"srl":                      "new_gtld",
+	"srt":                      "new_gtld",
+	"st":                       "cctld",
+	"stada":                    "new_gtld",
+	"staples":                  "new_gtld",
+	"star":                     "new_gtld",
+	"starhub":                  "new_gtld",
+	"statebank":                "new_gtld",
+	"statefarm":                "new_gtld",
+	"stc":                      "new_gtld",
+	"stcgroup":                 "new_gtld",
+	"stockholm":                "new_gtld",
+	"storage":                  "new_gtld",
+	"store":                    "new_gtld",
+	"stream":                   "new_gtld",
+	"studio":                   "new_gtld",
+	"study":                    "new_gtld",
+	"style":                    "new_gtld",
+	"su":                       "cctld",
+	"sucks":                    "new_gtld",
+	"supplies":                 "new_gtld",
+	"supply":                   "new_gtld",
+	"support":                  "new_gtld",
+	"surf":                     "new_gtld",
+	"surgery":                  "new_gtld",
+	"suzuki":                   "new_gtld",
+	"sv":                       "cctld",
+	"swatch":                   "new_gtld",
+	"swiftcover":               "new_gtld",
+	"swiss":                    "new_gtld",
+	"sx":                       "cctld",
+	"sy":                       "cctld",
+	"sydney":                   "new_gtld",
+	"symantec":                 "new_gtld",
+	"systems":                  "new_gtld",
+	"sz":                       "cctld",
+	"tab":                      "new_gtld",
+	"taipei":                   "new_gtld",
+	"talk":                     "new_gtld",
+	"taobao":                   "new_gtld",
+	"target":                   "new_gtld",
+	"tatamotors":               "new_gtld",
+	"tatar":                    "new_gtld",
+	"tattoo":                   "new_gtld",
+	"tax":                      "new_gtld",
+	"taxi":                     "new_gtld",
+	"tc":                       "cctld",
+	"tci":                      "new_gtld",
+	"td":                       "cctld",
+	"tdk":                      "new_gtld",
+	"team":                     "new_gtld",
+	"tech":                     "new_gtld",
+	"technology":               "new_gtld",
+	"tel":                      "gtld",
+	"telefonica":               "new_gtld",
+	"temasek":                  "new_gtld",
+	"tennis":                   "new_gtld",
+	"test":                     "special",
+	"teva":                     "new_gtld",
+	"tf":                       "cctld",
+	"tg":                       "cctld",
+	"th":                       "cctld",
+	"thd":                      "new_gtld",
+	"theater":                  "new_gtld",
+	"theatre":                  "new_gtld",
+	"tiaa":                     "new_gtld",
+	"tickets":                  "new_gtld",
+	"tienda":                   "new_gtld",
+	"tiffany":                  "new_gtld",
+	"tips":                     "new_gtld",
+	"tires":                    "new_gtld",
+	"tirol":                    "new_gtld",
+	"tj":                       "cctld",
+	"tjmaxx":                   "new_gtld",
+	"tjx":                      "new_gtld",
+	"tk":                       "cctld",
+	"tkmaxx":                   "new_gtld",
+	"tl":                       "cctld",
+	"tm":                       "cctld",
+	"tmall":                    "new_gtld",
+	"tn":                       "cctld",
+	"to":                       "cctld",
+	"today":                    "new_gtld",
+	"tokyo":                    "new_gtld",
+	"tools":                    "new_gtld",
+	"top":                      "new_gtld",
+	"toray":                    "new_gtld",
+	"toshiba":                  "new_gtld",
+	"total":                    "new_gtld",
+	"tours":                    "new_gtld",
+	"town":                     "new_gtld",
+	"toyota":                   "new_gtld",
+	"toys":                     "new_gtld",
+	"tr":                       "cctld",
+	"trade":                    "new_gtld",
+	"trading":                  "new_gtld",
+	"training":                 "new_gtld",
+	"travel":                   "gtld",
+	"travelchannel":            "new_gtld",
+	"travelers":                "new_gtld",
+	"travelersinsurance":       "new_gtld",
+	"trust":                    "new_gtld",
+	"trv":                      "new_gtld",
+	"tt":                       "cctld",
+	"tube":                     "new_gtld",
+	"tui":                      "new_gtld",
+	"tunes":                    "new_gtld",
+	"tushu":                    "new_gtld",
+	"tv":                       "cctld",
+	"tvs":                      "new_gtld",
+	"tw":                       "cctld",
+	"tz":                       "cctld",
+	"ua":                       "cctld",
+	"ubank":                    "new_gtld",
+	"ubs":                      "new_gtld",
+	"uconnect":                 "new_gtld",
+	"ug":                       "cctld",
+	"uk":                       "cctld",
+	"unicom":                   "new_gtld",
+	"university":               "new_gtld",
+	"uno":                      "new_gtld",
+	"uol":                      "new_gtld",
+	"ups":                      "new_gtld",
+	"us":                       "cctld",
+	"uy":                       "cctld",
+	"uz":                       "cctld",
+	"va":                       "cctld",
+	"vacations":                "new_gtld",
+	"vana":                     "new_gtld",
+	"vanguard":                 "new_gtld",
+	"vc":                       "cctld",
+	"ve":                       "cctld",
+	"vegas":                    "new_gtld",
+	"ventures":                 "new_gtld",
+	"verisign":                 "new_gtld",
+	"versicherung":             "new_gtld",
+	"vet":                      "new_gtld",
+	"vg":                       "cctld",
+	"vi":                       "cctld",
+	"viajes":                   "new_gtld",
+	"video":                    "new_gtld",
+	"vig":                      "new_gtld",
+	"viking":                   "new_gtld",
+	"villas":                   "new_gtld",
+	"vin":                      "new_gtld",
+	"vip":                      "new_gtld",
+	"virgin":                   "new_gtld",
+	"visa":                     "new_gtld",
+	"vision":                   "new_gtld",
+	"vistaprint":               "new_gtld",
+	"viva":                     "new_gtld",
+	"vivo":                     "new_gtld",
+	"vlaanderen":               "new_gtld",
+	"vn":                       "cctld",
+	"vodka":                    "new_gtld",
+	"volkswagen":               "new_gtld",
+	"volvo":                    "new_gtld",
+	"vote":                     "new_gtld",
+	"voting":                   "new_gtld",
+	"voto":                     "new_gtld",
+	"voyage":                   "new_gtld",
+	"vu":                       "cctld",
+	"vuelos":                   "new_gtld",
+	"wales":                    "new_gtld",
+	"walmart":                  "new_gtld",
+	"walter":                   "new_gtld",
+	"wang":                     "new_gtld",
+	"wanggou":                  "new_gtld",
+	"warman":                   "new_gtld",
+	"watch":                    "new_gtld",
+	"watches":                  "new_gtld",
+	"weather":                  "new_gtld",
+	"weatherchannel":           "new_gtld",
+	"webcam":                   "new_gtld",
+	"weber":                    "new_gtld",
+	"website":                  "new_gtld",
+	"wed":                      "new_gtld",
+	"wedding":                  "new_gtld",
+	"weibo":                    "new_gtld",
+	"weir":                     "new_gtld",
+	"wf":                       "cctld",
+	"whoswho":                  "new_gtld",
+	"wien":                     "new_gtld",
+	"wiki":                     "new_gtld",
+	"williamhill":              "new_gtld",
+	"win":                      "new_gtld",
+	"windows":                  "new_gtld",
+	"wine":                     "new_gtld",
+	"winners":                  "new_gtld",
+	"wme":                      "new_gtld",
+	"wolterskluwer":            "new_gtld",
+	"woodside":                 "new_gtld",
+	"work":                     "new_gtld",
+	"works":                    "new_gtld",
+	"world":                    "new_gtld",
+	"wow":                      "new_gtld",
+	"ws":                       "cctld",
+	"wtc":                      "new_gtld",
+	"wtf":                      "new_gtld",
+	"xbox":                     "new_gtld",
+	"xerox":                    "new_gtld",
+	"xfinity":                  "new_gtld",
+	"xihuan":                   "new_gtld",
+	"xin":                      "new_gtld",
+	"xn--11b4c3d":              "new_gtld",
+	"xn--1ck2e1b":              "new_gtld",
+	"xn--1qqw23a":              "new_gtld",
+	"xn--2scrj9c":              "cctld",
+	"xn--30rr7y":               "new_gtld",
+	"xn--3bst00m":              "new_gtld",
+	"xn--3ds443g":              "new_gtld",
+	"xn--3e0b707e":             "cctld",
+	"xn--3hcrj9c":              "cctld",
+	"xn--3oq18vl8pn36a":        "new_gtld",
+	"xn--3pxu8k":               "new_gtld",
+	"xn--42c2d9a":              "new_gtld",
+	"xn--45br5cyl":             "cctld",
+	"xn--45brj9c":              "cctld",
+	"xn--45q11c":               "new_gtld",
+	"xn--4gbrim":               "new_gtld",
+	"xn--54b7fta0cc":           "cctld",
+	"xn--55qw42g":              "new_gtld",
+	"xn--55qx5d":               "new_gtld",
+	"xn--5su34j936bgsg":        "new_gtld",
+	"xn--5tzm5g":               "new_gtld",
+	"xn--6frz82g":              "new_gtld",
+	"xn--6qq986b3xl":           "new_gtld",
+	"xn--80adxhks":             "new_gtld",
+	"xn--80ao21a":              "cctld",
+	"xn--80aqecdr1a":           "new_gtld",
+	"xn--80asehdb":             "new_gtld",
+	"xn--80aswg":               "new_gtld",
+	"xn--8y0a063a":             "new_gtld",
+	"xn--90a3ac":               "cctld",
+	"xn--90ae":                 "cctld",
+	"xn--90ais":                "cctld",
+	"xn--9dbq2a":               "new_gtld",
+	"xn--9et52u":               "new_gtld",
+	"xn--9krt00a":              "new_gtld",
+	"xn--b4w605ferd":           "new_gtld",
+	"xn--bck1b9a5dre4c":        "new_gtld",
+	"xn--c1avg":                "new_gtld",
+	"xn--c2br7g":               "new_gtld",
+	"xn--cck2b3b":              "new_gtld",
+	"xn--cg4bki":               "new_gtld",
+	"xn--clchc0ea0b2g2a9gcd":   "cctld",
+	"xn--czr694b":              "new_gtld",
+	"xn--czrs0t":               "new_gtld",
+	"xn--czru2d":               "new_gtld",
+	"xn--d1acj3b":              "new_gtld",
+	"xn--d1alf":                "cctld",
+	"xn--e1a4c":                "cctld",
+	"xn--eckvdtc9d":            "new_gtld",
+	"xn--efvy88h":              "new_gtld",
+	"xn--estv75g":              "new_gtld",
+	"xn--fct429k":              "new_gtld",
+	"xn--fhbei":                "new_gtld",
+	"xn--fiq228c5hs":           "new_gtld",
+	"xn--fiq64b":               "new_gtld",
+	"xn--fiqs8s":               "cctld",
+	"xn--fiqz9s":               "cctld",
+	"xn--fjq720a":              "new_gtld",
+	"xn--flw351e":              "new_gtld",
+	"xn--fpcrj9c3d":            "cctld",
+	"xn--fzc2c9e2c":            "cctld",
+	"xn--fzys8d69uvgm":         "new_gtld",
+	"xn--g2xx48c":              "new_gtld",
+	"xn--gckr3f0f":             "new_gtld",
+	"xn--gecrj9c":              "cctld",
+	"xn--gk3at1e":              "new_gtld",
+	"xn--h2breg3eve":           "cctld",
+	"xn--h2brj9c":              "cctld",
+	"xn--h2brj9c8c":            "cctld",
+	"xn--hxt814e":              "new_gtld",
+	"xn--i1b6b1a6a2e":          "new_gtld",
+	"xn--imr513n":              "new_gtld",
+	"xn--io0a7i":               "new_gtld",
+	"xn--j1aef":                "new_gtld",
+	"xn--j1amh":                "cctld",
+	"xn--j6w193g":              "cctld",
+	"xn--jlq61u9w7b":           "new_gtld",
+	"xn--jvr189m":              "new_gtld",
+	"xn--kcrx77d1x4a":          "new_gtld",
+	"xn--kprw13d":              "cctld",
+	"xn--kpry57d":              "cctld",
+	"xn--kpu716f":              "new_gtld",
+	"xn--kput3i":               "new_gtld",
+	"xn--l1acc":                "cctld",
+	"xn--lgbbat1ad8j":          "cctld",
+	"xn--mgb2ddes":             "cctld",
+	"xn--mgb9awbf":             "cctld",
+	"xn--mgba3a3ejt":           "new_gtld",
+	"xn--mgba3a4f16a":          "cctld",
+	"xn--mgba3a4fra":           "cctld",
+	"xn--mgba7c0bbn0a":         "new_gtld",
+	"xn--mgbaakc7dvf":          "new_gtld",
+	"xn--mgbaam7a8h":           "cctld",
+	"xn--mgbab2bd":             "new_gtld",
+	"xn--mgbai9a5eva00b":       "cctld",
+	"xn--mgbai9azgqp6j":        "cctld",
+	"xn--mgbayh7gpa":           "cctld",
+	"xn--mgbb9fbpob":           "new_gtld",
+	"xn--mgbbh1a":              "cctld",
+	"xn--mgbbh1a71e":           "cctld",
+	"xn--mgbc0a9azcg":          "cctld",
+	"xn--mgbca7dzdo":           "new_gtld",
+	"xn--mgberp4a5d4a87g":      "cctld",
+	"xn--mgberp4a5d4ar":        "cctld",
+	"xn--mgbgu82a":             "cctld",
+	"xn--mgbi4ecexp":           "new_gtld",
+	"xn--mgbpl2fh":             "cctld",
+	"xn--mgbqly7c0a67fbc":      "cctld",
+	"xn--mgbqly7cvafr":         "cctld",
+	"xn--mgbt3dhd":             "new_gtld",
+	"xn--mgbtf8fl":             "cctld",
+	"xn--mgbtx2b":              "cctld",
+	"xn--mgbx4cd0ab":           "cctld",
+	"xn--mix082f":              "cctld",
+	"xn--mix891f":              "cctld",
+	"xn--mk1bu44c":             "new_gtld",
+	"xn--mxtq1m":               "new_gtld",
+	"xn--ngbc5azd":             "new_gtld",
+	"xn--ngbe9e0a":             "new_gtld",
+	"xn--ngbrx":                "new_gtld",
+	"xn--nnx388a":              "cctld",
+	"xn--node":                 "cctld",
+	"xn--nqv7f":                "new_gtld",
+	"xn--nqv7fs00ema":          "new_gtld",
+	"xn--nyqy26a":              "new_gtld",
+	"xn--o3cw4h":               "cctld",
+	"xn--ogbpf8fl":             "cctld",
+	"xn--otu796d":              "new_gtld",
+	"xn--p1acf":                "new_gtld",
+	"xn--p1ai":                 "cctld",
+	"xn--pbt977c":              "new_gtld",
+	"xn--pgbs0dh":              "cctld",
+	"xn--pssy2u":               "new_gtld",
+	"xn--q9jyb4c":              "new_gtld",
+	"xn--qcka1pmc":             "new_gtld",
+	"xn--qxam":                 "cctld",
+	"xn--rhqv96g":              "new_gtld",
+	"xn--rovu88b":              "new_gtld",
+	"xn--rvc1e0am3e":           "cctld",
+	"xn--s9brj9c":              "cctld",
+	"xn--ses554g":              "new_gtld",
+	"xn--t60b56a":              "new_gtld",
+	"xn--tckwe":                "new_gtld",
+	"xn--tiq49xqyj":            "new_gtld",
+	"xn--unup4y":               "new_gtld",
+	"xn--vermgensberater-ctb":  "new_gtld",
+	"xn--vermgensberatung-pwb": "new_gtld",
+	"xn--vhquv":                "new_gtld",
+	"xn--vuq861b":              "new_gtld",
+	"xn--w4r85el8fhu5dnra":     "new_gtld",
+	"xn--w4rs40l":              "new_gtld",
+	"xn--wgbh1c":               "cctld",
+	"xn--wgbl6a":               "cctld",
+	"xn--xhq521b":              "new_gtld",
+	"xn--xkc2al3hye2a":         "cctld",
+	"xn--xkc2dl3a5ee0h":        "cctld",
+	"xn--y9a3aq":               "cctld",
+	"xn--yfro4i67o":            "cctld",
+	"xn--ygbi2ammx":            "cctld",
+	"xn--zfr164b":              "new_gtld",
+	"xxx":                      "gtld",
+	"xyz":                      "new_gtld",
+	"yachts":                   "new_gtld",
+	"yahoo":                    "new_gtld",
+	"yamaxun":                  "new_gtld",
+	"yandex":                   "new_gtld",
+	"ye":                       "cctld",
+	"yodobashi":                "new_gtld",
+	"yoga":                     "new_gtld",
+	"yokohama":                 "new_gtld",
+	"you":                      "new_gtld",
+	"youtube":                  "new_gtld",
+	"yt":                       "cctld",
+	"yun":                      "new_gtld",
+	"za":                       "cctld",
+	"zappos":                   "new_gtld",
+	"zara":                     "new_gtld",
+	"zero":                     "new_gtld",
+	"zip":                      "new_gtld",
+	"zm":                       "cctld",
+	"zone":                     "new_gtld",
+	"zuerich":                  "new_gtld",
+	"zw":                       "cctld",
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"testing"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+func TestTLDClass(t *testing.T) {
+	for tld, class := range map[string]string{
+		"com":       "gtld",
+		"ORG.":      "gtld",
+		"jp":        "cctld",
+		"xn--p1ai":  "cctld",
+		"xyz":       "new_gtld",
+		"xn--p1acf": "new_gtld",
+		"arpa":      "special",
+		"onion":     "special",
+		"corp":      "unknown",
+	} {
+		assert.Equal(t, class, dtap.TLDClass(tld), tld)
+	}
+
+	q := newTestQuery("www.example.shop.", dns.TypeA)
+	data, err := dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_CLIENT_QUERY, q), &dtap.FlatConfig{})
+	assert.NoError(t, err)
+	assert.Equal(t, "", data.TLDClass)
+	data, err = dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_CLIENT_QUERY, q), &dtap.FlatConfig{ClassifyTLD: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "new_gtld", data.ToMapString()["tld_class"])
+
+	// the class is of the TLD of the public suffix.
+	for qname, class := range map[string]string{
+		"www.example.co.uk.":    "cctld",
+		"foo.blogspot.com.":     "gtld",
+		"WWW.EXAMPLE.JP.":       "cctld",
+		"host.corp.":            "unknown",
+		"1.0.192.in-addr.arpa.": "special",
+	} {
+		q := newTestQuery(qname, dns.TypeA)
+		data, err := dtap.FlatDnstap(newTestDnstap(t, dnstap.Message_CLIENT_QUERY, q), &dtap.FlatConfig{ClassifyTLD: true})
+		assert.NoError(t, err)
+		assert.Equal(t, class, data.TLDClass, qname)
+	}
+}
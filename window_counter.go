@@ -0,0 +1,125 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// windowCounter counts values by key over sliding window made of fixed buckets.
+// Each bucket tracks at most maxKeys keys, new keys over the limit are counted as other.
+type windowCounter[T any] struct {
+	mux      sync.Mutex
+	buckets  []map[string]*T
+	current  int
+	maxKeys  int
+	other    string
+	newValue func() *T
+	merge    func(dst, src *T)
+}
+
+func newWindowCounter[T any](buckets int, maxKeys int, other string, newValue func() *T, merge func(dst, src *T)) *windowCounter[T] {
+	if buckets < 1 {
+		buckets = 1
+	}
+	c := &windowCounter[T]{
+		buckets:  make([]map[string]*T, buckets),
+		maxKeys:  maxKeys,
+		other:    other,
+		newValue: newValue,
+		merge:    merge,
+	}
+	for i := range c.buckets {
+		c.buckets[i] = map[string]*T{}
+	}
+	return c
+}
+
+// update calls f with the value of key in the current bucket.
+func (c *windowCounter[T]) update(key string, f func(*T)) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	b := c.buckets[c.current]
+	v, ok := b[key]
+	if !ok {
+		if c.maxKeys > 0 && len(b) >= c.maxKeys {
+			key = c.other
+		}
+		if v, ok = b[key]; !ok {
+			v = c.newValue()
+			b[key] = v
+		}
+	}
+	f(v)
+}
+
+// Rotate moves to the next bucket, dropping the oldest counts.
+func (c *windowCounter[T]) Rotate() {
+	c.mux.Lock()
+	c.current = (c.current + 1) % len(c.buckets)
+	c.buckets[c.current] = map[string]*T{}
+	c.mux.Unlock()
+}
+
+// total returns values of keys merged over the whole window.
+func (c *windowCounter[T]) total() map[string]*T {
+	res := map[string]*T{}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	for _, b := range c.buckets {
+		for k, v := range b {
+			if _, ok := res[k]; !ok {
+				res[k] = c.newValue()
+			}
+			c.merge(res[k], v)
+		}
+	}
+	return res
+}
+
+// windowTicker emits and rotates a windowCounter every interval, until stop.
+type windowTicker struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (t *windowTicker) start(interval time.Duration, emit func(), rotate func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.cancel = cancel
+	t.done = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer close(t.done)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				emit()
+				rotate()
+			}
+		}
+	}()
+}
+
+func (t *windowTicker) stop() {
+	t.cancel()
+	<-t.done
+}
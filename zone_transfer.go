@@ -0,0 +1,208 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+)
+
+var (
+	// DefaultZoneTransferTimeout is the default time to wait for the end of a zone transfer.
+	DefaultZoneTransferTimeout = 30 * time.Second
+	// DefaultZoneTransferSize is the default max number of zone transfers assembled at once.
+	DefaultZoneTransferSize = 1000
+)
+
+type transferState struct {
+	key     string
+	last    time.Time
+	summary *DnstapFlatT
+	ixfr    bool
+	rrs     int
+	soa     *dns.SOA
+	// incremental is set when the second record of an IXFR is a SOA, the deltas follow it.
+	incremental bool
+	// soas is the number of SOA records after the first, across messages.
+	soas int
+}
+
+// TransferAssembler reassembles AXFR/IXFR responses spanning many messages
+// by identity, connection and id, and emits a summary record per transfer
+// instead of the records of each message. A transfer ends with the final SOA record,
+// and is emitted as incomplete when no message arrives in timeout, when it is evicted
+// by size, or by Flush on shutdown.
+type TransferAssembler struct {
+	timeout time.Duration
+	size    int
+	now     func() time.Time
+	mux     sync.Mutex
+	states  map[string]*transferState
+	// queue is states in order of the last message.
+	queue []*transferState
+}
+
+func NewTransferAssembler(timeout time.Duration, size int, now func() time.Time) *TransferAssembler {
+	if timeout <= 0 {
+		timeout = DefaultZoneTransferTimeout
+	}
+	if size <= 0 {
+		size = DefaultZoneTransferSize
+	}
+	return &TransferAssembler{
+		timeout: timeout,
+		size:    size,
+		now:     now,
+		states:  map[string]*transferState{},
+	}
+}
+
+// Assemble returns summaries of ended transfers and records to emit.
+func (a *TransferAssembler) Assemble(dt *dnstap.Dnstap, records []*DnstapFlatT) []*DnstapFlatT {
+	msg := dt.GetMessage()
+	if len(records) == 0 || !isResponse(msg.GetType()) ||
+		records[0].Qtype != "AXFR" && records[0].Qtype != "IXFR" {
+		return append(a.Expire(), records...)
+	}
+	key := fmt.Sprintf("%s\x00%x\x00%d\x00%x\x00%d", dt.GetIdentity(), msg.GetQueryAddress(), msg.GetQueryPort(), msg.GetResponseAddress(), records[0].Txid)
+
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	now := a.now()
+	res := a.expire(now)
+	s, ok := a.states[key]
+	if !ok {
+		if len(a.states) >= a.size {
+			res = append(res, a.remove(a.queue[0], false))
+		}
+		summary := *records[0]
+		summary.dnsMsg = nil
+		s = &transferState{key: key, summary: &summary, ixfr: summary.Qtype == "IXFR"}
+		s.summary.Ancount = 0
+		s.summary.TransferRecords = map[string]interface{}{}
+		a.states[key] = s
+	} else {
+		a.unqueue(s)
+	}
+	a.queue = append(a.queue, s)
+	s.last = now
+	s.summary.TransferMessages++
+	s.summary.TransferBytes += len(msg.GetResponseMessage())
+	if records[0].Rcode != "NOERROR" {
+		s.summary.Rcode = records[0].Rcode
+		return append(res, a.remove(s, true))
+	}
+	dnsMsg := records[0].dnsMsg
+	if dnsMsg == nil {
+		dnsMsg = new(dns.Msg)
+		if err := dnsMsg.Unpack(msg.GetResponseMessage()); err != nil {
+			s.summary.addEnrichmentError("transfer", err)
+			return res
+		}
+	}
+	if s.add(dnsMsg.Answer) {
+		res = append(res, a.remove(s, true))
+	}
+	return res
+}
+
+// add counts answers of a message, and reports whether the transfer ended.
+// An AXFR, or an IXFR falling back to it, ends with the SOA of the first one.
+// An incremental IXFR has deltas of the old SOA, deleted records, the new SOA and added records,
+// so only a SOA of the first serial which doesn't start added records ends it.
+func (s *transferState) add(answers []dns.RR) bool {
+	for _, rr := range answers {
+		s.rrs++
+		s.summary.Ancount++
+		rrtype := dns.TypeToString[rr.Header().Rrtype]
+		count, _ := s.summary.TransferRecords[rrtype].(int)
+		s.summary.TransferRecords[rrtype] = count + 1
+		soa, ok := rr.(*dns.SOA)
+		if !ok {
+			continue
+		}
+		if s.soa == nil {
+			s.soa = soa
+			serial := soa.Serial
+			s.summary.TransferSerial = &serial
+			continue
+		}
+		s.soas++
+		if s.ixfr && s.rrs == 2 {
+			s.incremental = true
+			serial := soa.Serial
+			s.summary.TransferFromSerial = &serial
+		}
+		if s.incremental && s.soas%2 == 0 {
+			continue
+		}
+		if soa.Serial == s.soa.Serial {
+			return true
+		}
+	}
+	// a single SOA is an up to date IXFR response.
+	return s.ixfr && s.rrs == 1
+}
+
+func (a *TransferAssembler) unqueue(s *transferState) {
+	for i, q := range a.queue {
+		if q == s {
+			a.queue = append(a.queue[:i], a.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+func (a *TransferAssembler) remove(s *transferState, complete bool) *DnstapFlatT {
+	delete(a.states, s.key)
+	a.unqueue(s)
+	s.summary.TransferIncomplete = !complete
+	return s.summary
+}
+
+// Expire returns summaries of transfers timed out.
+func (a *TransferAssembler) Expire() []*DnstapFlatT {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	return a.expire(a.now())
+}
+
+func (a *TransferAssembler) expire(now time.Time) []*DnstapFlatT {
+	var res []*DnstapFlatT
+	for len(a.queue) > 0 && now.Sub(a.queue[0].last) >= a.timeout {
+		res = append(res, a.remove(a.queue[0], false))
+	}
+	return res
+}
+
+// Flush returns summaries of all transfers as incomplete.
+func (a *TransferAssembler) Flush() []*DnstapFlatT {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	var res []*DnstapFlatT
+	for _, s := range a.queue {
+		s.summary.TransferIncomplete = true
+		res = append(res, s.summary)
+	}
+	a.states = map[string]*transferState{}
+	a.queue = nil
+	return res
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2018 Manabu Sonoda
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dtap_test
+
+import (
+	"testing"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mimuret/dtap"
+)
+
+func assembleTransfer(t *testing.T, a *dtap.TransferAssembler, qtype uint16, rrs ...string) []*dtap.DnstapFlatT {
+	dt := newTestDnstap(t, dnstap.Message_AUTH_RESPONSE, newTestResponse(newTestQuery("example.com.", qtype), rrs...))
+	records, err := dtap.FlatDnstapRecords(dt, &dtap.FlatConfig{})
+	assert.NoError(t, err)
+	return a.Assemble(dt, records)
+}
+
+func TestTransferAssemblerAXFR(t *testing.T) {
+	now := time.Unix(1546300800, 0)
+	a := dtap.NewTransferAssembler(time.Minute, 10, func() time.Time { return now })
+	soa := "example.com. 3600 IN SOA ns.example.com. root.example.com. 2019010101 3600 900 604800 300"
+
+	assert.Empty(t, assembleTransfer(t, a, dns.TypeAXFR, soa, "example.com. 3600 IN NS ns.example.com."))
+	assert.Empty(t, assembleTransfer(t, a, dns.TypeAXFR, "www.example.com. 300 IN A 192.0.2.1", "www.example.com. 300 IN A 192.0.2.2"))
+	res := assembleTransfer(t, a, dns.TypeAXFR, "www.example.com. 300 IN AAAA 2001:db8::1", soa)
+	if assert.Len(t, res, 1) {
+		s := res[0]
+		assert.Equal(t, "AXFR", s.Qtype)
+		assert.Equal(t, 3, s.TransferMessages)
+		assert.Equal(t, map[string]interface{}{"SOA": 2, "NS": 1, "A": 2, "AAAA": 1}, s.TransferRecords)
+		assert.Equal(t, 6, s.Ancount)
+		assert.Equal(t, uint32(2019010101), *s.TransferSerial)
+		assert.Nil(t, s.TransferFromSerial)
+		assert.True(t, s.TransferBytes > 0)
+		assert.False(t, s.TransferIncomplete)
+		assert.Equal(t, false, s.ToMapString()["transfer_incomplete"])
+	}
+
+	// queries and other responses pass through.
+	dt := newTestDnstap(t, dnstap.Message_CLIENT_QUERY, newTestQuery("www.example.com.", dns.TypeA))
+	records, err := dtap.FlatDnstapRecords(dt, &dtap.FlatConfig{})
+	assert.NoError(t, err)
+	assert.Len(t, a.Assemble(dt, records), 1)
+}
+
+func TestTransferAssemblerIXFR(t *testing.T) {
+	now := time.Unix(1546300800, 0)
+	a := dtap.NewTransferAssembler(time.Minute, 10, func() time.Time { return now })
+	soa := func(serial string) string {
+		return "example.com. 3600 IN SOA ns.example.com. root.example.com. " + serial + " 3600 900 604800 300"
+	}
+	res := assembleTransfer(t, a, dns.TypeIXFR, soa("3"), soa("1"), "old.example.com. 300 IN A 192.0.2.1", soa("3"), "new.example.com. 300 IN A 192.0.2.2", soa("3"))
+	if assert.Len(t, res, 1) {
+		assert.Equal(t, uint32(3), *res[0].TransferSerial)
+		assert.Equal(t, uint32(1), *res[0].TransferFromSerial)
+		assert.Equal(t, 1, res[0].TransferMessages)
+	}
+
+	// the SOA starting added records at the end of a message doesn't end the transfer.
+	assert.Empty(t, assembleTransfer(t, a, dns.TypeIXFR, soa("3"), soa("1"), "old.example.com. 300 IN A 192.0.2.1", soa("2")))
+	assert.Empty(t, assembleTransfer(t, a, dns.TypeIXFR, "new.example.com. 300 IN A 192.0.2.2", soa("2"), soa("3")))
+	res = assembleTransfer(t, a, dns.TypeIXFR, "newer.example.com. 300 IN A 192.0.2.3", soa("3"))
+	if assert.Len(t, res, 1) {
+		assert.Equal(t, uint32(3), *res[0].TransferSerial)
+		assert.Equal(t, uint32(1), *res[0].TransferFromSerial)
+		assert.Equal(t, 3, res[0].TransferMessages)
+		assert.Equal(t, map[string]interface{}{"SOA": 6, "A": 3}, res[0].TransferRecords)
+		assert.False(t, res[0].TransferIncomplete)
+	}
+
+	// up to date response has only the SOA.
+	res = assembleTransfer(t, a, dns.TypeIXFR, soa("3"))
+	if assert.Len(t, res, 1) {
+		assert.False(t, res[0].TransferIncomplete)
+	}
+}
+
+func TestTransferAssemblerIncomplete(t *testing.T) {
+	now := time.Unix(1546300800, 0)
+	a := dtap.NewTransferAssembler(time.Minute, 10, func() time.Time { return now })
+	soa := "example.com. 3600 IN SOA ns.example.com. root.example.com. 2019010101 3600 900 604800 300"
+	assert.Empty(t, assembleTransfer(t, a, dns.TypeAXFR, soa, "www.example.com. 300 IN A 192.0.2.1"))
+
+	now = now.Add(time.Minute)
+	res := a.Expire()
+	if assert.Len(t, res, 1) {
+		assert.True(t, res[0].TransferIncomplete)
+		assert.Equal(t, 1, res[0].TransferMessages)
+	}
+
+	assert.Empty(t, assembleTransfer(t, a, dns.TypeAXFR, soa))
+	res = a.Flush()
+	if assert.Len(t, res, 1) {
+		assert.True(t, res[0].TransferIncomplete)
+	}
+	assert.Empty(t, a.Flush())
+}